@@ -3,7 +3,9 @@ package cmd
 import (
 	"ai-svc/internal/config"
 	"ai-svc/internal/model"
+	"ai-svc/internal/repository"
 	"ai-svc/internal/routes"
+	"ai-svc/internal/service"
 	"ai-svc/pkg/database"
 	"ai-svc/pkg/logger"
 	"context"
@@ -39,6 +41,7 @@ var serverCmd = &cobra.Command{
 • 短信验证码发送
 • 设备管理与安全控制
 • 智能限流保护
+• AI 对话服务（多提供商）
 • 健康检查接口
 
 示例用法：
@@ -110,19 +113,55 @@ func runServer() error {
 		return fmt.Errorf("数据库连接失败: %w", err)
 	}
 
-	// 第五步：设置 Gin 框架模式
+	// 第五步：初始化 AI 提供商
+	aiRegistry, err := initializeAIProviders()
+	if err != nil {
+		return fmt.Errorf("AI提供商初始化失败: %w", err)
+	}
+	defer aiRegistry.Close()
+	go watchAIProviderReload(aiRegistry)
+
+	// 初始化内容过滤，敏感词文件修改后自动重新加载
+	contentFilterConfig := config.AppConfig.AI.Features.ContentFilter
+	contentFilter, err := service.NewContentFilter(contentFilterConfig)
+	if err != nil {
+		return fmt.Errorf("内容过滤初始化失败: %w", err)
+	}
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go service.WatchContentFilter(watchCtx, contentFilter, contentFilterConfig)
+
+	// 初始化回复缓存
+	responseCache, err := service.NewResponseCacheStore(config.AppConfig.AI.Features.Cache, config.AppConfig.Redis)
+	if err != nil {
+		return fmt.Errorf("回复缓存初始化失败: %w", err)
+	}
+	if responseCache != nil {
+		defer responseCache.Close()
+	}
+
+	// 初始化每日使用统计，服务关闭时写入内存中剩余的统计
+	usageTrackingConfig := config.AppConfig.AI.Features.UsageTracking
+	usageAggregator := service.NewUsageAggregator(repository.NewAIRepository(), usageTrackingConfig)
+	if usageAggregator != nil {
+		defer usageAggregator.Close()
+	}
+
+	// 第六步：设置 Gin 框架模式
 	setupGinMode()
 
-	// 第六步：初始化路由和中间件
-	router := routes.SetupRoutes()
+	// 第七步：初始化路由和中间件
+	router, aiService := routes.SetupRoutes(aiRegistry, contentFilter, responseCache, usageAggregator)
+	// 在写入剩余的使用统计之前等待后台的标题和摘要生成结束
+	defer aiService.Close()
 
-	// 第六步：配置 HTTP 服务器
+	// 第八步：配置 HTTP 服务器
 	server := configureHTTPServer(router)
 
-	// 第七步：启动服务器（异步）
+	// 第九步：启动服务器（异步）
 	startServer(server)
 
-	// 第八步：等待关闭信号并优雅关闭
+	// 第十步：等待关闭信号并优雅关闭
 	return gracefulShutdown(server)
 }
 
@@ -273,6 +312,11 @@ func connectDatabase() error {
 		&model.User{},
 		&model.MessageDefinition{},
 		&model.UserMessage{},
+		&model.AIConversation{},
+		&model.AIMessage{},
+		&model.AIAttachment{},
+		&model.AIUsageStats{},
+		&model.APIKey{},
 	); err != nil {
 		return fmt.Errorf("数据库迁移失败: %w", err)
 	}
@@ -281,6 +325,45 @@ func connectDatabase() error {
 	return nil
 }
 
+// initializeAIProviders 根据配置创建 AI 提供商注册表，没有可用提供商时启动失败.
+func initializeAIProviders() (*service.ProviderRegistry, error) {
+	registry := service.NewProviderRegistry()
+	if err := registry.LoadFromConfig(&config.AppConfig.AI); err != nil {
+		registry.Close()
+		return nil, err
+	}
+
+	logger.Info("AI提供商初始化成功", map[string]any{
+		"providers":        registry.AvailableNames(),
+		"default_provider": config.AppConfig.AI.DefaultProvider,
+	})
+
+	return registry, nil
+}
+
+// watchAIProviderReload 收到 SIGHUP 信号时重新读取配置并同步 AI 提供商，无需重启服务
+// 只重新加载 ai.providers，ai.features 等其他配置仍需重启服务后生效.
+func watchAIProviderReload(registry *service.ProviderRegistry) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		aiConfig, err := config.ReloadAIConfig()
+		if err != nil {
+			logger.Error("重新读取AI配置失败", map[string]any{
+				"error": err.Error(),
+			})
+			continue
+		}
+
+		if err := registry.Reload(aiConfig); err != nil {
+			logger.Warn("部分AI提供商重新加载失败", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
 // 等待系统信号，然后优雅地关闭服务器，确保正在处理的请求能够完成.
 func gracefulShutdown(server *http.Server) error {
 	// 创建信号通道，监听系统中断信号
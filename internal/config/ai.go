@@ -12,9 +12,21 @@ type AIConfig struct {
 	// 请求超时时间
 	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
 
-	// 最大重试次数
+	// 最大重试次数（仅限流和网络错误时在同一提供商上重试）
 	MaxRetries int `mapstructure:"max_retries" yaml:"max_retries"`
 
+	// 重试初始退避时间，之后每次翻倍
+	RetryBackoff time.Duration `mapstructure:"retry_backoff" yaml:"retry_backoff"`
+
+	// 重试最大退避时间
+	RetryMaxBackoff time.Duration `mapstructure:"retry_max_backoff" yaml:"retry_max_backoff"`
+
+	// 故障转移列表，当前提供商失败后按顺序尝试
+	Fallbacks []FallbackConfig `mapstructure:"fallbacks" yaml:"fallbacks"`
+
+	// 熔断配置
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker" yaml:"circuit_breaker"`
+
 	// 提供商配置
 	Providers map[string]ProviderConfig `mapstructure:"providers" yaml:"providers"`
 
@@ -30,6 +42,9 @@ type ProviderConfig struct {
 	// 提供商名称
 	Name string `mapstructure:"name" yaml:"name"`
 
+	// 提供商类型（openai、claude、baidu、alibaba、tencent），为空时使用配置键名
+	Type string `mapstructure:"type" yaml:"type"`
+
 	// API 基础URL
 	BaseURL string `mapstructure:"base_url" yaml:"base_url"`
 
@@ -51,10 +66,40 @@ type ProviderConfig struct {
 	// 区域（腾讯专用）
 	Region string `mapstructure:"region" yaml:"region"`
 
+	// 接入模式（阿里专用）：native 原生接口，compatible OpenAI 兼容接口
+	Mode string `mapstructure:"mode" yaml:"mode"`
+
+	// 请求超时时间，为空时使用 ai.timeout
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+
 	// 支持的模型列表
 	Models []ModelConfig `mapstructure:"models" yaml:"models"`
 }
 
+// CircuitBreakerConfig 提供商熔断配置
+type CircuitBreakerConfig struct {
+	// 是否启用
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+
+	// 连续失败多少次后熔断
+	FailureThreshold int `mapstructure:"failure_threshold" yaml:"failure_threshold"`
+
+	// 熔断持续时间，到期后进入半开状态放行探测请求
+	OpenTimeout time.Duration `mapstructure:"open_timeout" yaml:"open_timeout"`
+
+	// 半开状态下连续成功多少次后恢复
+	HalfOpenSuccesses int `mapstructure:"half_open_successes" yaml:"half_open_successes"`
+}
+
+// FallbackConfig 故障转移目标
+type FallbackConfig struct {
+	// 提供商名称
+	Provider string `mapstructure:"provider" yaml:"provider"`
+
+	// 模型名称，为空时使用提供商的默认模型
+	Model string `mapstructure:"model" yaml:"model"`
+}
+
 // ModelConfig 模型配置
 type ModelConfig struct {
 	// 模型名称
@@ -66,6 +111,15 @@ type ModelConfig struct {
 	// 温度参数
 	Temperature float32 `mapstructure:"temperature" yaml:"temperature"`
 
+	// token 计数使用的编码（cl100k_base/o200k_base/approx/approx_cjk），为空时按模型名称推断
+	Tokenizer string `mapstructure:"tokenizer" yaml:"tokenizer"`
+
+	// 是否支持图片输入
+	Vision bool `mapstructure:"vision" yaml:"vision"`
+
+	// 是否原生支持 JSON Schema 结构化输出（response_format），不支持时通过提示词约束输出
+	StructuredOutput bool `mapstructure:"structured_output" yaml:"structured_output"`
+
 	// 定价信息
 	Pricing PricingConfig `mapstructure:"pricing" yaml:"pricing"`
 }
@@ -95,6 +149,24 @@ type FeatureConfig struct {
 
 	// 缓存配置
 	Cache CacheConfig `mapstructure:"cache" yaml:"cache"`
+
+	// 用量配额配置
+	Quota QuotaConfig `mapstructure:"quota" yaml:"quota"`
+
+	// 服务端工具调用配置
+	Tools ToolsConfig `mapstructure:"tools" yaml:"tools"`
+
+	// 图片输入配置
+	Multimodal MultimodalConfig `mapstructure:"multimodal" yaml:"multimodal"`
+
+	// 流式回复断线重连配置
+	StreamResume StreamResumeConfig `mapstructure:"stream_resume" yaml:"stream_resume"`
+
+	// WebSocket 对话配置
+	WebSocket WebSocketConfig `mapstructure:"websocket" yaml:"websocket"`
+
+	// 对话标题和摘要生成配置
+	Summarizer SummarizerConfig `mapstructure:"summarizer" yaml:"summarizer"`
 }
 
 // HistoryConfig 对话历史配置
@@ -107,6 +179,9 @@ type HistoryConfig struct {
 
 	// 最大token数
 	MaxTokens int `mapstructure:"max_tokens" yaml:"max_tokens"`
+
+	// 是否将超出窗口的早期对话压缩为摘要
+	Summarize bool `mapstructure:"summarize" yaml:"summarize"`
 }
 
 // ContentFilterConfig 内容过滤配置
@@ -116,6 +191,18 @@ type ContentFilterConfig struct {
 
 	// 敏感词列表
 	Keywords []string `mapstructure:"keywords" yaml:"keywords"`
+
+	// 正则表达式规则
+	Patterns []string `mapstructure:"patterns" yaml:"patterns"`
+
+	// 命中后的动作：block 拦截、mask 打码、flag 仅标记
+	Action string `mapstructure:"action" yaml:"action"`
+
+	// 敏感词文件，每行一条规则，re: 开头的行为正则表达式；文件修改后自动重新加载
+	KeywordsFile string `mapstructure:"keywords_file" yaml:"keywords_file"`
+
+	// 敏感词文件的检查间隔
+	ReloadInterval time.Duration `mapstructure:"reload_interval" yaml:"reload_interval"`
 }
 
 // UsageTrackingConfig 使用统计配置
@@ -125,6 +212,12 @@ type UsageTrackingConfig struct {
 
 	// 是否保存对话记录
 	SaveConversations bool `mapstructure:"save_conversations" yaml:"save_conversations"`
+
+	// 每日统计的写入间隔，统计先在内存中汇总再批量写入数据库
+	FlushInterval time.Duration `mapstructure:"flush_interval" yaml:"flush_interval"`
+
+	// 待写入的统计条数达到该值时立即写入
+	BatchSize int `mapstructure:"batch_size" yaml:"batch_size"`
 }
 
 // CacheConfig 缓存配置
@@ -134,6 +227,139 @@ type CacheConfig struct {
 
 	// 缓存时间（秒）
 	TTL int `mapstructure:"ttl" yaml:"ttl"`
+
+	// 存储类型：memory 进程内 LRU，redis 使用 Redis 兼容的服务（连接参数见 redis 配置）
+	Store string `mapstructure:"store" yaml:"store"`
+
+	// 进程内缓存的最大条目数
+	MaxEntries int `mapstructure:"max_entries" yaml:"max_entries"`
+
+	// Redis 键前缀
+	KeyPrefix string `mapstructure:"key_prefix" yaml:"key_prefix"`
+}
+
+// QuotaConfig 用量配额配置
+type QuotaConfig struct {
+	// 是否启用
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+
+	// 各 VIP 等级的配额，用户使用不高于其等级的最高一档；没有匹配的档位时不限制
+	Levels []QuotaLevelConfig `mapstructure:"levels" yaml:"levels"`
+}
+
+// QuotaLevelConfig 单个 VIP 等级的配额，0 表示不限制
+type QuotaLevelConfig struct {
+	// VIP 等级，0 为普通用户
+	Level int `mapstructure:"level" yaml:"level"`
+
+	// 每日 token 上限
+	DailyTokens int `mapstructure:"daily_tokens" yaml:"daily_tokens"`
+
+	// 每月 token 上限
+	MonthlyTokens int `mapstructure:"monthly_tokens" yaml:"monthly_tokens"`
+
+	// 每日费用上限
+	DailyCost float64 `mapstructure:"daily_cost" yaml:"daily_cost"`
+
+	// 每月费用上限
+	MonthlyCost float64 `mapstructure:"monthly_cost" yaml:"monthly_cost"`
+}
+
+// ToolsConfig 服务端工具调用配置
+type ToolsConfig struct {
+	// 是否启用，启用后对话接口会把内置工具提供给模型，并在服务端执行模型请求的工具调用
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+
+	// 一次对话最多执行几轮工具调用，达到上限后要求模型直接回答
+	MaxIterations int `mapstructure:"max_iterations" yaml:"max_iterations"`
+
+	// 单次工具执行的超时时间
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+// MultimodalConfig 图片输入配置
+type MultimodalConfig struct {
+	// 每条消息最多携带的图片数
+	MaxImages int `mapstructure:"max_images" yaml:"max_images"`
+
+	// 内嵌（base64）图片的最大字节数，远程图片由提供商下载时检查
+	MaxImageSize int `mapstructure:"max_image_size" yaml:"max_image_size"`
+
+	// 允许的图片类型
+	AllowedMimeTypes []string `mapstructure:"allowed_mime_types" yaml:"allowed_mime_types"`
+}
+
+// StreamResumeConfig 流式回复断线重连配置
+type StreamResumeConfig struct {
+	// 是否启用，启用后流式回复在服务端缓存，客户端断开后继续生成并保存，重连时从断点继续接收
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+
+	// 回复结束后缓存保留的时间，超过后无法再重连
+	Retention time.Duration `mapstructure:"retention" yaml:"retention"`
+
+	// 单次回复的最长生成时间，避免客户端断开后上游请求无限期占用
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+// WebSocketConfig WebSocket 对话配置
+type WebSocketConfig struct {
+	// 是否启用
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+
+	// 服务端发送 ping 的间隔
+	PingInterval time.Duration `mapstructure:"ping_interval" yaml:"ping_interval"`
+
+	// 超过该时间没有收到客户端的任何数据（包括 pong）时断开连接，应大于 ping_interval
+	PongTimeout time.Duration `mapstructure:"pong_timeout" yaml:"pong_timeout"`
+
+	// 单次写入的超时时间，客户端长时间不读取时断开连接
+	WriteTimeout time.Duration `mapstructure:"write_timeout" yaml:"write_timeout"`
+
+	// 每个连接待发送帧的队列长度，队列满时暂停转发回复，避免慢客户端占用内存
+	SendQueueSize int `mapstructure:"send_queue_size" yaml:"send_queue_size"`
+
+	// 客户端单条消息的最大字节数
+	MaxMessageSize int64 `mapstructure:"max_message_size" yaml:"max_message_size"`
+
+	// 每个连接同时进行的回复数
+	MaxConcurrentStreams int `mapstructure:"max_concurrent_streams" yaml:"max_concurrent_streams"`
+}
+
+// SummarizerConfig 对话标题和摘要生成配置
+type SummarizerConfig struct {
+	// 是否启用
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+
+	// 生成使用的提供商，为空时使用默认提供商
+	Provider string `mapstructure:"provider" yaml:"provider"`
+
+	// 生成使用的模型，为空时使用提供商的默认模型；建议使用价格较低的模型
+	Model string `mapstructure:"model" yaml:"model"`
+
+	// 是否在首轮对话后生成标题，创建对话时指定了标题的不会覆盖
+	Title bool `mapstructure:"title" yaml:"title"`
+
+	// 对话超出历史窗口后，每新增多少条消息更新一次摘要，<=0 时不生成摘要
+	Interval int `mapstructure:"interval" yaml:"interval"`
+
+	// 摘要的最大 token 数
+	MaxTokens int `mapstructure:"max_tokens" yaml:"max_tokens"`
+
+	// 单次生成的超时时间
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+// GetQuotaLevel 获取 VIP 等级适用的配额：不高于该等级的最高一档
+func (c *QuotaConfig) GetQuotaLevel(vipLevel int) (QuotaLevelConfig, bool) {
+	var matched QuotaLevelConfig
+	found := false
+	for _, level := range c.Levels {
+		if level.Level <= vipLevel && (!found || level.Level > matched.Level) {
+			matched = level
+			found = true
+		}
+	}
+	return matched, found
 }
 
 // GetProvider 获取指定提供商配置
@@ -165,17 +391,22 @@ func (p *ProviderConfig) GetDefaultModel() (ModelConfig, bool) {
 	return ModelConfig{}, false
 }
 
+// HasCredentials 检查是否配置了访问凭证（API密钥或腾讯云 SecretID）
+func (p *ProviderConfig) HasCredentials() bool {
+	return p.APIKey != "" || p.SecretID != ""
+}
+
 // IsValidProvider 检查提供商是否有效且启用
 func (c *AIConfig) IsValidProvider(name string) bool {
 	provider, exists := c.Providers[name]
-	return exists && provider.Enabled && provider.APIKey != ""
+	return exists && provider.Enabled && provider.HasCredentials()
 }
 
 // ListEnabledProviders 列出所有启用的提供商
 func (c *AIConfig) ListEnabledProviders() []string {
 	var providers []string
 	for name, config := range c.Providers {
-		if config.Enabled && config.APIKey != "" {
+		if config.Enabled && config.HasCredentials() {
 			providers = append(providers, name)
 		}
 	}
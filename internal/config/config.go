@@ -68,6 +68,7 @@ type GlobalRateLimitConfig struct {
 	SMS   RateLimitItemConfig `mapstructure:"sms"`
 	API   RateLimitItemConfig `mapstructure:"api"`
 	Login RateLimitItemConfig `mapstructure:"login"`
+	AI    RateLimitItemConfig `mapstructure:"ai"`
 }
 
 // RateLimitItemConfig 单个限流配置
@@ -147,6 +148,20 @@ func LoadConfig(configPath string) error {
 	return nil
 }
 
+// ReloadAIConfig 重新读取配置文件中的 AI 配置
+// 只返回新配置，不修改 AppConfig，由调用方决定如何生效.
+func ReloadAIConfig() (*AIConfig, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	aiConfig := &AIConfig{}
+	if err := viper.UnmarshalKey("ai", aiConfig); err != nil {
+		return nil, err
+	}
+	return aiConfig, nil
+}
+
 // setDefaults 设置默认配置值
 func setDefaults() {
 	// 服务器默认配置
@@ -192,6 +207,9 @@ func setDefaults() {
 	viper.SetDefault("rate_limit.login.capacity", 5)
 	viper.SetDefault("rate_limit.login.refill_rate", 1)
 	viper.SetDefault("rate_limit.login.refill_interval", "300s")
+	viper.SetDefault("rate_limit.ai.capacity", 30)
+	viper.SetDefault("rate_limit.ai.refill_rate", 10)
+	viper.SetDefault("rate_limit.ai.refill_interval", "60s")
 
 	// 日志默认配置
 	viper.SetDefault("logger.level", "info")
@@ -222,14 +240,51 @@ func setDefaults() {
 	viper.SetDefault("ai.default_provider", "openai")
 	viper.SetDefault("ai.timeout", "30s")
 	viper.SetDefault("ai.max_retries", 3)
+	viper.SetDefault("ai.retry_backoff", "500ms")
+	viper.SetDefault("ai.retry_max_backoff", "8s")
+	viper.SetDefault("ai.circuit_breaker.enabled", true)
+	viper.SetDefault("ai.circuit_breaker.failure_threshold", 5)
+	viper.SetDefault("ai.circuit_breaker.open_timeout", "30s")
+	viper.SetDefault("ai.circuit_breaker.half_open_successes", 2)
 	viper.SetDefault("ai.features.streaming", true)
 	viper.SetDefault("ai.features.history.enabled", true)
 	viper.SetDefault("ai.features.history.max_messages", 20)
 	viper.SetDefault("ai.features.history.max_tokens", 8000)
+	viper.SetDefault("ai.features.history.summarize", true)
 	viper.SetDefault("ai.features.content_filter.enabled", true)
+	viper.SetDefault("ai.features.content_filter.action", "block")
+	viper.SetDefault("ai.features.content_filter.reload_interval", "30s")
 	viper.SetDefault("ai.features.usage_tracking.enabled", true)
+	viper.SetDefault("ai.features.usage_tracking.flush_interval", "5s")
+	viper.SetDefault("ai.features.usage_tracking.batch_size", 100)
 	viper.SetDefault("ai.features.cache.enabled", true)
 	viper.SetDefault("ai.features.cache.ttl", 3600)
+	viper.SetDefault("ai.features.cache.store", "memory")
+	viper.SetDefault("ai.features.cache.max_entries", 1000)
+	viper.SetDefault("ai.features.cache.key_prefix", "ai:cache:")
+	viper.SetDefault("ai.features.quota.enabled", false)
+	viper.SetDefault("ai.features.tools.enabled", false)
+	viper.SetDefault("ai.features.tools.max_iterations", 5)
+	viper.SetDefault("ai.features.tools.timeout", "10s")
+	viper.SetDefault("ai.features.stream_resume.enabled", true)
+	viper.SetDefault("ai.features.stream_resume.retention", "5m")
+	viper.SetDefault("ai.features.stream_resume.timeout", "10m")
+	viper.SetDefault("ai.features.websocket.enabled", true)
+	viper.SetDefault("ai.features.websocket.ping_interval", "30s")
+	viper.SetDefault("ai.features.websocket.pong_timeout", "75s")
+	viper.SetDefault("ai.features.websocket.write_timeout", "10s")
+	viper.SetDefault("ai.features.websocket.send_queue_size", 64)
+	viper.SetDefault("ai.features.websocket.max_message_size", 8*1024*1024)
+	viper.SetDefault("ai.features.websocket.max_concurrent_streams", 3)
+	viper.SetDefault("ai.features.summarizer.enabled", false)
+	viper.SetDefault("ai.features.summarizer.title", true)
+	viper.SetDefault("ai.features.summarizer.interval", 10)
+	viper.SetDefault("ai.features.summarizer.max_tokens", 500)
+	viper.SetDefault("ai.features.summarizer.timeout", "30s")
+	viper.SetDefault("ai.features.multimodal.max_images", 4)
+	viper.SetDefault("ai.features.multimodal.max_image_size", 5*1024*1024)
+	viper.SetDefault("ai.features.multimodal.allowed_mime_types",
+		[]string{"image/png", "image/jpeg", "image/webp", "image/gif"})
 }
 
 // GetDSN 获取数据库连接字符串
@@ -2,44 +2,71 @@ package controller
 
 import (
 	"ai-svc/internal/config"
+	"ai-svc/internal/middleware"
 	"ai-svc/internal/service"
 	"ai-svc/pkg/response"
+	"context"
+	"errors"
 	"strconv"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 )
 
 // AIController AI 控制器
 type AIController struct {
-	aiService service.AIService
-	config    *config.AIConfig
+	aiService   service.AIService
+	config      *config.AIConfig
+	rateLimiter *middleware.RateLimiter // WebSocket 消息按用户限流，为 nil 时不限制
 }
 
 // NewAIController 创建 AI 控制器
-func NewAIController(aiService service.AIService, config *config.AIConfig) *AIController {
+func NewAIController(
+	aiService service.AIService,
+	config *config.AIConfig,
+	rateLimiter *middleware.RateLimiter,
+) *AIController {
 	return &AIController{
-		aiService: aiService,
-		config:    config,
+		aiService:   aiService,
+		config:      config,
+		rateLimiter: rateLimiter,
 	}
 }
 
 // ChatRequest 聊天请求
 type ChatRequest struct {
-	Message   string                 `json:"message"              binding:"required"`
-	SessionID string                 `json:"session_id,omitempty"`
-	Provider  string                 `json:"provider,omitempty"`
-	Model     string                 `json:"model,omitempty"`
-	Stream    bool                   `json:"stream,omitempty"`
-	Options   map[string]interface{} `json:"options,omitempty"`
+	Message        string                  `json:"message"               binding:"required"`
+	SessionID      string                  `json:"session_id,omitempty"`
+	Provider       string                  `json:"provider,omitempty"`
+	Model          string                  `json:"model,omitempty"`
+	Stream         bool                    `json:"stream,omitempty"`
+	Temperature    *float32                `json:"temperature,omitempty"`
+	Cache          bool                    `json:"cache,omitempty"`           // 非确定性请求也使用回复缓存
+	Images         []service.ImageURL      `json:"images,omitempty"`          // 图片链接或 base64 data URL
+	ResponseFormat *service.ResponseFormat `json:"response_format,omitempty"` // 要求输出 JSON，可指定 JSON Schema
+	Options        map[string]interface{}  `json:"options,omitempty"`
 }
 
 // CreateConversationRequest 创建对话请求
 type CreateConversationRequest struct {
-	Title    string `json:"title"              binding:"required"`
+	Title    string `json:"title,omitempty"` // 为空时在首轮对话后自动生成
 	Provider string `json:"provider,omitempty"`
 	Model    string `json:"model,omitempty"`
 }
 
+// chatOptions 构建聊天选项（未指定提供商时沿用对话设置或默认提供商）
+func (r *ChatRequest) chatOptions() *service.ChatOptions {
+	return &service.ChatOptions{
+		Provider:       r.Provider,
+		Model:          r.Model,
+		Stream:         r.Stream,
+		Temperature:    r.Temperature,
+		Cache:          r.Cache,
+		Images:         r.Images,
+		ResponseFormat: r.ResponseFormat,
+	}
+}
+
 // Chat 发送聊天消息
 func (c *AIController) Chat(ctx *gin.Context) {
 	var req ChatRequest
@@ -55,17 +82,7 @@ func (c *AIController) Chat(ctx *gin.Context) {
 		return
 	}
 
-	// 设置默认提供商和模型
-	if req.Provider == "" {
-		req.Provider = c.config.DefaultProvider
-	}
-
-	// 构建聊天选项
-	options := &service.ChatOptions{
-		Provider: req.Provider,
-		Model:    req.Model,
-		Stream:   req.Stream,
-	}
+	options := req.chatOptions()
 
 	// 处理流式响应
 	if req.Stream {
@@ -74,9 +91,9 @@ func (c *AIController) Chat(ctx *gin.Context) {
 	}
 
 	// 发送消息
-	message, err := c.aiService.SendMessage(ctx, userID, req.SessionID, req.Message, options)
+	message, err := c.aiService.SendMessage(callerContext(ctx, ctx), userID, req.SessionID, req.Message, options)
 	if err != nil {
-		response.Error(ctx, response.ERROR, "发送消息失败: "+err.Error())
+		respondAIError(ctx, "发送消息失败", err)
 		return
 	}
 
@@ -92,43 +109,93 @@ func (c *AIController) handleStreamChat(
 	sessionID, content string,
 	options *service.ChatOptions,
 ) {
-	// 设置SSE响应头
-	ctx.Header("Content-Type", "text/event-stream")
-	ctx.Header("Cache-Control", "no-cache")
-	ctx.Header("Connection", "keep-alive")
-	ctx.Header("Access-Control-Allow-Origin", "*")
+	setSSEHeaders(ctx)
 
 	// 获取流式响应
-	stream, err := c.aiService.SendMessageStream(ctx, userID, sessionID, content, options)
+	// 启用断线重连时回复在后台生成，客户端断开只结束本次接收
+	streamCtx := callerContext(ctx, ctx.Request.Context())
+	stream, err := c.aiService.SendMessageStream(streamCtx, userID, sessionID, content, options)
 	if err != nil {
-		ctx.SSEvent("error", gin.H{"error": err.Error()})
+		ctx.SSEvent("error", streamErrorPayload(err))
 		return
 	}
 
-	// 处理流式数据
-	for chunk := range stream {
-		if chunk.Error != nil {
-			ctx.SSEvent("error", gin.H{"error": chunk.Error.Message})
-			break
-		}
+	writeChatStream(ctx, stream)
+}
 
-		ctx.SSEvent("data", chunk)
-		ctx.Writer.Flush()
+// ResumeStream 断线重连，从 Last-Event-ID 之后继续接收对话最近一次的流式回复
+func (c *AIController) ResumeStream(ctx *gin.Context) {
+	sessionID := ctx.Param("session_id")
+	if sessionID == "" {
+		response.Error(ctx, response.INVALID_PARAMS, "会话ID不能为空")
+		return
+	}
 
-		if chunk.Done {
-			break
+	userID := getUserID(ctx)
+	if userID == 0 {
+		response.Error(ctx, response.UNAUTHORIZED, "用户未登录")
+		return
+	}
+
+	// 浏览器 EventSource 重连时使用 Last-Event-ID 请求头，其他客户端也可以使用查询参数
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.DefaultQuery("last_event_id", "0")
+	}
+	afterID, err := strconv.ParseInt(lastEventID, 10, 64)
+	if err != nil || afterID < 0 {
+		response.Error(ctx, response.INVALID_PARAMS, "Last-Event-ID 格式错误")
+		return
+	}
+
+	stream, err := c.aiService.ResumeMessageStream(ctx.Request.Context(), userID, sessionID, afterID)
+	if err != nil {
+		response.Error(ctx, response.NOT_FOUND, err.Error())
+		return
+	}
+
+	setSSEHeaders(ctx)
+	writeChatStream(ctx, stream)
+}
+
+// CancelGeneration 停止生成，已输出的部分保存为已取消的回复
+func (c *AIController) CancelGeneration(ctx *gin.Context) {
+	generationID := ctx.Param("id")
+	if generationID == "" {
+		response.Error(ctx, response.INVALID_PARAMS, "生成ID不能为空")
+		return
+	}
+
+	userID := getUserID(ctx)
+	if userID == 0 {
+		response.Error(ctx, response.UNAUTHORIZED, "用户未登录")
+		return
+	}
+
+	if err := c.aiService.CancelGeneration(ctx, userID, generationID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrGenerationNotFound):
+			response.Error(ctx, response.NOT_FOUND, err.Error())
+		case errors.Is(err, service.ErrGenerationFinished):
+			response.Error(ctx, response.CONFLICT, err.Error())
+		default:
+			response.Error(ctx, response.ERROR, "停止生成失败: "+err.Error())
 		}
+		return
 	}
 
-	ctx.SSEvent("done", gin.H{"message": "流式响应完成"})
+	response.Success(ctx, gin.H{"message": "已停止生成"})
 }
 
 // CreateConversation 创建对话
 func (c *AIController) CreateConversation(ctx *gin.Context) {
 	var req CreateConversationRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		response.Error(ctx, response.INVALID_PARAMS, "请求参数错误: "+err.Error())
-		return
+	// 请求体可以为空
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.Error(ctx, response.INVALID_PARAMS, "请求参数错误: "+err.Error())
+			return
+		}
 	}
 
 	userID := getUserID(ctx)
@@ -195,7 +262,7 @@ func (c *AIController) GetConversation(ctx *gin.Context) {
 	response.Success(ctx, conversation)
 }
 
-// GetMessages 获取消息列表
+// GetMessages 获取对话当前分支上的消息列表
 func (c *AIController) GetMessages(ctx *gin.Context) {
 	sessionID := ctx.Param("session_id")
 	if sessionID == "" {
@@ -278,6 +345,77 @@ func (c *AIController) DeleteConversation(ctx *gin.Context) {
 
 // 辅助函数
 
+// respondAIError 返回 AI 服务错误，配额超限时返回 429 并附带剩余额度和重置时间
+// 模型输出不符合格式要求时附带校验错误.
+func respondAIError(ctx *gin.Context, message string, err error) {
+	var apiErr *service.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case service.ErrorCodeQuotaExceeded:
+			response.ErrorWithData(ctx, response.TOO_MANY_REQUESTS, apiErr.Message, apiErr)
+			return
+		case service.ErrorCodeInvalidOutput:
+			response.ErrorWithData(ctx, response.ERROR, message+": "+apiErr.Message, apiErr)
+			return
+		}
+	}
+	response.Error(ctx, response.ERROR, message+": "+err.Error())
+}
+
+// streamErrorPayload 构建流式响应的错误事件，AI 服务错误附带错误码和详情
+func streamErrorPayload(err error) gin.H {
+	payload := gin.H{"error": err.Error()}
+	var apiErr *service.APIError
+	if errors.As(err, &apiErr) {
+		payload["code"] = apiErr.Code
+		if apiErr.Details != nil {
+			payload["details"] = apiErr.Details
+		}
+	}
+	return payload
+}
+
+// setSSEHeaders 设置SSE响应头
+func setSSEHeaders(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("Access-Control-Allow-Origin", "*")
+}
+
+// writeChatStream 输出流式回复，每个事件携带 ID，客户端断线后可以从最后收到的 ID 重连
+// 首个事件告知对话的 session ID 和生成 ID，便于新对话断线后重连和停止生成.
+func writeChatStream(ctx *gin.Context, stream *service.ChatStream) {
+	ctx.SSEvent("start", gin.H{"session_id": stream.SessionID, "generation_id": stream.GenerationID})
+	ctx.Writer.Flush()
+
+	for event := range stream.Events {
+		id := strconv.FormatInt(event.ID, 10)
+		if event.Chunk.Error != nil {
+			ctx.Render(-1, sse.Event{Id: id, Event: "error", Data: gin.H{"error": event.Chunk.Error.Message}})
+			break
+		}
+
+		ctx.Render(-1, sse.Event{Id: id, Event: "data", Data: event.Chunk})
+		ctx.Writer.Flush()
+
+		if event.Chunk.Done {
+			break
+		}
+	}
+
+	// 客户端已断开时不再输出
+	if ctx.Request.Context().Err() != nil {
+		return
+	}
+	ctx.SSEvent("done", gin.H{"message": "流式响应完成"})
+}
+
+// callerContext 在 parent 中记录调用者登录的设备，工具调用据此识别当前设备
+func callerContext(ctx *gin.Context, parent context.Context) context.Context {
+	return service.WithCallerDevice(parent, middleware.GetCurrentDeviceID(ctx))
+}
+
 // getUserID 从上下文获取用户ID
 func getUserID(ctx *gin.Context) uint {
 	if userID, exists := ctx.Get("user_id"); exists {
@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"ai-svc/internal/service"
+	"ai-svc/pkg/response"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegenerateRequest 重新生成回复请求，未指定的参数沿用对话设置
+type RegenerateRequest struct {
+	Provider       string                  `json:"provider,omitempty"`
+	Model          string                  `json:"model,omitempty"`
+	Stream         bool                    `json:"stream,omitempty"`
+	Temperature    *float32                `json:"temperature,omitempty"`
+	Cache          bool                    `json:"cache,omitempty"`
+	ResponseFormat *service.ResponseFormat `json:"response_format,omitempty"`
+}
+
+// SwitchBranchRequest 切换分支请求
+type SwitchBranchRequest struct {
+	MessageID uint `json:"message_id" binding:"required"` // 分支上的任一条消息
+}
+
+// chatOptions 构建聊天选项
+func (r *RegenerateRequest) chatOptions() *service.ChatOptions {
+	return &service.ChatOptions{
+		Provider:       r.Provider,
+		Model:          r.Model,
+		Stream:         r.Stream,
+		Temperature:    r.Temperature,
+		Cache:          r.Cache,
+		ResponseFormat: r.ResponseFormat,
+	}
+}
+
+// RegenerateMessage 重新生成回复，新回复与原回复并列成为新的分支
+func (c *AIController) RegenerateMessage(ctx *gin.Context) {
+	sessionID, messageID, ok := branchParams(ctx)
+	if !ok {
+		return
+	}
+
+	var req RegenerateRequest
+	// 请求体可以为空
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.Error(ctx, response.INVALID_PARAMS, "请求参数错误: "+err.Error())
+			return
+		}
+	}
+
+	userID := getUserID(ctx)
+	if userID == 0 {
+		response.Error(ctx, response.UNAUTHORIZED, "用户未登录")
+		return
+	}
+
+	options := req.chatOptions()
+	if req.Stream {
+		setSSEHeaders(ctx)
+		streamCtx := callerContext(ctx, ctx.Request.Context())
+		stream, err := c.aiService.RegenerateMessageStream(streamCtx, userID, sessionID, messageID, options)
+		if err != nil {
+			ctx.SSEvent("error", streamErrorPayload(err))
+			return
+		}
+		writeChatStream(ctx, stream)
+		return
+	}
+
+	message, err := c.aiService.RegenerateMessage(callerContext(ctx, ctx), userID, sessionID, messageID, options)
+	if err != nil {
+		respondBranchError(ctx, "重新生成失败", err)
+		return
+	}
+
+	response.Success(ctx, gin.H{
+		"message": message,
+	})
+}
+
+// ForkMessage 从指定消息开始新的分支并发送消息
+// 从用户消息分叉相当于编辑后重新发送，从助手回复分叉时新消息接在该回复之后.
+func (c *AIController) ForkMessage(ctx *gin.Context) {
+	sessionID, messageID, ok := branchParams(ctx)
+	if !ok {
+		return
+	}
+
+	var req ChatRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.Error(ctx, response.INVALID_PARAMS, "请求参数错误: "+err.Error())
+		return
+	}
+
+	userID := getUserID(ctx)
+	if userID == 0 {
+		response.Error(ctx, response.UNAUTHORIZED, "用户未登录")
+		return
+	}
+
+	options := req.chatOptions()
+	options.ForkFrom = messageID
+	if req.Stream {
+		c.handleStreamChat(ctx, userID, sessionID, req.Message, options)
+		return
+	}
+
+	message, err := c.aiService.SendMessage(callerContext(ctx, ctx), userID, sessionID, req.Message, options)
+	if err != nil {
+		respondBranchError(ctx, "发送消息失败", err)
+		return
+	}
+
+	response.Success(ctx, gin.H{
+		"message": message,
+	})
+}
+
+// ListBranches 获取对话的分支列表
+func (c *AIController) ListBranches(ctx *gin.Context) {
+	sessionID := ctx.Param("session_id")
+	if sessionID == "" {
+		response.Error(ctx, response.INVALID_PARAMS, "会话ID不能为空")
+		return
+	}
+
+	userID := getUserID(ctx)
+	if userID == 0 {
+		response.Error(ctx, response.UNAUTHORIZED, "用户未登录")
+		return
+	}
+
+	branches, err := c.aiService.ListBranches(ctx, userID, sessionID)
+	if err != nil {
+		response.Error(ctx, response.ERROR, "获取分支列表失败: "+err.Error())
+		return
+	}
+
+	response.Success(ctx, branches)
+}
+
+// SwitchBranch 切换当前分支，返回该分支的全部消息
+func (c *AIController) SwitchBranch(ctx *gin.Context) {
+	sessionID := ctx.Param("session_id")
+	if sessionID == "" {
+		response.Error(ctx, response.INVALID_PARAMS, "会话ID不能为空")
+		return
+	}
+
+	var req SwitchBranchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.Error(ctx, response.INVALID_PARAMS, "请求参数错误: "+err.Error())
+		return
+	}
+
+	userID := getUserID(ctx)
+	if userID == 0 {
+		response.Error(ctx, response.UNAUTHORIZED, "用户未登录")
+		return
+	}
+
+	messages, err := c.aiService.SwitchBranch(ctx, userID, sessionID, req.MessageID)
+	if err != nil {
+		respondBranchError(ctx, "切换分支失败", err)
+		return
+	}
+
+	response.Success(ctx, messages)
+}
+
+// branchParams 解析路径中的会话ID和消息ID，格式错误时返回错误响应
+func branchParams(ctx *gin.Context) (string, uint, bool) {
+	sessionID := ctx.Param("session_id")
+	if sessionID == "" {
+		response.Error(ctx, response.INVALID_PARAMS, "会话ID不能为空")
+		return "", 0, false
+	}
+
+	messageID, err := strconv.ParseUint(ctx.Param("message_id"), 10, 64)
+	if err != nil || messageID == 0 {
+		response.Error(ctx, response.INVALID_PARAMS, "消息ID格式错误")
+		return "", 0, false
+	}
+	return sessionID, uint(messageID), true
+}
+
+// respondBranchError 返回分支操作的错误，消息不存在时返回 404
+func respondBranchError(ctx *gin.Context, message string, err error) {
+	if errors.Is(err, service.ErrMessageNotFound) {
+		response.Error(ctx, response.NOT_FOUND, err.Error())
+		return
+	}
+	respondAIError(ctx, message, err)
+}
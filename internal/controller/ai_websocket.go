@@ -0,0 +1,373 @@
+package controller
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/middleware"
+	"ai-svc/internal/service"
+	"ai-svc/pkg/response"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket 帧类型
+const (
+	wsFrameSend   = "send"   // 客户端发送消息，data 为 ChatRequest
+	wsFrameCancel = "cancel" // 客户端停止生成
+	wsFrameResume = "resume" // 客户端重连后继续接收对话最近一次的回复
+	wsFrameStart  = "start"  // 回复开始，携带 session ID 和生成 ID
+	wsFrameDelta  = "delta"  // 回复的增量内容，data 为 ChatStreamResponse
+	wsFrameDone   = "done"   // 回复结束，data 为携带用量的 ChatStreamResponse
+	wsFrameError  = "error"  // 请求或回复出错
+)
+
+// wsRateLimitType send、resume 消息使用的限流配置，与 HTTP 对话接口相同
+const wsRateLimitType = "ai"
+
+// wsUpgrader 升级 WebSocket 连接
+// 与 CORS 中间件一致允许任意来源，连接本身需要通过 JWT 认证.
+var wsUpgrader = websocket.Upgrader{
+	HandshakeTimeout: 10 * time.Second,
+	CheckOrigin:      func(*http.Request) bool { return true },
+}
+
+// wsClientFrame 客户端发送的帧
+type wsClientFrame struct {
+	Type         string       `json:"type"`
+	RequestID    string       `json:"request_id,omitempty"`    // 客户端自定义，start、error 帧原样带回
+	Data         *ChatRequest `json:"data,omitempty"`          // send
+	GenerationID string       `json:"generation_id,omitempty"` // cancel
+	SessionID    string       `json:"session_id,omitempty"`    // resume
+	LastEventID  int64        `json:"last_event_id,omitempty"` // resume，从该事件之后继续接收
+}
+
+// wsServerFrame 服务端发送的帧
+type wsServerFrame struct {
+	Type         string                      `json:"type"`
+	RequestID    string                      `json:"request_id,omitempty"`
+	ID           int64                       `json:"id,omitempty"` // 事件 ID，与 SSE 的事件 ID 相同
+	SessionID    string                      `json:"session_id,omitempty"`
+	GenerationID string                      `json:"generation_id,omitempty"`
+	Data         *service.ChatStreamResponse `json:"data,omitempty"`
+	Error        gin.H                       `json:"error,omitempty"`
+}
+
+// ChatWebSocket 通过 WebSocket 进行对话：在同一连接上发送消息、接收增量、停止生成
+func (c *AIController) ChatWebSocket(ctx *gin.Context) {
+	cfg := c.config.Features.WebSocket
+	if !cfg.Enabled {
+		response.Error(ctx, response.NOT_FOUND, "WebSocket 对话未启用")
+		return
+	}
+
+	userID := getUserID(ctx)
+	if userID == 0 {
+		response.Error(ctx, response.UNAUTHORIZED, "用户未登录")
+		return
+	}
+
+	// 握手失败时 Upgrade 已返回错误响应
+	conn, err := wsUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		return
+	}
+
+	connCtx, cancel := context.WithCancel(callerContext(ctx, ctx.Request.Context()))
+	session := &wsChatSession{
+		aiService: c.aiService,
+		limiter:   c.rateLimiter,
+		conn:      conn,
+		config:    cfg,
+		userID:    userID,
+		ctx:       connCtx,
+		cancel:    cancel,
+		outbox:    make(chan *wsServerFrame, max(cfg.SendQueueSize, 1)),
+		streams:   make(chan struct{}, max(cfg.MaxConcurrentStreams, 1)),
+	}
+	session.serve()
+}
+
+// wsChatSession 一个 WebSocket 连接上的对话
+// 读取协程处理客户端的帧，每个回复由单独的协程转发到发送队列，写入协程统一发送；
+// 发送队列满时转发协程等待，客户端长时间不读取时写入超时并断开连接.
+type wsChatSession struct {
+	aiService service.AIService
+	limiter   *middleware.RateLimiter // 握手请求只经过一次限流，之后每条 send、resume 消息单独限流
+	conn      *websocket.Conn
+	config    config.WebSocketConfig
+	userID    uint
+
+	// ctx 连接断开时取消，结束转发回复；启用断线重连时回复本身继续生成
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	outbox  chan *wsServerFrame // 待发送的帧
+	streams chan struct{}       // 进行中的回复，限制每个连接的并发数
+	wg      sync.WaitGroup
+}
+
+// serve 处理连接直到断开
+func (s *wsChatSession) serve() {
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		s.writeLoop()
+	}()
+
+	s.readLoop()
+	s.cancel()
+	s.wg.Wait()
+	<-writerDone
+	_ = s.conn.Close()
+}
+
+// readLoop 读取并处理客户端的帧，超过 pong_timeout 没有收到任何数据时断开
+func (s *wsChatSession) readLoop() {
+	s.conn.SetReadLimit(s.config.MaxMessageSize)
+	s.extendReadDeadline()
+	s.conn.SetPongHandler(func(string) error {
+		s.extendReadDeadline()
+		return nil
+	})
+
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.extendReadDeadline()
+
+		if messageType != websocket.TextMessage {
+			s.sendError("", "", errors.New("只支持 JSON 文本消息"))
+			continue
+		}
+		var frame wsClientFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			s.sendError("", "", errors.New("消息格式错误: "+err.Error()))
+			continue
+		}
+
+		switch frame.Type {
+		case wsFrameSend:
+			s.handleSend(&frame)
+		case wsFrameCancel:
+			s.handleCancel(&frame)
+		case wsFrameResume:
+			s.handleResume(&frame)
+		default:
+			s.sendError(frame.RequestID, "", errors.New("不支持的消息类型: "+frame.Type))
+		}
+	}
+}
+
+// writeLoop 发送队列中的帧并定时发送 ping，写入失败时断开连接
+func (s *wsChatSession) writeLoop() {
+	var ping <-chan time.Time
+	if s.config.PingInterval > 0 {
+		ticker := time.NewTicker(s.config.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		var err error
+		select {
+		case frame := <-s.outbox:
+			data, _ := json.Marshal(frame)
+			_ = s.conn.SetWriteDeadline(s.writeDeadline())
+			err = s.conn.WriteMessage(websocket.TextMessage, data)
+		case <-ping:
+			err = s.conn.WriteControl(websocket.PingMessage, nil, s.writeDeadline())
+		case <-s.ctx.Done():
+			closing := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			_ = s.conn.WriteControl(websocket.CloseMessage, closing, s.writeDeadline())
+			return
+		}
+
+		if err != nil {
+			// 关闭连接使读取协程结束
+			s.cancel()
+			_ = s.conn.Close()
+			return
+		}
+	}
+}
+
+// handleSend 发送消息并转发流式回复
+func (s *wsChatSession) handleSend(frame *wsClientFrame) {
+	req := frame.Data
+	if req == nil {
+		s.sendError(frame.RequestID, "", errors.New("缺少消息内容"))
+		return
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		s.sendError(frame.RequestID, "", errors.New("请求参数错误: "+err.Error()))
+		return
+	}
+	if !s.allowRequest(frame.RequestID) {
+		return
+	}
+	if !s.acquireStream() {
+		s.sendError(frame.RequestID, "", errors.New("同时进行的回复过多，请等待当前回复结束"))
+		return
+	}
+
+	// 建立上游连接可能较慢，不阻塞读取协程
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.releaseStream()
+
+		options := req.chatOptions()
+		options.Stream = true
+		stream, err := s.aiService.SendMessageStream(s.ctx, s.userID, req.SessionID, req.Message, options)
+		if err != nil {
+			s.sendError(frame.RequestID, "", err)
+			return
+		}
+		s.forward(frame.RequestID, stream)
+	}()
+}
+
+// handleCancel 停止生成，回复随后以 finish_reason 为 cancelled 的增量和 done 帧结束
+func (s *wsChatSession) handleCancel(frame *wsClientFrame) {
+	if err := s.aiService.CancelGeneration(s.ctx, s.userID, frame.GenerationID); err != nil {
+		s.sendError(frame.RequestID, frame.GenerationID, err)
+	}
+}
+
+// handleResume 从指定事件之后继续接收对话最近一次的回复
+func (s *wsChatSession) handleResume(frame *wsClientFrame) {
+	if frame.SessionID == "" {
+		s.sendError(frame.RequestID, "", errors.New("会话ID不能为空"))
+		return
+	}
+	if !s.allowRequest(frame.RequestID) {
+		return
+	}
+	if !s.acquireStream() {
+		s.sendError(frame.RequestID, "", errors.New("同时进行的回复过多，请等待当前回复结束"))
+		return
+	}
+
+	stream, err := s.aiService.ResumeMessageStream(s.ctx, s.userID, frame.SessionID, frame.LastEventID)
+	if err != nil {
+		s.releaseStream()
+		s.sendError(frame.RequestID, "", err)
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.releaseStream()
+		s.forward(frame.RequestID, stream)
+	}()
+}
+
+// forward 把回复的事件转发到发送队列，连接断开时停止
+func (s *wsChatSession) forward(requestID string, stream *service.ChatStream) {
+	if !s.enqueue(&wsServerFrame{
+		Type:         wsFrameStart,
+		RequestID:    requestID,
+		SessionID:    stream.SessionID,
+		GenerationID: stream.GenerationID,
+	}) {
+		return
+	}
+
+	for event := range stream.Events {
+		frame := &wsServerFrame{
+			Type:         wsFrameDelta,
+			ID:           event.ID,
+			GenerationID: stream.GenerationID,
+			Data:         event.Chunk,
+		}
+		switch {
+		case event.Chunk.Error != nil:
+			frame = &wsServerFrame{
+				Type:         wsFrameError,
+				ID:           event.ID,
+				GenerationID: stream.GenerationID,
+				Error:        streamErrorPayload(event.Chunk.Error),
+			}
+		case event.Chunk.Done:
+			frame.Type = wsFrameDone
+		}
+
+		if !s.enqueue(frame) {
+			return
+		}
+	}
+}
+
+// sendError 发送错误帧
+func (s *wsChatSession) sendError(requestID, generationID string, err error) {
+	s.enqueue(&wsServerFrame{
+		Type:         wsFrameError,
+		RequestID:    requestID,
+		GenerationID: generationID,
+		Error:        streamErrorPayload(err),
+	})
+}
+
+// enqueue 把帧放入发送队列，队列满时等待，连接断开时返回 false
+func (s *wsChatSession) enqueue(frame *wsServerFrame) bool {
+	select {
+	case s.outbox <- frame:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// allowRequest 按 AI 对话的限流规则检查用户的一次请求，超出时发送错误帧并返回 false
+// 以用户为键，同一用户的多个连接共享额度.
+func (s *wsChatSession) allowRequest(requestID string) bool {
+	if s.limiter == nil || s.limiter.AllowKey(fmt.Sprintf("user:%d", s.userID), wsRateLimitType) {
+		return true
+	}
+	s.sendError(requestID, "", &service.APIError{
+		Code:    service.ErrorCodeRateLimitExceeded,
+		Message: middleware.GetConfigRateLimit(wsRateLimitType).ErrorMsg,
+	})
+	return false
+}
+
+// acquireStream 占用一个回复名额，已达上限时返回 false
+func (s *wsChatSession) acquireStream() bool {
+	select {
+	case s.streams <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseStream 释放回复名额
+func (s *wsChatSession) releaseStream() {
+	<-s.streams
+}
+
+// extendReadDeadline 收到客户端数据后延长读取截止时间
+func (s *wsChatSession) extendReadDeadline() {
+	if s.config.PongTimeout > 0 {
+		_ = s.conn.SetReadDeadline(time.Now().Add(s.config.PongTimeout))
+	}
+}
+
+// writeDeadline 本次写入的截止时间，未配置写入超时时不限制
+func (s *wsChatSession) writeDeadline() time.Time {
+	if s.config.WriteTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(s.config.WriteTimeout)
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"ai-svc/internal/middleware"
+	"ai-svc/internal/service"
+	"ai-svc/pkg/response"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyController API 密钥控制器
+type APIKeyController struct {
+	apiKeyService service.APIKeyService
+}
+
+// NewAPIKeyController 创建 API 密钥控制器
+func NewAPIKeyController(apiKeyService service.APIKeyService) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateAPIKeyRequest 签发 API 密钥请求
+type CreateAPIKeyRequest struct {
+	Name      string `json:"name"                 binding:"required,max=100"`
+	ExpiresIn int    `json:"expires_in,omitempty" binding:"min=0"` // 有效期（天），0 表示不过期
+}
+
+// CreateAPIKey 签发 API 密钥，明文密钥只在本次响应中返回
+func (c *APIKeyController) CreateAPIKey(ctx *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		response.Error(ctx, response.INVALID_PARAMS, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresIn)
+		expiresAt = &expires
+	}
+
+	userID := middleware.GetCurrentUserID(ctx)
+	plain, key, err := c.apiKeyService.Issue(userID, req.Name, expiresAt)
+	if err != nil {
+		response.Error(ctx, response.ERROR, err.Error())
+		return
+	}
+
+	response.Success(ctx, gin.H{
+		"key":     plain,
+		"api_key": key,
+	})
+}
+
+// ListAPIKeys 获取 API 密钥列表
+func (c *APIKeyController) ListAPIKeys(ctx *gin.Context) {
+	keys, err := c.apiKeyService.List(middleware.GetCurrentUserID(ctx))
+	if err != nil {
+		response.Error(ctx, response.ERROR, "获取API密钥列表失败")
+		return
+	}
+
+	response.Success(ctx, keys)
+}
+
+// RevokeAPIKey 吊销 API 密钥
+func (c *APIKeyController) RevokeAPIKey(ctx *gin.Context) {
+	keyID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		response.Error(ctx, response.INVALID_PARAMS, "密钥ID格式错误")
+		return
+	}
+
+	if err := c.apiKeyService.Revoke(middleware.GetCurrentUserID(ctx), uint(keyID)); err != nil {
+		response.Error(ctx, response.ERROR, err.Error())
+		return
+	}
+
+	response.Success(ctx, gin.H{"message": "API密钥已吊销"})
+}
@@ -0,0 +1,287 @@
+package controller
+
+import (
+	"ai-svc/internal/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OpenAIController OpenAI 兼容接口控制器
+// 请求和响应均使用 OpenAI 的格式，现有的 OpenAI SDK 修改 base_url 即可接入.
+type OpenAIController struct {
+	aiService service.AIService
+}
+
+// NewOpenAIController 创建 OpenAI 兼容接口控制器
+func NewOpenAIController(aiService service.AIService) *OpenAIController {
+	return &OpenAIController{
+		aiService: aiService,
+	}
+}
+
+// OpenAIModel OpenAI 模型信息
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// OpenAIModelList OpenAI 模型列表
+type OpenAIModelList struct {
+	Object string        `json:"object"`
+	Data   []OpenAIModel `json:"data"`
+}
+
+// ChatCompletions 聊天补全接口 POST /v1/chat/completions
+func (c *OpenAIController) ChatCompletions(ctx *gin.Context) {
+	var req service.OpenAIChatRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeOpenAIError(ctx, &service.APIError{
+			Code:    service.ErrorCodeInvalidRequest,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	userID := getUserID(ctx)
+	chatReq := chatRequestFromOpenAI(&req)
+
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		c.streamChatCompletions(ctx, userID, chatReq, includeUsage)
+		return
+	}
+
+	resp, err := c.aiService.CreateChatCompletion(ctx.Request.Context(), userID, chatReq)
+	if err != nil {
+		writeOpenAIError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, openAIResponseFromChat(resp))
+}
+
+// streamChatCompletions 以 OpenAI SSE 格式返回流式补全，最后发送 data: [DONE]
+func (c *OpenAIController) streamChatCompletions(
+	ctx *gin.Context,
+	userID uint,
+	req *service.ChatRequest,
+	includeUsage bool,
+) {
+	stream, err := c.aiService.CreateChatCompletionStream(ctx.Request.Context(), userID, req)
+	if err != nil {
+		// 尚未开始输出，按普通请求返回错误状态码
+		writeOpenAIError(ctx, err)
+		return
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Status(http.StatusOK)
+
+	// 同一次补全的所有块使用相同的 ID
+	completionID := "chatcmpl-" + uuid.New().String()
+	created := time.Now().Unix()
+
+	for chunk := range stream {
+		if chunk.Error != nil {
+			_, body := openAIErrorBody(chunk.Error)
+			writeSSEData(ctx, body)
+			break
+		}
+
+		openaiChunk := openAIChunkFromStream(chunk, completionID, created)
+		if chunk.Done {
+			if includeUsage && chunk.Usage != nil {
+				openaiChunk.Choices = []service.OpenAIStreamChoice{}
+				openaiChunk.Usage = &service.OpenAIUsage{
+					PromptTokens:     chunk.Usage.PromptTokens,
+					CompletionTokens: chunk.Usage.CompletionTokens,
+					TotalTokens:      chunk.Usage.TotalTokens,
+				}
+				writeSSEData(ctx, openaiChunk)
+			}
+			break
+		}
+		writeSSEData(ctx, openaiChunk)
+	}
+
+	_, _ = ctx.Writer.WriteString("data: [DONE]\n\n")
+	ctx.Writer.Flush()
+}
+
+// ListModels 模型列表接口 GET /v1/models
+func (c *OpenAIController) ListModels(ctx *gin.Context) {
+	models, err := c.aiService.ListModels(ctx.Request.Context())
+	if err != nil {
+		writeOpenAIError(ctx, err)
+		return
+	}
+
+	created := time.Now().Unix()
+	list := OpenAIModelList{
+		Object: "list",
+		Data:   make([]OpenAIModel, 0, len(models)),
+	}
+	for _, info := range models {
+		list.Data = append(list.Data, OpenAIModel{
+			ID:      info.ID,
+			Object:  "model",
+			Created: created,
+			OwnedBy: info.Provider,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, list)
+}
+
+// 辅助函数
+
+// chatRequestFromOpenAI 将 OpenAI 请求转换为内部请求
+func chatRequestFromOpenAI(req *service.OpenAIChatRequest) *service.ChatRequest {
+	messages := make([]service.Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = service.Message{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+			Parts:      msg.Parts,
+		}
+	}
+
+	chatReq := service.NewChatRequest(req.Model, messages)
+	chatReq.Temperature = req.Temperature
+	chatReq.MaxTokens = req.MaxTokens
+	if req.MaxCompletionTokens != nil {
+		chatReq.MaxTokens = req.MaxCompletionTokens
+	}
+	chatReq.TopP = req.TopP
+	chatReq.FrequencyPenalty = req.FrequencyPenalty
+	chatReq.PresencePenalty = req.PresencePenalty
+	chatReq.Stop = req.Stop
+	chatReq.Tools = req.Tools
+	chatReq.ToolChoice = req.ToolChoice
+	chatReq.ResponseFormat = req.ResponseFormat
+	chatReq.Stream = req.Stream
+	return chatReq
+}
+
+// openAIResponseFromChat 将内部响应转换为 OpenAI 响应
+func openAIResponseFromChat(resp *service.ChatResponse) *service.OpenAIChatResponse {
+	choices := make([]service.OpenAIChoice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choices[i] = service.OpenAIChoice{
+			Index: choice.Index,
+			Message: service.OpenAIMessage{
+				Role:      choice.Message.Role,
+				Content:   choice.Message.Content,
+				ToolCalls: choice.Message.ToolCalls,
+			},
+			FinishReason: choice.FinishReason,
+		}
+	}
+
+	id := resp.ID
+	if id == "" {
+		id = "chatcmpl-" + uuid.New().String()
+	}
+	created := resp.Created
+	if created == 0 {
+		created = time.Now().Unix()
+	}
+
+	return &service.OpenAIChatResponse{
+		ID:      id,
+		Object:  service.ObjectChatCompletion,
+		Created: created,
+		Model:   resp.Model,
+		Choices: choices,
+		Usage: service.OpenAIUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}
+}
+
+// openAIChunkFromStream 将内部流式块转换为 OpenAI 流式块
+func openAIChunkFromStream(chunk *service.ChatStreamResponse, id string, created int64) *service.OpenAIStreamChunk {
+	choices := make([]service.OpenAIStreamChoice, len(chunk.Choices))
+	for i, choice := range chunk.Choices {
+		choices[i] = service.OpenAIStreamChoice{
+			Index:        choice.Index,
+			Delta:        choice.Delta,
+			FinishReason: choice.FinishReason,
+		}
+	}
+
+	return &service.OpenAIStreamChunk{
+		ID:      id,
+		Object:  service.ObjectChatCompletionChunk,
+		Created: created,
+		Model:   chunk.Model,
+		Choices: choices,
+	}
+}
+
+// writeSSEData 写入一条 OpenAI 格式的 SSE 数据
+func writeSSEData(ctx *gin.Context, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	_, _ = ctx.Writer.WriteString("data: " + string(data) + "\n\n")
+	ctx.Writer.Flush()
+}
+
+// writeOpenAIError 以 OpenAI 错误格式返回错误
+func writeOpenAIError(ctx *gin.Context, err error) {
+	status, body := openAIErrorBody(err)
+	ctx.JSON(status, body)
+}
+
+// openAIErrorBody 将服务错误映射为 OpenAI 错误类型和 HTTP 状态码
+func openAIErrorBody(err error) (int, *service.OpenAIErrorResponse) {
+	body := &service.OpenAIErrorResponse{
+		Error: service.OpenAIError{
+			Message: err.Error(),
+			Type:    "api_error",
+			Code:    service.ErrorCodeProviderError,
+		},
+	}
+
+	var apiErr *service.APIError
+	if !errors.As(err, &apiErr) {
+		return http.StatusInternalServerError, body
+	}
+
+	body.Error.Code = apiErr.Code
+	switch apiErr.Code {
+	case service.ErrorCodeInvalidRequest, service.ErrorCodeInvalidProvider, service.ErrorCodeContentFiltered:
+		body.Error.Type = "invalid_request_error"
+		return http.StatusBadRequest, body
+	case service.ErrorCodeInvalidModel:
+		body.Error.Type = "invalid_request_error"
+		body.Error.Code = "model_not_found"
+		return http.StatusNotFound, body
+	case service.ErrorCodeQuotaExceeded:
+		body.Error.Type = "insufficient_quota"
+		return http.StatusTooManyRequests, body
+	case service.ErrorCodeRateLimitExceeded:
+		body.Error.Type = "rate_limit_error"
+		return http.StatusTooManyRequests, body
+	case service.ErrorCodeProviderUnavailable:
+		return http.StatusServiceUnavailable, body
+	default:
+		return http.StatusBadGateway, body
+	}
+}
@@ -2,9 +2,11 @@ package middleware
 
 import (
 	"ai-svc/internal/config"
+	"ai-svc/internal/model"
 	"ai-svc/internal/repository"
 	"ai-svc/pkg/logger"
 	"ai-svc/pkg/response"
+	"errors"
 	"strings"
 	"time"
 
@@ -125,89 +127,17 @@ func JWTWithDeviceAuth() gin.HandlerFunc {
 			return
 		}
 
-		// 3. 解析Token
+		// 3. 解析Token并验证设备
 		tokenString := strings.TrimPrefix(token, "Bearer ")
-		claims, err := ParseToken(tokenString)
+		claims, device, err := authenticateDevice(c, deviceRepo, tokenString)
 		if err != nil {
-			logger.Warn("JWT认证失败：令牌解析失败", map[string]any{
-				"request_id": requestID,
-				"error":      err.Error(),
-			})
-			response.Error(c, response.UNAUTHORIZED, "认证令牌无效")
-			c.Abort()
-			return
-		}
-
-		// 4. 检查Token是否过期
-		if time.Now().Unix() > claims.ExpiresAt.Unix() {
-			logger.Warn("JWT认证失败：令牌已过期", map[string]any{
-				"request_id": requestID,
-				"user_id":    claims.UserID,
-				"device_id":  claims.DeviceID,
-				"expired_at": claims.ExpiresAt.Unix(),
-			})
-			response.Error(c, response.UNAUTHORIZED, "认证令牌已过期")
-			c.Abort()
-			return
-		}
-
-		// 5. 验证设备状态
-		device, err := deviceRepo.GetDeviceByDeviceID(claims.DeviceID)
-		if err != nil {
-			logger.Warn("设备验证失败：设备不存在或已被踢出", map[string]any{
-				"request_id": requestID,
-				"user_id":    claims.UserID,
-				"device_id":  claims.DeviceID,
-				"error":      err.Error(),
-			})
-			response.Error(c, response.UNAUTHORIZED, "设备已被踢出，请重新登录")
-			c.Abort()
-			return
-		}
-
-		// 6. 检查设备是否属于当前用户
-		if device.UserID != claims.UserID {
-			logger.Warn("设备验证失败：设备不属于当前用户", map[string]any{
-				"request_id":     requestID,
-				"token_user_id":  claims.UserID,
-				"device_user_id": device.UserID,
-				"device_id":      claims.DeviceID,
-			})
-			response.Error(c, response.UNAUTHORIZED, "设备认证失败")
-			c.Abort()
-			return
-		}
-
-		// 7. 检查设备是否在线（可选，根据业务需求）
-		if !device.IsOnline() {
-			logger.Warn("设备验证失败：设备已离线", map[string]any{
-				"request_id":  requestID,
-				"user_id":     claims.UserID,
-				"device_id":   claims.DeviceID,
-				"last_active": device.LastActiveAt,
-			})
-			response.Error(c, response.UNAUTHORIZED, "设备已离线，请重新登录")
+			response.Error(c, response.UNAUTHORIZED, err.Error())
 			c.Abort()
 			return
 		}
 
-		// 8. 更新设备活跃时间（异步，避免影响性能）
-		go func() {
-			if err := deviceRepo.UpdateDeviceActivity(claims.DeviceID); err != nil {
-				logger.Error("更新设备活跃时间失败", map[string]any{
-					"device_id": claims.DeviceID,
-					"error":     err.Error(),
-				})
-			}
-		}()
-
-		// 9. 将用户和设备信息存入上下文
-		c.Set("user_id", claims.UserID)
-		c.Set("phone", claims.Phone)
-		c.Set("device_id", claims.DeviceID)
-		c.Set("device_type", claims.DeviceType)
-		c.Set("session_id", claims.SessionID)
-		c.Set("device", device) // 将完整设备信息也存入上下文
+		// 4. 将用户和设备信息存入上下文
+		setDeviceAuthContext(c, claims, device)
 
 		// 记录成功认证日志
 		logger.Info("JWT和设备认证成功", map[string]any{
@@ -224,6 +154,93 @@ func JWTWithDeviceAuth() gin.HandlerFunc {
 	}
 }
 
+// authenticateDevice 解析JWT令牌并验证令牌对应的设备.
+// 失败时已记录日志，返回的错误信息可以直接返回给客户端.
+func authenticateDevice(
+	c *gin.Context,
+	deviceRepo repository.DeviceRepository,
+	tokenString string,
+) (*JWTClaims, *model.UserDevice, error) {
+	requestID := GetRequestID(c)
+
+	// 1. 解析Token
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		logger.Warn("JWT认证失败：令牌解析失败", map[string]any{
+			"request_id": requestID,
+			"error":      err.Error(),
+		})
+		return nil, nil, errors.New("认证令牌无效")
+	}
+
+	// 2. 检查Token是否过期
+	if time.Now().Unix() > claims.ExpiresAt.Unix() {
+		logger.Warn("JWT认证失败：令牌已过期", map[string]any{
+			"request_id": requestID,
+			"user_id":    claims.UserID,
+			"device_id":  claims.DeviceID,
+			"expired_at": claims.ExpiresAt.Unix(),
+		})
+		return nil, nil, errors.New("认证令牌已过期")
+	}
+
+	// 3. 验证设备状态
+	device, err := deviceRepo.GetDeviceByDeviceID(claims.DeviceID)
+	if err != nil {
+		logger.Warn("设备验证失败：设备不存在或已被踢出", map[string]any{
+			"request_id": requestID,
+			"user_id":    claims.UserID,
+			"device_id":  claims.DeviceID,
+			"error":      err.Error(),
+		})
+		return nil, nil, errors.New("设备已被踢出，请重新登录")
+	}
+
+	// 4. 检查设备是否属于当前用户
+	if device.UserID != claims.UserID {
+		logger.Warn("设备验证失败：设备不属于当前用户", map[string]any{
+			"request_id":     requestID,
+			"token_user_id":  claims.UserID,
+			"device_user_id": device.UserID,
+			"device_id":      claims.DeviceID,
+		})
+		return nil, nil, errors.New("设备认证失败")
+	}
+
+	// 5. 检查设备是否在线（可选，根据业务需求）
+	if !device.IsOnline() {
+		logger.Warn("设备验证失败：设备已离线", map[string]any{
+			"request_id":  requestID,
+			"user_id":     claims.UserID,
+			"device_id":   claims.DeviceID,
+			"last_active": device.LastActiveAt,
+		})
+		return nil, nil, errors.New("设备已离线，请重新登录")
+	}
+
+	// 6. 更新设备活跃时间（异步，避免影响性能）
+	go func() {
+		if err := deviceRepo.UpdateDeviceActivity(claims.DeviceID); err != nil {
+			logger.Error("更新设备活跃时间失败", map[string]any{
+				"device_id": claims.DeviceID,
+				"error":     err.Error(),
+			})
+		}
+	}()
+
+	return claims, device, nil
+}
+
+// setDeviceAuthContext 将用户和设备信息存入上下文.
+func setDeviceAuthContext(c *gin.Context, claims *JWTClaims, device *model.UserDevice) {
+	c.Set("user_id", claims.UserID)
+	c.Set("phone", claims.Phone)
+	c.Set("device_id", claims.DeviceID)
+	c.Set("device_type", claims.DeviceType)
+	c.Set("session_id", claims.SessionID)
+	c.Set("device", device) // 将完整设备信息也存入上下文
+}
+
 // GenerateToken 生成JWT令牌.
 func GenerateToken(userID uint, phone, deviceID, deviceType, sessionID string) (string, error) {
 	expireTime := time.Now().Add(time.Duration(config.AppConfig.JWT.ExpireHours) * time.Hour)
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"ai-svc/internal/repository"
+	"ai-svc/pkg/logger"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyAuthenticator 校验 API 密钥并返回所属的用户ID.
+type APIKeyAuthenticator interface {
+	Authenticate(key string) (uint, error)
+}
+
+// OpenAIAuth OpenAI 兼容接口的认证中间件.
+// 同时支持 JWT（带设备验证）和以 keyPrefix 开头的 API 密钥，认证失败时返回 OpenAI 格式的错误，便于 SDK 直接识别.
+func OpenAIAuth(keys APIKeyAuthenticator, keyPrefix string) gin.HandlerFunc {
+	deviceRepo := repository.NewDeviceRepository()
+
+	return func(c *gin.Context) {
+		requestID := GetRequestID(c)
+
+		token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || token == "" {
+			abortOpenAIUnauthorized(c, "未提供认证令牌")
+			return
+		}
+
+		// API 密钥认证
+		if strings.HasPrefix(token, keyPrefix) {
+			userID, err := keys.Authenticate(token)
+			if err != nil {
+				logger.Warn("API密钥认证失败", map[string]any{
+					"request_id": requestID,
+					"path":       c.Request.URL.Path,
+				})
+				abortOpenAIUnauthorized(c, err.Error())
+				return
+			}
+
+			c.Set("user_id", userID)
+			c.Set("auth_type", "api_key")
+			c.Next()
+			return
+		}
+
+		// JWT 认证，与 JWTWithDeviceAuth 一样要求设备有效
+		claims, device, err := authenticateDevice(c, deviceRepo, token)
+		if err != nil {
+			abortOpenAIUnauthorized(c, err.Error())
+			return
+		}
+
+		setDeviceAuthContext(c, claims, device)
+		c.Set("auth_type", "jwt")
+		c.Next()
+	}
+}
+
+// abortOpenAIUnauthorized 以 OpenAI 错误格式返回 401.
+func abortOpenAIUnauthorized(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    "invalid_api_key",
+		},
+	})
+}
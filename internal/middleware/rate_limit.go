@@ -117,6 +117,13 @@ func (v *Visitor) GetLimiter(endpoint string, config RateLimitConfig) *TokenBuck
 	return limiter
 }
 
+// AllowKey 按配置文件中 configType 的限流规则检查 key 的一次请求.
+// 用于不经过 HTTP 中间件的请求，如同一 WebSocket 连接上的多条消息.
+func (rl *RateLimiter) AllowKey(key, configType string) bool {
+	visitor := rl.GetVisitor(key)
+	return visitor.GetLimiter(configType, GetConfigRateLimit(configType)).Allow()
+}
+
 // cleanupVisitors 清理过期的访问者.
 func (rl *RateLimiter) cleanupVisitors() {
 	for {
@@ -201,6 +208,12 @@ func GetConfigRateLimit(configType string) RateLimitConfig {
 		if errorMsg == "" {
 			errorMsg = "登录尝试过于频繁，请稍后再试"
 		}
+	case "ai":
+		rateLimitConfig = config.AppConfig.RateLimit.AI
+		errorMsg = rateLimitConfig.ErrorMessage
+		if errorMsg == "" {
+			errorMsg = "AI请求过于频繁，请稍后再试"
+		}
 	default:
 		// 默认配置
 		return DefaultRateLimitConfig
@@ -234,3 +247,8 @@ func APIRateLimit(limiter *RateLimiter) gin.HandlerFunc {
 func LoginRateLimit(limiter *RateLimiter) gin.HandlerFunc {
 	return ConfigRateLimit(limiter, "login")
 }
+
+// AIRateLimit AI对话频率限制中间件（使用配置文件）.
+func AIRateLimit(limiter *RateLimiter) gin.HandlerFunc {
+	return ConfigRateLimit(limiter, "ai")
+}
@@ -34,25 +34,35 @@ type AIConversation struct {
 	// 时间信息
 	LastMessageAt *time.Time `gorm:"index" json:"last_message_at"` // 最后消息时间
 
+	// 分支信息
+	CurrentMessageID *uint `json:"current_message_id"` // 当前分支的最后一条消息，新消息接在其后
+
+	// 自动生成的信息
+	AutoTitle        bool   `gorm:"default:false" json:"auto_title"`                   // 标题是否由服务生成，为 true 时首轮对话后更新
+	Summary          string `gorm:"type:text"     json:"summary,omitempty"`            // 早期对话的摘要，作为超出历史窗口部分的上下文
+	SummaryMessageID *uint  `                     json:"summary_message_id,omitempty"` // 摘要涵盖到的最后一条消息
+
 	// 关联数据
 	Messages []AIMessage `gorm:"foreignKey:ConversationID" json:"messages,omitempty"`
 }
 
 // AIMessage AI 对话消息
+// 消息按 ParentID 组成一棵树，从第一条消息到任一条消息的路径是一个分支.
 type AIMessage struct {
 	BaseModel
 
 	// 关联信息
 	ConversationID uint            `gorm:"not null;index"            json:"conversation_id"`
 	Conversation   *AIConversation `gorm:"foreignKey:ConversationID" json:"conversation,omitempty"`
+	ParentID       *uint           `gorm:"index"                     json:"parent_id"` // 上一条消息，为空时是首条消息
 
 	// 消息基本信息
-	Role        string `gorm:"type:varchar(20);not null"       json:"role"`         // 角色：user, assistant, system
+	Role        string `gorm:"type:varchar(20);not null"       json:"role"`         // 角色：user, assistant, system, tool
 	Content     string `gorm:"type:longtext;not null"          json:"content"`      // 消息内容
 	ContentType string `gorm:"type:varchar(20);default:'text'" json:"content_type"` // 内容类型：text, image, file
 
 	// 消息状态
-	Status string `gorm:"type:varchar(20);default:'sent'" json:"status"` // 状态：sent, received, error
+	Status string `gorm:"type:varchar(20);default:'sent'" json:"status"` // 状态：sent, received, error, cancelled
 
 	// Token 统计
 	PromptTokens     int `gorm:"default:0" json:"prompt_tokens"`     // 输入token数
@@ -73,17 +83,36 @@ type AIMessage struct {
 
 	// 元数据
 	Metadata string `gorm:"type:json" json:"metadata,omitempty"` // 额外元数据（JSON格式）
+
+	// 关联数据
+	Attachments []AIAttachment `gorm:"foreignKey:MessageID" json:"attachments,omitempty"` // 随消息发送的图片等附件
+}
+
+// AIAttachment AI 消息附件
+type AIAttachment struct {
+	BaseModel
+
+	// 关联信息
+	MessageID uint `gorm:"not null;index" json:"message_id"`
+
+	// 附件信息
+	Type     string `gorm:"type:varchar(20);not null" json:"type"`             // 类型：image
+	MimeType string `gorm:"type:varchar(100)"         json:"mime_type"`        // MIME 类型，远程图片可能为空
+	URL      string `gorm:"type:text"                 json:"url,omitempty"`    // 远程图片地址，内嵌图片为空
+	Data     string `gorm:"type:longtext"             json:"-"`                // 内嵌图片的 base64 数据，不随消息列表返回
+	Size     int    `gorm:"default:0"                 json:"size"`             // 内嵌图片的字节数
+	Detail   string `gorm:"type:varchar(20)"          json:"detail,omitempty"` // 图片精细度：auto, low, high
 }
 
 // AIUsageStats AI 使用统计
 type AIUsageStats struct {
 	BaseModel
 
-	// 统计维度
-	UserID   uint   `gorm:"not null;index"                   json:"user_id"`
-	Provider string `gorm:"type:varchar(50);not null;index"  json:"provider"`
-	Model    string `gorm:"type:varchar(100);not null;index" json:"model"`
-	Date     string `gorm:"type:date;not null;index"         json:"date"` // 统计日期 YYYY-MM-DD
+	// 统计维度，同一用户、提供商、模型每天一条记录
+	UserID   uint   `gorm:"not null;uniqueIndex:idx_usage_unique,priority:1"                         json:"user_id"`
+	Provider string `gorm:"type:varchar(50);not null;index;uniqueIndex:idx_usage_unique,priority:2"  json:"provider"`
+	Model    string `gorm:"type:varchar(100);not null;index;uniqueIndex:idx_usage_unique,priority:3" json:"model"`
+	Date     string `gorm:"type:date;not null;index;uniqueIndex:idx_usage_unique,priority:4"         json:"date"` // 统计日期 YYYY-MM-DD
 
 	// 统计数据
 	RequestCount     int     `gorm:"default:0"                    json:"request_count"`     // 请求次数
@@ -96,9 +125,6 @@ type AIUsageStats struct {
 	// 性能数据
 	AvgResponseTime int `gorm:"default:0" json:"avg_response_time"` // 平均响应时间（毫秒）
 	ErrorCount      int `gorm:"default:0" json:"error_count"`       // 错误次数
-
-	// 组合索引
-	_ struct{} `gorm:"uniqueIndex:idx_usage_unique,user_id,provider,model,date"`
 }
 
 // AIProviderConfig AI 提供商配置（运行时配置缓存）
@@ -145,13 +171,15 @@ const (
 	MessageRoleUser      = "user"
 	MessageRoleAssistant = "assistant"
 	MessageRoleSystem    = "system"
+	MessageRoleTool      = "tool"
 )
 
 // MessageStatus 消息状态常量
 const (
-	MessageStatusSent     = "sent"
-	MessageStatusReceived = "received"
-	MessageStatusError    = "error"
+	MessageStatusSent      = "sent"
+	MessageStatusReceived  = "received"
+	MessageStatusError     = "error"
+	MessageStatusCancelled = "cancelled" // 用户停止生成，内容为已输出的部分
 )
 
 // ContentType 内容类型常量
@@ -170,6 +198,10 @@ func (AIMessage) TableName() string {
 	return "ai_messages"
 }
 
+func (AIAttachment) TableName() string {
+	return "ai_message_attachments"
+}
+
 func (AIUsageStats) TableName() string {
 	return "ai_usage_stats"
 }
@@ -180,10 +212,11 @@ func (AIProviderConfig) TableName() string {
 
 // 模型方法
 
-// AddMessage 添加消息到对话
+// AddMessage 添加消息到对话，消息接在当前分支的最后一条之后
 func (c *AIConversation) AddMessage(role, content string) *AIMessage {
 	return &AIMessage{
 		ConversationID: c.ID,
+		ParentID:       c.CurrentMessageID,
 		Role:           role,
 		Content:        content,
 		Status:         MessageStatusSent,
@@ -193,7 +226,12 @@ func (c *AIConversation) AddMessage(role, content string) *AIMessage {
 	}
 }
 
-// UpdateStats 更新对话统计
+// SetCurrentMessage 把消息设为当前分支的最后一条，之后添加的消息接在其后
+func (c *AIConversation) SetCurrentMessage(messageID uint) {
+	c.CurrentMessageID = &messageID
+}
+
+// UpdateStats 更新内存中的对话统计，用于返回给调用方
 func (c *AIConversation) UpdateStats(tokenUsage TokenUsage, cost float64) {
 	c.MessageCount++
 	c.TotalTokens += tokenUsage.TotalTokens
@@ -202,6 +240,21 @@ func (c *AIConversation) UpdateStats(tokenUsage TokenUsage, cost float64) {
 	c.LastMessageAt = &now
 }
 
+// Merge 合并同一维度的使用统计，平均响应时间按请求次数加权
+func (s *AIUsageStats) Merge(other *AIUsageStats) {
+	if requests := s.RequestCount + other.RequestCount; requests > 0 {
+		totalTime := s.AvgResponseTime*s.RequestCount + other.AvgResponseTime*other.RequestCount
+		s.AvgResponseTime = totalTime / requests
+	}
+	s.RequestCount += other.RequestCount
+	s.MessageCount += other.MessageCount
+	s.PromptTokens += other.PromptTokens
+	s.CompletionTokens += other.CompletionTokens
+	s.TotalTokens += other.TotalTokens
+	s.TotalCost += other.TotalCost
+	s.ErrorCount += other.ErrorCount
+}
+
 // TokenUsage Token 使用量结构
 type TokenUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
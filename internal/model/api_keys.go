@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+)
+
+// APIKey 用户签发的 API 密钥，用于 OpenAI 兼容接口等服务间调用
+// 只保存密钥的 SHA-256 摘要，明文仅在签发时返回一次.
+type APIKey struct {
+	BaseModel
+
+	UserID uint   `gorm:"not null;index"                        json:"user_id"`
+	Name   string `gorm:"type:varchar(100);not null"            json:"name"`   // 密钥名称
+	Prefix string `gorm:"type:varchar(20);not null"             json:"prefix"` // 密钥前缀，用于识别密钥
+	Hash   string `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`      // 密钥摘要
+
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // 最后使用时间
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`   // 过期时间，为空表示不过期
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`   // 吊销时间
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsActive 检查密钥是否可用（未吊销且未过期）
+func (k *APIKey) IsActive() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || k.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"ai-svc/internal/model"
+	"ai-svc/pkg/database"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AIRepository AI 对话仓储接口
+type AIRepository interface {
+	// 对话相关
+	CreateConversation(conversation *model.AIConversation) error
+	GetConversationBySessionID(userID uint, sessionID string) (*model.AIConversation, error)
+	ListConversations(userID uint, page, size int) ([]*model.AIConversation, int64, error)
+	AddConversationStats(id, currentMessageID uint, messages int, usage model.TokenUsage, cost float64) error
+	UpdateConversationFields(id uint, updates map[string]interface{}) error
+	SetGeneratedTitle(id uint, title string) error
+	SetConversationSummary(id uint, summary string, summaryMessageID uint) error
+	DeleteConversation(id uint) error
+
+	// 消息相关
+	CreateMessage(message *model.AIMessage) error
+	GetMessage(conversationID, messageID uint) (*model.AIMessage, error)
+	GetMessagePath(conversationID, leafID uint, limit int) ([]*model.AIMessage, error)
+	GetMessageTree(conversationID uint) ([]*model.AIMessage, error)
+
+	// 统计相关
+	GetUsageStats(userID uint, startDate, endDate string) ([]*model.AIUsageStats, error)
+	UpsertUsageStats(stats []*model.AIUsageStats) error
+	ListUserConversations(userID uint) ([]*model.AIConversation, error)
+}
+
+// aiRepository AI 对话仓储实现
+type aiRepository struct {
+	db *gorm.DB
+}
+
+// NewAIRepository 创建 AI 对话仓储实例
+func NewAIRepository() AIRepository {
+	return &aiRepository{
+		db: database.GetDB(),
+	}
+}
+
+// CreateConversation 创建对话
+func (r *aiRepository) CreateConversation(conversation *model.AIConversation) error {
+	return r.db.Create(conversation).Error
+}
+
+// GetConversationBySessionID 根据会话ID获取用户的对话
+func (r *aiRepository) GetConversationBySessionID(userID uint, sessionID string) (*model.AIConversation, error) {
+	var conversation model.AIConversation
+	err := r.db.Where("user_id = ? AND session_id = ? AND status <> ?",
+		userID, sessionID, model.ConversationStatusDeleted).
+		First(&conversation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// ListConversations 分页获取用户对话列表
+func (r *aiRepository) ListConversations(userID uint, page, size int) ([]*model.AIConversation, int64, error) {
+	var conversations []*model.AIConversation
+	var total int64
+
+	query := r.db.Model(&model.AIConversation{}).
+		Where("user_id = ? AND status <> ?", userID, model.ConversationStatusDeleted)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * size
+	err := query.Order("COALESCE(last_message_at, created_at) DESC").
+		Offset(offset).
+		Limit(size).
+		Find(&conversations).Error
+
+	return conversations, total, err
+}
+
+// AddConversationStats 累加一条回复的对话统计，并把它设为当前分支的最后一条
+// messages 为上次累加之后新增的消息数，包括用户消息、工具结果和这条回复.
+// 统计在数据库中原子累加且只更新这些列，同一对话并发的回复不会互相覆盖.
+func (r *aiRepository) AddConversationStats(
+	id, currentMessageID uint,
+	messages int,
+	usage model.TokenUsage,
+	cost float64,
+) error {
+	return r.db.Model(&model.AIConversation{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"message_count":      gorm.Expr("message_count + ?", messages),
+		"total_tokens":       gorm.Expr("total_tokens + ?", usage.TotalTokens),
+		"total_cost":         gorm.Expr("total_cost + ?", cost),
+		"last_message_at":    time.Now(),
+		"current_message_id": currentMessageID,
+	}).Error
+}
+
+// UpdateConversationFields 更新对话指定字段
+func (r *aiRepository) UpdateConversationFields(id uint, updates map[string]interface{}) error {
+	return r.db.Model(&model.AIConversation{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// SetGeneratedTitle 保存生成的标题，用户已修改过标题（auto_title 为 false）时不覆盖
+func (r *aiRepository) SetGeneratedTitle(id uint, title string) error {
+	return r.db.Model(&model.AIConversation{}).
+		Where("id = ? AND auto_title = ?", id, true).
+		Updates(map[string]interface{}{"title": title, "auto_title": false}).Error
+}
+
+// SetConversationSummary 保存生成的摘要，已有摘要涵盖到更新的消息时不覆盖
+func (r *aiRepository) SetConversationSummary(id uint, summary string, summaryMessageID uint) error {
+	return r.db.Model(&model.AIConversation{}).
+		Where("id = ? AND (summary_message_id IS NULL OR summary_message_id < ?)", id, summaryMessageID).
+		Updates(map[string]interface{}{"summary": summary, "summary_message_id": summaryMessageID}).Error
+}
+
+// DeleteConversation 删除对话（标记删除状态并软删除）
+func (r *aiRepository) DeleteConversation(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.AIConversation{}).
+			Where("id = ?", id).
+			Update("status", model.ConversationStatusDeleted).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.AIConversation{}, id).Error
+	})
+}
+
+// CreateMessage 创建消息，附件随消息一起保存
+func (r *aiRepository) CreateMessage(message *model.AIMessage) error {
+	return r.db.Create(message).Error
+}
+
+// GetMessage 获取对话中的一条消息
+func (r *aiRepository) GetMessage(conversationID, messageID uint) (*model.AIMessage, error) {
+	var message model.AIMessage
+	err := r.db.Preload("Attachments").
+		Where("conversation_id = ? AND id = ?", conversationID, messageID).
+		First(&message).Error
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetMessagePath 获取从第一条消息到 leafID 的分支路径上最后 limit 条消息（按时间正序），limit<=0 时不限制
+// 沿 parent_id 递归查找，后续消息总是晚于上一条消息创建，按 ID 排序即为路径顺序.
+func (r *aiRepository) GetMessagePath(conversationID, leafID uint, limit int) ([]*model.AIMessage, error) {
+	depth := limit
+	if depth <= 0 {
+		depth = math.MaxInt32
+	}
+
+	var ids []uint
+	err := r.db.Raw(`WITH RECURSIVE path AS (
+			SELECT id, parent_id, 1 AS depth FROM ai_messages
+			WHERE id = ? AND conversation_id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT m.id, m.parent_id, path.depth + 1 FROM ai_messages m
+			JOIN path ON m.id = path.parent_id
+			WHERE path.depth < ? AND m.deleted_at IS NULL
+		)
+		SELECT id FROM path`, leafID, conversationID, depth).
+		Scan(&ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var messages []*model.AIMessage
+	err = r.db.Preload("Attachments").
+		Where("id IN ?", ids).
+		Order("id ASC").
+		Find(&messages).Error
+	return messages, err
+}
+
+// GetMessageTree 获取对话的全部消息（不含附件），用于按 parent_id 构建分支
+func (r *aiRepository) GetMessageTree(conversationID uint) ([]*model.AIMessage, error) {
+	var messages []*model.AIMessage
+	err := r.db.Select("id", "parent_id", "role", "status", "content", "created_at").
+		Where("conversation_id = ?", conversationID).
+		Order("id ASC").
+		Find(&messages).Error
+	return messages, err
+}
+
+// GetUsageStats 获取用户使用统计
+func (r *aiRepository) GetUsageStats(userID uint, startDate, endDate string) ([]*model.AIUsageStats, error) {
+	var stats []*model.AIUsageStats
+	query := r.db.Where("user_id = ?", userID)
+	if startDate != "" {
+		query = query.Where("date >= ?", startDate)
+	}
+	if endDate != "" {
+		query = query.Where("date <= ?", endDate)
+	}
+	err := query.Order("date DESC").Find(&stats).Error
+	return stats, err
+}
+
+// UpsertUsageStats 批量累加使用统计，同一用户、提供商、模型和日期的记录已存在时在原记录上累加
+func (r *aiRepository) UpsertUsageStats(stats []*model.AIUsageStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	// MySQL 按顺序执行赋值，平均响应时间必须在请求次数累加之前计算
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Set{
+			usageAssignment("avg_response_time",
+				"(avg_response_time * request_count + VALUES(avg_response_time) * VALUES(request_count)) / "+
+					"GREATEST(request_count + VALUES(request_count), 1)"),
+			usageAssignment("request_count", "request_count + VALUES(request_count)"),
+			usageAssignment("message_count", "message_count + VALUES(message_count)"),
+			usageAssignment("prompt_tokens", "prompt_tokens + VALUES(prompt_tokens)"),
+			usageAssignment("completion_tokens", "completion_tokens + VALUES(completion_tokens)"),
+			usageAssignment("total_tokens", "total_tokens + VALUES(total_tokens)"),
+			usageAssignment("total_cost", "total_cost + VALUES(total_cost)"),
+			usageAssignment("error_count", "error_count + VALUES(error_count)"),
+			usageAssignment("updated_at", "VALUES(updated_at)"),
+		},
+	}).Create(&stats).Error
+}
+
+// usageAssignment 构建 ON DUPLICATE KEY UPDATE 的赋值表达式
+func usageAssignment(column, expr string) clause.Assignment {
+	return clause.Assignment{Column: clause.Column{Name: column}, Value: gorm.Expr(expr)}
+}
+
+// ListUserConversations 获取用户全部有效对话（用于统计）
+func (r *aiRepository) ListUserConversations(userID uint) ([]*model.AIConversation, error) {
+	var conversations []*model.AIConversation
+	err := r.db.Where("user_id = ? AND status <> ?", userID, model.ConversationStatusDeleted).
+		Find(&conversations).Error
+	return conversations, err
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"ai-svc/internal/model"
+	"ai-svc/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository API 密钥仓储接口.
+type APIKeyRepository interface {
+	Create(key *model.APIKey) error
+	GetByHash(hash string) (*model.APIKey, error)
+	ListByUser(userID uint) ([]*model.APIKey, error)
+	Revoke(userID, id uint) (bool, error)
+	UpdateLastUsed(id uint, usedAt time.Time) error
+}
+
+// apiKeyRepository API 密钥仓储实现.
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository 创建 API 密钥仓储实例.
+func NewAPIKeyRepository() APIKeyRepository {
+	return &apiKeyRepository{
+		db: database.GetDB(),
+	}
+}
+
+// Create 创建密钥.
+func (r *apiKeyRepository) Create(key *model.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+// GetByHash 根据密钥摘要获取密钥.
+func (r *apiKeyRepository) GetByHash(hash string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.db.Where("hash = ?", hash).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListByUser 获取用户的全部密钥（按创建时间倒序）.
+func (r *apiKeyRepository) ListByUser(userID uint) ([]*model.APIKey, error) {
+	var keys []*model.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke 吊销用户的密钥，返回是否有密钥被吊销.
+func (r *apiKeyRepository) Revoke(userID, id uint) (bool, error) {
+	result := r.db.Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateLastUsed 更新密钥最后使用时间.
+func (r *apiKeyRepository) UpdateLastUsed(id uint, usedAt time.Time) error {
+	return r.db.Model(&model.APIKey{}).Where("id = ?", id).Update("last_used_at", usedAt).Error
+}
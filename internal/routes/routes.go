@@ -1,18 +1,26 @@
 package routes
 
 import (
+	"ai-svc/internal/config"
 	"ai-svc/internal/controller"
 	"ai-svc/internal/middleware"
 	"ai-svc/internal/repository"
 	"ai-svc/internal/service"
+	"ai-svc/pkg/cache"
+	"ai-svc/pkg/contentfilter"
 	"ai-svc/pkg/response"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRoutes 设置路由.
-func SetupRoutes() *gin.Engine {
+// SetupRoutes 设置路由，同时返回 AI 服务，服务关闭时需调用其 Close.
+func SetupRoutes(
+	aiRegistry *service.ProviderRegistry,
+	contentFilter *contentfilter.Filter,
+	responseCache cache.Store,
+	usageAggregator *service.UsageAggregator,
+) (*gin.Engine, service.AIService) {
 	// 创建Gin引擎
 	router := gin.New()
 
@@ -37,6 +45,8 @@ func SetupRoutes() *gin.Engine {
 	deviceRepo := repository.NewDeviceRepository()
 	behaviorLogRepo := repository.NewUserBehaviorLogRepository() // 新增用户行为日志仓储
 	messageRepo := repository.NewMessageRepository()             // 新增消息仓储
+	aiRepo := repository.NewAIRepository()
+	apiKeyRepo := repository.NewAPIKeyRepository()
 
 	smsService := service.NewSMSService(smsRepo)
 	deviceService := service.NewDeviceService(deviceRepo)
@@ -44,6 +54,14 @@ func SetupRoutes() *gin.Engine {
 	loginLogService := service.NewLoginLogService(behaviorLogRepo, userRepo, locationService)   // 新增登录日志服务
 	userService := service.NewUserService(userRepo, smsService, deviceService, loginLogService) // 修改用户服务，添加登录日志服务
 	messageService := service.NewMessageService(messageRepo, userRepo)                          // 新增消息服务
+	quotaManager := service.NewQuotaManager(config.AppConfig.AI.Features.Quota, userRepo, aiRepo)
+	toolRegistry := service.NewBuiltinToolRegistry(config.AppConfig.AI.Features.Tools, messageService, deviceService)
+	streamHub := service.NewStreamHub(config.AppConfig.AI.Features.StreamResume)
+	aiService := service.NewAIService(
+		aiRepo, &config.AppConfig.AI, aiRegistry, contentFilter, responseCache, usageAggregator, quotaManager,
+		toolRegistry, streamHub,
+	)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
 	userController := controller.NewUserController(userService, smsService)
 	smsController := controller.NewSMSController(smsService)
 	messageController := controller.NewMessageController(messageService) // 新增消息控制器
@@ -51,6 +69,10 @@ func SetupRoutes() *gin.Engine {
 	// 创建频率限制器
 	rateLimiter := middleware.NewRateLimiter()
 
+	aiController := controller.NewAIController(aiService, &config.AppConfig.AI, rateLimiter)
+	apiKeyController := controller.NewAPIKeyController(apiKeyService)
+	openAIController := controller.NewOpenAIController(aiService)
+
 	// API路由组
 	api := router.Group("/api/v1")
 	{
@@ -110,6 +132,23 @@ func SetupRoutes() *gin.Engine {
 				middleware.ConfigRateLimit(rateLimiter, "login"), // 使用登录限流作为严格限流
 				userController.KickDevices,
 			)
+
+			// API Key 管理接口（用于 OpenAI 兼容接口）
+			auth.GET(
+				"/api-keys",
+				middleware.APIRateLimit(rateLimiter),
+				apiKeyController.ListAPIKeys,
+			)
+			auth.POST(
+				"/api-keys",
+				middleware.ConfigRateLimit(rateLimiter, "login"),
+				apiKeyController.CreateAPIKey,
+			)
+			auth.DELETE(
+				"/api-keys/:id",
+				middleware.APIRateLimit(rateLimiter),
+				apiKeyController.RevokeAPIKey,
+			)
 		}
 
 		// 消息管理接口
@@ -173,6 +212,39 @@ func SetupRoutes() *gin.Engine {
 			)
 		}
 
+		// AI 对话接口（使用增强认证和AI专用限流）
+		ai := api.Group("/ai")
+		ai.Use(middleware.JWTWithDeviceAuth())
+		ai.Use(middleware.AIRateLimit(rateLimiter))
+		{
+			// 发送聊天消息（支持流式响应）
+			ai.POST("/chat", aiController.Chat)
+
+			// 对话管理
+			ai.POST("/conversations", aiController.CreateConversation)
+			ai.GET("/conversations", aiController.GetConversations)
+			ai.GET("/conversations/:session_id", aiController.GetConversation)
+			ai.GET("/conversations/:session_id/messages", aiController.GetMessages)
+			ai.GET("/conversations/:session_id/stream", aiController.ResumeStream)
+			ai.DELETE("/conversations/:session_id", aiController.DeleteConversation)
+
+			// 对话分支
+			ai.GET("/conversations/:session_id/branches", aiController.ListBranches)
+			ai.PUT("/conversations/:session_id/branches/current", aiController.SwitchBranch)
+			ai.POST("/conversations/:session_id/messages/:message_id/regenerate", aiController.RegenerateMessage)
+			ai.POST("/conversations/:session_id/messages/:message_id/fork", aiController.ForkMessage)
+
+			// 停止生成
+			ai.POST("/generations/:id/cancel", aiController.CancelGeneration)
+
+			// WebSocket 对话（握手请求使用相同的认证）
+			ai.GET("/ws", aiController.ChatWebSocket)
+
+			// 提供商与使用统计
+			ai.GET("/providers", aiController.ListProviders)
+			ai.GET("/usage", aiController.GetUsageStats)
+		}
+
 		// 设备管理接口（使用增强认证）
 		devices := api.Group("/devices")
 		devices.Use(middleware.JWTWithDeviceAuth())
@@ -268,5 +340,14 @@ func SetupRoutes() *gin.Engine {
 		)
 	}
 
-	return router
+	// OpenAI 兼容接口（API Key 或 JWT+设备认证，使用AI专用限流）
+	v1 := router.Group("/v1")
+	v1.Use(middleware.OpenAIAuth(apiKeyService, service.APIKeyPrefix))
+	v1.Use(middleware.AIRateLimit(rateLimiter))
+	{
+		v1.POST("/chat/completions", openAIController.ChatCompletions)
+		v1.GET("/models", openAIController.ListModels)
+	}
+
+	return router, aiService
 }
@@ -0,0 +1,1265 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/internal/repository"
+	"ai-svc/pkg/cache"
+	"ai-svc/pkg/contentfilter"
+	"ai-svc/pkg/jsonschema"
+	"ai-svc/pkg/logger"
+	"ai-svc/pkg/tokenizer"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultConversationMaxTokens 对话默认的最大输出token数
+	defaultConversationMaxTokens = 4096
+
+	// conversationTitleMaxRunes 自动生成标题的最大字符数
+	conversationTitleMaxRunes = 30
+
+	// defaultConversationTitle 创建对话时未指定标题的临时标题
+	defaultConversationTitle = "新对话"
+
+	// defaultHistoryMessages 未配置时默认携带的历史消息数
+	defaultHistoryMessages = 20
+)
+
+// aiService AI 服务实现
+type aiService struct {
+	repo     repository.AIRepository
+	config   *config.AIConfig
+	registry *ProviderRegistry
+	filter   *contentfilter.Filter // 内容过滤器，为 nil 时不过滤
+	cache    cache.Store           // 回复缓存，为 nil 时不缓存
+	usage    *UsageAggregator      // 每日使用统计，为 nil 时不统计
+	quota    *QuotaManager         // 用量配额，为 nil 时不限制
+	tools    *ToolRegistry         // 服务端工具，为 nil 时不执行工具调用
+	streams  *StreamHub            // 流式回复缓存，为 nil 时不支持断线重连
+
+	generations generationRegistry // 进行中的流式回复，用于停止生成
+	summaries   summaryTasks       // 后台生成标题和摘要的任务
+}
+
+// NewAIService 创建 AI 服务实例
+func NewAIService(
+	repo repository.AIRepository,
+	cfg *config.AIConfig,
+	registry *ProviderRegistry,
+	filter *contentfilter.Filter,
+	responseCache cache.Store,
+	usage *UsageAggregator,
+	quota *QuotaManager,
+	tools *ToolRegistry,
+	streams *StreamHub,
+) AIService {
+	return &aiService{
+		repo:     repo,
+		config:   cfg,
+		registry: registry,
+		filter:   filter,
+		cache:    responseCache,
+		usage:    usage,
+		quota:    quota,
+		tools:    tools,
+		streams:  streams,
+	}
+}
+
+// Close 不再启动新的后台任务，并等待进行中的标题和摘要生成结束
+// 它们的用量计入使用统计，应在关闭 UsageAggregator 之前调用.
+func (s *aiService) Close() {
+	s.summaries.close()
+}
+
+// chatTarget 一次聊天请求解析出的目标提供商和模型
+type chatTarget struct {
+	providerName string
+	provider     AIProvider
+	model        config.ModelConfig
+
+	// fallbackFrom 故障转移前请求的目标，未发生故障转移时为 nil
+	fallbackFrom *chatTarget
+}
+
+// replyMetadata 在回复元数据中记录故障转移信息
+func (t *chatTarget) replyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	if t.fallbackFrom != nil {
+		metadata["requested_provider"] = t.fallbackFrom.providerName
+		metadata["requested_model"] = t.fallbackFrom.model.Name
+	}
+	return metadata
+}
+
+// CreateConversation 创建对话，未指定标题时在首轮对话后自动生成
+func (s *aiService) CreateConversation(
+	ctx context.Context,
+	userID uint,
+	title, provider, modelName string,
+) (*model.AIConversation, error) {
+	autoTitle := title == ""
+	if autoTitle {
+		title = defaultConversationTitle
+	}
+	return s.createConversation(userID, title, autoTitle, provider, modelName)
+}
+
+// createConversation 创建对话，autoTitle 表示标题由服务生成
+func (s *aiService) createConversation(
+	userID uint,
+	title string,
+	autoTitle bool,
+	provider, modelName string,
+) (*model.AIConversation, error) {
+	if provider == "" {
+		provider = s.config.DefaultProvider
+	}
+
+	target, err := s.resolveTarget(provider, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	conversation := &model.AIConversation{
+		UserID:      userID,
+		Title:       title,
+		AutoTitle:   autoTitle,
+		Provider:    target.providerName,
+		Model:       target.model.Name,
+		SessionID:   uuid.New().String(),
+		Status:      model.ConversationStatusActive,
+		Temperature: target.model.Temperature,
+		MaxTokens:   conversationMaxTokens(target.model),
+	}
+
+	if err := s.repo.CreateConversation(conversation); err != nil {
+		logger.Error("创建AI对话失败", map[string]any{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		return nil, errors.New("创建对话失败")
+	}
+
+	return conversation, nil
+}
+
+// GetConversation 获取对话
+func (s *aiService) GetConversation(ctx context.Context, userID uint, sessionID string) (*model.AIConversation, error) {
+	conversation, err := s.repo.GetConversationBySessionID(userID, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("对话不存在")
+		}
+		logger.Error("查询AI对话失败", map[string]any{
+			"user_id":    userID,
+			"session_id": sessionID,
+			"error":      err.Error(),
+		})
+		return nil, errors.New("获取对话失败")
+	}
+	return conversation, nil
+}
+
+// ListConversations 获取对话列表
+func (s *aiService) ListConversations(
+	ctx context.Context,
+	userID uint,
+	page, size int,
+) ([]*model.AIConversation, int64, error) {
+	page, size = normalizePage(page, size, 20)
+	return s.repo.ListConversations(userID, page, size)
+}
+
+// UpdateConversation 更新对话
+func (s *aiService) UpdateConversation(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	updates map[string]interface{},
+) error {
+	conversation, err := s.GetConversation(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// 只允许更新部分字段
+	allowed := map[string]bool{
+		"title":       true,
+		"status":      true,
+		"is_public":   true,
+		"temperature": true,
+		"max_tokens":  true,
+	}
+	filtered := make(map[string]interface{}, len(updates))
+	for key, value := range updates {
+		if !allowed[key] {
+			return fmt.Errorf("不支持更新字段: %s", key)
+		}
+		filtered[key] = value
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	// 用户修改过的标题不再自动生成
+	if _, exists := filtered["title"]; exists {
+		filtered["auto_title"] = false
+	}
+
+	return s.repo.UpdateConversationFields(conversation.ID, filtered)
+}
+
+// DeleteConversation 删除对话
+func (s *aiService) DeleteConversation(ctx context.Context, userID uint, sessionID string) error {
+	conversation, err := s.GetConversation(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteConversation(conversation.ID)
+}
+
+// SendMessage 发送消息并等待完整回复
+func (s *aiService) SendMessage(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	content string,
+	options *ChatOptions,
+) (*model.AIMessage, error) {
+	if options == nil {
+		options = &ChatOptions{}
+	}
+	output, err := newStructuredOutput(options.ResponseFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, target, req, reservation, err := s.prepareChat(ctx, userID, sessionID, content, options)
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.Release()
+
+	// 用户消息已保存并计入对话统计
+	counts := newUsageCounts(conversation.MessageCount - 1)
+	return s.generateReply(ctx, conversation, target, req, options, output, counts)
+}
+
+// generateReply 请求模型并保存回复，执行模型请求的工具调用，结构化输出不符合要求时请求模型修正
+func (s *aiService) generateReply(
+	ctx context.Context,
+	conversation *model.AIConversation,
+	target *chatTarget,
+	req *ChatRequest,
+	options *ChatOptions,
+	output *structuredOutput,
+	counts *usageCounts,
+) (*model.AIMessage, error) {
+	start := time.Now()
+	cacheKey := ""
+	// 工具结果随时间变化，启用服务端工具时不使用缓存；结构化输出需要校验回复，也不使用缓存
+	if s.tools == nil && output == nil && s.shouldUseCache(req, options) {
+		cacheKey = responseCacheKey(target.providerName, req)
+		if cached := s.getCachedReply(ctx, cacheKey); cached != nil {
+			return s.saveCachedReply(conversation, cached, req, int(time.Since(start).Milliseconds()), counts)
+		}
+	}
+
+	// 模型请求调用工具时，执行工具并把结果发回模型，直到得到最终回答
+	for iteration := 1; ; iteration++ {
+		resp, answered, err := s.chatWithFailover(ctx, target, req)
+		elapsed := int(time.Since(start).Milliseconds())
+		if err != nil {
+			s.saveFailedReply(conversation, answered, req, err, elapsed, counts)
+			return nil, err
+		}
+		target = answered
+		if cacheKey != "" {
+			s.storeCachedReply(ctx, cacheKey, resp, target)
+		}
+
+		metadata := map[string]interface{}{"response_id": resp.ID}
+		replyContent, finishReason := s.filterReply(resp.GetLastAssistantMessage(), firstFinishReason(resp), metadata)
+		var toolCalls []ToolCall
+		if len(resp.Choices) > 0 {
+			toolCalls = s.pendingToolCalls(req, finishReason, resp.Choices[0].Message.ToolCalls)
+		}
+		if len(toolCalls) > 0 {
+			metadata["tool_calls"] = toolCalls
+		}
+		var outputErrors jsonschema.Errors
+		if output != nil && len(toolCalls) == 0 {
+			if replyContent, outputErrors = output.check(replyContent); len(outputErrors) > 0 {
+				metadata["output_errors"] = outputErrors.Messages()
+			}
+		}
+
+		reply := conversation.AddMessage(model.MessageRoleAssistant, replyContent)
+		reply.Status = model.MessageStatusReceived
+		reply.Provider = target.providerName
+		reply.Model = target.model.Name
+		reply.Temperature = requestTemperature(req)
+		reply.FinishReason = finishReason
+		reply.PromptTokens = resp.Usage.PromptTokens
+		reply.CompletionTokens = resp.Usage.CompletionTokens
+		reply.TotalTokens = resp.Usage.TotalTokens
+		reply.Cost = target.model.CalculatePrice(resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+		reply.ResponseTime = elapsed
+		reply.Metadata = encodeMetadata(target.replyMetadata(metadata))
+		// 不符合格式要求的回复保存为失败消息，不作为后续对话的上下文
+		if len(outputErrors) > 0 {
+			reply.Status = model.MessageStatusError
+		}
+
+		if err := s.saveReply(conversation, reply, resp.Usage, counts); err != nil {
+			return nil, err
+		}
+		if len(outputErrors) > 0 {
+			if !output.repair(req, replyContent, outputErrors) {
+				return nil, invalidOutputError(outputErrors)
+			}
+			if err := checkTokenBudget(req, target.model); err != nil {
+				return nil, err
+			}
+			start = time.Now()
+			continue
+		}
+		if len(toolCalls) == 0 {
+			return reply, nil
+		}
+
+		if err := s.runToolCalls(ctx, conversation, target, req, replyContent, toolCalls, iteration); err != nil {
+			return nil, err
+		}
+		start = time.Now()
+	}
+}
+
+// SendMessageStream 发送消息并以流式方式返回回复
+// 启用流式回复缓存时，回复在后台生成，客户端断开后继续生成并保存，可通过 ResumeMessageStream 重新接收.
+func (s *aiService) SendMessageStream(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	content string,
+	options *ChatOptions,
+) (*ChatStream, error) {
+	if options == nil {
+		options = &ChatOptions{}
+	}
+	if err := rejectStreamingResponseFormat(options.ResponseFormat); err != nil {
+		return nil, err
+	}
+
+	conversation, target, req, reservation, err := s.prepareChat(ctx, userID, sessionID, content, options)
+	if err != nil {
+		return nil, err
+	}
+	return s.startStream(ctx, conversation, target, req, reservation, newUsageCounts(conversation.MessageCount-1))
+}
+
+// startStream 建立流式连接并在后台转发和保存回复，结束后释放配额预占
+func (s *aiService) startStream(
+	ctx context.Context,
+	conversation *model.AIConversation,
+	target *chatTarget,
+	req *ChatRequest,
+	reservation *quotaReservation,
+	counts *usageCounts,
+) (*ChatStream, error) {
+	req.Stream = true
+
+	generation := s.streams.newGeneration(ctx, conversation.UserID, conversation.SessionID)
+	start := time.Now()
+	upstream, answered, cancel, err := s.openStream(generation.ctx, target, req)
+	if err != nil {
+		generation.cancel(nil)
+		s.saveFailedReply(conversation, answered, req, err, int(time.Since(start).Milliseconds()), counts)
+		reservation.Release()
+		return nil, err
+	}
+
+	s.generations.register(generation)
+	s.streams.register(generation)
+	go func() {
+		defer reservation.Release()
+		defer generation.finish()
+		s.relayStream(generation.ctx, cancel, conversation, answered, req, upstream, generation.publish, start, counts)
+	}()
+
+	return newChatStream(ctx, generation, 0), nil
+}
+
+// ResumeMessageStream 重新接收对话最近一次的流式回复，从 lastEventID 之后的事件开始
+// 回复仍在生成时继续接收后续事件，已结束时只补发剩余事件.
+func (s *aiService) ResumeMessageStream(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	lastEventID int64,
+) (*ChatStream, error) {
+	generation := s.streams.find(userID, sessionID)
+	if generation == nil {
+		return nil, errors.New("没有可恢复的流式回复")
+	}
+	return newChatStream(ctx, generation, lastEventID), nil
+}
+
+// CancelGeneration 停止生成，取消上游请求，已输出的部分保存为已取消的回复，只按已生成的 token 计费
+func (s *aiService) CancelGeneration(ctx context.Context, userID uint, generationID string) error {
+	generation := s.generations.lookup(userID, generationID)
+	if generation == nil {
+		return ErrGenerationNotFound
+	}
+	if !generation.stop() {
+		return ErrGenerationFinished
+	}
+	return nil
+}
+
+// GetMessages 分页获取对话当前分支上的消息（按时间正序）
+// 只包含从第一条消息到 current_message_id 的路径，其他分支的消息需切换分支后获取.
+func (s *aiService) GetMessages(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	page, size int,
+) ([]*model.AIMessage, error) {
+	conversation, err := s.GetConversation(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.CurrentMessageID == nil {
+		return []*model.AIMessage{}, nil
+	}
+
+	path, err := s.repo.GetMessagePath(conversation.ID, *conversation.CurrentMessageID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	page, size = normalizePage(page, size, 50)
+	start := (page - 1) * size
+	if start >= len(path) {
+		return []*model.AIMessage{}, nil
+	}
+	return path[start:min(start+size, len(path))], nil
+}
+
+// ListProviders 列出所有提供商
+func (s *aiService) ListProviders(ctx context.Context) ([]ProviderInfo, error) {
+	names := s.registry.Names()
+	providers := make([]ProviderInfo, 0, len(names))
+	for _, name := range names {
+		if providerCfg, exists := s.registry.Config(name); exists {
+			providers = append(providers, s.buildProviderInfo(ctx, name, providerCfg))
+		}
+	}
+	return providers, nil
+}
+
+// GetProvider 获取指定提供商信息
+func (s *aiService) GetProvider(ctx context.Context, name string) (ProviderInfo, error) {
+	providerCfg, exists := s.registry.Config(name)
+	if !exists {
+		return ProviderInfo{}, &APIError{
+			Code:    ErrorCodeInvalidProvider,
+			Message: fmt.Sprintf("提供商不存在: %s", name),
+		}
+	}
+	return s.buildProviderInfo(ctx, name, providerCfg), nil
+}
+
+// GetUsageStats 获取使用统计
+func (s *aiService) GetUsageStats(
+	ctx context.Context,
+	userID uint,
+	startDate, endDate string,
+) ([]*model.AIUsageStats, error) {
+	return s.repo.GetUsageStats(userID, startDate, endDate)
+}
+
+// GetConversationStats 获取对话统计
+func (s *aiService) GetConversationStats(ctx context.Context, userID uint) (*ConversationStats, error) {
+	conversations, err := s.repo.ListUserConversations(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ConversationStats{
+		ProviderStats: make(map[string]*ProviderStats),
+	}
+	for _, conversation := range conversations {
+		stats.TotalConversations++
+		stats.TotalMessages += conversation.MessageCount
+		stats.TotalTokens += conversation.TotalTokens
+		stats.TotalCost += conversation.TotalCost
+
+		providerStats, exists := stats.ProviderStats[conversation.Provider]
+		if !exists {
+			providerStats = &ProviderStats{}
+			stats.ProviderStats[conversation.Provider] = providerStats
+		}
+		providerStats.Conversations++
+		providerStats.Messages += conversation.MessageCount
+		providerStats.Tokens += conversation.TotalTokens
+		providerStats.Cost += conversation.TotalCost
+	}
+
+	return stats, nil
+}
+
+// 私有方法
+
+// prepareChat 准备聊天：获取或创建对话、解析目标模型、预占配额、保存用户消息并构建请求
+// 用户消息接在当前分支末尾，指定 ForkFrom 时从该消息开始新的分支.
+// 返回的配额预占需要在请求结束后释放.
+func (s *aiService) prepareChat(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	content string,
+	options *ChatOptions,
+) (*model.AIConversation, *chatTarget, *ChatRequest, *quotaReservation, error) {
+	if content == "" {
+		return nil, nil, nil, nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: "消息内容不能为空",
+		}
+	}
+	if len(content) > maxMessageContentBytes {
+		return nil, nil, nil, nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("消息内容过长，最多 %d KB", maxMessageContentBytes/1024),
+		}
+	}
+
+	content, filterMetadata, err := s.filterInput(content)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	conversation, err := s.getOrCreateConversation(ctx, userID, sessionID, content, options)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	parentID, err := s.forkParent(conversation, options.ForkFrom)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	latest := Message{
+		Role:    model.MessageRoleUser,
+		Content: content,
+		Parts:   buildContentParts(content, options.Images),
+	}
+	target, req, reservation, err := s.prepareRequest(conversation, parentID, latest, options)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	userMessage := conversation.AddMessage(model.MessageRoleUser, content)
+	userMessage.ParentID = parentID
+	userMessage.Provider = target.providerName
+	userMessage.Model = target.model.Name
+	userMessage.Temperature = requestTemperature(req)
+	userMessage.Metadata = encodeMetadata(filterMetadata)
+	if userMessage.Attachments = attachmentsFromParts(latest.Parts); len(userMessage.Attachments) > 0 {
+		userMessage.ContentType = model.ContentTypeImage
+	}
+	if err := s.repo.CreateMessage(userMessage); err != nil {
+		logger.Error("保存用户消息失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"error":           err.Error(),
+		})
+		reservation.Release()
+		return nil, nil, nil, nil, errors.New("保存消息失败")
+	}
+	conversation.SetCurrentMessage(userMessage.ID)
+	conversation.UpdateStats(model.TokenUsage{}, 0)
+
+	return conversation, target, req, reservation, nil
+}
+
+// prepareRequest 解析目标模型，加载 parentID 所在分支的历史，构建请求并预占配额
+func (s *aiService) prepareRequest(
+	conversation *model.AIConversation,
+	parentID *uint,
+	latest Message,
+	options *ChatOptions,
+) (*chatTarget, *ChatRequest, *quotaReservation, error) {
+	providerName, modelName := conversation.Provider, conversation.Model
+	if options.Provider != "" && options.Provider != conversation.Provider {
+		providerName, modelName = options.Provider, ""
+	}
+	if options.Model != "" {
+		modelName = options.Model
+	}
+
+	target, err := s.resolveTarget(providerName, modelName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	history, err := s.loadHistory(conversation, parentID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := s.validateImages([]Message{latest}, target.model); err != nil {
+		return nil, nil, nil, err
+	}
+
+	req := s.buildChatRequest(conversation, target, history, latest, options, conversation.UserID)
+	if err := req.ValidateMessages(); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := checkTokenBudget(req, target.model); err != nil {
+		return nil, nil, nil, err
+	}
+	reservation, err := s.reserveQuota(conversation.UserID, target, req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return target, req, reservation, nil
+}
+
+// getOrCreateConversation 获取已有对话，会话ID为空时自动创建
+func (s *aiService) getOrCreateConversation(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	content string,
+	options *ChatOptions,
+) (*model.AIConversation, error) {
+	if sessionID != "" {
+		return s.GetConversation(ctx, userID, sessionID)
+	}
+	// 先以消息开头作为标题，开启自动生成时在首轮对话后更新
+	return s.createConversation(userID, truncateTitle(content), true, options.Provider, options.Model)
+}
+
+// resolveTarget 根据提供商和模型名称解析聊天目标
+func (s *aiService) resolveTarget(providerName, modelName string) (*chatTarget, error) {
+	if providerName == "" {
+		providerName = s.config.DefaultProvider
+	}
+
+	providerCfg, exists := s.registry.Config(providerName)
+	if !exists || !providerCfg.Enabled {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidProvider,
+			Message: fmt.Sprintf("提供商不存在或未启用: %s", providerName),
+		}
+	}
+
+	provider, exists := s.registry.Provider(providerName)
+	if !exists {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidProvider,
+			Message: fmt.Sprintf("提供商未初始化: %s", providerName),
+		}
+	}
+
+	var modelCfg config.ModelConfig
+	if modelName == "" {
+		modelCfg, exists = providerCfg.GetDefaultModel()
+	} else {
+		modelCfg, exists = providerCfg.GetModel(modelName)
+	}
+	if !exists {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidModel,
+			Message: fmt.Sprintf("提供商 %s 不支持模型: %s", providerName, modelName),
+		}
+	}
+
+	return &chatTarget{
+		providerName: providerName,
+		provider:     provider,
+		model:        modelCfg,
+	}, nil
+}
+
+// loadHistory 加载分支上截至 leafID 的历史消息，leafID 为空时没有历史
+func (s *aiService) loadHistory(conversation *model.AIConversation, leafID *uint) ([]*model.AIMessage, error) {
+	history := s.config.Features.History
+	if !history.Enabled || leafID == nil {
+		return nil, nil
+	}
+
+	limit := s.historyMaxMessages()
+	// 开启摘要时多加载一些，超出窗口的部分用于生成摘要
+	if history.Summarize {
+		limit *= 2
+	}
+	// 已生成的摘要涵盖到的消息需要在加载范围内
+	if summarizer := s.config.Features.Summarizer; summarizer.Enabled && summarizer.Interval > 0 {
+		limit = max(limit, s.summaryLookback())
+	}
+
+	messages, err := s.repo.GetMessagePath(conversation.ID, *leafID, limit)
+	if err != nil {
+		logger.Error("加载对话历史失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"error":           err.Error(),
+		})
+		return nil, errors.New("加载对话历史失败")
+	}
+	return messages, nil
+}
+
+// historyWindow 根据配置和目标模型确定历史窗口
+// token 预算取配置值和模型上下文长度扣除输出预留后较小的一个.
+func (s *aiService) historyWindow(target *chatTarget, maxTokens *int) historyWindow {
+	history := s.config.Features.History
+
+	window := historyWindow{
+		counter:     tokenizerFor(target.model),
+		maxMessages: s.historyMaxMessages(),
+		maxTokens:   history.MaxTokens,
+		summarize:   history.Summarize,
+	}
+	if budget := promptTokenBudget(target.model, maxTokens); budget > 0 &&
+		(window.maxTokens <= 0 || budget < window.maxTokens) {
+		window.maxTokens = budget
+	}
+	return window
+}
+
+// historyMaxMessages 获取历史窗口最多携带的消息数
+func (s *aiService) historyMaxMessages() int {
+	if maxMessages := s.config.Features.History.MaxMessages; maxMessages > 0 {
+		return maxMessages
+	}
+	return defaultHistoryMessages
+}
+
+// buildChatRequest 构建发送给提供商的聊天请求
+func (s *aiService) buildChatRequest(
+	conversation *model.AIConversation,
+	target *chatTarget,
+	history []*model.AIMessage,
+	latest Message,
+	options *ChatOptions,
+	userID uint,
+) *ChatRequest {
+	temperature := options.Temperature
+	if temperature == nil && conversation.Temperature > 0 {
+		value := conversation.Temperature
+		temperature = &value
+	}
+	maxTokens := options.MaxTokens
+	if maxTokens == nil && conversation.MaxTokens > 0 {
+		value := conversation.MaxTokens
+		maxTokens = &value
+	}
+
+	// 已生成摘要的早期消息以摘要代替
+	window := s.historyWindow(target, maxTokens)
+	history, summary := summarizedHistory(conversation, history, &window)
+	built := buildContextMessages(options.SystemPrompt, history, latest, window)
+	if summary != nil {
+		built.addSummary(*summary, window, options.SystemPrompt != "")
+	}
+	if built.DroppedMessages > 0 {
+		logger.Debug("对话历史超出窗口，已裁剪", map[string]any{
+			"conversation_id":  conversation.ID,
+			"dropped_messages": built.DroppedMessages,
+			"summarized":       built.Summarized,
+			"estimated_tokens": built.EstimatedTokens,
+		})
+	}
+
+	req := NewChatRequest(target.model.Name, built.Messages)
+	req.User = fmt.Sprintf("%d", userID)
+	req.SetParameters(temperature, maxTokens)
+	if s.tools != nil {
+		req.Tools = s.tools.Definitions()
+	}
+	applyResponseFormat(req, options.ResponseFormat, target.model)
+
+	return req
+}
+
+// checkTokenBudget 发送前按模型上下文长度检查 token 预算
+// 提示词本身超出上限时拒绝请求；提示词与最大输出之和超出时下调 max_tokens.
+func checkTokenBudget(req *ChatRequest, modelCfg config.ModelConfig) error {
+	limit := modelCfg.MaxTokens
+	if limit <= 0 {
+		return nil
+	}
+
+	promptTokens := estimateRequestTokens(tokenizerFor(modelCfg), req)
+	if promptTokens >= limit {
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("消息过长：预计 %d tokens，超出模型上限 %d", promptTokens, limit),
+		}
+	}
+
+	if req.MaxTokens != nil && promptTokens+*req.MaxTokens > limit {
+		remaining := limit - promptTokens
+		req.MaxTokens = &remaining
+	}
+	return nil
+}
+
+// promptTokenBudget 计算提示词可用的 token 数：模型上下文长度扣除输出预留
+// 输出预留最多占上下文的一半，避免较大的 max_tokens 挤掉全部历史.
+func promptTokenBudget(modelCfg config.ModelConfig, maxTokens *int) int {
+	if modelCfg.MaxTokens <= 0 {
+		return 0
+	}
+
+	reserve := 0
+	if maxTokens != nil && *maxTokens > 0 {
+		reserve = min(*maxTokens, modelCfg.MaxTokens/2)
+	}
+	return modelCfg.MaxTokens - reserve
+}
+
+// tokenizerFor 获取模型的 token 计数器，优先使用配置指定的编码
+func tokenizerFor(modelCfg config.ModelConfig) tokenizer.Tokenizer {
+	if modelCfg.Tokenizer != "" {
+		if counter, err := tokenizer.Get(modelCfg.Tokenizer); err == nil {
+			return counter
+		}
+	}
+	return tokenizer.ForModel(modelCfg.Name)
+}
+
+// openStream 建立流式连接，返回的 cancel 用于提前结束上游请求（如回复被内容过滤拦截）
+// 建立失败时上游请求已结束，cancel 可以安全地重复调用.
+func (s *aiService) openStream(
+	ctx context.Context,
+	target *chatTarget,
+	req *ChatRequest,
+) (<-chan *ChatStreamResponse, *chatTarget, context.CancelFunc, error) {
+	upstreamCtx, cancel := context.WithCancel(ctx)
+	upstream, answered, err := s.chatStreamWithFailover(upstreamCtx, target, req)
+	if err != nil {
+		cancel()
+		return nil, answered, cancel, err
+	}
+	return upstream, answered, cancel, nil
+}
+
+// relayStream 转发提供商的流式响应，并在结束后保存回复
+// 回复被内容过滤拦截或上下文取消时，已输出的部分仍会保存.
+// 模型请求调用工具时，执行工具后继续请求模型，各轮的增量内容依次转发，结束标记携带各轮的合计用量.
+func (s *aiService) relayStream(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	conversation *model.AIConversation,
+	target *chatTarget,
+	req *ChatRequest,
+	upstream <-chan *ChatStreamResponse,
+	send func(*ChatStreamResponse) bool,
+	start time.Time,
+	counts *usageCounts,
+) {
+	defer func() { cancel() }()
+
+	var totalUsage model.TokenUsage
+	for iteration := 1; ; iteration++ {
+		result := s.forwardStream(ctx, cancel, target, upstream, send)
+		if result.err != nil {
+			s.saveFailedReply(conversation, target, req, result.err, int(time.Since(start).Milliseconds()), counts)
+			return
+		}
+
+		toolCalls := s.pendingToolCalls(req, result.finishReason, result.toolCalls)
+		if len(toolCalls) > 0 {
+			result.metadata["tool_calls"] = toolCalls
+		}
+
+		status := model.MessageStatusReceived
+		if result.finishReason == FinishReasonCancelled {
+			// 上游请求被取消时通常没有返回用量，按已生成的内容估算
+			status = model.MessageStatusCancelled
+			if result.usage.TotalTokens == 0 {
+				result.usage = producedUsage(target.model, req, result.content)
+			}
+		}
+
+		result.metadata["stream"] = true
+		reply := conversation.AddMessage(model.MessageRoleAssistant, result.content)
+		reply.Status = status
+		reply.Provider = target.providerName
+		reply.Model = target.model.Name
+		reply.Temperature = requestTemperature(req)
+		reply.FinishReason = result.finishReason
+		reply.PromptTokens = result.usage.PromptTokens
+		reply.CompletionTokens = result.usage.CompletionTokens
+		reply.TotalTokens = result.usage.TotalTokens
+		reply.Cost = target.model.CalculatePrice(result.usage.PromptTokens, result.usage.CompletionTokens)
+		reply.ResponseTime = int(time.Since(start).Milliseconds())
+		reply.Metadata = encodeMetadata(target.replyMetadata(result.metadata))
+
+		if err := s.saveReply(conversation, reply, result.usage, counts); err != nil {
+			send(newStreamErrorChunk(target, err))
+			return
+		}
+
+		totalUsage.PromptTokens += result.usage.PromptTokens
+		totalUsage.CompletionTokens += result.usage.CompletionTokens
+		totalUsage.TotalTokens += result.usage.TotalTokens
+		if len(toolCalls) == 0 {
+			result.usage = totalUsage
+			send(result.doneChunk(target))
+			return
+		}
+
+		if err := s.runToolCalls(ctx, conversation, target, req, result.content, toolCalls, iteration); err != nil {
+			send(newStreamErrorChunk(target, err))
+			return
+		}
+		if ctx.Err() != nil {
+			// 生成已取消或超时，不再继续请求模型
+			return
+		}
+
+		cancel()
+		start = time.Now()
+
+		var err error
+		upstream, target, cancel, err = s.openStream(ctx, target, req)
+		if err != nil {
+			s.saveFailedReply(conversation, target, req, err, int(time.Since(start).Milliseconds()), counts)
+			send(newStreamErrorChunk(target, err))
+			return
+		}
+	}
+}
+
+// streamResult 流式回复转发结束后的汇总
+type streamResult struct {
+	responseID   string
+	content      string
+	toolCalls    []ToolCall
+	usage        model.TokenUsage
+	finishReason string
+	metadata     map[string]interface{}
+
+	// err 上游返回的错误，已转发给调用方
+	err *APIError
+}
+
+// doneChunk 构建流式响应的结束标记
+func (r *streamResult) doneChunk(target *chatTarget) *ChatStreamResponse {
+	usage := r.usage
+	return &ChatStreamResponse{
+		ID:       r.responseID,
+		Object:   ObjectChatCompletionChunk,
+		Created:  time.Now().Unix(),
+		Model:    target.model.Name,
+		Usage:    &usage,
+		Done:     true,
+		Provider: target.providerName,
+	}
+}
+
+// streamSender 向调用方发送流式块，调用方已断开时返回 false
+func streamSender(ctx context.Context, out chan<- *ChatStreamResponse) func(*ChatStreamResponse) bool {
+	return func(chunk *ChatStreamResponse) bool {
+		select {
+		case out <- chunk:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// forwardStream 转发提供商的流式响应并过滤增量内容，返回汇总结果
+// 上游的结束标记不转发，由调用方处理完回复后发送；调用方断开后继续消费上游，以便保存已生成的内容.
+// 回复被内容过滤拦截时调用 cancel 结束上游请求；用户停止生成时以 cancelled 作为完成原因.
+func (s *aiService) forwardStream(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	target *chatTarget,
+	upstream <-chan *ChatStreamResponse,
+	send func(*ChatStreamResponse) bool,
+) *streamResult {
+	var filter *contentfilter.Stream
+	if s.filter != nil {
+		filter = s.filter.NewStream()
+	}
+
+	var content []byte
+	result := &streamResult{metadata: map[string]interface{}{}}
+
+	for chunk := range upstream {
+		if chunk.Error != nil {
+			if generationCancelled(ctx) {
+				// 用户停止生成，上游请求因取消而结束，不计为提供商错误
+				drainStream(upstream)
+				break
+			}
+			send(chunk)
+			drainStream(upstream)
+			result.err = chunk.Error
+			return result
+		}
+
+		if chunk.Usage != nil {
+			result.usage = *chunk.Usage
+		}
+		if chunk.ID != "" {
+			result.responseID = chunk.ID
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				result.finishReason = *choice.FinishReason
+			}
+			result.toolCalls = appendToolCallDeltas(result.toolCalls, choice.Delta.ToolCalls)
+		}
+
+		// 结束标记由调用方统一发送
+		if chunk.Done && len(chunk.Choices) == 0 {
+			continue
+		}
+
+		blocked := false
+		if filter != nil {
+			blocked = filterStreamChunk(filter, chunk).Blocked()
+			if !blocked && isEmptyStreamChunk(chunk) {
+				// 增量内容全部留在过滤缓冲区中
+				continue
+			}
+		}
+
+		content = append(content, chunk.GetContent()...)
+		chunk.Done = false
+		chunk.Provider = target.providerName
+		send(chunk)
+
+		if blocked {
+			result.finishReason = FinishReasonContentFilter
+			cancel()
+			drainStream(upstream)
+			break
+		}
+	}
+
+	result.metadata["response_id"] = result.responseID
+	if filter != nil {
+		// 上游未发送完成原因时，输出过滤缓冲区的剩余内容
+		if !filter.Blocked() {
+			rest := filter.Flush()
+			if rest.Blocked() {
+				result.finishReason = FinishReasonContentFilter
+			}
+			if rest.Text != "" || rest.Blocked() {
+				content = append(content, rest.Text...)
+				send(newStreamTextChunk(result.responseID, target, rest.Text, result.finishReason))
+			}
+		}
+		if matches := filter.Matches(); len(matches) > 0 {
+			logContentFilter(model.MessageRoleAssistant, s.filter.Action(), matches)
+			result.metadata["content_filter"] = contentFilterMetadata(s.filter.Action(), matches)
+		}
+	}
+
+	if result.finishReason == "" && generationCancelled(ctx) {
+		result.finishReason = FinishReasonCancelled
+		send(newStreamTextChunk(result.responseID, target, "", result.finishReason))
+	}
+	if result.finishReason == "" {
+		result.finishReason = FinishReasonStop
+	}
+	result.content = string(content)
+	return result
+}
+
+// saveReply 保存助手回复，设为当前分支的最后一条并更新对话统计
+func (s *aiService) saveReply(
+	conversation *model.AIConversation,
+	reply *model.AIMessage,
+	usage model.TokenUsage,
+	counts *usageCounts,
+) error {
+	requests, messages := counts.next(conversation.MessageCount + 1)
+	s.recordUsage(conversation.UserID, reply, requests, messages)
+
+	if err := s.repo.CreateMessage(reply); err != nil {
+		logger.Error("保存AI回复失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"error":           err.Error(),
+		})
+		return errors.New("保存回复失败")
+	}
+
+	conversation.SetCurrentMessage(reply.ID)
+	conversation.UpdateStats(usage, reply.Cost)
+	if err := s.repo.AddConversationStats(conversation.ID, reply.ID, messages, usage, reply.Cost); err != nil {
+		logger.Error("更新对话统计失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"error":           err.Error(),
+		})
+	}
+
+	s.summarizeAfterReply(conversation, reply)
+	return nil
+}
+
+// recordUsage 记录一次模型调用的用量：汇总到每日统计并结算配额
+// requests 和 messages 为计入每日统计的请求数和消息数.
+func (s *aiService) recordUsage(userID uint, reply *model.AIMessage, requests, messages int) {
+	if s.usage != nil {
+		s.usage.Record(userID, reply, requests, messages)
+	}
+	if s.quota != nil {
+		s.quota.Record(userID, reply)
+	}
+}
+
+// saveFailedReply 记录失败的回复，便于排查问题
+func (s *aiService) saveFailedReply(
+	conversation *model.AIConversation,
+	target *chatTarget,
+	req *ChatRequest,
+	cause error,
+	elapsed int,
+	counts *usageCounts,
+) {
+	logger.Error("AI提供商请求失败", map[string]any{
+		"conversation_id": conversation.ID,
+		"provider":        target.providerName,
+		"model":           target.model.Name,
+		"error":           cause.Error(),
+	})
+
+	reply := conversation.AddMessage(model.MessageRoleAssistant, cause.Error())
+	reply.Status = model.MessageStatusError
+	reply.Provider = target.providerName
+	reply.Model = target.model.Name
+	reply.Temperature = requestTemperature(req)
+	reply.FinishReason = FinishReasonError
+	reply.ResponseTime = elapsed
+	reply.Metadata = encodeMetadata(nil)
+
+	if err := s.saveReply(conversation, reply, model.TokenUsage{}, counts); err != nil {
+		logger.Error("记录失败回复失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"error":           err.Error(),
+		})
+	}
+}
+
+// buildProviderInfo 构建提供商信息
+func (s *aiService) buildProviderInfo(
+	ctx context.Context,
+	name string,
+	providerCfg config.ProviderConfig,
+) ProviderInfo {
+	info := ProviderInfo{
+		Name:        name,
+		DisplayName: providerCfg.Name,
+		Enabled:     providerCfg.Enabled,
+		Models:      modelsFromConfig(name, providerCfg),
+	}
+
+	health, _ := s.registry.Health(name)
+	info.Status = health.Status
+	info.LastError = health.LastError
+	if health.Circuit != nil {
+		info.CircuitState = health.Circuit.State
+	}
+
+	if provider, exists := s.registry.Provider(name); exists {
+		if models, err := provider.ListModels(ctx); err == nil && len(models) > 0 {
+			info.Models = models
+		}
+	}
+	return info
+}
+
+// 辅助函数
+
+// modelsFromConfig 从配置构建模型信息列表
+func modelsFromConfig(providerName string, providerCfg config.ProviderConfig) []ModelInfo {
+	models := make([]ModelInfo, 0, len(providerCfg.Models))
+	for _, modelCfg := range providerCfg.Models {
+		models = append(models, ModelInfo{
+			ID:          modelCfg.Name,
+			Name:        modelCfg.Name,
+			MaxTokens:   modelCfg.MaxTokens,
+			InputPrice:  modelCfg.Pricing.Input,
+			OutputPrice: modelCfg.Pricing.Output,
+			Provider:    providerName,
+		})
+	}
+	return models
+}
+
+// conversationMaxTokens 计算对话默认的最大输出token数
+func conversationMaxTokens(modelCfg config.ModelConfig) int {
+	if modelCfg.MaxTokens > 0 && modelCfg.MaxTokens < defaultConversationMaxTokens {
+		return modelCfg.MaxTokens
+	}
+	return defaultConversationMaxTokens
+}
+
+// truncateTitle 截取消息内容作为对话标题
+func truncateTitle(content string) string {
+	runes := []rune(content)
+	if len(runes) <= conversationTitleMaxRunes {
+		return content
+	}
+	return string(runes[:conversationTitleMaxRunes]) + "..."
+}
+
+// requestTemperature 获取请求的温度参数
+func requestTemperature(req *ChatRequest) float32 {
+	if req.Temperature != nil {
+		return *req.Temperature
+	}
+	return 0
+}
+
+// firstFinishReason 获取响应的完成原因
+func firstFinishReason(resp *ChatResponse) string {
+	if len(resp.Choices) > 0 && resp.Choices[0].FinishReason != "" {
+		return resp.Choices[0].FinishReason
+	}
+	return FinishReasonStop
+}
+
+// encodeMetadata 序列化消息元数据（JSON列不接受空字符串）
+func encodeMetadata(metadata map[string]interface{}) string {
+	if len(metadata) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// drainStream 丢弃通道中剩余的数据，避免上游goroutine阻塞
+func drainStream(ch <-chan *ChatStreamResponse) {
+	for range ch {
+	}
+}
+
+// normalizePage 规范化分页参数
+func normalizePage(page, size, defaultSize int) (int, int) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 || size > 100 {
+		size = defaultSize
+	}
+	return page, size
+}
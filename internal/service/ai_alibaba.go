@@ -0,0 +1,595 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// alibabaDefaultBaseURL DashScope 默认地址
+	alibabaDefaultBaseURL = "https://dashscope.aliyuncs.com"
+
+	// alibabaGenerationPath 原生文本生成接口路径
+	alibabaGenerationPath = "/api/v1/services/aigc/text-generation/generation"
+
+	// alibabaMultimodalPath 原生多模态生成接口路径，请求包含图片时使用
+	alibabaMultimodalPath = "/api/v1/services/aigc/multimodal-generation/generation"
+
+	// alibabaCompatiblePath OpenAI 兼容接口路径
+	alibabaCompatiblePath = "/compatible-mode/v1"
+)
+
+// 阿里云接入模式
+const (
+	AlibabaModeNative     = "native"
+	AlibabaModeCompatible = "compatible"
+)
+
+// AlibabaProvider 阿里通义千问（DashScope）提供商实现
+type AlibabaProvider struct {
+	config     config.ProviderConfig
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	mode       string
+
+	// compatible 兼容模式下复用 OpenAI 协议实现
+	compatible *OpenAIProvider
+}
+
+// NewAlibabaProvider 创建阿里通义千问提供商
+func NewAlibabaProvider(cfg config.ProviderConfig) *AlibabaProvider {
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = alibabaDefaultBaseURL
+	}
+	mode := cfg.Mode
+	if mode == "" {
+		mode = AlibabaModeNative
+	}
+
+	p := &AlibabaProvider{
+		config:     cfg,
+		baseURL:    baseURL,
+		apiKey:     cfg.APIKey,
+		mode:       mode,
+		httpClient: newProviderHTTPClient(cfg),
+	}
+	if mode == AlibabaModeCompatible {
+		p.compatible = newOpenAICompatibleProvider(p.GetName(), cfg, baseURL+alibabaCompatiblePath)
+	}
+
+	return p
+}
+
+// GetName 获取提供商名称
+func (p *AlibabaProvider) GetName() string {
+	return "alibaba"
+}
+
+// Chat 发送聊天请求
+func (p *AlibabaProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if p.compatible != nil {
+		return p.compatible.Chat(ctx, req)
+	}
+
+	resp, err := p.doRequest(ctx, p.buildRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var dashResp DashScopeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&dashResp); err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeProviderError,
+			Message: fmt.Sprintf("解析响应失败: %v", err),
+		}
+	}
+	if dashResp.Code != "" {
+		return nil, newDashScopeAPIError(dashResp.Code, dashResp.Message)
+	}
+
+	return p.convertToStandardResponse(req.Model, &dashResp), nil
+}
+
+// ChatStream 发送流式聊天请求
+func (p *AlibabaProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatStreamResponse, error) {
+	if p.compatible != nil {
+		return p.compatible.ChatStream(ctx, req)
+	}
+
+	resp, err := p.doRequest(ctx, p.buildRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *ChatStreamResponse, 10)
+	go p.handleStreamResponse(ctx, req.Model, resp.Body, ch)
+
+	return ch, nil
+}
+
+// ListModels 列出可用模型
+func (p *AlibabaProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return modelsFromConfig(p.GetName(), p.config), nil
+}
+
+// ValidateConfig 验证配置是否有效
+func (p *AlibabaProvider) ValidateConfig() error {
+	if p.apiKey == "" {
+		return fmt.Errorf("阿里云 DashScope API密钥不能为空")
+	}
+	if p.mode != AlibabaModeNative && p.mode != AlibabaModeCompatible {
+		return fmt.Errorf("不支持的阿里云接入模式: %s (支持: native, compatible)", p.mode)
+	}
+	if len(p.config.Models) == 0 {
+		return fmt.Errorf("阿里通义千问至少需要配置一个模型")
+	}
+	return nil
+}
+
+// Close 关闭连接
+func (p *AlibabaProvider) Close() error {
+	p.httpClient.CloseIdleConnections()
+	if p.compatible != nil {
+		return p.compatible.Close()
+	}
+	return nil
+}
+
+// 私有方法
+
+// buildRequest 构建原生接口请求
+// 包含图片时使用多模态接口，所有消息的内容都以内容片段数组发送.
+func (p *AlibabaProvider) buildRequest(req *ChatRequest, stream bool) *DashScopeRequest {
+	multimodal := hasImages(req.Messages)
+	messages := make([]DashScopeMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = DashScopeMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCallID: msg.ToolCallID,
+		}
+		if multimodal {
+			messages[i].Contents = convertToDashScopeContents(msg)
+		}
+		for _, call := range msg.ToolCalls {
+			messages[i].ToolCalls = append(messages[i].ToolCalls, DashScopeToolCall{
+				ID:       call.ID,
+				Type:     call.Type,
+				Function: call.Function,
+			})
+		}
+	}
+
+	dashReq := &DashScopeRequest{
+		Model: req.Model,
+		Input: DashScopeInput{Messages: messages},
+		Parameters: DashScopeParameters{
+			ResultFormat:      "message",
+			Temperature:       req.Temperature,
+			TopP:              req.TopP,
+			MaxTokens:         req.MaxTokens,
+			Stop:              req.Stop,
+			IncrementalOutput: stream,
+		},
+		stream:     stream,
+		multimodal: multimodal,
+	}
+	// 工具定义和选择策略与 OpenAI 格式相同
+	if len(req.Tools) > 0 {
+		dashReq.Parameters.Tools = req.Tools
+		dashReq.Parameters.ToolChoice = req.ToolChoice
+	}
+	return dashReq
+}
+
+// convertToDashScopeContents 转换为多模态接口的内容片段
+func convertToDashScopeContents(msg Message) []DashScopeContent {
+	if len(msg.Parts) == 0 {
+		return []DashScopeContent{{Text: msg.Content}}
+	}
+
+	contents := make([]DashScopeContent, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		switch {
+		case part.Type == ContentPartText && part.Text != "":
+			contents = append(contents, DashScopeContent{Text: part.Text})
+		case part.Type == ContentPartImage && part.ImageURL != nil:
+			contents = append(contents, DashScopeContent{Image: part.ImageURL.URL})
+		}
+	}
+	return contents
+}
+
+// doRequest 发送原生接口请求并检查状态码
+func (p *AlibabaProvider) doRequest(ctx context.Context, dashReq *DashScopeRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(dashReq)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("序列化请求失败: %v", err),
+		}
+	}
+
+	url := p.baseURL + alibabaGenerationPath
+	if dashReq.multimodal {
+		url = p.baseURL + alibabaMultimodalPath
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("创建HTTP请求失败: %v", err),
+		}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	httpReq.Header.Set("User-Agent", "ai-svc/1.0")
+	if dashReq.stream {
+		httpReq.Header.Set("X-DashScope-SSE", "enable")
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("发送请求失败: %v", err),
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, p.handleErrorResponse(resp)
+	}
+
+	return resp, nil
+}
+
+// handleErrorResponse 处理错误响应
+func (p *AlibabaProvider) handleErrorResponse(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("读取错误响应失败: %v", err),
+		}
+	}
+
+	var errorResp DashScopeResponse
+	if err := json.Unmarshal(body, &errorResp); err != nil || errorResp.Code == "" {
+		return &APIError{
+			Code:    mapHTTPStatusErrorCode(resp.StatusCode),
+			Message: fmt.Sprintf("HTTP错误 %d: %s", resp.StatusCode, string(body)),
+		}
+	}
+
+	return newDashScopeAPIError(errorResp.Code, errorResp.Message)
+}
+
+// handleStreamResponse 处理原生接口流式响应
+func (p *AlibabaProvider) handleStreamResponse(
+	ctx context.Context,
+	modelName string,
+	body io.ReadCloser,
+	ch chan<- *ChatStreamResponse,
+) {
+	defer close(ch)
+	defer body.Close()
+
+	created := time.Now().Unix()
+	first := true
+	var requestID string
+	var usage model.TokenUsage
+
+	err := readSSE(body, func(event *sseEvent) bool {
+		if event.Data == "" {
+			return true
+		}
+
+		var chunk DashScopeResponse
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			sendStreamChunk(ctx, ch, &ChatStreamResponse{
+				Error: &APIError{
+					Code:    ErrorCodeProviderError,
+					Message: fmt.Sprintf("解析流式数据失败: %v", err),
+				},
+				Provider: p.GetName(),
+			})
+			return false
+		}
+
+		if event.Event == "error" || chunk.Code != "" {
+			sendStreamChunk(ctx, ch, &ChatStreamResponse{
+				Error:    newDashScopeAPIError(chunk.Code, chunk.Message),
+				Provider: p.GetName(),
+			})
+			return false
+		}
+
+		requestID = chunk.RequestID
+		usage = chunk.Usage.toTokenUsage()
+
+		var content, reason string
+		var toolCalls []ToolCallDelta
+		if len(chunk.Output.Choices) > 0 {
+			content = chunk.Output.Choices[0].Message.Content
+			reason = chunk.Output.Choices[0].FinishReason
+			for _, call := range chunk.Output.Choices[0].Message.ToolCalls {
+				toolCalls = append(toolCalls, ToolCallDelta(call))
+			}
+		}
+
+		role := ""
+		if first {
+			role = model.MessageRoleAssistant
+			first = false
+		}
+
+		var finishReason *string
+		if reason != "" && reason != "null" {
+			mapped := mapDashScopeFinishReason(reason)
+			finishReason = &mapped
+		}
+
+		choice := newStreamChoice(role, content, finishReason)
+		choice.Delta.ToolCalls = toolCalls
+		return sendStreamChunk(ctx, ch, &ChatStreamResponse{
+			ID:       requestID,
+			Object:   ObjectChatCompletionChunk,
+			Created:  created,
+			Model:    modelName,
+			Choices:  []StreamChoice{choice},
+			Provider: p.GetName(),
+		})
+	})
+
+	if err != nil {
+		sendStreamChunk(ctx, ch, &ChatStreamResponse{
+			Error: &APIError{
+				Code:    ErrorCodeNetworkError,
+				Message: fmt.Sprintf("读取流式数据失败: %v", err),
+			},
+			Provider: p.GetName(),
+		})
+		return
+	}
+
+	sendStreamChunk(ctx, ch, &ChatStreamResponse{
+		ID:       requestID,
+		Object:   ObjectChatCompletionChunk,
+		Created:  created,
+		Model:    modelName,
+		Usage:    &usage,
+		Done:     true,
+		Provider: p.GetName(),
+	})
+}
+
+// convertToStandardResponse 转换为标准响应
+func (p *AlibabaProvider) convertToStandardResponse(modelName string, resp *DashScopeResponse) *ChatResponse {
+	choices := make([]Choice, len(resp.Output.Choices))
+	for i, choice := range resp.Output.Choices {
+		choices[i] = Choice{
+			Index: i,
+			Message: Message{
+				Role:    model.MessageRoleAssistant,
+				Content: choice.Message.Content,
+			},
+			FinishReason: mapDashScopeFinishReason(choice.FinishReason),
+		}
+		for _, call := range choice.Message.ToolCalls {
+			choices[i].Message.ToolCalls = append(choices[i].Message.ToolCalls, ToolCall{
+				ID:       call.ID,
+				Type:     call.Type,
+				Function: call.Function,
+			})
+		}
+	}
+
+	return &ChatResponse{
+		ID:       resp.RequestID,
+		Object:   ObjectChatCompletion,
+		Created:  time.Now().Unix(),
+		Model:    modelName,
+		Choices:  choices,
+		Usage:    resp.Usage.toTokenUsage(),
+		Provider: p.GetName(),
+	}
+}
+
+// DashScope API 结构体定义
+
+// DashScopeRequest DashScope 文本生成请求
+type DashScopeRequest struct {
+	Model      string              `json:"model"`
+	Input      DashScopeInput      `json:"input"`
+	Parameters DashScopeParameters `json:"parameters"`
+
+	// stream 是否流式请求（通过请求头控制，不参与序列化）
+	stream bool
+
+	// multimodal 是否使用多模态接口（通过接口路径区分，不参与序列化）
+	multimodal bool
+}
+
+// DashScopeInput DashScope 输入
+type DashScopeInput struct {
+	Messages []DashScopeMessage `json:"messages"`
+}
+
+// DashScopeMessage DashScope 消息
+type DashScopeMessage struct {
+	Role       string              `json:"role"`
+	Content    string              `json:"content"`
+	ToolCalls  []DashScopeToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string              `json:"tool_call_id,omitempty"`
+
+	// Contents 多模态接口的内容片段，不为空时 content 序列化为数组
+	Contents []DashScopeContent `json:"-"`
+}
+
+// DashScopeContent DashScope 多模态内容片段，每个片段只包含文本或图片之一
+type DashScopeContent struct {
+	Text  string `json:"text,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// MarshalJSON 有内容片段时 content 使用数组形式
+func (m DashScopeMessage) MarshalJSON() ([]byte, error) {
+	type alias DashScopeMessage
+	if len(m.Contents) == 0 {
+		return json.Marshal(alias(m))
+	}
+	return json.Marshal(struct {
+		alias
+		Content []DashScopeContent `json:"content"`
+	}{alias: alias(m), Content: m.Contents})
+}
+
+// UnmarshalJSON 解析字符串或内容片段数组形式的 content（多模态接口返回数组）
+func (m *DashScopeMessage) UnmarshalJSON(data []byte) error {
+	type alias DashScopeMessage
+	var raw struct {
+		alias
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = DashScopeMessage(raw.alias)
+
+	content := bytes.TrimSpace(raw.Content)
+	switch {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+		return nil
+	case content[0] == '[':
+		if err := json.Unmarshal(content, &m.Contents); err != nil {
+			return err
+		}
+		var texts []string
+		for _, item := range m.Contents {
+			if item.Text != "" {
+				texts = append(texts, item.Text)
+			}
+		}
+		m.Content = strings.Join(texts, "")
+		return nil
+	default:
+		return json.Unmarshal(content, &m.Content)
+	}
+}
+
+// DashScopeToolCall DashScope 工具调用，流式增量中通过 index 区分不同的调用
+type DashScopeToolCall struct {
+	Index    int              `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// DashScopeParameters DashScope 参数
+type DashScopeParameters struct {
+	ResultFormat      string           `json:"result_format"`
+	Temperature       *float32         `json:"temperature,omitempty"`
+	TopP              *float32         `json:"top_p,omitempty"`
+	MaxTokens         *int             `json:"max_tokens,omitempty"`
+	Stop              []string         `json:"stop,omitempty"`
+	IncrementalOutput bool             `json:"incremental_output,omitempty"`
+	Tools             []ToolDefinition `json:"tools,omitempty"`
+	ToolChoice        *ToolChoice      `json:"tool_choice,omitempty"`
+}
+
+// DashScopeResponse DashScope 响应（流式和非流式共用，出错时 Code 非空）
+type DashScopeResponse struct {
+	RequestID string          `json:"request_id"`
+	Output    DashScopeOutput `json:"output"`
+	Usage     DashScopeUsage  `json:"usage"`
+	Code      string          `json:"code,omitempty"`
+	Message   string          `json:"message,omitempty"`
+}
+
+// DashScopeOutput DashScope 输出
+type DashScopeOutput struct {
+	Choices []DashScopeChoice `json:"choices"`
+}
+
+// DashScopeChoice DashScope 选择
+type DashScopeChoice struct {
+	FinishReason string           `json:"finish_reason"`
+	Message      DashScopeMessage `json:"message"`
+}
+
+// DashScopeUsage DashScope 使用量
+type DashScopeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// toTokenUsage 转换为标准使用量
+func (u DashScopeUsage) toTokenUsage() model.TokenUsage {
+	total := u.TotalTokens
+	if total == 0 {
+		total = u.InputTokens + u.OutputTokens
+	}
+	return model.TokenUsage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      total,
+	}
+}
+
+// 辅助函数
+
+// newDashScopeAPIError 根据 DashScope 错误码创建 API 错误
+func newDashScopeAPIError(code, message string) *APIError {
+	if message == "" {
+		message = "DashScope 请求失败"
+	}
+	return &APIError{
+		Code:    mapDashScopeErrorCode(code),
+		Message: message,
+		Type:    code,
+	}
+}
+
+// mapDashScopeErrorCode 映射 DashScope 错误代码
+func mapDashScopeErrorCode(code string) string {
+	switch {
+	case code == "InvalidApiKey" || code == "AccessDenied" || strings.HasPrefix(code, "AccessDenied."):
+		return ErrorCodeAuthenticationError
+	case code == "Arrearage" || code == "Throttling.AllocationQuota":
+		return ErrorCodeQuotaExceeded
+	case strings.HasPrefix(code, "Throttling"):
+		return ErrorCodeRateLimitExceeded
+	case code == "ModelNotFound" || code == "Model.AccessDenied":
+		return ErrorCodeInvalidModel
+	case code == "InvalidParameter" || code == "DataInspectionFailed" || strings.HasPrefix(code, "InvalidParameter."):
+		return ErrorCodeInvalidRequest
+	default:
+		return ErrorCodeProviderError
+	}
+}
+
+// mapDashScopeFinishReason 映射 DashScope 完成原因
+func mapDashScopeFinishReason(reason string) string {
+	switch reason {
+	case "length":
+		return FinishReasonLength
+	case "tool_calls":
+		return FinishReasonToolCalls
+	default:
+		return FinishReasonStop
+	}
+}
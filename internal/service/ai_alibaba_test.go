@@ -0,0 +1,191 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAlibabaProvider(baseURL, mode string) *AlibabaProvider {
+	return NewAlibabaProvider(config.ProviderConfig{
+		Enabled: true,
+		BaseURL: baseURL,
+		APIKey:  "test-key",
+		Mode:    mode,
+		Models:  []config.ModelConfig{{Name: "qwen-turbo", MaxTokens: 8192}},
+	})
+}
+
+func TestAlibabaProviderNativeChatStream(t *testing.T) {
+	events := []string{
+		"id:1\nevent:result\n:HTTP_STATUS/200\n" +
+			`data:{"output":{"choices":[{"message":{"content":"你","role":"assistant"},"finish_reason":"null"}]},` +
+			`"usage":{"total_tokens":11,"input_tokens":10,"output_tokens":1},"request_id":"req-1"}`,
+		"id:2\nevent:result\n:HTTP_STATUS/200\n" +
+			`data:{"output":{"choices":[{"message":{"content":"好","role":"assistant"},"finish_reason":"length"}]},` +
+			`"usage":{"total_tokens":12,"input_tokens":10,"output_tokens":2},"request_id":"req-1"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, alibabaGenerationPath, r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "enable", r.Header.Get("X-DashScope-SSE"))
+
+		var req DashScopeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "message", req.Parameters.ResultFormat)
+		assert.True(t, req.Parameters.IncrementalOutput)
+		require.Len(t, req.Input.Messages, 1)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, strings.Join(events, "\n\n")+"\n\n")
+	}))
+	defer server.Close()
+
+	provider := newTestAlibabaProvider(server.URL, "")
+	stream, err := provider.ChatStream(context.Background(), NewStreamChatRequest(
+		"qwen-turbo",
+		[]Message{{Role: "user", Content: "你好"}},
+	))
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var finishReason string
+	var last *ChatStreamResponse
+	for chunk := range stream {
+		require.Nil(t, chunk.Error)
+		content.WriteString(chunk.GetContent())
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+		last = chunk
+	}
+
+	assert.Equal(t, "你好", content.String())
+	assert.Equal(t, FinishReasonLength, finishReason)
+	require.NotNil(t, last)
+	assert.True(t, last.Done)
+	assert.Equal(t, "req-1", last.ID)
+	require.NotNil(t, last.Usage)
+	assert.Equal(t, 10, last.Usage.PromptTokens)
+	assert.Equal(t, 2, last.Usage.CompletionTokens)
+	assert.Equal(t, 12, last.Usage.TotalTokens)
+}
+
+func TestAlibabaProviderCompatibleMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, alibabaCompatiblePath+"/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"qwen-turbo",`+
+			`"choices":[{"index":0,"message":{"role":"assistant","content":"你好"},"finish_reason":"stop"}],`+
+			`"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`)
+	}))
+	defer server.Close()
+
+	provider := newTestAlibabaProvider(server.URL, AlibabaModeCompatible)
+	resp, err := provider.Chat(context.Background(), NewChatRequest(
+		"qwen-turbo",
+		[]Message{{Role: "user", Content: "你好"}},
+	))
+	require.NoError(t, err)
+
+	assert.Equal(t, "alibaba", resp.Provider)
+	assert.Equal(t, "你好", resp.GetLastAssistantMessage())
+	assert.Equal(t, 5, resp.Usage.TotalTokens)
+}
+
+func TestAlibabaProviderErrorMapping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"code":"InvalidApiKey","message":"Invalid API-key provided.","request_id":"req-2"}`)
+	}))
+	defer server.Close()
+
+	provider := newTestAlibabaProvider(server.URL, AlibabaModeNative)
+	_, err := provider.Chat(context.Background(), NewChatRequest(
+		"qwen-turbo",
+		[]Message{{Role: "user", Content: "你好"}},
+	))
+	require.Error(t, err)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorCodeAuthenticationError, apiErr.Code)
+	assert.Equal(t, "InvalidApiKey", apiErr.Type)
+}
+
+func TestAlibabaProviderNativeToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req DashScopeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Parameters.Tools, 1)
+		require.Len(t, req.Input.Messages, 3)
+		require.Len(t, req.Input.Messages[1].ToolCalls, 1)
+		assert.Equal(t, "get_weather", req.Input.Messages[1].ToolCalls[0].Function.Name)
+		assert.Equal(t, "call_1", req.Input.Messages[2].ToolCallID)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"output":{"choices":[{"finish_reason":"tool_calls","message":{"role":"assistant",`+
+			`"content":"","tool_calls":[{"id":"call_2","type":"function",`+
+			`"function":{"name":"get_weather","arguments":"{\"city\":\"杭州\"}"}}]}}]},`+
+			`"usage":{"input_tokens":20,"output_tokens":8},"request_id":"req-2"}`)
+	}))
+	defer server.Close()
+
+	provider := newTestAlibabaProvider(server.URL, "")
+	resp, err := provider.Chat(context.Background(), newToolTestRequest("qwen-turbo"))
+	require.NoError(t, err)
+
+	assert.Equal(t, FinishReasonToolCalls, resp.Choices[0].FinishReason)
+	require.Len(t, resp.Choices[0].Message.ToolCalls, 1)
+	assert.Equal(t, "call_2", resp.Choices[0].Message.ToolCalls[0].ID)
+	assert.JSONEq(t, `{"city":"杭州"}`, resp.Choices[0].Message.ToolCalls[0].Function.Arguments)
+}
+
+func TestAlibabaProviderNativeMultimodal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, alibabaMultimodalPath, r.URL.Path)
+
+		var req struct {
+			Input struct {
+				Messages []struct {
+					Role    string              `json:"role"`
+					Content []map[string]string `json:"content"`
+				} `json:"messages"`
+			} `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Input.Messages, 2)
+		assert.Equal(t, []map[string]string{{"text": "你是一个助手"}}, req.Input.Messages[0].Content)
+		assert.Equal(t, []map[string]string{
+			{"text": "这是什么"},
+			{"image": testPNGDataURL()},
+			{"image": "https://example.com/cat.jpg"},
+		}, req.Input.Messages[1].Content)
+
+		// 多模态接口返回的 content 是数组
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"output":{"choices":[{"finish_reason":"stop","message":{"role":"assistant",`+
+			`"content":[{"text":"一只猫"}]}}]},"usage":{"input_tokens":900,"output_tokens":3},"request_id":"req-3"}`)
+	}))
+	defer server.Close()
+
+	provider := newTestAlibabaProvider(server.URL, "")
+	resp, err := provider.Chat(context.Background(), newImageTestRequest("qwen-vl-plus"))
+	require.NoError(t, err)
+	assert.Equal(t, "一只猫", resp.GetLastAssistantMessage())
+}
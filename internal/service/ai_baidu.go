@@ -0,0 +1,704 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// baiduDefaultBaseURL 百度千帆默认地址
+	baiduDefaultBaseURL = "https://aip.baidubce.com"
+
+	// baiduTokenRefreshAhead access_token 提前刷新的时间
+	baiduTokenRefreshAhead = 10 * time.Minute
+
+	// baiduChatPath 文心一言对话接口路径前缀
+	baiduChatPath = "/rpc/2.0/ai_custom/v1/wenxinworkshop/chat/"
+
+	// baiduRoleFunction 函数执行结果的消息角色
+	baiduRoleFunction = "function"
+)
+
+// baiduModelEndpoints 模型名称到接口路径的映射
+var baiduModelEndpoints = map[string]string{
+	"ernie-bot-turbo": "eb-instant",
+	"ernie-bot":       "completions",
+	"ernie-bot-4":     "completions_pro",
+	"ernie-speed":     "ernie_speed",
+	"ernie-lite-8k":   "ernie-lite-8k",
+}
+
+// BaiduProvider 百度文心一言提供商实现
+type BaiduProvider struct {
+	config     config.ProviderConfig
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	secretKey  string
+
+	// access_token 缓存
+	tokenMu        sync.Mutex
+	accessToken    string
+	tokenExpiresAt time.Time
+}
+
+// NewBaiduProvider 创建百度文心一言提供商
+func NewBaiduProvider(cfg config.ProviderConfig) *BaiduProvider {
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = baiduDefaultBaseURL
+	}
+
+	return &BaiduProvider{
+		config:     cfg,
+		baseURL:    baseURL,
+		apiKey:     cfg.APIKey,
+		secretKey:  cfg.SecretKey,
+		httpClient: newProviderHTTPClient(cfg),
+	}
+}
+
+// GetName 获取提供商名称
+func (p *BaiduProvider) GetName() string {
+	return "baidu"
+}
+
+// Chat 发送聊天请求
+func (p *BaiduProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if err := checkBaiduImages(req); err != nil {
+		return nil, err
+	}
+	body, err := p.doChatRequest(ctx, req.Model, p.buildRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var baiduResp BaiduChatResponse
+	if err := json.NewDecoder(body).Decode(&baiduResp); err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeProviderError,
+			Message: fmt.Sprintf("解析响应失败: %v", err),
+		}
+	}
+	if baiduResp.ErrorCode != 0 {
+		return nil, newBaiduAPIError(baiduResp.ErrorCode, baiduResp.ErrorMsg)
+	}
+
+	return p.convertToStandardResponse(req.Model, &baiduResp), nil
+}
+
+// ChatStream 发送流式聊天请求
+func (p *BaiduProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatStreamResponse, error) {
+	if err := checkBaiduImages(req); err != nil {
+		return nil, err
+	}
+	body, err := p.doChatRequest(ctx, req.Model, p.buildRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *ChatStreamResponse, 10)
+	go p.handleStreamResponse(ctx, req.Model, body, ch)
+
+	return ch, nil
+}
+
+// ListModels 列出可用模型
+func (p *BaiduProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return modelsFromConfig(p.GetName(), p.config), nil
+}
+
+// ValidateConfig 验证配置是否有效
+func (p *BaiduProvider) ValidateConfig() error {
+	if p.apiKey == "" {
+		return fmt.Errorf("百度 API Key 不能为空")
+	}
+	if p.secretKey == "" {
+		return fmt.Errorf("百度 Secret Key 不能为空")
+	}
+	if len(p.config.Models) == 0 {
+		return fmt.Errorf("百度文心一言至少需要配置一个模型")
+	}
+	return nil
+}
+
+// Close 关闭连接
+func (p *BaiduProvider) Close() error {
+	p.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// 私有方法
+
+// getAccessToken 获取 access_token，过期前自动刷新
+func (p *BaiduProvider) getAccessToken(ctx context.Context) (string, error) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	if p.accessToken != "" && time.Now().Before(p.tokenExpiresAt.Add(-baiduTokenRefreshAhead)) {
+		return p.accessToken, nil
+	}
+
+	query := url.Values{}
+	query.Set("grant_type", "client_credentials")
+	query.Set("client_id", p.apiKey)
+	query.Set("client_secret", p.secretKey)
+
+	tokenURL := p.baseURL + "/oauth/2.0/token?" + query.Encode()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, http.NoBody)
+	if err != nil {
+		return "", &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("创建access_token请求失败: %v", err),
+		}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return "", &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("获取access_token失败: %v", err),
+		}
+	}
+	defer resp.Body.Close()
+
+	var tokenResp BaiduTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", &APIError{
+			Code:    ErrorCodeProviderError,
+			Message: fmt.Sprintf("解析access_token响应失败: %v", err),
+		}
+	}
+	if tokenResp.AccessToken == "" {
+		return "", &APIError{
+			Code:    ErrorCodeAuthenticationError,
+			Message: fmt.Sprintf("获取access_token失败: %s %s", tokenResp.Error, tokenResp.ErrorDescription),
+			Type:    tokenResp.Error,
+		}
+	}
+
+	p.accessToken = tokenResp.AccessToken
+	p.tokenExpiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+
+	return p.accessToken, nil
+}
+
+// invalidateAccessToken 使缓存的 access_token 失效
+func (p *BaiduProvider) invalidateAccessToken(token string) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	if p.accessToken == token {
+		p.accessToken = ""
+		p.tokenExpiresAt = time.Time{}
+	}
+}
+
+// doChatRequest 发送对话请求，access_token 失效时刷新后重试一次
+func (p *BaiduProvider) doChatRequest(
+	ctx context.Context,
+	modelName string,
+	baiduReq *BaiduChatRequest,
+) (io.ReadCloser, error) {
+	reqBody, err := json.Marshal(baiduReq)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("序列化请求失败: %v", err),
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := p.getAccessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := p.postChat(ctx, modelName, token, reqBody)
+		var apiErr *APIError
+		if attempt == 0 && errors.As(err, &apiErr) && isBaiduTokenError(apiErr.Type) {
+			p.invalidateAccessToken(token)
+			continue
+		}
+		return body, err
+	}
+}
+
+// postChat 发送一次对话请求，接口在 HTTP 200 时也可能返回错误体
+func (p *BaiduProvider) postChat(ctx context.Context, modelName, token string, reqBody []byte) (io.ReadCloser, error) {
+	chatURL := p.baseURL + baiduChatPath + baiduEndpoint(modelName) + "?access_token=" + url.QueryEscape(token)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, chatURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("创建HTTP请求失败: %v", err),
+		}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "ai-svc/1.0")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("发送请求失败: %v", err),
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{
+			Code:    mapHTTPStatusErrorCode(resp.StatusCode),
+			Message: fmt.Sprintf("HTTP错误 %d: %s", resp.StatusCode, string(body)),
+		}
+	}
+
+	// 流式请求出错时返回的是普通 JSON
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, &APIError{
+				Code:    ErrorCodeNetworkError,
+				Message: fmt.Sprintf("读取响应失败: %v", err),
+			}
+		}
+
+		var errResp BaiduChatResponse
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.ErrorCode != 0 {
+			return nil, newBaiduAPIError(errResp.ErrorCode, errResp.ErrorMsg)
+		}
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return resp.Body, nil
+}
+
+// buildRequest 构建文心一言请求
+// 文心一言要求消息以 user 开头、user/assistant 交替且总数为奇数，system 消息放在 system 字段.
+// 工具调用使用 functions 协议：每轮只支持一次函数调用，多个调用只保留第一个及其结果.
+func (p *BaiduProvider) buildRequest(req *ChatRequest, stream bool) *BaiduChatRequest {
+	baiduReq := &BaiduChatRequest{
+		TopP:            req.TopP,
+		Stop:            req.Stop,
+		MaxOutputTokens: req.MaxTokens,
+		Stream:          stream,
+		UserID:          req.User,
+	}
+
+	// 温度取值范围 (0, 1]
+	if req.Temperature != nil {
+		temperature := *req.Temperature
+		if temperature <= 0 {
+			temperature = 0.01
+		}
+		if temperature > 1 {
+			temperature = 1
+		}
+		baiduReq.Temperature = &temperature
+	}
+
+	if req.toolsEnabled() {
+		baiduReq.Functions = convertToBaiduFunctions(req.Tools)
+		baiduReq.ToolChoice = convertToBaiduToolChoice(req.Tools, req.ToolChoice)
+	}
+
+	// callNames 工具调用ID到函数名的映射，函数结果消息需要带上函数名
+	callNames := make(map[string]string)
+
+	var systemParts []string
+	for _, msg := range req.Messages {
+		if msg.Role == model.MessageRoleSystem {
+			systemParts = append(systemParts, msg.Content)
+			continue
+		}
+
+		// 首条消息必须是 user
+		if len(baiduReq.Messages) == 0 && msg.Role != model.MessageRoleUser {
+			continue
+		}
+
+		baiduMsg := BaiduMessage{Role: msg.Role, Content: msg.Content}
+		switch {
+		case msg.Role == model.MessageRoleTool:
+			name, exists := callNames[msg.ToolCallID]
+			if !exists {
+				continue
+			}
+			baiduMsg.Role = baiduRoleFunction
+			baiduMsg.Name = name
+		case len(msg.ToolCalls) > 0:
+			call := msg.ToolCalls[0]
+			callNames[call.ID] = call.Function.Name
+			baiduMsg.FunctionCall = &BaiduFunctionCall{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			}
+		}
+
+		// 合并相邻的同角色文本消息
+		last := len(baiduReq.Messages) - 1
+		if last >= 0 && baiduReq.Messages[last].Role == baiduMsg.Role && baiduMsg.Role != baiduRoleFunction &&
+			baiduReq.Messages[last].FunctionCall == nil && baiduMsg.FunctionCall == nil {
+			baiduReq.Messages[last].Content += "\n\n" + baiduMsg.Content
+			continue
+		}
+		baiduReq.Messages = append(baiduReq.Messages, baiduMsg)
+	}
+	baiduReq.System = strings.Join(systemParts, "\n\n")
+
+	return baiduReq
+}
+
+// handleStreamResponse 处理流式响应
+func (p *BaiduProvider) handleStreamResponse(
+	ctx context.Context,
+	modelName string,
+	body io.ReadCloser,
+	ch chan<- *ChatStreamResponse,
+) {
+	defer close(ch)
+	defer body.Close()
+
+	first := true
+	err := readSSE(body, func(event *sseEvent) bool {
+		if event.Data == "" {
+			return true
+		}
+
+		var chunk BaiduChatResponse
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			sendStreamChunk(ctx, ch, &ChatStreamResponse{
+				Error: &APIError{
+					Code:    ErrorCodeProviderError,
+					Message: fmt.Sprintf("解析流式数据失败: %v", err),
+				},
+				Provider: p.GetName(),
+			})
+			return false
+		}
+		if chunk.ErrorCode != 0 {
+			sendStreamChunk(ctx, ch, &ChatStreamResponse{
+				Error:    newBaiduAPIError(chunk.ErrorCode, chunk.ErrorMsg),
+				Provider: p.GetName(),
+			})
+			return false
+		}
+
+		role := ""
+		if first {
+			role = model.MessageRoleAssistant
+			first = false
+		}
+
+		var finishReason *string
+		if chunk.IsEnd {
+			reason := mapBaiduFinishReason(chunk.FinishReason)
+			finishReason = &reason
+		}
+
+		// 函数调用在一个数据块中完整返回
+		choice := newStreamChoice(role, chunk.Result, finishReason)
+		if call := chunk.toolCall(); call != nil {
+			choice.Delta.ToolCalls = []ToolCallDelta{{
+				ID:       call.ID,
+				Type:     call.Type,
+				Function: call.Function,
+			}}
+		}
+
+		streamResp := &ChatStreamResponse{
+			ID:       chunk.ID,
+			Object:   ObjectChatCompletionChunk,
+			Created:  chunk.Created,
+			Model:    modelName,
+			Choices:  []StreamChoice{choice},
+			Provider: p.GetName(),
+		}
+		if !sendStreamChunk(ctx, ch, streamResp) {
+			return false
+		}
+
+		if chunk.IsEnd {
+			usage := chunk.Usage.toTokenUsage()
+			sendStreamChunk(ctx, ch, &ChatStreamResponse{
+				ID:       chunk.ID,
+				Object:   ObjectChatCompletionChunk,
+				Created:  chunk.Created,
+				Model:    modelName,
+				Usage:    &usage,
+				Done:     true,
+				Provider: p.GetName(),
+			})
+			return false
+		}
+		return true
+	})
+
+	if err != nil {
+		sendStreamChunk(ctx, ch, &ChatStreamResponse{
+			Error: &APIError{
+				Code:    ErrorCodeNetworkError,
+				Message: fmt.Sprintf("读取流式数据失败: %v", err),
+			},
+			Provider: p.GetName(),
+		})
+	}
+}
+
+// convertToStandardResponse 转换为标准响应
+func (p *BaiduProvider) convertToStandardResponse(modelName string, resp *BaiduChatResponse) *ChatResponse {
+	var toolCalls []ToolCall
+	if call := resp.toolCall(); call != nil {
+		toolCalls = []ToolCall{*call}
+	}
+
+	return &ChatResponse{
+		ID:      resp.ID,
+		Object:  ObjectChatCompletion,
+		Created: resp.Created,
+		Model:   modelName,
+		Choices: []Choice{
+			{
+				Index: 0,
+				Message: Message{
+					Role:      model.MessageRoleAssistant,
+					Content:   resp.Result,
+					ToolCalls: toolCalls,
+				},
+				FinishReason: mapBaiduFinishReason(resp.FinishReason),
+			},
+		},
+		Usage:    resp.Usage.toTokenUsage(),
+		Provider: p.GetName(),
+		Extra: map[string]interface{}{
+			"is_truncated":       resp.IsTruncated,
+			"need_clear_history": resp.NeedClearHistory,
+		},
+	}
+}
+
+// 百度 API 结构体定义
+
+// BaiduTokenResponse 百度 access_token 响应
+type BaiduTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// BaiduChatRequest 文心一言对话请求
+type BaiduChatRequest struct {
+	Messages        []BaiduMessage   `json:"messages"`
+	System          string           `json:"system,omitempty"`
+	Temperature     *float32         `json:"temperature,omitempty"`
+	TopP            *float32         `json:"top_p,omitempty"`
+	PenaltyScore    *float32         `json:"penalty_score,omitempty"`
+	Stop            []string         `json:"stop,omitempty"`
+	MaxOutputTokens *int             `json:"max_output_tokens,omitempty"`
+	Stream          bool             `json:"stream,omitempty"`
+	UserID          string           `json:"user_id,omitempty"`
+	Functions       []BaiduFunction  `json:"functions,omitempty"`
+	ToolChoice      *BaiduToolChoice `json:"tool_choice,omitempty"`
+}
+
+// BaiduMessage 文心一言消息
+type BaiduMessage struct {
+	Role         string             `json:"role"` // user, assistant, function
+	Content      string             `json:"content"`
+	Name         string             `json:"name,omitempty"` // function 消息对应的函数名
+	FunctionCall *BaiduFunctionCall `json:"function_call,omitempty"`
+}
+
+// BaiduFunction 文心一言函数定义
+type BaiduFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// BaiduFunctionCall 文心一言函数调用
+type BaiduFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Thoughts  string `json:"thoughts,omitempty"`
+}
+
+// BaiduToolChoice 文心一言指定调用的函数
+type BaiduToolChoice struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"`
+}
+
+// BaiduChatResponse 文心一言对话响应（流式和非流式共用）
+type BaiduChatResponse struct {
+	ID               string             `json:"id"`
+	Object           string             `json:"object"`
+	Created          int64              `json:"created"`
+	SentenceID       int                `json:"sentence_id,omitempty"`
+	IsEnd            bool               `json:"is_end,omitempty"`
+	IsTruncated      bool               `json:"is_truncated"`
+	Result           string             `json:"result"`
+	FinishReason     string             `json:"finish_reason,omitempty"`
+	NeedClearHistory bool               `json:"need_clear_history"`
+	FunctionCall     *BaiduFunctionCall `json:"function_call,omitempty"`
+	Usage            BaiduUsage         `json:"usage"`
+	ErrorCode        int                `json:"error_code,omitempty"`
+	ErrorMsg         string             `json:"error_msg,omitempty"`
+}
+
+// BaiduUsage 文心一言使用量
+type BaiduUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// toolCall 转换响应中的函数调用，文心一言不返回调用ID，使用响应ID生成
+func (r *BaiduChatResponse) toolCall() *ToolCall {
+	if r.FunctionCall == nil {
+		return nil
+	}
+	return &ToolCall{
+		ID:   "call_" + r.ID,
+		Type: ToolTypeFunction,
+		Function: ToolCallFunction{
+			Name:      r.FunctionCall.Name,
+			Arguments: r.FunctionCall.Arguments,
+		},
+	}
+}
+
+// toTokenUsage 转换为标准使用量
+func (u BaiduUsage) toTokenUsage() model.TokenUsage {
+	return model.TokenUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
+
+// 辅助函数
+
+// baiduEndpoint 获取模型对应的接口路径
+func baiduEndpoint(modelName string) string {
+	if endpoint, exists := baiduModelEndpoints[modelName]; exists {
+		return endpoint
+	}
+	return modelName
+}
+
+// checkBaiduImages 文心一言对话接口不支持图片输入
+func checkBaiduImages(req *ChatRequest) error {
+	if hasImages(req.Messages) {
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: "文心一言暂不支持图片输入",
+		}
+	}
+	return nil
+}
+
+// convertToBaiduFunctions 转换工具定义，文心一言要求必须提供描述和参数定义
+func convertToBaiduFunctions(tools []ToolDefinition) []BaiduFunction {
+	functions := make([]BaiduFunction, len(tools))
+	for i, tool := range tools {
+		parameters := tool.Function.Parameters
+		if len(parameters) == 0 {
+			parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		description := tool.Function.Description
+		if description == "" {
+			description = tool.Function.Name
+		}
+		functions[i] = BaiduFunction{
+			Name:        tool.Function.Name,
+			Description: description,
+			Parameters:  parameters,
+		}
+	}
+	return functions
+}
+
+// convertToBaiduToolChoice 转换工具选择策略
+// 文心一言只支持指定函数，required 在只有一个工具时等同于指定该工具.
+func convertToBaiduToolChoice(tools []ToolDefinition, choice *ToolChoice) *BaiduToolChoice {
+	if choice == nil {
+		return nil
+	}
+
+	name := ""
+	switch {
+	case choice.Type == ToolChoiceFunction:
+		name = choice.Function
+	case choice.Type == ToolChoiceRequired && len(tools) == 1:
+		name = tools[0].Function.Name
+	default:
+		return nil
+	}
+
+	baiduChoice := &BaiduToolChoice{Type: ToolTypeFunction}
+	baiduChoice.Function.Name = name
+	return baiduChoice
+}
+
+// newBaiduAPIError 根据百度错误码创建 API 错误，Type 字段保存原始错误码
+func newBaiduAPIError(code int, message string) *APIError {
+	return &APIError{
+		Code:    mapBaiduErrorCode(code),
+		Message: message,
+		Type:    fmt.Sprintf("%d", code),
+	}
+}
+
+// isBaiduTokenError 检查是否为 access_token 无效或过期错误
+func isBaiduTokenError(errorType string) bool {
+	return errorType == "110" || errorType == "111"
+}
+
+// mapBaiduErrorCode 映射百度错误代码
+func mapBaiduErrorCode(code int) string {
+	switch code {
+	case 110, 111, 6, 13, 14, 15:
+		return ErrorCodeAuthenticationError
+	case 4, 18, 336100:
+		return ErrorCodeRateLimitExceeded
+	case 17, 19:
+		return ErrorCodeQuotaExceeded
+	case 336001, 336002, 336003, 336006, 336007:
+		return ErrorCodeInvalidRequest
+	default:
+		return ErrorCodeProviderError
+	}
+}
+
+// mapBaiduFinishReason 映射百度完成原因
+func mapBaiduFinishReason(reason string) string {
+	switch reason {
+	case "length":
+		return FinishReasonLength
+	case "content_filter":
+		return FinishReasonContentFilter
+	case "function_call":
+		return FinishReasonToolCalls
+	default:
+		return FinishReasonStop
+	}
+}
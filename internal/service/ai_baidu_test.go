@@ -0,0 +1,129 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaiduProviderAccessTokenCache(t *testing.T) {
+	var tokenRequests, chatRequests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/oauth/2.0/token" {
+			n := atomic.AddInt32(&tokenRequests, 1)
+			assert.Equal(t, "client_credentials", r.URL.Query().Get("grant_type"))
+			assert.Equal(t, "ak", r.URL.Query().Get("client_id"))
+			assert.Equal(t, "sk", r.URL.Query().Get("client_secret"))
+			fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":2592000}`, n)
+			return
+		}
+
+		require.True(t, strings.HasSuffix(r.URL.Path, "/chat/completions"))
+		n := atomic.AddInt32(&chatRequests, 1)
+
+		// 第一次对话返回 access_token 过期，应刷新后重试
+		if n == 1 {
+			assert.Equal(t, "token-1", r.URL.Query().Get("access_token"))
+			fmt.Fprint(w, `{"error_code":111,"error_msg":"Access token expired"}`)
+			return
+		}
+		assert.Equal(t, "token-2", r.URL.Query().Get("access_token"))
+		fmt.Fprint(w, `{"id":"as-1","object":"chat.completion","created":1700000000,"result":"你好",`+
+			`"finish_reason":"normal","usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`)
+	}))
+	defer server.Close()
+
+	provider := NewBaiduProvider(config.ProviderConfig{
+		BaseURL:   server.URL,
+		APIKey:    "ak",
+		SecretKey: "sk",
+		Models:    []config.ModelConfig{{Name: "ernie-bot"}},
+	})
+
+	req := NewChatRequest("ernie-bot", []Message{{Role: "user", Content: "你好"}})
+	for i := 0; i < 2; i++ {
+		resp, err := provider.Chat(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, "你好", resp.GetLastAssistantMessage())
+		assert.Equal(t, FinishReasonStop, resp.Choices[0].FinishReason)
+		assert.Equal(t, 5, resp.Usage.TotalTokens)
+	}
+
+	// 过期后刷新一次，之后复用缓存
+	assert.Equal(t, int32(2), atomic.LoadInt32(&tokenRequests))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&chatRequests))
+}
+
+func TestBaiduProviderFunctionCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/oauth/2.0/token" {
+			fmt.Fprint(w, `{"access_token":"token","expires_in":2592000}`)
+			return
+		}
+
+		var req BaiduChatRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Functions, 1)
+		assert.Equal(t, "get_weather", req.Functions[0].Name)
+
+		// 工具结果转换为 function 角色，并带上函数名
+		require.Len(t, req.Messages, 3)
+		require.NotNil(t, req.Messages[1].FunctionCall)
+		assert.Equal(t, "get_weather", req.Messages[1].FunctionCall.Name)
+		assert.Equal(t, "function", req.Messages[2].Role)
+		assert.Equal(t, "get_weather", req.Messages[2].Name)
+
+		fmt.Fprint(w, `{"id":"as-2","created":1700000000,"result":"","finish_reason":"function_call",`+
+			`"function_call":{"name":"get_weather","arguments":"{\"city\":\"广州\"}","thoughts":"需要查询天气"},`+
+			`"usage":{"prompt_tokens":20,"completion_tokens":6,"total_tokens":26}}`)
+	}))
+	defer server.Close()
+
+	provider := NewBaiduProvider(config.ProviderConfig{
+		BaseURL:   server.URL,
+		APIKey:    "ak",
+		SecretKey: "sk",
+		Models:    []config.ModelConfig{{Name: "ernie-bot-4"}},
+	})
+	resp, err := provider.Chat(context.Background(), newToolTestRequest("ernie-bot-4"))
+	require.NoError(t, err)
+
+	assert.Equal(t, FinishReasonToolCalls, resp.Choices[0].FinishReason)
+	require.Len(t, resp.Choices[0].Message.ToolCalls, 1)
+	call := resp.Choices[0].Message.ToolCalls[0]
+	assert.Equal(t, "call_as-2", call.ID)
+	assert.Equal(t, "get_weather", call.Function.Name)
+	assert.JSONEq(t, `{"city":"广州"}`, call.Function.Arguments)
+}
+
+func TestBaiduProviderRejectsImages(t *testing.T) {
+	provider := NewBaiduProvider(config.ProviderConfig{
+		BaseURL:   "http://127.0.0.1:0",
+		APIKey:    "ak",
+		SecretKey: "sk",
+		Models:    []config.ModelConfig{{Name: "ernie-bot-4"}},
+	})
+
+	_, err := provider.Chat(context.Background(), newImageTestRequest("ernie-bot-4"))
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorCodeInvalidRequest, apiErr.Code)
+
+	_, err = provider.ChatStream(context.Background(), newImageTestRequest("ernie-bot-4"))
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorCodeInvalidRequest, apiErr.Code)
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"ai-svc/internal/model"
+	"ai-svc/pkg/logger"
+	"context"
+	"errors"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// branchPreviewMaxRunes 分支列表中最后一条消息摘录的最大长度
+const branchPreviewMaxRunes = 60
+
+// ErrMessageNotFound 消息不存在或不属于该对话
+var ErrMessageNotFound = errors.New("消息不存在")
+
+// RegenerateMessage 重新生成回复，新回复与原回复并列成为新的分支，并设为当前分支
+// messageID 可以是用户消息或助手回复，为助手回复时重新回答它所回应的用户消息.
+func (s *aiService) RegenerateMessage(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	messageID uint,
+	options *ChatOptions,
+) (*model.AIMessage, error) {
+	if options == nil {
+		options = &ChatOptions{}
+	}
+	output, err := newStructuredOutput(options.ResponseFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	conversation, target, req, reservation, err := s.prepareRegenerate(ctx, userID, sessionID, messageID, options)
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.Release()
+
+	// 重新生成不保存新的用户消息
+	counts := newUsageCounts(conversation.MessageCount)
+	return s.generateReply(ctx, conversation, target, req, options, output, counts)
+}
+
+// RegenerateMessageStream 重新生成回复并以流式方式返回
+func (s *aiService) RegenerateMessageStream(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	messageID uint,
+	options *ChatOptions,
+) (*ChatStream, error) {
+	if options == nil {
+		options = &ChatOptions{}
+	}
+	if err := rejectStreamingResponseFormat(options.ResponseFormat); err != nil {
+		return nil, err
+	}
+
+	conversation, target, req, reservation, err := s.prepareRegenerate(ctx, userID, sessionID, messageID, options)
+	if err != nil {
+		return nil, err
+	}
+	return s.startStream(ctx, conversation, target, req, reservation, newUsageCounts(conversation.MessageCount))
+}
+
+// ListBranches 列出对话的全部分支，最近更新的在前
+func (s *aiService) ListBranches(ctx context.Context, userID uint, sessionID string) ([]*BranchInfo, error) {
+	conversation, err := s.GetConversation(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := s.loadMessageTree(conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var currentLeaf uint
+	if conversation.CurrentMessageID != nil {
+		currentLeaf = tree.latestLeaf(*conversation.CurrentMessageID)
+	}
+
+	leaves := tree.leaves()
+	branches := make([]*BranchInfo, 0, len(leaves))
+	for _, leaf := range leaves {
+		branches = append(branches, &BranchInfo{
+			LeafID:        leaf.ID,
+			MessageCount:  tree.depth(leaf.ID),
+			Preview:       truncateRunes(collapseSpaces(leaf.Content), branchPreviewMaxRunes),
+			LastMessageAt: leaf.CreatedAt,
+			Current:       leaf.ID == currentLeaf,
+		})
+	}
+	return branches, nil
+}
+
+// SwitchBranch 切换到包含指定消息的分支，返回该分支的全部消息
+// 指定的消息之后还有多个分支时切换到其中最近更新的一个.
+func (s *aiService) SwitchBranch(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	messageID uint,
+) ([]*model.AIMessage, error) {
+	conversation, err := s.GetConversation(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := s.loadMessageTree(conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := tree.nodes[messageID]; !exists {
+		return nil, ErrMessageNotFound
+	}
+
+	leafID := tree.latestLeaf(messageID)
+	updates := map[string]interface{}{"current_message_id": leafID}
+	if err := s.repo.UpdateConversationFields(conversation.ID, updates); err != nil {
+		logger.Error("切换对话分支失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"message_id":      leafID,
+			"error":           err.Error(),
+		})
+		return nil, errors.New("切换分支失败")
+	}
+
+	messages, err := s.repo.GetMessagePath(conversation.ID, leafID, 0)
+	if err != nil {
+		logger.Error("获取分支消息失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"message_id":      leafID,
+			"error":           err.Error(),
+		})
+		return nil, errors.New("获取分支消息失败")
+	}
+	return messages, nil
+}
+
+// prepareRegenerate 准备重新生成：找到要回答的用户消息，按它之前的分支构建请求并预占配额
+// 新回复接在该用户消息之后，不再保存用户消息.
+func (s *aiService) prepareRegenerate(
+	ctx context.Context,
+	userID uint,
+	sessionID string,
+	messageID uint,
+	options *ChatOptions,
+) (*model.AIConversation, *chatTarget, *ChatRequest, *quotaReservation, error) {
+	conversation, err := s.GetConversation(ctx, userID, sessionID)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	prompt, err := s.findPrompt(conversation.ID, messageID)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	latest := Message{
+		Role:    model.MessageRoleUser,
+		Content: prompt.Content,
+		Parts:   partsFromAttachments(prompt.Content, prompt.Attachments),
+	}
+	target, req, reservation, err := s.prepareRequest(conversation, prompt.ParentID, latest, options)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	conversation.SetCurrentMessage(prompt.ID)
+	return conversation, target, req, reservation, nil
+}
+
+// forkParent 确定新用户消息的上一条消息
+func (s *aiService) forkParent(conversation *model.AIConversation, forkFrom uint) (*uint, error) {
+	if forkFrom == 0 {
+		return conversation.CurrentMessageID, nil
+	}
+
+	message, err := s.getMessage(conversation.ID, forkFrom)
+	if err != nil {
+		return nil, err
+	}
+	// 从用户消息分叉相当于编辑后重新发送，新消息与其并列
+	if message.Role == model.MessageRoleUser {
+		return message.ParentID, nil
+	}
+	return &message.ID, nil
+}
+
+// findPrompt 找到消息所回应的用户消息：沿分支向前查找，跳过工具调用的中间步骤
+func (s *aiService) findPrompt(conversationID, messageID uint) (*model.AIMessage, error) {
+	message, err := s.getMessage(conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	for message.Role != model.MessageRoleUser {
+		if message.ParentID == nil {
+			return nil, &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: "该消息之前没有用户消息，无法重新生成",
+			}
+		}
+		if message, err = s.getMessage(conversationID, *message.ParentID); err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+// getMessage 获取对话中的一条消息
+func (s *aiService) getMessage(conversationID, messageID uint) (*model.AIMessage, error) {
+	message, err := s.repo.GetMessage(conversationID, messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		logger.Error("查询AI消息失败", map[string]any{
+			"conversation_id": conversationID,
+			"message_id":      messageID,
+			"error":           err.Error(),
+		})
+		return nil, errors.New("获取消息失败")
+	}
+	return message, nil
+}
+
+// loadMessageTree 加载对话的消息树
+func (s *aiService) loadMessageTree(conversationID uint) (*messageTree, error) {
+	messages, err := s.repo.GetMessageTree(conversationID)
+	if err != nil {
+		logger.Error("加载对话消息树失败", map[string]any{
+			"conversation_id": conversationID,
+			"error":           err.Error(),
+		})
+		return nil, errors.New("获取对话分支失败")
+	}
+	return newMessageTree(messages), nil
+}
+
+// messageTree 按上一条消息组织的对话消息
+type messageTree struct {
+	nodes    map[uint]*model.AIMessage
+	children map[uint][]uint
+}
+
+// newMessageTree 构建消息树
+func newMessageTree(messages []*model.AIMessage) *messageTree {
+	t := &messageTree{
+		nodes:    make(map[uint]*model.AIMessage, len(messages)),
+		children: make(map[uint][]uint),
+	}
+	for _, message := range messages {
+		t.nodes[message.ID] = message
+	}
+	for _, message := range messages {
+		if message.ParentID != nil {
+			t.children[*message.ParentID] = append(t.children[*message.ParentID], message.ID)
+		}
+	}
+	return t
+}
+
+// leaves 获取所有分支的最后一条消息，按 ID 从新到旧排列
+func (t *messageTree) leaves() []*model.AIMessage {
+	var leaves []*model.AIMessage
+	for id, message := range t.nodes {
+		if len(t.children[id]) == 0 {
+			leaves = append(leaves, message)
+		}
+	}
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].ID > leaves[j].ID })
+	return leaves
+}
+
+// depth 计算从第一条消息到指定消息的路径长度
+func (t *messageTree) depth(id uint) int {
+	depth := 0
+	for message, exists := t.nodes[id]; exists; {
+		depth++
+		if message.ParentID == nil {
+			break
+		}
+		message, exists = t.nodes[*message.ParentID]
+	}
+	return depth
+}
+
+// latestLeaf 获取指定消息之后最近创建的一条消息（即最近更新的分支末尾），没有后续消息时返回其本身
+// 后续消息总是晚于上一条消息创建，子树中 ID 最大的消息必然是分支末尾.
+func (t *messageTree) latestLeaf(id uint) uint {
+	latest := id
+	pending := []uint{id}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		latest = max(latest, current)
+		pending = append(pending, t.children[current]...)
+	}
+	return latest
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegenerateAndForkFollowBranchPath(t *testing.T) {
+	provider := &fakeProvider{replies: []string{"回答一", "回答二", "重新回答", "分叉回答", "回答三"}}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, func(s *aiService) {
+		s.config.Features.History = config.HistoryConfig{Enabled: true}
+	})
+	ctx := context.Background()
+
+	_, err := s.SendMessage(ctx, 1, "", "问题一", nil)
+	require.NoError(t, err)
+	sessionID := repo.conversations[0].SessionID
+	_, err = s.SendMessage(ctx, 1, sessionID, "问题二", nil)
+	require.NoError(t, err)
+
+	// 重新生成助手回复：按用户消息之前的分支请求，新回复与原回复并列
+	regenerated, err := s.RegenerateMessage(ctx, 1, sessionID, 4, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "重新回答", regenerated.Content)
+	assert.Equal(t, uintPtr(3), regenerated.ParentID)
+	assert.Equal(t, []string{"问题一", "回答一", "问题二"}, requestContents(provider.requests[2]))
+
+	// 从用户消息分叉相当于编辑后重新发送
+	forked, err := s.SendMessage(ctx, 1, sessionID, "改写的问题二", &ChatOptions{ForkFrom: 3})
+	require.NoError(t, err)
+	assert.Equal(t, uintPtr(2), repo.messages[5].ParentID)
+	assert.Equal(t, uintPtr(6), forked.ParentID)
+	assert.Equal(t, []string{"问题一", "回答一", "改写的问题二"}, requestContents(provider.requests[3]))
+
+	// 之后的消息接在当前分支末尾，上下文只包含当前分支
+	_, err = s.SendMessage(ctx, 1, sessionID, "问题三", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"问题一", "回答一", "改写的问题二", "分叉回答", "问题三"},
+		requestContents(provider.requests[4]))
+
+	// 消息列表只包含当前分支，按路径分页
+	messages, err := s.GetMessages(ctx, 1, sessionID, 2, 4)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "问题三", messages[0].Content)
+	assert.Equal(t, "回答三", messages[1].Content)
+
+	_, err = s.RegenerateMessage(ctx, 1, sessionID, 99, nil)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, err = s.SendMessage(ctx, 1, sessionID, "问题", &ChatOptions{ForkFrom: 99})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+}
+
+func TestListAndSwitchBranches(t *testing.T) {
+	provider := &fakeProvider{replies: []string{"回答一", "回答二", "重新回答", "追问回答"}}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, func(s *aiService) {
+		s.config.Features.History = config.HistoryConfig{Enabled: true}
+	})
+	ctx := context.Background()
+
+	_, err := s.SendMessage(ctx, 1, "", "问题一", nil)
+	require.NoError(t, err)
+	sessionID := repo.conversations[0].SessionID
+	_, err = s.SendMessage(ctx, 1, sessionID, "问题二", nil)
+	require.NoError(t, err)
+	_, err = s.RegenerateMessage(ctx, 1, sessionID, 3, nil)
+	require.NoError(t, err)
+
+	branches, err := s.ListBranches(ctx, 1, sessionID)
+	require.NoError(t, err)
+	require.Len(t, branches, 2)
+	assert.Equal(t, uint(5), branches[0].LeafID)
+	assert.Equal(t, "重新回答", branches[0].Preview)
+	assert.Equal(t, 4, branches[0].MessageCount)
+	assert.True(t, branches[0].Current)
+	assert.Equal(t, uint(4), branches[1].LeafID)
+	assert.False(t, branches[1].Current)
+
+	// 切换到原回复所在的分支后继续对话
+	messages, err := s.SwitchBranch(ctx, 1, sessionID, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user", "assistant", "user", "assistant"}, messageRoles(messages))
+	assert.Equal(t, "回答二", messages[3].Content)
+
+	_, err = s.SendMessage(ctx, 1, sessionID, "追问", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"问题一", "回答一", "问题二", "回答二", "追问"},
+		requestContents(provider.requests[3]))
+
+	// 指定的消息之后有多个分支时切换到最近更新的一个
+	messages, err = s.SwitchBranch(ctx, 1, sessionID, 1)
+	require.NoError(t, err)
+	require.Len(t, messages, 6)
+	assert.Equal(t, "追问回答", messages[5].Content)
+
+	_, err = s.SwitchBranch(ctx, 1, sessionID, 99)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+}
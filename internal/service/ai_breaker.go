@@ -0,0 +1,191 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// 熔断器状态常量
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+const (
+	// defaultFailureThreshold 未配置时的连续失败熔断阈值
+	defaultFailureThreshold = 5
+
+	// defaultOpenTimeout 未配置时的熔断持续时间
+	defaultOpenTimeout = 30 * time.Second
+
+	// defaultHalfOpenSuccesses 未配置时半开状态恢复所需的连续成功次数
+	defaultHalfOpenSuccesses = 2
+)
+
+// CircuitStats 熔断器统计
+// ErrorCount/SuccessCount 与 model.AIProviderConfig 语义一致，为累计次数.
+type CircuitStats struct {
+	State        string     `json:"state"`
+	ErrorCount   int        `json:"error_count"`
+	SuccessCount int        `json:"success_count"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	OpenedAt     *time.Time `json:"opened_at,omitempty"`
+}
+
+// circuitBreaker 单个提供商的熔断器
+// closed 时正常放行并统计连续失败；达到阈值后 open，拒绝所有请求；
+// 熔断到期后 half_open，每次只放行一个探测请求，连续成功足够次数后恢复 closed，失败则重新 open.
+type circuitBreaker struct {
+	mu     sync.Mutex
+	config config.CircuitBreakerConfig
+	now    func() time.Time
+
+	state     string
+	usage     model.AIProviderConfig // 复用 ErrorCount/SuccessCount/LastUsedAt 统计
+	failures  int                    // closed 状态下的连续失败次数
+	successes int                    // half_open 状态下的连续成功次数
+	probing   bool                   // half_open 状态下是否有探测请求未返回
+	lastError string
+	openedAt  time.Time
+}
+
+// newCircuitBreaker 创建熔断器，未配置的参数使用默认值
+func newCircuitBreaker(cfg config.CircuitBreakerConfig) *circuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaultOpenTimeout
+	}
+	if cfg.HalfOpenSuccesses <= 0 {
+		cfg.HalfOpenSuccesses = defaultHalfOpenSuccesses
+	}
+
+	return &circuitBreaker{
+		config: cfg,
+		now:    time.Now,
+		state:  CircuitStateClosed,
+	}
+}
+
+// Allow 判断是否放行请求，放行后必须调用 Record 报告结果
+func (b *circuitBreaker) Allow() bool {
+	if !b.config.Enabled {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitStateOpen:
+		if b.now().Sub(b.openedAt) < b.config.OpenTimeout {
+			return false
+		}
+		b.state = CircuitStateHalfOpen
+		b.successes = 0
+		b.probing = true
+		return true
+	case CircuitStateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record 报告请求结果，不属于提供商故障的错误按成功处理
+func (b *circuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := isProviderFailure(err)
+	b.usage.UpdateUsage(!failed)
+	if failed {
+		b.lastError = err.Error()
+	}
+	if !b.config.Enabled {
+		return
+	}
+
+	switch b.state {
+	case CircuitStateHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenSuccesses {
+			b.state = CircuitStateClosed
+			b.failures = 0
+			b.lastError = ""
+		}
+	case CircuitStateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.open()
+		}
+	}
+}
+
+// Release 放弃本次结果（如调用方取消请求），释放半开状态的探测名额
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Stats 获取熔断器统计
+func (b *circuitBreaker) Stats() CircuitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := CircuitStats{
+		State:        b.state,
+		ErrorCount:   b.usage.ErrorCount,
+		SuccessCount: b.usage.SuccessCount,
+		LastUsedAt:   b.usage.LastUsedAt,
+		LastError:    b.lastError,
+	}
+	if b.state != CircuitStateClosed {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
+
+// open 进入熔断状态，调用方需持有锁
+func (b *circuitBreaker) open() {
+	b.state = CircuitStateOpen
+	b.openedAt = b.now()
+	b.failures = 0
+	b.successes = 0
+}
+
+// isProviderFailure 判断错误是否应计入提供商失败
+// 请求本身无效或调用方取消不代表提供商故障.
+func isProviderFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code != ErrorCodeInvalidRequest && apiErr.Code != ErrorCodeInvalidModel
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(config.CircuitBreakerConfig{
+		Enabled:           true,
+		FailureThreshold:  2,
+		OpenTimeout:       time.Minute,
+		HalfOpenSuccesses: 2,
+	})
+	breaker.now = func() time.Time { return now }
+
+	failure := &APIError{Code: ErrorCodeProviderError, Message: "HTTP错误: 503"}
+
+	// 请求本身无效不计入失败
+	require.True(t, breaker.Allow())
+	breaker.Record(&APIError{Code: ErrorCodeInvalidRequest, Message: "bad request"})
+	require.True(t, breaker.Allow())
+	breaker.Record(failure)
+	assert.Equal(t, CircuitStateClosed, breaker.Stats().State)
+
+	// 连续失败达到阈值后熔断
+	require.True(t, breaker.Allow())
+	breaker.Record(failure)
+	assert.Equal(t, CircuitStateOpen, breaker.Stats().State)
+	assert.False(t, breaker.Allow())
+
+	// 到期后半开，只放行一个探测请求，探测失败重新熔断
+	now = now.Add(time.Minute)
+	require.True(t, breaker.Allow())
+	assert.False(t, breaker.Allow())
+	breaker.Record(failure)
+	assert.Equal(t, CircuitStateOpen, breaker.Stats().State)
+
+	// 半开状态连续成功后恢复
+	now = now.Add(time.Minute)
+	require.True(t, breaker.Allow())
+	breaker.Record(nil)
+	assert.Equal(t, CircuitStateHalfOpen, breaker.Stats().State)
+	require.True(t, breaker.Allow())
+	breaker.Record(nil)
+
+	stats := breaker.Stats()
+	assert.Equal(t, CircuitStateClosed, stats.State)
+	assert.Empty(t, stats.LastError)
+	assert.Equal(t, 3, stats.ErrorCount)
+	assert.Equal(t, 3, stats.SuccessCount)
+	assert.NotNil(t, stats.LastUsedAt)
+}
+
+func TestProviderRegistryCircuitHealth(t *testing.T) {
+	var created []*fakeProvider
+	registry := newFakeRegistry(t, &created)
+	require.NoError(t, registry.LoadFromConfig(&config.AIConfig{
+		CircuitBreaker: config.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, OpenTimeout: time.Minute},
+		Providers: map[string]config.ProviderConfig{
+			"a": {Enabled: true, Type: "fake", APIKey: "key"},
+		},
+	}))
+
+	require.True(t, registry.Allow("a"))
+	registry.RecordResult(context.Background(), "a", &APIError{Code: ErrorCodeNetworkError, Message: "连接超时"})
+
+	health, exists := registry.Health("a")
+	require.True(t, exists)
+	assert.Equal(t, ProviderStatusError, health.Status)
+	assert.Equal(t, "连接超时", health.LastError)
+	require.NotNil(t, health.Circuit)
+	assert.Equal(t, CircuitStateOpen, health.Circuit.State)
+	assert.False(t, registry.Allow("a"))
+
+	// 熔断中的提供商不再被调用，直接切换到下一个目标
+	s := &aiService{config: &config.AIConfig{}, registry: registry}
+	err := s.withRetry(context.Background(), &chatTarget{providerName: "a"}, func() error {
+		t.Fatal("熔断中不应调用提供商")
+		return nil
+	})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeProviderUnavailable, apiErr.Code)
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/pkg/cache"
+	"ai-svc/pkg/logger"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 回复缓存存储类型常量
+const (
+	CacheStoreMemory = "memory"
+	CacheStoreRedis  = "redis"
+)
+
+const (
+	// defaultCacheEntries 未配置时进程内缓存的最大条目数
+	defaultCacheEntries = 1000
+
+	// defaultCacheTTL 未配置时的缓存时间
+	defaultCacheTTL = time.Hour
+
+	// cachePingTimeout 启动时检查 Redis 连接的超时时间
+	cachePingTimeout = 3 * time.Second
+)
+
+// NewResponseCacheStore 按配置创建回复缓存存储，未启用时返回 nil
+// Redis 不可用时退回进程内缓存，缓存故障不影响服务启动.
+func NewResponseCacheStore(cfg config.CacheConfig, redisCfg config.RedisConfig) (cache.Store, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	entries := cfg.MaxEntries
+	if entries <= 0 {
+		entries = defaultCacheEntries
+	}
+
+	switch cfg.Store {
+	case "", CacheStoreMemory:
+		return cache.NewLRU(entries), nil
+	case CacheStoreRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:         redisCfg.GetRedisAddr(),
+			Password:     redisCfg.Password,
+			DB:           redisCfg.DB,
+			PoolSize:     redisCfg.PoolSize,
+			MinIdleConns: redisCfg.MinIdleConns,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), cachePingTimeout)
+		defer cancel()
+		if err := client.Ping(ctx).Err(); err != nil {
+			client.Close()
+			logger.Warn("连接Redis失败，回复缓存改用进程内缓存", map[string]any{
+				"addr":  redisCfg.GetRedisAddr(),
+				"error": err.Error(),
+			})
+			return cache.NewLRU(entries), nil
+		}
+		return cache.NewRedisStore(client, cfg.KeyPrefix), nil
+	default:
+		return nil, fmt.Errorf("不支持的缓存存储类型: %s", cfg.Store)
+	}
+}
+
+// cachedReply 缓存的回复
+type cachedReply struct {
+	Response *ChatResponse `json:"response"`
+	Provider string        `json:"provider"`
+	Model    string        `json:"model"`
+	CachedAt time.Time     `json:"cached_at"`
+}
+
+// cacheKeyPayload 参与缓存键计算的请求内容，字段顺序固定以保证序列化结果稳定
+type cacheKeyPayload struct {
+	Provider         string           `json:"provider"`
+	Model            string           `json:"model"`
+	Messages         []Message        `json:"messages"`
+	Temperature      *float32         `json:"temperature"`
+	MaxTokens        *int             `json:"max_tokens"`
+	TopP             *float32         `json:"top_p"`
+	FrequencyPenalty *float32         `json:"frequency_penalty"`
+	PresencePenalty  *float32         `json:"presence_penalty"`
+	Stop             []string         `json:"stop"`
+	Tools            []ToolDefinition `json:"tools,omitempty"`
+	ToolChoice       *ToolChoice      `json:"tool_choice,omitempty"`
+}
+
+// responseCacheKey 计算请求的缓存键：模型、消息和采样参数规范化后的 SHA-256
+func responseCacheKey(providerName string, req *ChatRequest) string {
+	data, _ := json.Marshal(cacheKeyPayload{
+		Provider:         providerName,
+		Model:            req.Model,
+		Messages:         req.Messages,
+		Temperature:      req.Temperature,
+		MaxTokens:        req.MaxTokens,
+		TopP:             req.TopP,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+		Stop:             req.Stop,
+		Tools:            req.Tools,
+		ToolChoice:       req.ToolChoice,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// shouldUseCache 判断请求是否使用回复缓存
+// 只有结果确定的请求（temperature 为 0）才默认缓存，其他请求需要调用方显式开启.
+func (s *aiService) shouldUseCache(req *ChatRequest, options *ChatOptions) bool {
+	if s.cache == nil {
+		return false
+	}
+	return options.Cache || (req.Temperature != nil && *req.Temperature == 0)
+}
+
+// getCachedReply 读取缓存的回复，读取失败按未命中处理
+func (s *aiService) getCachedReply(ctx context.Context, key string) *cachedReply {
+	data, found, err := s.cache.Get(ctx, key)
+	if err != nil {
+		logger.Warn("读取回复缓存失败", map[string]any{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	if !found {
+		return nil
+	}
+
+	var cached cachedReply
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Response == nil {
+		return nil
+	}
+	return &cached
+}
+
+// storeCachedReply 缓存完整生成的回复，被截断或过滤的回复不缓存
+func (s *aiService) storeCachedReply(ctx context.Context, key string, resp *ChatResponse, target *chatTarget) {
+	finishReason := firstFinishReason(resp)
+	if finishReason != FinishReasonStop && finishReason != "" {
+		return
+	}
+
+	data, err := json.Marshal(cachedReply{
+		Response: resp,
+		Provider: target.providerName,
+		Model:    target.model.Name,
+		CachedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	ttl := time.Duration(s.config.Features.Cache.TTL) * time.Second
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	if err := s.cache.Set(ctx, key, data, ttl); err != nil {
+		logger.Warn("写入回复缓存失败", map[string]any{
+			"error": err.Error(),
+		})
+	}
+}
+
+// saveCachedReply 以缓存的回复作答：不调用提供商，不计 token 和费用
+func (s *aiService) saveCachedReply(
+	conversation *model.AIConversation,
+	cached *cachedReply,
+	req *ChatRequest,
+	elapsed int,
+	counts *usageCounts,
+) (*model.AIMessage, error) {
+	resp := cached.Response
+	metadata := map[string]interface{}{
+		"response_id": resp.ID,
+		"cache_hit":   true,
+		"cached_at":   cached.CachedAt,
+	}
+	content, finishReason := s.filterReply(resp.GetLastAssistantMessage(), firstFinishReason(resp), metadata)
+
+	reply := conversation.AddMessage(model.MessageRoleAssistant, content)
+	reply.Status = model.MessageStatusReceived
+	reply.Provider = cached.Provider
+	reply.Model = cached.Model
+	reply.Temperature = requestTemperature(req)
+	reply.FinishReason = finishReason
+	reply.ResponseTime = elapsed
+	reply.Metadata = encodeMetadata(metadata)
+
+	if err := s.saveReply(conversation, reply, model.TokenUsage{}, counts); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"ai-svc/internal/model"
+	"ai-svc/pkg/cache"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendMessageServesDeterministicRequestFromCache(t *testing.T) {
+	provider := &fakeProvider{}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": provider}, func(s *aiService) {
+		s.cache = cache.NewLRU(10)
+	})
+
+	temperature := float32(0)
+	options := &ChatOptions{Temperature: &temperature}
+	first, err := s.SendMessage(context.Background(), 1, "", "你好", options)
+	require.NoError(t, err)
+	second, err := s.SendMessage(context.Background(), 2, "", "你好", options)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, provider.calls)
+	assert.Equal(t, first.Content, second.Content)
+	assert.Zero(t, second.Cost)
+	assert.Zero(t, second.TotalTokens)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(second.Metadata), &metadata))
+	assert.Equal(t, true, metadata["cache_hit"])
+}
+
+func TestSendMessageSkipsCacheForSampledRequests(t *testing.T) {
+	provider := &fakeProvider{}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": provider}, func(s *aiService) {
+		s.cache = cache.NewLRU(10)
+	})
+
+	temperature := float32(0.7)
+	options := &ChatOptions{Temperature: &temperature}
+	for i := 0; i < 2; i++ {
+		_, err := s.SendMessage(context.Background(), 1, "", "你好", options)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, provider.calls)
+
+	// 调用方显式开启缓存
+	options.Cache = true
+	for i := 0; i < 2; i++ {
+		_, err := s.SendMessage(context.Background(), 1, "", "你好", options)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, provider.calls)
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	temperature := float32(0)
+	req := NewChatRequest("gpt-4", []Message{{Role: model.MessageRoleUser, Content: "你好"}})
+	req.Temperature = &temperature
+	req.User = "1"
+
+	other := *req
+	other.User = "2"
+	assert.Equal(t, responseCacheKey("openai", req), responseCacheKey("openai", &other))
+
+	other.Messages = []Message{{Role: model.MessageRoleUser, Content: "您好"}}
+	assert.NotEqual(t, responseCacheKey("openai", req), responseCacheKey("openai", &other))
+
+	maxTokens := 100
+	other = *req
+	other.MaxTokens = &maxTokens
+	assert.NotEqual(t, responseCacheKey("openai", req), responseCacheKey("openai", &other))
+	assert.NotEqual(t, responseCacheKey("openai", req), responseCacheKey("claude", req))
+}
@@ -0,0 +1,684 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// claudeDefaultBaseURL Claude API 默认地址
+	claudeDefaultBaseURL = "https://api.anthropic.com"
+
+	// claudeDefaultVersion 默认的 anthropic-version 请求头
+	claudeDefaultVersion = "2023-06-01"
+
+	// claudeDefaultMaxTokens Messages API 要求必须指定 max_tokens
+	claudeDefaultMaxTokens = 4096
+)
+
+// Claude 内容块类型
+const (
+	claudeBlockText       = "text"
+	claudeBlockToolUse    = "tool_use"
+	claudeBlockToolResult = "tool_result"
+	claudeBlockImage      = "image"
+)
+
+// ClaudeProvider Anthropic Claude 提供商实现
+type ClaudeProvider struct {
+	config     config.ProviderConfig
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	version    string
+}
+
+// NewClaudeProvider 创建 Claude 提供商
+func NewClaudeProvider(cfg config.ProviderConfig) *ClaudeProvider {
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = claudeDefaultBaseURL
+	}
+	version := cfg.Version
+	if version == "" {
+		version = claudeDefaultVersion
+	}
+
+	return &ClaudeProvider{
+		config:     cfg,
+		baseURL:    baseURL,
+		apiKey:     cfg.APIKey,
+		version:    version,
+		httpClient: newProviderHTTPClient(cfg),
+	}
+}
+
+// GetName 获取提供商名称
+func (p *ClaudeProvider) GetName() string {
+	return "claude"
+}
+
+// Chat 发送聊天请求
+func (p *ClaudeProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	resp, err := p.doRequest(ctx, p.buildRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var claudeResp ClaudeMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeProviderError,
+			Message: fmt.Sprintf("解析响应失败: %v", err),
+		}
+	}
+
+	return p.convertToStandardResponse(&claudeResp), nil
+}
+
+// ChatStream 发送流式聊天请求
+func (p *ClaudeProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatStreamResponse, error) {
+	resp, err := p.doRequest(ctx, p.buildRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *ChatStreamResponse, 10)
+	go p.handleStreamResponse(ctx, resp.Body, ch)
+
+	return ch, nil
+}
+
+// ListModels 列出可用模型
+func (p *ClaudeProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return modelsFromConfig(p.GetName(), p.config), nil
+}
+
+// ValidateConfig 验证配置是否有效
+func (p *ClaudeProvider) ValidateConfig() error {
+	if p.apiKey == "" {
+		return fmt.Errorf("Claude API密钥不能为空")
+	}
+	if len(p.config.Models) == 0 {
+		return fmt.Errorf("Claude 至少需要配置一个模型")
+	}
+	return nil
+}
+
+// Close 关闭连接
+func (p *ClaudeProvider) Close() error {
+	p.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// 私有方法
+
+// buildRequest 构建 Messages API 请求，system 消息合并到顶层 system 字段
+func (p *ClaudeProvider) buildRequest(req *ChatRequest, stream bool) *ClaudeMessageRequest {
+	claudeReq := &ClaudeMessageRequest{
+		Model:         req.Model,
+		MaxTokens:     claudeDefaultMaxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+		Stream:        stream,
+	}
+	if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		claudeReq.MaxTokens = *req.MaxTokens
+	}
+	if req.User != "" {
+		claudeReq.Metadata = &ClaudeMetadata{UserID: req.User}
+	}
+
+	if len(req.Tools) > 0 {
+		claudeReq.Tools = convertToClaudeTools(req.Tools)
+		claudeReq.ToolChoice = convertToClaudeToolChoice(req.ToolChoice)
+	}
+
+	var systemParts []string
+	for _, msg := range req.Messages {
+		if msg.Role == model.MessageRoleSystem {
+			systemParts = append(systemParts, msg.Content)
+			continue
+		}
+
+		// 工具结果以 user 角色的 tool_result 块发送
+		role := msg.Role
+		if role == model.MessageRoleTool {
+			role = model.MessageRoleUser
+		}
+		blocks := convertToClaudeBlocks(msg)
+
+		// 相邻的同角色消息合并，保证 user/assistant 交替
+		last := len(claudeReq.Messages) - 1
+		if last >= 0 && claudeReq.Messages[last].Role == role {
+			claudeReq.Messages[last].Content = append(claudeReq.Messages[last].Content, blocks...)
+			continue
+		}
+		claudeReq.Messages = append(claudeReq.Messages, ClaudeMessage{
+			Role:    role,
+			Content: blocks,
+		})
+	}
+	claudeReq.System = strings.Join(systemParts, "\n\n")
+
+	return claudeReq
+}
+
+// doRequest 发送请求并检查状态码
+func (p *ClaudeProvider) doRequest(ctx context.Context, claudeReq *ClaudeMessageRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(claudeReq)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("序列化请求失败: %v", err),
+		}
+	}
+
+	url := p.baseURL + "/v1/messages"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("创建HTTP请求失败: %v", err),
+		}
+	}
+	p.setHeaders(httpReq, claudeReq.Stream)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("发送请求失败: %v", err),
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, p.handleErrorResponse(resp)
+	}
+
+	return resp, nil
+}
+
+// setHeaders 设置请求头
+func (p *ClaudeProvider) setHeaders(req *http.Request, stream bool) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", p.version)
+	req.Header.Set("User-Agent", "ai-svc/1.0")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+}
+
+// handleErrorResponse 处理错误响应
+func (p *ClaudeProvider) handleErrorResponse(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("读取错误响应失败: %v", err),
+		}
+	}
+
+	var errorResp ClaudeErrorResponse
+	if err := json.Unmarshal(body, &errorResp); err != nil || errorResp.Error.Type == "" {
+		return &APIError{
+			Code:    mapHTTPStatusErrorCode(resp.StatusCode),
+			Message: fmt.Sprintf("HTTP错误 %d: %s", resp.StatusCode, string(body)),
+		}
+	}
+
+	return &APIError{
+		Code:    mapClaudeErrorCode(errorResp.Error.Type),
+		Message: errorResp.Error.Message,
+		Type:    errorResp.Error.Type,
+	}
+}
+
+// handleStreamResponse 处理流式响应
+func (p *ClaudeProvider) handleStreamResponse(
+	ctx context.Context,
+	body io.ReadCloser,
+	ch chan<- *ChatStreamResponse,
+) {
+	defer close(ch)
+	defer body.Close()
+
+	var (
+		messageID string
+		modelName string
+		created   = time.Now().Unix()
+		usage     model.TokenUsage
+
+		// toolIndexes 内容块序号到工具调用序号的映射
+		toolIndexes = make(map[int]int)
+	)
+
+	newChunk := func() *ChatStreamResponse {
+		return &ChatStreamResponse{
+			ID:       messageID,
+			Object:   ObjectChatCompletionChunk,
+			Created:  created,
+			Model:    modelName,
+			Provider: p.GetName(),
+		}
+	}
+
+	// 收到 message_stop 或错误事件前连接断开时，流被截断，按网络错误处理
+	finished := false
+	err := readSSE(body, func(event *sseEvent) bool {
+		if event.Data == "" {
+			return true
+		}
+
+		var streamEvent ClaudeStreamEvent
+		if err := json.Unmarshal([]byte(event.Data), &streamEvent); err != nil {
+			chunk := newChunk()
+			chunk.Error = &APIError{
+				Code:    ErrorCodeProviderError,
+				Message: fmt.Sprintf("解析流式数据失败: %v", err),
+			}
+			finished = true
+			sendStreamChunk(ctx, ch, chunk)
+			return false
+		}
+
+		eventType := streamEvent.Type
+		if eventType == "" {
+			eventType = event.Event
+		}
+
+		switch eventType {
+		case "message_start":
+			if streamEvent.Message != nil {
+				messageID = streamEvent.Message.ID
+				modelName = streamEvent.Message.Model
+				usage.PromptTokens = streamEvent.Message.Usage.InputTokens
+				usage.CompletionTokens = streamEvent.Message.Usage.OutputTokens
+			}
+			chunk := newChunk()
+			chunk.Choices = []StreamChoice{newStreamChoice(model.MessageRoleAssistant, "", nil)}
+			return sendStreamChunk(ctx, ch, chunk)
+
+		case "content_block_start":
+			block := streamEvent.ContentBlock
+			if block == nil || block.Type != claudeBlockToolUse {
+				return true
+			}
+			toolIndex := len(toolIndexes)
+			toolIndexes[streamEvent.Index] = toolIndex
+			chunk := newChunk()
+			chunk.Choices = []StreamChoice{newToolCallStreamChoice(ToolCallDelta{
+				Index:    toolIndex,
+				ID:       block.ID,
+				Type:     ToolTypeFunction,
+				Function: ToolCallFunction{Name: block.Name},
+			})}
+			return sendStreamChunk(ctx, ch, chunk)
+
+		case "content_block_delta":
+			if streamEvent.Delta == nil {
+				return true
+			}
+			chunk := newChunk()
+			if streamEvent.Delta.Type == "input_json_delta" {
+				toolIndex, exists := toolIndexes[streamEvent.Index]
+				if !exists || streamEvent.Delta.PartialJSON == "" {
+					return true
+				}
+				chunk.Choices = []StreamChoice{newToolCallStreamChoice(ToolCallDelta{
+					Index:    toolIndex,
+					Function: ToolCallFunction{Arguments: streamEvent.Delta.PartialJSON},
+				})}
+				return sendStreamChunk(ctx, ch, chunk)
+			}
+			if streamEvent.Delta.Text == "" {
+				return true
+			}
+			chunk.Choices = []StreamChoice{newStreamChoice("", streamEvent.Delta.Text, nil)}
+			return sendStreamChunk(ctx, ch, chunk)
+
+		case "message_delta":
+			if streamEvent.Usage != nil {
+				usage.CompletionTokens = streamEvent.Usage.OutputTokens
+			}
+			if streamEvent.Delta == nil || streamEvent.Delta.StopReason == "" {
+				return true
+			}
+			finishReason := mapClaudeStopReason(streamEvent.Delta.StopReason)
+			chunk := newChunk()
+			chunk.Choices = []StreamChoice{newStreamChoice("", "", &finishReason)}
+			return sendStreamChunk(ctx, ch, chunk)
+
+		case "message_stop":
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+			finalUsage := usage
+			chunk := newChunk()
+			chunk.Usage = &finalUsage
+			chunk.Done = true
+			finished = true
+			sendStreamChunk(ctx, ch, chunk)
+			return false
+
+		case "error":
+			chunk := newChunk()
+			chunk.Error = &APIError{
+				Code:    ErrorCodeProviderError,
+				Message: "Claude 流式响应错误",
+			}
+			if streamEvent.Error != nil {
+				chunk.Error.Code = mapClaudeErrorCode(streamEvent.Error.Type)
+				chunk.Error.Message = streamEvent.Error.Message
+				chunk.Error.Type = streamEvent.Error.Type
+			}
+			finished = true
+			sendStreamChunk(ctx, ch, chunk)
+			return false
+		}
+
+		// ping、content_block_stop 等事件无需处理
+		return true
+	})
+
+	if err == nil && !finished && ctx.Err() == nil {
+		err = errors.New("连接在 message_stop 之前断开")
+	}
+	if err != nil {
+		chunk := newChunk()
+		chunk.Error = &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("读取流式数据失败: %v", err),
+		}
+		sendStreamChunk(ctx, ch, chunk)
+	}
+}
+
+// convertToStandardResponse 转换为标准响应
+func (p *ClaudeProvider) convertToStandardResponse(resp *ClaudeMessageResponse) *ChatResponse {
+	var content strings.Builder
+	var toolCalls []ToolCall
+	for _, block := range resp.Content {
+		switch block.Type {
+		case claudeBlockText:
+			content.WriteString(block.Text)
+		case claudeBlockToolUse:
+			toolCalls = append(toolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     ToolTypeFunction,
+				Function: ToolCallFunction{Name: block.Name, Arguments: string(block.Input)},
+			})
+		}
+	}
+
+	return &ChatResponse{
+		ID:      resp.ID,
+		Object:  ObjectChatCompletion,
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []Choice{
+			{
+				Index: 0,
+				Message: Message{
+					Role:      model.MessageRoleAssistant,
+					Content:   content.String(),
+					ToolCalls: toolCalls,
+				},
+				FinishReason: mapClaudeStopReason(resp.StopReason),
+			},
+		},
+		Usage: model.TokenUsage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+		Provider: p.GetName(),
+	}
+}
+
+// Claude API 结构体定义
+
+// ClaudeMessageRequest Claude Messages API 请求
+type ClaudeMessageRequest struct {
+	Model         string            `json:"model"`
+	MaxTokens     int               `json:"max_tokens"`
+	System        string            `json:"system,omitempty"`
+	Messages      []ClaudeMessage   `json:"messages"`
+	Temperature   *float32          `json:"temperature,omitempty"`
+	TopP          *float32          `json:"top_p,omitempty"`
+	StopSequences []string          `json:"stop_sequences,omitempty"`
+	Stream        bool              `json:"stream,omitempty"`
+	Metadata      *ClaudeMetadata   `json:"metadata,omitempty"`
+	Tools         []ClaudeTool      `json:"tools,omitempty"`
+	ToolChoice    *ClaudeToolChoice `json:"tool_choice,omitempty"`
+}
+
+// ClaudeMessage Claude 消息
+type ClaudeMessage struct {
+	Role    string               `json:"role"`
+	Content []ClaudeContentBlock `json:"content"`
+}
+
+// ClaudeTool Claude 工具定义
+type ClaudeTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ClaudeToolChoice Claude 工具选择策略
+type ClaudeToolChoice struct {
+	Type string `json:"type"` // auto, any, tool, none
+	Name string `json:"name,omitempty"`
+}
+
+// ClaudeMetadata Claude 请求元数据
+type ClaudeMetadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+// ClaudeMessageResponse Claude Messages API 响应
+type ClaudeMessageResponse struct {
+	ID           string               `json:"id"`
+	Type         string               `json:"type"`
+	Role         string               `json:"role"`
+	Content      []ClaudeContentBlock `json:"content"`
+	Model        string               `json:"model"`
+	StopReason   string               `json:"stop_reason"`
+	StopSequence string               `json:"stop_sequence,omitempty"`
+	Usage        ClaudeUsage          `json:"usage"`
+}
+
+// ClaudeContentBlock Claude 内容块（text、image、tool_use、tool_result）
+type ClaudeContentBlock struct {
+	Type      string             `json:"type"`
+	Text      string             `json:"text,omitempty"`
+	Source    *ClaudeImageSource `json:"source,omitempty"`
+	ID        string             `json:"id,omitempty"`
+	Name      string             `json:"name,omitempty"`
+	Input     json.RawMessage    `json:"input,omitempty"`
+	ToolUseID string             `json:"tool_use_id,omitempty"`
+	Content   string             `json:"content,omitempty"`
+}
+
+// ClaudeImageSource Claude 图片来源（base64 或 url）
+type ClaudeImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// ClaudeUsage Claude 使用量
+type ClaudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// ClaudeStreamEvent Claude 流式事件
+type ClaudeStreamEvent struct {
+	Type         string                 `json:"type"`
+	Index        int                    `json:"index"`
+	Message      *ClaudeMessageResponse `json:"message,omitempty"`
+	ContentBlock *ClaudeContentBlock    `json:"content_block,omitempty"`
+	Delta        *ClaudeStreamDelta     `json:"delta,omitempty"`
+	Usage        *ClaudeUsage           `json:"usage,omitempty"`
+	Error        *ClaudeError           `json:"error,omitempty"`
+}
+
+// ClaudeStreamDelta Claude 流式增量
+type ClaudeStreamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+// ClaudeErrorResponse Claude 错误响应
+type ClaudeErrorResponse struct {
+	Type  string      `json:"type"`
+	Error ClaudeError `json:"error"`
+}
+
+// ClaudeError Claude 错误
+type ClaudeError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// 辅助函数
+
+// convertToClaudeBlocks 将消息转换为 Claude 内容块
+func convertToClaudeBlocks(msg Message) []ClaudeContentBlock {
+	if msg.Role == model.MessageRoleTool {
+		return []ClaudeContentBlock{{
+			Type:      claudeBlockToolResult,
+			ToolUseID: msg.ToolCallID,
+			Content:   msg.Content,
+		}}
+	}
+
+	var blocks []ClaudeContentBlock
+	if len(msg.Parts) > 0 {
+		blocks = convertPartsToClaudeBlocks(msg.Parts)
+	} else if msg.Content != "" {
+		blocks = append(blocks, ClaudeContentBlock{Type: claudeBlockText, Text: msg.Content})
+	}
+	for _, call := range msg.ToolCalls {
+		// input 必须是 JSON 对象，参数为空或不完整时按空对象发送
+		input := json.RawMessage(call.Function.Arguments)
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+		blocks = append(blocks, ClaudeContentBlock{
+			Type:  claudeBlockToolUse,
+			ID:    call.ID,
+			Name:  call.Function.Name,
+			Input: input,
+		})
+	}
+	return blocks
+}
+
+// convertPartsToClaudeBlocks 转换多模态内容，内嵌图片使用 base64 来源，远程图片使用 url 来源
+func convertPartsToClaudeBlocks(parts []ContentPart) []ClaudeContentBlock {
+	blocks := make([]ClaudeContentBlock, 0, len(parts))
+	for _, part := range parts {
+		switch {
+		case part.Type == ContentPartText && part.Text != "":
+			blocks = append(blocks, ClaudeContentBlock{Type: claudeBlockText, Text: part.Text})
+		case part.Type == ContentPartImage && part.ImageURL != nil:
+			source := &ClaudeImageSource{Type: "url", URL: part.ImageURL.URL}
+			if inline, ok := parseDataURL(part.ImageURL.URL); ok {
+				source = &ClaudeImageSource{Type: "base64", MediaType: inline.mimeType, Data: inline.data}
+			}
+			blocks = append(blocks, ClaudeContentBlock{Type: claudeBlockImage, Source: source})
+		}
+	}
+	return blocks
+}
+
+// convertToClaudeTools 转换工具定义，未提供参数定义时使用空对象
+func convertToClaudeTools(tools []ToolDefinition) []ClaudeTool {
+	claudeTools := make([]ClaudeTool, len(tools))
+	for i, tool := range tools {
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		claudeTools[i] = ClaudeTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		}
+	}
+	return claudeTools
+}
+
+// convertToClaudeToolChoice 转换工具选择策略
+func convertToClaudeToolChoice(choice *ToolChoice) *ClaudeToolChoice {
+	if choice == nil {
+		return nil
+	}
+	switch choice.Type {
+	case ToolChoiceNone:
+		return &ClaudeToolChoice{Type: "none"}
+	case ToolChoiceRequired:
+		return &ClaudeToolChoice{Type: "any"}
+	case ToolChoiceFunction:
+		return &ClaudeToolChoice{Type: "tool", Name: choice.Function}
+	default:
+		return &ClaudeToolChoice{Type: "auto"}
+	}
+}
+
+// mapClaudeStopReason 映射 Claude 停止原因
+func mapClaudeStopReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return FinishReasonLength
+	case "tool_use":
+		return FinishReasonToolCalls
+	default:
+		return FinishReasonStop
+	}
+}
+
+// mapClaudeErrorCode 映射 Claude 错误代码
+func mapClaudeErrorCode(errorType string) string {
+	switch errorType {
+	case "invalid_request_error", "not_found_error", "request_too_large":
+		return ErrorCodeInvalidRequest
+	case "authentication_error", "permission_error":
+		return ErrorCodeAuthenticationError
+	case "rate_limit_error", "overloaded_error":
+		return ErrorCodeRateLimitExceeded
+	default:
+		return ErrorCodeProviderError
+	}
+}
+
+// mapHTTPStatusErrorCode 根据 HTTP 状态码映射错误代码
+func mapHTTPStatusErrorCode(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorCodeAuthenticationError
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorCodeRateLimitExceeded
+	case statusCode >= 400 && statusCode < 500:
+		return ErrorCodeInvalidRequest
+	default:
+		return ErrorCodeProviderError
+	}
+}
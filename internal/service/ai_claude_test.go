@@ -0,0 +1,304 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClaudeProvider(baseURL string) *ClaudeProvider {
+	return NewClaudeProvider(config.ProviderConfig{
+		Enabled: true,
+		BaseURL: baseURL,
+		APIKey:  "test-key",
+		Version: "2023-06-01",
+		Models:  []config.ModelConfig{{Name: "claude-3-haiku-20240307", MaxTokens: 200000}},
+	})
+}
+
+func TestClaudeProviderChat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, "2023-06-01", r.Header.Get("anthropic-version"))
+
+		var req ClaudeMessageRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		// system 消息应提升到顶层字段
+		assert.Equal(t, "你是一个助手", req.System)
+		assert.Equal(t, 1024, req.MaxTokens)
+		require.Len(t, req.Messages, 1)
+		assert.Equal(t, "user", req.Messages[0].Role)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "msg_01",
+			"type": "message",
+			"role": "assistant",
+			"model": "claude-3-haiku-20240307",
+			"content": [{"type": "text", "text": "你好！"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 12, "output_tokens": 5}
+		}`)
+	}))
+	defer server.Close()
+
+	provider := newTestClaudeProvider(server.URL)
+	maxTokens := 1024
+	req := NewChatRequest("claude-3-haiku-20240307", []Message{
+		{Role: "system", Content: "你是一个助手"},
+		{Role: "user", Content: "你好"},
+	})
+	req.MaxTokens = &maxTokens
+
+	resp, err := provider.Chat(context.Background(), req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "msg_01", resp.ID)
+	assert.Equal(t, "claude", resp.Provider)
+	assert.Equal(t, "你好！", resp.GetLastAssistantMessage())
+	assert.Equal(t, FinishReasonStop, resp.Choices[0].FinishReason)
+	assert.Equal(t, 12, resp.Usage.PromptTokens)
+	assert.Equal(t, 5, resp.Usage.CompletionTokens)
+	assert.Equal(t, 17, resp.Usage.TotalTokens)
+}
+
+func TestClaudeProviderChatStream(t *testing.T) {
+	events := []string{
+		`event: message_start
+data: {"type":"message_start","message":{"id":"msg_02","model":"claude-3-haiku-20240307",` +
+			`"usage":{"input_tokens":20,"output_tokens":1}}}`,
+		`event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`event: ping
+data: {"type":"ping"}`,
+		`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"你"}}`,
+		`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"好"}}`,
+		`event: content_block_stop
+data: {"type":"content_block_stop","index":0}`,
+		`event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":8}}`,
+		`event: message_stop
+data: {"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ClaudeMessageRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, strings.Join(events, "\n\n")+"\n\n")
+	}))
+	defer server.Close()
+
+	provider := newTestClaudeProvider(server.URL)
+	stream, err := provider.ChatStream(context.Background(), NewStreamChatRequest(
+		"claude-3-haiku-20240307",
+		[]Message{{Role: "user", Content: "你好"}},
+	))
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var finishReason string
+	var last *ChatStreamResponse
+	for chunk := range stream {
+		require.Nil(t, chunk.Error)
+		content.WriteString(chunk.GetContent())
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+		last = chunk
+	}
+
+	assert.Equal(t, "你好", content.String())
+	assert.Equal(t, FinishReasonLength, finishReason)
+	require.NotNil(t, last)
+	assert.True(t, last.Done)
+	assert.Equal(t, "msg_02", last.ID)
+	require.NotNil(t, last.Usage)
+	assert.Equal(t, 20, last.Usage.PromptTokens)
+	assert.Equal(t, 8, last.Usage.CompletionTokens)
+	assert.Equal(t, 28, last.Usage.TotalTokens)
+}
+
+func TestClaudeProviderChatStreamTruncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"你"}}`+"\n\n")
+	}))
+	defer server.Close()
+
+	provider := newTestClaudeProvider(server.URL)
+	stream, err := provider.ChatStream(context.Background(), NewStreamChatRequest(
+		"claude-3-haiku-20240307",
+		[]Message{{Role: "user", Content: "你好"}},
+	))
+	require.NoError(t, err)
+
+	var last *ChatStreamResponse
+	for chunk := range stream {
+		last = chunk
+	}
+	require.NotNil(t, last)
+	require.NotNil(t, last.Error)
+	assert.Equal(t, ErrorCodeNetworkError, last.Error.Code)
+}
+
+func TestClaudeProviderErrorMapping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests exceeded"}}`)
+	}))
+	defer server.Close()
+
+	provider := newTestClaudeProvider(server.URL)
+	_, err := provider.Chat(context.Background(), NewChatRequest(
+		"claude-3-haiku-20240307",
+		[]Message{{Role: "user", Content: "你好"}},
+	))
+	require.Error(t, err)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorCodeRateLimitExceeded, apiErr.Code)
+	assert.Equal(t, "rate_limit_error", apiErr.Type)
+}
+
+func TestClaudeProviderToolUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ClaudeMessageRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		require.Len(t, req.Tools, 1)
+		assert.Equal(t, "get_weather", req.Tools[0].Name)
+		assert.JSONEq(t, `{"type":"object","properties":{"city":{"type":"string"}}}`, string(req.Tools[0].InputSchema))
+		assert.Equal(t, &ClaudeToolChoice{Type: "auto"}, req.ToolChoice)
+
+		// 工具调用转换为 tool_use 块，工具结果转换为 user 角色的 tool_result 块
+		require.Len(t, req.Messages, 3)
+		assert.Equal(t, "tool_use", req.Messages[1].Content[0].Type)
+		assert.JSONEq(t, `{"city":"北京"}`, string(req.Messages[1].Content[0].Input))
+		assert.Equal(t, "user", req.Messages[2].Role)
+		assert.Equal(t, "tool_result", req.Messages[2].Content[0].Type)
+		assert.Equal(t, "call_1", req.Messages[2].Content[0].ToolUseID)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"id": "msg_03",
+			"model": "claude-3-haiku-20240307",
+			"content": [
+				{"type": "text", "text": "我来查一下"},
+				{"type": "tool_use", "id": "toolu_01", "name": "get_weather", "input": {"city": "上海"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 30, "output_tokens": 12}
+		}`)
+	}))
+	defer server.Close()
+
+	provider := newTestClaudeProvider(server.URL)
+	resp, err := provider.Chat(context.Background(), newToolTestRequest("claude-3-haiku-20240307"))
+	require.NoError(t, err)
+
+	assert.Equal(t, FinishReasonToolCalls, resp.Choices[0].FinishReason)
+	assert.Equal(t, "我来查一下", resp.GetLastAssistantMessage())
+	require.Len(t, resp.Choices[0].Message.ToolCalls, 1)
+	call := resp.Choices[0].Message.ToolCalls[0]
+	assert.Equal(t, "toolu_01", call.ID)
+	assert.Equal(t, "get_weather", call.Function.Name)
+	assert.JSONEq(t, `{"city":"上海"}`, call.Function.Arguments)
+}
+
+func TestClaudeProviderStreamToolUse(t *testing.T) {
+	events := []string{
+		`data: {"type":"message_start","message":{"id":"msg_04","model":"claude-3-haiku-20240307",` +
+			`"usage":{"input_tokens":30,"output_tokens":1}}}`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"查询中"}}`,
+		`data: {"type":"content_block_start","index":1,` +
+			`"content_block":{"type":"tool_use","id":"toolu_02","name":"get_weather","input":{}}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"上海\"}"}}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":15}}`,
+		`data: {"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, strings.Join(events, "\n\n")+"\n\n")
+	}))
+	defer server.Close()
+
+	provider := newTestClaudeProvider(server.URL)
+	stream, err := provider.ChatStream(context.Background(), newToolTestRequest("claude-3-haiku-20240307"))
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var calls []ToolCall
+	var finishReason string
+	for chunk := range stream {
+		require.Nil(t, chunk.Error)
+		content.WriteString(chunk.GetContent())
+		for _, choice := range chunk.Choices {
+			calls = appendToolCallDeltas(calls, choice.Delta.ToolCalls)
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+
+	assert.Equal(t, "查询中", content.String())
+	assert.Equal(t, FinishReasonToolCalls, finishReason)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "toolu_02", calls[0].ID)
+	assert.Equal(t, "get_weather", calls[0].Function.Name)
+	assert.JSONEq(t, `{"city":"上海"}`, calls[0].Function.Arguments)
+}
+
+func TestClaudeProviderImageBlocks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ClaudeMessageRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		require.Len(t, req.Messages, 1)
+		blocks := req.Messages[0].Content
+		require.Len(t, blocks, 3)
+		assert.Equal(t, ClaudeContentBlock{Type: "text", Text: "这是什么"}, blocks[0])
+		assert.Equal(t, "image", blocks[1].Type)
+		assert.Equal(t, &ClaudeImageSource{
+			Type:      "base64",
+			MediaType: "image/png",
+			Data:      base64.StdEncoding.EncodeToString(testPNG),
+		}, blocks[1].Source)
+		assert.Equal(t, &ClaudeImageSource{Type: "url", URL: "https://example.com/cat.jpg"}, blocks[2].Source)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_02","type":"message","role":"assistant","model":"claude-3-haiku-20240307",`+
+			`"content":[{"type":"text","text":"一只猫"}],"stop_reason":"end_turn",`+
+			`"usage":{"input_tokens":800,"output_tokens":3}}`)
+	}))
+	defer server.Close()
+
+	provider := newTestClaudeProvider(server.URL)
+	resp, err := provider.Chat(context.Background(), newImageTestRequest("claude-3-haiku-20240307"))
+	require.NoError(t, err)
+	assert.Equal(t, "一只猫", resp.GetLastAssistantMessage())
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"ai-svc/internal/model"
+	"ai-svc/pkg/tokenizer"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// messageTokenOverhead 每条消息的格式开销（角色、分隔符等）
+	messageTokenOverhead = 3
+
+	// replyTokenOverhead 回复的起始开销
+	replyTokenOverhead = 3
+
+	// summaryMaxRunes 被裁剪历史的摘要最大长度
+	summaryMaxRunes = 600
+
+	// summaryItemMaxRunes 摘要中每条消息的最大长度
+	summaryItemMaxRunes = 60
+
+	// earlierSummaryPrefix 早期对话摘要的系统消息前缀
+	earlierSummaryPrefix = "以下是更早对话的摘要，供参考：\n"
+)
+
+// historyWindow 对话历史窗口限制
+type historyWindow struct {
+	counter     tokenizer.Tokenizer // 目标模型的 token 计数器
+	maxMessages int                 // 最多携带的历史消息数，<=0 表示不限制
+	maxTokens   int                 // 整个上下文的 token 预算，<=0 表示不限制
+	summarize   bool                // 是否为被裁剪的历史生成摘要
+}
+
+// contextResult 上下文组装结果
+type contextResult struct {
+	Messages        []Message
+	EstimatedTokens int
+	DroppedMessages int
+	Summarized      bool
+}
+
+// historyTurn 一轮对话：一条用户消息及其后的助手回复
+type historyTurn struct {
+	messages []Message
+	tokens   int
+}
+
+// buildContextMessages 组装发送给提供商的上下文
+// 系统提示词和本次用户消息始终保留；历史按轮次从新到旧装入，超出消息数或 token 预算的最早轮次被丢弃，
+// 开启摘要时被丢弃的轮次会摘录为一条系统消息.
+func buildContextMessages(
+	systemPrompt string,
+	history []*model.AIMessage,
+	latest Message,
+	window historyWindow,
+) contextResult {
+	var result contextResult
+
+	var head []Message
+	if systemPrompt != "" {
+		head = append(head, Message{Role: model.MessageRoleSystem, Content: systemPrompt})
+	}
+
+	fixed := append(append([]Message{}, head...), latest)
+	fixedTokens := estimateMessagesTokens(window.counter, fixed)
+	turns := groupHistoryTurns(window.counter, history)
+
+	// 从最新的轮次开始装入
+	kept := len(turns)
+	messageCount, historyTokens := 0, 0
+	for i := len(turns) - 1; i >= 0; i-- {
+		turn := turns[i]
+		if window.maxMessages > 0 && messageCount+len(turn.messages) > window.maxMessages {
+			break
+		}
+		if window.maxTokens > 0 && fixedTokens+historyTokens+turn.tokens > window.maxTokens {
+			break
+		}
+		kept = i
+		messageCount += len(turn.messages)
+		historyTokens += turn.tokens
+	}
+
+	// 摘录被丢弃的轮次，摘要放不下时继续丢弃最早的轮次
+	var summary *Message
+	if kept > 0 && window.summarize {
+		for {
+			candidate := Message{
+				Role:    model.MessageRoleSystem,
+				Content: earlierSummaryPrefix + summarizeTurns(turns[:kept]),
+			}
+			summaryTokens := estimateMessagesTokens(window.counter, []Message{candidate})
+			if window.maxTokens <= 0 || fixedTokens+historyTokens+summaryTokens <= window.maxTokens {
+				summary = &candidate
+				historyTokens += summaryTokens
+				break
+			}
+			if kept == len(turns) {
+				break
+			}
+			historyTokens -= turns[kept].tokens
+			kept++
+		}
+	}
+
+	result.Messages = append(result.Messages, head...)
+	if summary != nil {
+		result.Messages = append(result.Messages, *summary)
+		result.Summarized = true
+	}
+	for _, turn := range turns[kept:] {
+		result.Messages = append(result.Messages, turn.messages...)
+	}
+	result.Messages = append(result.Messages, latest)
+
+	for _, turn := range turns[:kept] {
+		result.DroppedMessages += len(turn.messages)
+	}
+	result.EstimatedTokens = fixedTokens + historyTokens
+	return result
+}
+
+// groupHistoryTurns 将历史消息按轮次分组，失败和空的消息不作为上下文
+// 工具调用的中间步骤只在当轮有效，之后只保留最终回答.
+func groupHistoryTurns(counter tokenizer.Tokenizer, history []*model.AIMessage) []historyTurn {
+	var turns []historyTurn
+	for _, msg := range history {
+		if msg.Status == model.MessageStatusError || msg.Content == "" || msg.Role == model.MessageRoleSystem {
+			continue
+		}
+		if msg.Role == model.MessageRoleTool || msg.FinishReason == FinishReasonToolCalls {
+			continue
+		}
+
+		message := Message{
+			Role:    msg.Role,
+			Content: msg.Content,
+			Parts:   partsFromAttachments(msg.Content, msg.Attachments),
+		}
+		tokens := estimateMessageTokens(counter, message)
+		if msg.Role == model.MessageRoleUser || len(turns) == 0 {
+			turns = append(turns, historyTurn{})
+		}
+		last := &turns[len(turns)-1]
+		last.messages = append(last.messages, message)
+		last.tokens += tokens
+	}
+	return turns
+}
+
+// summarizeTurns 以摘录方式压缩被丢弃的轮次
+func summarizeTurns(turns []historyTurn) string {
+	var builder strings.Builder
+	for _, turn := range turns {
+		for _, msg := range turn.messages {
+			speaker := "用户"
+			if msg.Role == model.MessageRoleAssistant {
+				speaker = "助手"
+			}
+			line := fmt.Sprintf("- %s：%s\n", speaker, truncateRunes(collapseSpaces(msg.Content), summaryItemMaxRunes))
+			if utf8.RuneCountInString(builder.String())+utf8.RuneCountInString(line) > summaryMaxRunes {
+				return builder.String()
+			}
+			builder.WriteString(line)
+		}
+	}
+	return builder.String()
+}
+
+// estimateMessagesTokens 估算一组消息的 token 数（含回复起始开销）
+func estimateMessagesTokens(counter tokenizer.Tokenizer, messages []Message) int {
+	total := replyTokenOverhead
+	for _, msg := range messages {
+		total += estimateMessageTokens(counter, msg)
+	}
+	return total
+}
+
+// estimateMessageTokens 估算单条消息的 token 数
+func estimateMessageTokens(counter tokenizer.Tokenizer, msg Message) int {
+	total := messageTokenOverhead + counter.Count(msg.Role) + counter.Count(msg.Content)
+	for _, call := range msg.ToolCalls {
+		total += counter.Count(call.Function.Name) + counter.Count(call.Function.Arguments)
+	}
+	for _, part := range msg.Parts {
+		if part.Type == ContentPartImage {
+			total += imageTokenEstimate
+		}
+	}
+	return total
+}
+
+// estimateRequestTokens 估算请求提示词的 token 数，工具定义按序列化后的 JSON 计算
+func estimateRequestTokens(counter tokenizer.Tokenizer, req *ChatRequest) int {
+	total := estimateMessagesTokens(counter, req.Messages)
+	if len(req.Tools) > 0 {
+		data, _ := json.Marshal(req.Tools)
+		total += counter.Count(string(data))
+	}
+	return total
+}
+
+// truncateRunes 按字符截断文本
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "..."
+}
+
+// collapseSpaces 合并连续空白
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/pkg/tokenizer"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHistory(turns int) []*model.AIMessage {
+	var history []*model.AIMessage
+	for i := 1; i <= turns; i++ {
+		history = append(history,
+			&model.AIMessage{Role: model.MessageRoleUser, Content: fmt.Sprintf("问题%d", i)},
+			&model.AIMessage{Role: model.MessageRoleAssistant, Content: fmt.Sprintf("回答%d", i)},
+		)
+	}
+	return history
+}
+
+func userMessage(content string) Message {
+	return Message{Role: model.MessageRoleUser, Content: content}
+}
+
+func TestBuildContextMessagesMaxMessages(t *testing.T) {
+	history := newHistory(5)
+	history = append(history, &model.AIMessage{
+		Role:    model.MessageRoleAssistant,
+		Content: "请求失败",
+		Status:  model.MessageStatusError,
+	})
+
+	result := buildContextMessages("你是一个助手", history, userMessage("最新问题"), historyWindow{
+		counter:     tokenizer.ForModel("gpt-3.5-turbo"),
+		maxMessages: 4,
+	})
+
+	require.Len(t, result.Messages, 6)
+	assert.Equal(t, model.MessageRoleSystem, result.Messages[0].Role)
+	assert.Equal(t, "问题4", result.Messages[1].Content)
+	assert.Equal(t, "回答5", result.Messages[4].Content)
+	assert.Equal(t, "最新问题", result.Messages[5].Content)
+	assert.Equal(t, 6, result.DroppedMessages)
+	assert.False(t, result.Summarized)
+}
+
+func TestBuildContextMessagesTokenBudget(t *testing.T) {
+	history := newHistory(3)
+	history[0].Content = strings.Repeat("很长的问题", 200)
+
+	window := historyWindow{counter: tokenizer.ForModel("gpt-3.5-turbo"), maxMessages: 20, maxTokens: 200}
+	result := buildContextMessages("", history, userMessage("最新问题"), window)
+
+	// 第一轮超出预算被整轮丢弃，不会留下孤立的回答
+	require.Len(t, result.Messages, 5)
+	assert.Equal(t, "问题2", result.Messages[0].Content)
+	assert.Equal(t, 2, result.DroppedMessages)
+	assert.LessOrEqual(t, result.EstimatedTokens, window.maxTokens)
+}
+
+func TestBuildContextMessagesAlwaysKeepsSystemAndLatest(t *testing.T) {
+	latest := strings.Repeat("超长的用户输入", 100)
+	result := buildContextMessages("系统提示词", newHistory(2), userMessage(latest), historyWindow{
+		counter:   tokenizer.ForModel("gpt-3.5-turbo"),
+		maxTokens: 10,
+		summarize: true,
+	})
+
+	require.Len(t, result.Messages, 2)
+	assert.Equal(t, "系统提示词", result.Messages[0].Content)
+	assert.Equal(t, latest, result.Messages[1].Content)
+	assert.Equal(t, 4, result.DroppedMessages)
+	assert.False(t, result.Summarized)
+}
+
+func TestBuildContextMessagesSummarizesDroppedTurns(t *testing.T) {
+	result := buildContextMessages("系统提示词", newHistory(4), userMessage("最新问题"), historyWindow{
+		counter:     tokenizer.ForModel("qwen-turbo"),
+		maxMessages: 2,
+		summarize:   true,
+	})
+
+	require.Len(t, result.Messages, 5)
+	assert.Equal(t, model.MessageRoleSystem, result.Messages[1].Role)
+	assert.Contains(t, result.Messages[1].Content, "用户：问题1")
+	assert.Contains(t, result.Messages[1].Content, "助手：回答3")
+	assert.NotContains(t, result.Messages[1].Content, "问题4")
+	assert.Equal(t, "问题4", result.Messages[2].Content)
+	assert.True(t, result.Summarized)
+}
+
+func TestCheckTokenBudget(t *testing.T) {
+	modelCfg := config.ModelConfig{Name: "gpt-3.5-turbo", MaxTokens: 100}
+
+	maxTokens := 4096
+	req := NewChatRequest(modelCfg.Name, []Message{{Role: model.MessageRoleUser, Content: "hello world"}})
+	req.MaxTokens = &maxTokens
+	require.NoError(t, checkTokenBudget(req, modelCfg))
+	// 3 (回复) + 3 (消息) + 1 (user) + 2 (hello world)
+	assert.Equal(t, 100-9, *req.MaxTokens)
+
+	long := Message{Role: model.MessageRoleUser, Content: strings.Repeat("hello ", 100)}
+	req = NewChatRequest(modelCfg.Name, []Message{long})
+	err := checkTokenBudget(req, modelCfg)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeInvalidRequest, apiErr.Code)
+}
+
+func TestPromptTokenBudget(t *testing.T) {
+	maxTokens := 1000
+	assert.Equal(t, 7192, promptTokenBudget(config.ModelConfig{MaxTokens: 8192}, &maxTokens))
+
+	maxTokens = 8192
+	assert.Equal(t, 4096, promptTokenBudget(config.ModelConfig{MaxTokens: 8192}, &maxTokens))
+	assert.Equal(t, 0, promptTokenBudget(config.ModelConfig{}, &maxTokens))
+}
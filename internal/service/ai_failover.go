@@ -0,0 +1,289 @@
+package service
+
+import (
+	"ai-svc/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultRetryBackoff 未配置时的重试初始退避时间
+	defaultRetryBackoff = 500 * time.Millisecond
+
+	// defaultRetryMaxBackoff 未配置时的重试最大退避时间
+	defaultRetryMaxBackoff = 8 * time.Second
+)
+
+// chatWithFailover 发送聊天请求，按重试策略重试并在失败时依次切换到故障转移目标
+// 返回实际应答的目标；全部失败时返回最后一个尝试的目标和错误.
+func (s *aiService) chatWithFailover(
+	ctx context.Context,
+	primary *chatTarget,
+	req *ChatRequest,
+) (*ChatResponse, *chatTarget, error) {
+	target := primary
+	var lastErr error
+
+	for i, candidate := range s.failoverTargets(primary) {
+		attemptReq, err := requestForTarget(req, candidate)
+		if err != nil {
+			s.logSkippedFallback(candidate, err)
+			continue
+		}
+		target = candidate
+
+		var resp *ChatResponse
+		err = s.withRetry(ctx, target, func() error {
+			var err error
+			resp, err = target.provider.Chat(ctx, attemptReq)
+			return err
+		})
+		if err == nil {
+			resp.Provider = target.providerName
+			return resp, target, nil
+		}
+
+		lastErr = err
+		if !shouldFailover(ctx, err) {
+			break
+		}
+		s.logFailover(target, i, err)
+	}
+
+	return nil, target, lastErr
+}
+
+// chatStreamWithFailover 建立流式连接，在收到首个数据块之前出错时按策略重试或切换目标
+// 一旦开始输出内容就不再切换，避免客户端收到两段不同的回复；
+// 已开始输出的流在结束时才向熔断器报告结果，中途出错计为一次失败.
+func (s *aiService) chatStreamWithFailover(
+	ctx context.Context,
+	primary *chatTarget,
+	req *ChatRequest,
+) (<-chan *ChatStreamResponse, *chatTarget, error) {
+	target := primary
+	var lastErr error
+
+	for i, candidate := range s.failoverTargets(primary) {
+		attemptReq, err := requestForTarget(req, candidate)
+		if err != nil {
+			s.logSkippedFallback(candidate, err)
+			continue
+		}
+		target = candidate
+
+		var stream <-chan *ChatStreamResponse
+		providerName := target.providerName
+		err = s.retryTarget(ctx, target, true, func() error {
+			upstream, err := target.provider.ChatStream(ctx, attemptReq)
+			if err != nil {
+				return err
+			}
+			stream, err = peekStream(upstream, func(err error) {
+				s.registry.RecordResult(ctx, providerName, err)
+			})
+			return err
+		})
+		if err == nil {
+			return stream, target, nil
+		}
+
+		lastErr = err
+		if !shouldFailover(ctx, err) {
+			break
+		}
+		s.logFailover(target, i, err)
+	}
+
+	return nil, target, lastErr
+}
+
+// failoverTargets 返回依次尝试的目标：主目标在前，之后是配置的故障转移目标
+// 不可用或重复的故障转移目标会被跳过.
+func (s *aiService) failoverTargets(primary *chatTarget) []*chatTarget {
+	targets := []*chatTarget{primary}
+	seen := map[string]bool{primary.providerName + "/" + primary.model.Name: true}
+
+	for _, fallback := range s.config.Fallbacks {
+		target, err := s.resolveTarget(fallback.Provider, fallback.Model)
+		if err != nil {
+			continue
+		}
+
+		key := target.providerName + "/" + target.model.Name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		target.fallbackFrom = primary
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+// withRetry 在同一目标上执行 fn，限流和网络错误时按指数退避重试
+// 每次尝试前检查熔断器，结果计入熔断统计；熔断中直接返回 provider_unavailable.
+func (s *aiService) withRetry(ctx context.Context, target *chatTarget, fn func() error) error {
+	return s.retryTarget(ctx, target, false, fn)
+}
+
+// retryTarget withRetry 的实现
+// deferSuccess 为 true 时成功的尝试不在这里报告，由 fn 在请求真正结束时报告，失败的尝试仍在这里报告.
+func (s *aiService) retryTarget(ctx context.Context, target *chatTarget, deferSuccess bool, fn func() error) error {
+	maxRetries := s.config.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		if !s.registry.Allow(target.providerName) {
+			return &APIError{
+				Code:    ErrorCodeProviderUnavailable,
+				Message: fmt.Sprintf("提供商暂时不可用（已熔断）: %s", target.providerName),
+			}
+		}
+
+		err := fn()
+		if err != nil || !deferSuccess {
+			s.registry.RecordResult(ctx, target.providerName, err)
+		}
+		if err == nil || attempt >= maxRetries || !isRetryableError(err) {
+			return err
+		}
+
+		wait := s.retryBackoff(attempt)
+		logger.Warn("AI提供商请求失败，准备重试", map[string]any{
+			"provider": target.providerName,
+			"model":    target.model.Name,
+			"attempt":  attempt + 1,
+			"wait":     wait.String(),
+			"error":    err.Error(),
+		})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// retryBackoff 计算第 attempt 次重试前的等待时间
+func (s *aiService) retryBackoff(attempt int) time.Duration {
+	backoff := s.config.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	maxBackoff := s.config.RetryMaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	for i := 0; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// logFailover 记录切换到下一个目标
+func (s *aiService) logFailover(target *chatTarget, index int, err error) {
+	logger.Warn("AI提供商不可用，切换到故障转移目标", map[string]any{
+		"provider": target.providerName,
+		"model":    target.model.Name,
+		"index":    index,
+		"error":    err.Error(),
+	})
+}
+
+// logSkippedFallback 记录跳过无法处理该请求的故障转移目标
+func (s *aiService) logSkippedFallback(target *chatTarget, err error) {
+	logger.Warn("故障转移目标无法处理该请求，已跳过", map[string]any{
+		"provider": target.providerName,
+		"model":    target.model.Name,
+		"error":    err.Error(),
+	})
+}
+
+// isRetryableError 判断错误是否可以在同一提供商上重试
+func isRetryableError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == ErrorCodeRateLimitExceeded || apiErr.Code == ErrorCodeNetworkError
+}
+
+// shouldFailover 判断失败后是否切换到下一个目标
+// 请求已取消或请求本身无效时，换提供商也无济于事.
+func shouldFailover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Code == ErrorCodeInvalidRequest {
+		return false
+	}
+	return true
+}
+
+// requestForTarget 复制请求并替换为目标模型
+// 请求按主目标构建，切换到故障转移目标时按目标模型重新检查图片支持和 token 预算，
+// 并在目标不支持原生结构化输出时改用系统提示词说明格式；目标无法处理该请求时返回错误.
+func requestForTarget(req *ChatRequest, target *chatTarget) (*ChatRequest, error) {
+	attemptReq := *req
+	attemptReq.Model = target.model.Name
+	if target.fallbackFrom == nil {
+		return &attemptReq, nil
+	}
+
+	if err := checkVision(attemptReq.Messages, target.model); err != nil {
+		return nil, err
+	}
+	if attemptReq.ResponseFormat != nil && !target.model.StructuredOutput {
+		format := attemptReq.ResponseFormat
+		attemptReq.Messages = append([]Message{}, req.Messages...)
+		applyResponseFormat(&attemptReq, format, target.model)
+	}
+	if err := checkTokenBudget(&attemptReq, target.model); err != nil {
+		return nil, err
+	}
+	return &attemptReq, nil
+}
+
+// peekStream 读取首个数据块：为错误时返回该错误，否则返回包含首个数据块的完整流
+// 返回完整流时，流结束后以其中第一个错误（没有错误时为 nil）调用一次 done.
+func peekStream(upstream <-chan *ChatStreamResponse, done func(error)) (<-chan *ChatStreamResponse, error) {
+	first, ok := <-upstream
+	if !ok {
+		done(nil)
+		return upstream, nil
+	}
+	if first.Error != nil {
+		drainStream(upstream)
+		return nil, first.Error
+	}
+
+	stream := make(chan *ChatStreamResponse, cap(upstream)+1)
+	go func() {
+		defer close(stream)
+		var streamErr error
+		stream <- first
+		for chunk := range upstream {
+			if chunk.Error != nil && streamErr == nil {
+				streamErr = chunk.Error
+			}
+			stream <- chunk
+		}
+		done(streamErr)
+	}()
+	return stream, nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatWithFailoverRetriesRateLimit(t *testing.T) {
+	primary := &fakeProvider{errs: []error{
+		&APIError{Code: ErrorCodeRateLimitExceeded, Message: "too many requests"},
+		&APIError{Code: ErrorCodeNetworkError, Message: "connection reset"},
+	}}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": primary}, func(s *aiService) {
+		s.config.MaxRetries = 3
+	})
+
+	target, err := s.resolveTarget("primary", "")
+	require.NoError(t, err)
+
+	resp, answered, err := s.chatWithFailover(context.Background(), target, NewChatRequest("", []Message{
+		{Role: model.MessageRoleUser, Content: "你好"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 3, primary.calls)
+	assert.Equal(t, "primary", resp.Provider)
+	assert.Nil(t, answered.fallbackFrom)
+}
+
+func TestChatWithFailoverSwitchesProvider(t *testing.T) {
+	primary := &fakeProvider{errs: []error{
+		&APIError{Code: ErrorCodeRateLimitExceeded, Message: "too many requests"},
+		&APIError{Code: ErrorCodeRateLimitExceeded, Message: "too many requests"},
+	}}
+	backup := &fakeProvider{}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": primary, "backup": backup}, func(s *aiService) {
+		s.config.MaxRetries = 1
+		s.config.Fallbacks = []config.FallbackConfig{{Provider: "missing"}, {Provider: "primary"}, {Provider: "backup"}}
+	})
+
+	target, err := s.resolveTarget("primary", "")
+	require.NoError(t, err)
+
+	resp, answered, err := s.chatWithFailover(context.Background(), target, NewChatRequest("", []Message{
+		{Role: model.MessageRoleUser, Content: "你好"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 2, primary.calls)
+	assert.Equal(t, 1, backup.calls)
+	assert.Equal(t, "backup", resp.Provider)
+	assert.Equal(t, "backup-model", resp.Model)
+	assert.Equal(t, "backup", answered.providerName)
+	require.NotNil(t, answered.fallbackFrom)
+
+	metadata := answered.replyMetadata(map[string]interface{}{})
+	assert.Equal(t, "primary", metadata["requested_provider"])
+}
+
+func TestChatWithFailoverStopsOnInvalidRequest(t *testing.T) {
+	primary := &fakeProvider{errs: []error{&APIError{Code: ErrorCodeInvalidRequest, Message: "bad request"}}}
+	backup := &fakeProvider{}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": primary, "backup": backup}, func(s *aiService) {
+		s.config.MaxRetries = 3
+		s.config.Fallbacks = []config.FallbackConfig{{Provider: "backup"}}
+	})
+
+	target, err := s.resolveTarget("primary", "")
+	require.NoError(t, err)
+
+	_, _, err = s.chatWithFailover(context.Background(), target, NewChatRequest("", nil))
+	require.Error(t, err)
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 0, backup.calls)
+}
+
+func TestChatStreamWithFailover(t *testing.T) {
+	primary := &fakeProvider{errs: []error{&APIError{Code: ErrorCodeProviderError, Message: "HTTP错误: 503"}}}
+	backup := &fakeProvider{}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": primary, "backup": backup}, func(s *aiService) {
+		s.config.Fallbacks = []config.FallbackConfig{{Provider: "backup"}}
+	})
+
+	target, err := s.resolveTarget("primary", "")
+	require.NoError(t, err)
+
+	stream, answered, err := s.chatStreamWithFailover(context.Background(), target, NewStreamChatRequest("", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "backup", answered.providerName)
+
+	var content string
+	for chunk := range stream {
+		require.Nil(t, chunk.Error)
+		content += chunk.GetContent()
+	}
+	assert.Equal(t, "ok", content)
+}
+
+func TestChatStreamRecordsOutcomeOnce(t *testing.T) {
+	primary := &fakeProvider{
+		parts:     []string{"你", "好"},
+		streamErr: &APIError{Code: ErrorCodeNetworkError, Message: "连接中断"},
+	}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": primary})
+
+	target, err := s.resolveTarget("primary", "")
+	require.NoError(t, err)
+	stream, _, err := s.chatStreamWithFailover(context.Background(), target, NewStreamChatRequest("", nil))
+	require.NoError(t, err)
+	drainStream(stream)
+
+	// 已开始输出后中途出错只计一次失败，不再计入建立连接时的成功
+	stats := s.registry.breaker("primary").Stats()
+	assert.Equal(t, 1, stats.ErrorCount)
+	assert.Equal(t, 0, stats.SuccessCount)
+	assert.Equal(t, "连接中断", stats.LastError)
+}
+
+func TestRequestForTargetRechecksFallback(t *testing.T) {
+	primary := &chatTarget{model: config.ModelConfig{Name: "primary-model", Vision: true, StructuredOutput: true}}
+	fallback := func(modelCfg config.ModelConfig) *chatTarget {
+		return &chatTarget{model: modelCfg, fallbackFrom: primary}
+	}
+
+	req := NewChatRequest("primary-model", []Message{{Role: model.MessageRoleUser, Content: "返回天气"}})
+	req.ResponseFormat = weatherFormat
+
+	attemptReq, err := requestForTarget(req, primary)
+	require.NoError(t, err)
+	assert.Equal(t, weatherFormat, attemptReq.ResponseFormat)
+
+	// 不支持原生结构化输出的目标改用系统提示词，原请求不受影响
+	attemptReq, err = requestForTarget(req, fallback(config.ModelConfig{Name: "backup-model"}))
+	require.NoError(t, err)
+	assert.Equal(t, "backup-model", attemptReq.Model)
+	assert.Nil(t, attemptReq.ResponseFormat)
+	require.Len(t, attemptReq.Messages, 2)
+	assert.Equal(t, model.MessageRoleSystem, attemptReq.Messages[0].Role)
+	assert.Len(t, req.Messages, 1)
+
+	// 上下文放不下的目标被跳过
+	_, err = requestForTarget(req, fallback(config.ModelConfig{Name: "backup-model", MaxTokens: 10}))
+	assert.Error(t, err)
+
+	// 不支持图片的目标被跳过
+	image := NewChatRequest("primary-model", []Message{{
+		Role:  model.MessageRoleUser,
+		Parts: []ContentPart{{Type: ContentPartImage, ImageURL: &ImageURL{URL: "https://example.com/a.png"}}},
+	}})
+	_, err = requestForTarget(image, fallback(config.ModelConfig{Name: "backup-model"}))
+	assert.Error(t, err)
+}
+
+func TestChatWithFailoverSkipsIncapableFallback(t *testing.T) {
+	primary := &fakeProvider{errs: []error{&APIError{Code: ErrorCodeNetworkError, Message: "connection reset"}}}
+	backup := &fakeProvider{}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": primary, "backup": backup}, func(s *aiService) {
+		s.config.Fallbacks = []config.FallbackConfig{{Provider: "backup"}}
+		s.config.Providers["backup"].Models[0].MaxTokens = 10
+	})
+
+	target, err := s.resolveTarget("primary", "")
+	require.NoError(t, err)
+	_, answered, err := s.chatWithFailover(context.Background(), target, NewChatRequest("", []Message{
+		{Role: model.MessageRoleUser, Content: strings.Repeat("很长的问题", 20)},
+	}))
+
+	// 备用目标放不下该请求，返回主目标的错误
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeNetworkError, apiErr.Code)
+	assert.Equal(t, "primary", answered.providerName)
+	assert.Zero(t, backup.calls)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	s := &aiService{config: &config.AIConfig{RetryBackoff: 100 * time.Millisecond, RetryMaxBackoff: time.Second}}
+
+	assert.Equal(t, 100*time.Millisecond, s.retryBackoff(0))
+	assert.Equal(t, 200*time.Millisecond, s.retryBackoff(1))
+	assert.Equal(t, 800*time.Millisecond, s.retryBackoff(3))
+	assert.Equal(t, time.Second, s.retryBackoff(10))
+}
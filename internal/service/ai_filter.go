@@ -0,0 +1,158 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/pkg/contentfilter"
+	"ai-svc/pkg/logger"
+	"context"
+	"time"
+)
+
+// defaultFilterReloadInterval 未配置时敏感词文件的检查间隔
+const defaultFilterReloadInterval = 30 * time.Second
+
+// NewContentFilter 按配置创建内容过滤器，未启用时返回 nil
+func NewContentFilter(cfg config.ContentFilterConfig) (*contentfilter.Filter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	rules := contentfilter.Rules{Keywords: cfg.Keywords, Patterns: cfg.Patterns}
+	if cfg.KeywordsFile != "" {
+		fileRules, err := contentfilter.LoadRulesFile(cfg.KeywordsFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = rules.Merge(fileRules)
+	}
+
+	return contentfilter.New(contentfilter.Action(cfg.Action), rules)
+}
+
+// WatchContentFilter 监听敏感词文件，修改后重新加载规则，阻塞直到 ctx 结束
+func WatchContentFilter(ctx context.Context, filter *contentfilter.Filter, cfg config.ContentFilterConfig) {
+	if filter == nil || cfg.KeywordsFile == "" {
+		return
+	}
+
+	interval := cfg.ReloadInterval
+	if interval <= 0 {
+		interval = defaultFilterReloadInterval
+	}
+
+	base := contentfilter.Rules{Keywords: cfg.Keywords, Patterns: cfg.Patterns}
+	filter.WatchFile(ctx, cfg.KeywordsFile, base, interval, func(rules contentfilter.Rules, err error) {
+		if err != nil {
+			logger.Error("重新加载敏感词失败，继续使用原规则", map[string]any{
+				"file":  cfg.KeywordsFile,
+				"error": err.Error(),
+			})
+			return
+		}
+		logger.Info("敏感词已重新加载", map[string]any{
+			"file":     cfg.KeywordsFile,
+			"keywords": len(rules.Keywords),
+			"patterns": len(rules.Patterns),
+		})
+	})
+}
+
+// filterInput 过滤用户输入：拦截时返回错误，打码时返回打码后的内容
+// 命中时同时返回写入用户消息元数据的过滤记录.
+func (s *aiService) filterInput(content string) (string, map[string]interface{}, error) {
+	if s.filter == nil {
+		return content, nil, nil
+	}
+
+	result := s.filter.Check(content)
+	if result.Action == "" {
+		return content, nil, nil
+	}
+
+	logContentFilter(model.MessageRoleUser, result.Action, result.Matches)
+	if result.Blocked() {
+		return "", nil, &APIError{
+			Code:    ErrorCodeContentFiltered,
+			Message: "消息包含敏感内容，请修改后重试",
+		}
+	}
+	return result.Text, map[string]interface{}{
+		"content_filter": contentFilterMetadata(result.Action, result.Matches),
+	}, nil
+}
+
+// filterReply 过滤完整的回复，拦截时只保留命中位置之前的内容并将完成原因设为 content_filter
+func (s *aiService) filterReply(
+	content, finishReason string,
+	metadata map[string]interface{},
+) (string, string) {
+	if s.filter == nil {
+		return content, finishReason
+	}
+
+	result := s.filter.Check(content)
+	if result.Action == "" {
+		return content, finishReason
+	}
+
+	logContentFilter(model.MessageRoleAssistant, result.Action, result.Matches)
+	metadata["content_filter"] = contentFilterMetadata(result.Action, result.Matches)
+	if result.Blocked() {
+		finishReason = FinishReasonContentFilter
+	}
+	return result.Text, finishReason
+}
+
+// filterStreamChunk 过滤流式分片的增量内容
+// 增量内容先进入缓冲区，可能与后续分片组成敏感词的末尾部分留到下一个分片输出；
+// 分片带完成原因时输出缓冲区的剩余内容. 被拦截时分片的完成原因改为 content_filter.
+func filterStreamChunk(stream *contentfilter.Stream, chunk *ChatStreamResponse) contentfilter.Result {
+	if len(chunk.Choices) == 0 {
+		return contentfilter.Result{}
+	}
+
+	choice := &chunk.Choices[0]
+	result := stream.Write(choice.Delta.Content)
+	text := result.Text
+	if !result.Blocked() && choice.FinishReason != nil && *choice.FinishReason != "" {
+		flushed := stream.Flush()
+		text += flushed.Text
+		if flushed.Action != "" {
+			result = flushed
+		}
+	}
+
+	choice.Delta.Content = text
+	if result.Blocked() {
+		reason := FinishReasonContentFilter
+		choice.FinishReason = &reason
+	}
+	return result
+}
+
+// contentFilterMetadata 过滤记录，保存命中的规则供审核
+func contentFilterMetadata(action contentfilter.Action, matches []contentfilter.Match) map[string]interface{} {
+	return map[string]interface{}{
+		"action": string(action),
+		"rules":  matchedRules(matches),
+	}
+}
+
+// logContentFilter 记录命中过滤规则
+func logContentFilter(role string, action contentfilter.Action, matches []contentfilter.Match) {
+	logger.Warn("内容命中过滤规则", map[string]any{
+		"role":   role,
+		"action": string(action),
+		"rules":  matchedRules(matches),
+	})
+}
+
+// matchedRules 命中的规则列表
+func matchedRules(matches []contentfilter.Match) []string {
+	rules := make([]string, 0, len(matches))
+	for _, match := range matches {
+		rules = append(rules, match.Rule)
+	}
+	return rules
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enableFilter 开启内容过滤，命中关键词 "敏感词" 时按 action 处理
+func enableFilter(t *testing.T, action string) func(s *aiService) {
+	return func(s *aiService) {
+		filter, err := NewContentFilter(config.ContentFilterConfig{
+			Enabled:  true,
+			Keywords: []string{"敏感词"},
+			Action:   action,
+		})
+		require.NoError(t, err)
+		s.filter = filter
+	}
+}
+
+func streamChunk(content string, finishReason string) *ChatStreamResponse {
+	var reason *string
+	if finishReason != "" {
+		reason = &finishReason
+	}
+	return &ChatStreamResponse{Choices: []StreamChoice{newStreamChoice("", content, reason)}}
+}
+
+func TestFilterInput(t *testing.T) {
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": {}}, enableFilter(t, "block"))
+	_, _, err := s.filterInput("这里有敏感词")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeContentFiltered, apiErr.Code)
+
+	s, _ = newTestService(t, map[string]*fakeProvider{"primary": {}}, enableFilter(t, "mask"))
+	content, metadata, err := s.filterInput("这里有敏感词")
+	require.NoError(t, err)
+	assert.Equal(t, "这里有***", content)
+	assert.Contains(t, metadata, "content_filter")
+
+	content, metadata, err = (&aiService{}).filterInput("这里有敏感词")
+	require.NoError(t, err)
+	assert.Equal(t, "这里有敏感词", content)
+	assert.Nil(t, metadata)
+}
+
+func TestFilterReplyBlocked(t *testing.T) {
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": {}}, enableFilter(t, "block"))
+	metadata := map[string]interface{}{}
+
+	content, finishReason := s.filterReply("前半段敏感词后半段", FinishReasonStop, metadata)
+	assert.Equal(t, "前半段", content)
+	assert.Equal(t, FinishReasonContentFilter, finishReason)
+	assert.Contains(t, metadata, "content_filter")
+}
+
+func TestFilterStreamChunkAcrossBoundaries(t *testing.T) {
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": {}}, enableFilter(t, "mask"))
+	stream := s.filter.NewStream()
+
+	var output strings.Builder
+	for _, chunk := range []*ChatStreamResponse{
+		streamChunk("你好，", ""),
+		streamChunk("敏感", ""),
+		streamChunk("词在这里", ""),
+		streamChunk("。", FinishReasonStop),
+	} {
+		filterStreamChunk(stream, chunk)
+		output.WriteString(chunk.GetContent())
+	}
+	assert.Equal(t, "你好，***在这里。", output.String())
+
+	s, _ = newTestService(t, map[string]*fakeProvider{"primary": {}}, enableFilter(t, "block"))
+	stream = s.filter.NewStream()
+	first := streamChunk("开头敏", "")
+	assert.False(t, filterStreamChunk(stream, first).Blocked())
+	// 末尾可能组成敏感词的部分留在缓冲区
+	assert.Equal(t, "开", first.GetContent())
+
+	second := streamChunk("感词结尾", "")
+	assert.True(t, filterStreamChunk(stream, second).Blocked())
+	assert.Equal(t, "头", second.GetContent())
+	require.NotNil(t, second.Choices[0].FinishReason)
+	assert.Equal(t, FinishReasonContentFilter, *second.Choices[0].FinishReason)
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"ai-svc/internal/model"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CreateChatCompletion OpenAI 兼容的聊天接口：按模型名称路由到提供商，不保存对话
+// 与对话接口一样经过内容过滤、配额检查、回复缓存和用量统计；要求结构化输出时校验回复，不符合时要求模型修正一次.
+func (s *aiService) CreateChatCompletion(ctx context.Context, userID uint, req *ChatRequest) (*ChatResponse, error) {
+	output, err := newStructuredOutput(req.ResponseFormat)
+	if err != nil {
+		return nil, err
+	}
+	target, reservation, err := s.prepareCompletion(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.Release()
+	req.Stream = false
+
+	counts := newUsageCounts(0)
+	start := time.Now()
+	cacheKey := ""
+	if output == nil && s.shouldUseCache(req, &ChatOptions{}) {
+		cacheKey = responseCacheKey(target.providerName, req)
+		if cached := s.getCachedReply(ctx, cacheKey); cached != nil {
+			resp := *cached.Response
+			resp.Usage = model.TokenUsage{}
+			s.recordCompletionUsage(userID, req, counts, completionUsage(target, resp.Usage, time.Since(start), nil))
+			return s.filterCompletion(&resp), nil
+		}
+	}
+
+	for {
+		resp, answered, err := s.chatWithFailover(ctx, target, req)
+		if err != nil {
+			s.recordCompletionUsage(
+				userID, req, counts, completionUsage(answered, model.TokenUsage{}, time.Since(start), err),
+			)
+			return nil, err
+		}
+		target = answered
+		if cacheKey != "" {
+			s.storeCachedReply(ctx, cacheKey, resp, answered)
+		}
+
+		resp.Provider = answered.providerName
+		resp = s.filterCompletion(resp)
+		if output == nil || len(resp.Choices) == 0 {
+			s.recordCompletionUsage(userID, req, counts, completionUsage(answered, resp.Usage, time.Since(start), nil))
+			return resp, nil
+		}
+
+		content, outputErrors := output.check(resp.Choices[0].Message.Content)
+		if len(outputErrors) == 0 {
+			s.recordCompletionUsage(userID, req, counts, completionUsage(answered, resp.Usage, time.Since(start), nil))
+			resp.Choices[0].Message.Content = content
+			return resp, nil
+		}
+
+		// 不符合格式要求的回复同样计入用量
+		cause := invalidOutputError(outputErrors)
+		s.recordCompletionUsage(userID, req, counts, completionUsage(answered, resp.Usage, time.Since(start), cause))
+		if !output.repair(req, content, outputErrors) {
+			return nil, cause
+		}
+		if err := checkTokenBudget(req, target.model); err != nil {
+			return nil, err
+		}
+		start = time.Now()
+	}
+}
+
+// CreateChatCompletionStream OpenAI 兼容的流式聊天接口，结束标记携带本次用量
+func (s *aiService) CreateChatCompletionStream(
+	ctx context.Context,
+	userID uint,
+	req *ChatRequest,
+) (<-chan *ChatStreamResponse, error) {
+	if err := rejectStreamingResponseFormat(req.ResponseFormat); err != nil {
+		return nil, err
+	}
+	target, reservation, err := s.prepareCompletion(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	req.Stream = true
+
+	// 回复被内容过滤拦截时需要提前结束上游请求
+	upstreamCtx, cancel := context.WithCancel(ctx)
+
+	counts := newUsageCounts(0)
+	start := time.Now()
+	upstream, answered, err := s.chatStreamWithFailover(upstreamCtx, target, req)
+	if err != nil {
+		cancel()
+		s.recordCompletionUsage(
+			userID, req, counts, completionUsage(answered, model.TokenUsage{}, time.Since(start), err),
+		)
+		reservation.Release()
+		return nil, err
+	}
+
+	out := make(chan *ChatStreamResponse, 10)
+	go func() {
+		defer close(out)
+		defer cancel()
+		defer reservation.Release()
+
+		send := streamSender(ctx, out)
+		result := s.forwardStream(ctx, cancel, answered, upstream, send)
+		if result.err != nil {
+			s.recordCompletionUsage(
+				userID, req, counts, completionUsage(answered, model.TokenUsage{}, time.Since(start), result.err),
+			)
+			return
+		}
+
+		s.recordCompletionUsage(userID, req, counts, completionUsage(answered, result.usage, time.Since(start), nil))
+		send(result.doneChunk(answered))
+	}()
+
+	return out, nil
+}
+
+// ListModels 列出 OpenAI 兼容接口可用的模型
+// 同名模型只列出路由时实际使用的提供商.
+func (s *aiService) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	seen := make(map[string]bool)
+	var models []ModelInfo
+	for _, providerName := range s.gatewayProviders() {
+		providerCfg, exists := s.registry.Config(providerName)
+		if !exists {
+			continue
+		}
+		for _, info := range modelsFromConfig(providerName, providerCfg) {
+			if !seen[info.ID] {
+				seen[info.ID] = true
+				models = append(models, info)
+			}
+		}
+	}
+	return models, nil
+}
+
+// prepareCompletion 校验 OpenAI 兼容请求、解析目标模型并预占配额
+func (s *aiService) prepareCompletion(userID uint, req *ChatRequest) (*chatTarget, *quotaReservation, error) {
+	if req.Model == "" {
+		return nil, nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: "缺少模型名称",
+		}
+	}
+	if err := req.ValidateMessages(); err != nil {
+		return nil, nil, err
+	}
+	if err := req.ValidateTools(); err != nil {
+		return nil, nil, err
+	}
+
+	target, err := s.resolveModelTarget(req.Model)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Model = target.model.Name
+	req.User = fmt.Sprintf("%d", userID)
+	if err := s.validateImages(req.Messages, target.model); err != nil {
+		return nil, nil, err
+	}
+
+	for i := range req.Messages {
+		if req.Messages[i].Role != model.MessageRoleUser {
+			continue
+		}
+		if err := s.filterMessageInput(&req.Messages[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	applyResponseFormat(req, req.ResponseFormat, target.model)
+
+	if err := checkTokenBudget(req, target.model); err != nil {
+		return nil, nil, err
+	}
+	reservation, err := s.reserveQuota(userID, target, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return target, reservation, nil
+}
+
+// filterMessageInput 对用户消息的文本和多模态内容中的文本片段做内容过滤
+func (s *aiService) filterMessageInput(msg *Message) error {
+	content, _, err := s.filterInput(msg.Content)
+	if err != nil {
+		return err
+	}
+	msg.Content = content
+
+	if len(msg.Parts) == 0 {
+		return nil
+	}
+	parts := make([]ContentPart, len(msg.Parts))
+	copy(parts, msg.Parts)
+	for i := range parts {
+		if parts[i].Type != ContentPartText {
+			continue
+		}
+		if parts[i].Text, _, err = s.filterInput(parts[i].Text); err != nil {
+			return err
+		}
+	}
+	msg.Parts = parts
+	return nil
+}
+
+// resolveModelTarget 按模型名称查找提供商
+// 支持 "provider/model" 的写法指定提供商；否则依次在默认提供商和其他已启用的提供商中查找.
+func (s *aiService) resolveModelTarget(name string) (*chatTarget, error) {
+	if providerName, modelName, found := strings.Cut(name, "/"); found {
+		if _, exists := s.registry.Config(providerName); exists {
+			return s.resolveTarget(providerName, modelName)
+		}
+	}
+
+	for _, providerName := range s.gatewayProviders() {
+		providerCfg, exists := s.registry.Config(providerName)
+		if !exists {
+			continue
+		}
+		if _, exists := providerCfg.GetModel(name); exists {
+			return s.resolveTarget(providerName, name)
+		}
+	}
+
+	return nil, &APIError{
+		Code:    ErrorCodeInvalidModel,
+		Message: fmt.Sprintf("模型不存在: %s", name),
+	}
+}
+
+// gatewayProviders 按路由优先级列出已启用的提供商：默认提供商优先，其余按名称排序
+func (s *aiService) gatewayProviders() []string {
+	names := []string{s.config.DefaultProvider}
+	for _, name := range s.registry.Names() {
+		if name != s.config.DefaultProvider {
+			names = append(names, name)
+		}
+	}
+
+	enabled := names[:0]
+	for _, name := range names {
+		if providerCfg, exists := s.registry.Config(name); exists && providerCfg.Enabled {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled
+}
+
+// filterCompletion 对回复内容做内容过滤
+func (s *aiService) filterCompletion(resp *ChatResponse) *ChatResponse {
+	if len(resp.Choices) == 0 {
+		return resp
+	}
+	choices := make([]Choice, len(resp.Choices))
+	copy(choices, resp.Choices)
+	choices[0].Message.Content, choices[0].FinishReason = s.filterReply(
+		choices[0].Message.Content, firstFinishReason(resp), map[string]interface{}{},
+	)
+	resp.Choices = choices
+	return resp
+}
+
+// recordCompletionUsage 记录 OpenAI 兼容请求一次模型调用的用量，消息数按请求中的消息和回复计
+func (s *aiService) recordCompletionUsage(
+	userID uint,
+	req *ChatRequest,
+	counts *usageCounts,
+	message *model.AIMessage,
+) {
+	requests, messages := counts.next(len(req.Messages) + 1)
+	s.recordUsage(userID, message, requests, messages)
+}
+
+// completionUsage 构建 OpenAI 兼容请求的用量记录，cause 不为空时记为失败
+func completionUsage(target *chatTarget, usage model.TokenUsage, elapsed time.Duration, cause error) *model.AIMessage {
+	message := &model.AIMessage{
+		Status:           model.MessageStatusReceived,
+		Provider:         target.providerName,
+		Model:            target.model.Name,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		Cost:             target.model.CalculatePrice(usage.PromptTokens, usage.CompletionTokens),
+		ResponseTime:     int(elapsed.Milliseconds()),
+	}
+	if cause != nil {
+		message.Status = model.MessageStatusError
+	}
+	return message
+}
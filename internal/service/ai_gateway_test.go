@@ -0,0 +1,137 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveModelTarget(t *testing.T) {
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": {}, "backup": {}})
+
+	target, err := s.resolveModelTarget("backup-model")
+	require.NoError(t, err)
+	assert.Equal(t, "backup", target.providerName)
+
+	target, err = s.resolveModelTarget("primary/primary-model")
+	require.NoError(t, err)
+	assert.Equal(t, "primary", target.providerName)
+	assert.Equal(t, "primary-model", target.model.Name)
+
+	_, err = s.resolveModelTarget("unknown-model")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeInvalidModel, apiErr.Code)
+}
+
+func TestCreateChatCompletionRecordsUsage(t *testing.T) {
+	providers := map[string]*fakeProvider{"primary": {}, "backup": {}}
+	s, repo := newTestService(t, providers)
+	s.usage = newUsageAggregator(repo, config.UsageTrackingConfig{Enabled: true})
+
+	req := NewChatRequest("backup-model", []Message{{Role: model.MessageRoleUser, Content: "你好"}})
+	resp, err := s.CreateChatCompletion(context.Background(), 7, req)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.Choices[0].Message.Content)
+	assert.Equal(t, "backup", resp.Provider)
+	assert.Equal(t, 1, providers["backup"].calls)
+	assert.Zero(t, providers["primary"].calls)
+	assert.Equal(t, "7", req.User)
+
+	s.usage.Flush()
+	stats, err := s.repo.GetUsageStats(7, "0000-00-00", "9999-99-99")
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, "backup", stats[0].Provider)
+	assert.Equal(t, 1, stats[0].RequestCount)
+
+	// 不保存对话
+	conversations, err := s.repo.ListUserConversations(7)
+	require.NoError(t, err)
+	assert.Empty(t, conversations)
+}
+
+func TestCreateChatCompletionStreamEndsWithDoneChunk(t *testing.T) {
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": {}, "backup": {}})
+
+	req := NewChatRequest("primary-model", []Message{{Role: model.MessageRoleUser, Content: "你好"}})
+	stream, err := s.CreateChatCompletionStream(context.Background(), 1, req)
+	require.NoError(t, err)
+
+	var chunks []*ChatStreamResponse
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	require.Len(t, chunks, 3)
+	assert.Equal(t, "ok", chunks[0].Choices[0].Delta.Content)
+	assert.Equal(t, FinishReasonStop, *chunks[1].Choices[0].FinishReason)
+	assert.True(t, chunks[2].Done)
+	require.NotNil(t, chunks[2].Usage)
+	assert.Equal(t, fakeUsage.TotalTokens, chunks[2].Usage.TotalTokens)
+}
+
+func TestListModelsDeduplicatesByRoutingOrder(t *testing.T) {
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": {}, "backup": {}})
+
+	models, err := s.ListModels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	assert.Equal(t, "primary-model", models[0].ID)
+	assert.Equal(t, "backup-model", models[1].ID)
+}
+
+func TestOpenAIStopUnmarshal(t *testing.T) {
+	var req OpenAIChatRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"stop":"END"}`), &req))
+	assert.Equal(t, OpenAIStop{"END"}, req.Stop)
+
+	req = OpenAIChatRequest{}
+	require.NoError(t, json.Unmarshal([]byte(`{"stop":["a","b"]}`), &req))
+	assert.Equal(t, OpenAIStop{"a", "b"}, req.Stop)
+
+	req = OpenAIChatRequest{}
+	require.NoError(t, json.Unmarshal([]byte(`{"stop":null}`), &req))
+	assert.Empty(t, req.Stop)
+}
+
+func TestCreateChatCompletionValidatesTools(t *testing.T) {
+	provider := &fakeProvider{}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": provider})
+
+	req := newToolTestRequest("primary-model")
+	req.ToolChoice = &ToolChoice{Type: ToolChoiceFunction, Function: "unknown"}
+	_, err := s.CreateChatCompletion(context.Background(), 1, req)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeInvalidRequest, apiErr.Code)
+
+	req = newToolTestRequest("primary-model")
+	req.Tools[0].Function.Name = "get weather"
+	_, err = s.CreateChatCompletion(context.Background(), 1, req)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Zero(t, provider.calls)
+
+	// 工具调用历史中助手消息可以没有文本内容
+	_, err = s.CreateChatCompletion(context.Background(), 1, newToolTestRequest("primary-model"))
+	require.NoError(t, err)
+}
+
+func TestCreateChatCompletionRejectsOversizedMessage(t *testing.T) {
+	provider := &fakeProvider{}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": provider})
+
+	req := NewChatRequest("primary-model", []Message{
+		{Role: model.MessageRoleUser, Content: strings.Repeat("a", maxMessageContentBytes+1)},
+	})
+	_, err := s.CreateChatCompletion(context.Background(), 1, req)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeInvalidRequest, apiErr.Code)
+	assert.Zero(t, provider.calls)
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultStreamRetention 未配置时回复结束后缓存保留的时间
+	defaultStreamRetention = 5 * time.Minute
+
+	// defaultStreamTimeout 未配置时单次回复的最长生成时间
+	defaultStreamTimeout = 10 * time.Minute
+
+	// generationRetention 回复结束后仍可按生成 ID 查到的时间，期间停止生成返回已结束
+	generationRetention = time.Minute
+
+	// streamSubscriberBuffer 订阅通道的缓冲大小
+	streamSubscriberBuffer = 10
+)
+
+var (
+	// ErrGenerationNotFound 回复不存在、不属于当前用户或结束已久
+	ErrGenerationNotFound = errors.New("生成不存在或已过期")
+
+	// ErrGenerationFinished 回复已经结束，无法停止
+	ErrGenerationFinished = errors.New("生成已结束")
+
+	// errGenerationCancelled 用户停止生成时生成上下文的取消原因
+	errGenerationCancelled = errors.New("生成已被用户停止")
+)
+
+// StreamHub 按对话缓存进行中和最近结束的流式回复，客户端断开后回复继续生成，重连时从断点继续接收
+// 缓存保存在进程内，多实例部署时重连请求需要路由到同一实例.
+type StreamHub struct {
+	retention time.Duration
+	timeout   time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*streamGeneration // 以对话 session ID 为键，只保留最近一次回复
+}
+
+// NewStreamHub 创建流式回复缓存，未启用时返回 nil
+func NewStreamHub(cfg config.StreamResumeConfig) *StreamHub {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	h := &StreamHub{
+		retention: cfg.Retention,
+		timeout:   cfg.Timeout,
+		sessions:  make(map[string]*streamGeneration),
+	}
+	if h.retention <= 0 {
+		h.retention = defaultStreamRetention
+	}
+	if h.timeout <= 0 {
+		h.timeout = defaultStreamTimeout
+	}
+	return h
+}
+
+// newGeneration 创建一次回复及其生成上下文，开始输出前需登记到 generationRegistry 和 StreamHub
+// 启用缓存时生成上下文与请求上下文脱离，客户端断开后继续生成，直到完成、超时或被停止；未启用时随请求取消.
+func (h *StreamHub) newGeneration(ctx context.Context, userID uint, sessionID string) *streamGeneration {
+	release := func() {}
+	if h != nil {
+		ctx, release = context.WithTimeout(context.WithoutCancel(ctx), h.timeout)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	return &streamGeneration{
+		id:        uuid.New().String(),
+		userID:    userID,
+		sessionID: sessionID,
+		firstID:   1,
+		ctx:       ctx,
+		cancel: func(cause error) {
+			cancel(cause)
+			release()
+		},
+		notifyCh: make(chan struct{}),
+	}
+}
+
+// register 登记回复，事件 ID 接着该对话上一次回复继续递增
+// 未启用缓存时不登记，回复只供本次请求读取.
+func (h *StreamHub) register(g *streamGeneration) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sweep()
+
+	if previous, exists := h.sessions[g.sessionID]; exists {
+		g.firstID = previous.lastID() + 1
+	}
+	h.sessions[g.sessionID] = g
+}
+
+// find 查找用户在对话中最近一次的回复，不存在或已过期时返回 nil
+func (h *StreamHub) find(userID uint, sessionID string) *streamGeneration {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sweep()
+
+	g, exists := h.sessions[sessionID]
+	if !exists || g.userID != userID {
+		return nil
+	}
+	return g
+}
+
+// sweep 清理结束后超过保留时间的回复，调用方需持有锁
+func (h *StreamHub) sweep() {
+	now := time.Now()
+	for sessionID, g := range h.sessions {
+		if finishedAt, done := g.finishedAt(); done && now.Sub(finishedAt) > h.retention {
+			delete(h.sessions, sessionID)
+		}
+	}
+}
+
+// generationRegistry 按生成 ID 登记进行中和刚结束的回复，用于停止生成
+// 与断线重连的回复缓存无关，总是启用；零值可以直接使用.
+type generationRegistry struct {
+	mu          sync.Mutex
+	generations map[string]*streamGeneration
+}
+
+// register 登记回复
+func (r *generationRegistry) register(g *streamGeneration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep()
+
+	if r.generations == nil {
+		r.generations = make(map[string]*streamGeneration)
+	}
+	r.generations[g.id] = g
+}
+
+// lookup 按生成 ID 查找用户的回复，不存在或结束已久时返回 nil
+func (r *generationRegistry) lookup(userID uint, generationID string) *streamGeneration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep()
+
+	g, exists := r.generations[generationID]
+	if !exists || g.userID != userID {
+		return nil
+	}
+	return g
+}
+
+// sweep 清理结束后超过 generationRetention 的回复，调用方需持有锁
+func (r *generationRegistry) sweep() {
+	now := time.Now()
+	for id, g := range r.generations {
+		if finishedAt, done := g.finishedAt(); done && now.Sub(finishedAt) > generationRetention {
+			delete(r.generations, id)
+		}
+	}
+}
+
+// streamGeneration 一次流式回复，按顺序缓存已输出的事件供订阅者读取
+type streamGeneration struct {
+	id        string
+	userID    uint
+	sessionID string
+	firstID   int64
+
+	// ctx 生成回复使用的上下文，cancel 以指定原因取消生成
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	events   []*StreamEvent
+	done     bool
+	doneAt   time.Time
+	notifyCh chan struct{} // 有新事件或回复结束时关闭并替换
+}
+
+// publish 追加一个事件并通知订阅者，回复已结束时返回 false
+func (g *streamGeneration) publish(chunk *ChatStreamResponse) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done {
+		return false
+	}
+
+	g.events = append(g.events, &StreamEvent{ID: g.firstID + int64(len(g.events)), Chunk: chunk})
+	close(g.notifyCh)
+	g.notifyCh = make(chan struct{})
+	return true
+}
+
+// finish 标记回复结束并释放生成上下文，订阅者读完剩余事件后结束
+func (g *streamGeneration) finish() {
+	defer g.cancel(nil)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done {
+		return
+	}
+
+	g.done = true
+	g.doneAt = time.Now()
+	close(g.notifyCh)
+}
+
+// stop 停止生成，取消上游请求，已输出的部分由生成方保存；回复已结束时返回 false
+func (g *streamGeneration) stop() bool {
+	g.mu.Lock()
+	done := g.done
+	g.mu.Unlock()
+	if done {
+		return false
+	}
+
+	g.cancel(errGenerationCancelled)
+	return true
+}
+
+// finishedAt 获取回复结束的时间，回复未结束时 done 为 false
+func (g *streamGeneration) finishedAt() (at time.Time, done bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.doneAt, g.done
+}
+
+// lastID 获取最后一个事件的 ID，还没有事件时为 firstID-1
+func (g *streamGeneration) lastID() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.firstID + int64(len(g.events)) - 1
+}
+
+// subscribe 读取 ID 大于 afterID 的事件，回复结束且事件读完后关闭通道，ctx 取消时停止读取
+// afterID 不属于本次回复（如上一次回复的事件）时从头读取.
+func (g *streamGeneration) subscribe(ctx context.Context, afterID int64) <-chan *StreamEvent {
+	out := make(chan *StreamEvent, streamSubscriberBuffer)
+	go func() {
+		defer close(out)
+
+		g.mu.Lock()
+		next := 0
+		if afterID >= g.firstID && afterID < g.firstID+int64(len(g.events)) {
+			next = int(afterID-g.firstID) + 1
+		}
+		g.mu.Unlock()
+
+		for {
+			g.mu.Lock()
+			pending := g.events[next:]
+			done := g.done
+			notify := g.notifyCh
+			g.mu.Unlock()
+
+			for _, event := range pending {
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			next += len(pending)
+			if len(pending) > 0 {
+				continue
+			}
+			if done {
+				return
+			}
+
+			select {
+			case <-notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// newChatStream 订阅回复中 afterID 之后的事件
+func newChatStream(ctx context.Context, g *streamGeneration, afterID int64) *ChatStream {
+	return &ChatStream{
+		SessionID:    g.sessionID,
+		GenerationID: g.id,
+		Events:       g.subscribe(ctx, afterID),
+	}
+}
+
+// producedUsage 估算被停止的回复的用量：提示词按请求估算，输出只计已生成的内容
+func producedUsage(modelCfg config.ModelConfig, req *ChatRequest, content string) model.TokenUsage {
+	counter := tokenizerFor(modelCfg)
+	promptTokens := estimateRequestTokens(counter, req)
+	completionTokens := counter.Count(content)
+	return model.TokenUsage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
+
+// generationCancelled 判断生成上下文是否因用户停止生成而取消
+func generationCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errGenerationCancelled)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enableStreamResume 开启流式回复缓存
+func enableStreamResume(s *aiService) {
+	s.streams = NewStreamHub(config.StreamResumeConfig{Enabled: true})
+}
+
+func startGeneration(hub *StreamHub, userID uint, sessionID string) *streamGeneration {
+	g := hub.newGeneration(context.Background(), userID, sessionID)
+	hub.register(g)
+	return g
+}
+
+func textChunk(content string) *ChatStreamResponse {
+	return &ChatStreamResponse{Choices: []StreamChoice{newStreamChoice("assistant", content, nil)}}
+}
+
+func collectEvents(t *testing.T, events <-chan *StreamEvent) ([]int64, string) {
+	var ids []int64
+	var content strings.Builder
+	for event := range events {
+		require.Nil(t, event.Chunk.Error)
+		ids = append(ids, event.ID)
+		content.WriteString(event.Chunk.GetContent())
+	}
+	return ids, content.String()
+}
+
+func TestStreamGenerationReplaysFromLastEventID(t *testing.T) {
+	hub := NewStreamHub(config.StreamResumeConfig{Enabled: true})
+	first := startGeneration(hub, 1, "session")
+	for _, content := range []string{"一", "二", "三"} {
+		first.publish(textChunk(content))
+	}
+
+	// 订阅后继续输出的事件也能收到
+	events := first.subscribe(context.Background(), 1)
+	first.publish(textChunk("四"))
+	first.finish()
+	assert.False(t, first.publish(textChunk("五")))
+
+	ids, content := collectEvents(t, events)
+	assert.Equal(t, []int64{2, 3, 4}, ids)
+	assert.Equal(t, "二三四", content)
+
+	// 同一对话的下一次回复接着递增，断点属于上一次回复时从头读取
+	second := startGeneration(hub, 1, "session")
+	second.publish(textChunk("好"))
+	second.finish()
+	ids, content = collectEvents(t, hub.find(1, "session").subscribe(context.Background(), 3))
+	assert.Equal(t, []int64{5}, ids)
+	assert.Equal(t, "好", content)
+}
+
+func TestStreamHubFind(t *testing.T) {
+	assert.Nil(t, NewStreamHub(config.StreamResumeConfig{}))
+
+	hub := NewStreamHub(config.StreamResumeConfig{Enabled: true, Retention: time.Minute})
+	g := startGeneration(hub, 1, "session")
+	assert.Same(t, g, hub.find(1, "session"))
+	assert.Nil(t, hub.find(2, "session"))
+	assert.Nil(t, hub.find(1, "other"))
+
+	// 结束超过保留时间后清理
+	g.finish()
+	assert.Same(t, g, hub.find(1, "session"))
+	g.doneAt = time.Now().Add(-2 * time.Minute)
+	assert.Nil(t, hub.find(1, "session"))
+}
+
+func TestSendMessageStreamSurvivesClientDisconnect(t *testing.T) {
+	provider := &fakeProvider{parts: []string{"你好，", "我是", "助手"}, release: make(chan struct{})}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableStreamResume)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	stream, err := s.SendMessageStream(ctx, 1, "", "你好", nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, stream.SessionID)
+
+	first := <-stream.Events
+	assert.Equal(t, int64(1), first.ID)
+	assert.Equal(t, "你好，", first.Chunk.GetContent())
+
+	// 客户端断开后上游继续输出
+	disconnect()
+	close(provider.release)
+
+	_, err = s.ResumeMessageStream(context.Background(), 2, stream.SessionID, first.ID)
+	assert.Error(t, err)
+
+	resumed, err := s.ResumeMessageStream(context.Background(), 1, stream.SessionID, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, stream.GenerationID, resumed.GenerationID)
+	var done *ChatStreamResponse
+	var content strings.Builder
+	for event := range resumed.Events {
+		require.Nil(t, event.Chunk.Error)
+		assert.Greater(t, event.ID, first.ID)
+		content.WriteString(event.Chunk.GetContent())
+		if event.Chunk.Done {
+			done = event.Chunk
+		}
+	}
+	assert.Equal(t, "我是助手", content.String())
+	require.NotNil(t, done)
+
+	// 完整的回复已保存
+	require.Equal(t, []string{"user", "assistant"}, messageRoles(repo.messages))
+	assert.Equal(t, "你好，我是助手", repo.messages[1].Content)
+	assert.Equal(t, model.MessageStatusReceived, repo.messages[1].Status)
+}
+
+func TestCancelGenerationPersistsPartialReply(t *testing.T) {
+	provider := &fakeProvider{parts: []string{"你好，", "我是", "助手"}, release: make(chan struct{})}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableStreamResume)
+
+	stream, err := s.SendMessageStream(context.Background(), 1, "", "你好", nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, stream.GenerationID)
+	<-stream.Events
+
+	assert.ErrorIs(t, s.CancelGeneration(context.Background(), 2, stream.GenerationID), ErrGenerationNotFound)
+	require.NoError(t, s.CancelGeneration(context.Background(), 1, stream.GenerationID))
+
+	// 停止后输出完成原因为 cancelled 的块和结束标记
+	var finishReasons []string
+	var done *ChatStreamResponse
+	for event := range stream.Events {
+		require.Nil(t, event.Chunk.Error)
+		for _, choice := range event.Chunk.Choices {
+			if choice.FinishReason != nil {
+				finishReasons = append(finishReasons, *choice.FinishReason)
+			}
+		}
+		if event.Chunk.Done {
+			done = event.Chunk
+		}
+	}
+	assert.Equal(t, []string{FinishReasonCancelled}, finishReasons)
+	require.NotNil(t, done)
+	assert.ErrorIs(t, s.CancelGeneration(context.Background(), 1, stream.GenerationID), ErrGenerationFinished)
+
+	// 已输出的部分保存为已取消的回复，只按已生成的内容计算用量
+	require.Equal(t, []string{"user", "assistant"}, messageRoles(repo.messages))
+	reply := repo.messages[1]
+	assert.Equal(t, "你好，", reply.Content)
+	assert.Equal(t, model.MessageStatusCancelled, reply.Status)
+	assert.Equal(t, FinishReasonCancelled, reply.FinishReason)
+	assert.Equal(t, tokenizerFor(config.ModelConfig{}).Count("你好，"), reply.CompletionTokens)
+	assert.Positive(t, reply.PromptTokens)
+	assert.Equal(t, reply.PromptTokens+reply.CompletionTokens, done.Usage.TotalTokens)
+}
+
+func TestCancelGenerationWithoutStreamResume(t *testing.T) {
+	provider := &fakeProvider{parts: []string{"你好，", "我是", "助手"}, release: make(chan struct{})}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableStreamResume)
+	s.streams = nil
+
+	stream, err := s.SendMessageStream(context.Background(), 1, "", "你好", nil)
+	require.NoError(t, err)
+	<-stream.Events
+	require.NoError(t, s.CancelGeneration(context.Background(), 1, stream.GenerationID))
+
+	for range stream.Events {
+	}
+	assert.ErrorIs(t, s.CancelGeneration(context.Background(), 1, stream.GenerationID), ErrGenerationFinished)
+	require.Equal(t, []string{"user", "assistant"}, messageRoles(repo.messages))
+	assert.Equal(t, model.MessageStatusCancelled, repo.messages[1].Status)
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/pkg/logger"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeUsage 测试提供商每次回复的用量
+var fakeUsage = model.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+
+// fakeProvider 可配置的测试用提供商
+// 先按顺序返回 errs 中的错误，之后按顺序回复 replies，用完后重复最后一条，未设置时回复 "ok"；
+// 请求提供了工具时，在收到工具结果之前请求调用未读消息工具；
+// 流式回复按 parts 分段输出，设置 release 时输出第一段后等待它关闭，请求取消时返回错误.
+type fakeProvider struct {
+	name        string
+	validateErr error
+	closed      bool
+
+	errs       []error
+	replies    []string
+	alwaysCall bool // 只要允许调用工具就一直请求调用
+	parts      []string
+	release    chan struct{}
+	streamErr  *APIError // 流式输出第一段内容后返回的错误
+
+	mu       sync.Mutex
+	calls    int
+	replied  int
+	requests []*ChatRequest
+}
+
+func (p *fakeProvider) GetName() string { return p.name }
+
+func (p *fakeProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if err := p.record(req); err != nil {
+		return nil, err
+	}
+	if p.wantsTool(req) {
+		return &ChatResponse{
+			ID:    "resp-tool",
+			Model: req.Model,
+			Choices: []Choice{{
+				Message: Message{Role: "assistant", ToolCalls: []ToolCall{{
+					Type:     ToolTypeFunction,
+					Function: ToolCallFunction{Name: ToolNameUnreadMessageCount, Arguments: "{}"},
+				}}},
+				FinishReason: FinishReasonToolCalls,
+			}},
+			Usage:    fakeUsage,
+			Provider: p.name,
+		}, nil
+	}
+	return &ChatResponse{
+		ID:       "resp-final",
+		Model:    req.Model,
+		Choices:  []Choice{{Message: Message{Role: "assistant", Content: p.reply()}, FinishReason: FinishReasonStop}},
+		Usage:    fakeUsage,
+		Provider: p.name,
+	}, nil
+}
+
+func (p *fakeProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatStreamResponse, error) {
+	err := p.record(req)
+	toolCall := err == nil && p.wantsTool(req)
+	parts := p.parts
+	if err == nil && !toolCall && len(parts) == 0 {
+		parts = []string{p.reply()}
+	}
+
+	ch := make(chan *ChatStreamResponse, len(parts)+3)
+	go func() {
+		defer close(ch)
+		usage := fakeUsage
+		switch {
+		case err != nil:
+			// 与 OpenAI 实现一致：错误通过流返回
+			ch <- &ChatStreamResponse{Error: err.(*APIError)}
+			return
+		case toolCall:
+			ch <- &ChatStreamResponse{ID: "stream-tool", Choices: []StreamChoice{newToolCallStreamChoice(ToolCallDelta{
+				ID:       "call_stream",
+				Type:     ToolTypeFunction,
+				Function: ToolCallFunction{Name: ToolNameUnreadMessageCount, Arguments: "{"},
+			})}}
+			ch <- &ChatStreamResponse{Choices: []StreamChoice{newToolCallStreamChoice(ToolCallDelta{
+				Function: ToolCallFunction{Arguments: "}"},
+			})}}
+			finishReason := FinishReasonToolCalls
+			ch <- &ChatStreamResponse{Choices: []StreamChoice{newStreamChoice("", "", &finishReason)}, Usage: &usage}
+			return
+		}
+
+		for i, part := range parts {
+			if i == 1 && p.release != nil {
+				select {
+				case <-p.release:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				ch <- &ChatStreamResponse{Error: &APIError{Code: ErrorCodeNetworkError, Message: "上游请求已取消"}}
+				return
+			}
+			ch <- &ChatStreamResponse{ID: "stream", Choices: []StreamChoice{newStreamChoice("assistant", part, nil)}}
+			if p.streamErr != nil {
+				ch <- &ChatStreamResponse{Error: p.streamErr}
+				return
+			}
+		}
+		finishReason := FinishReasonStop
+		ch <- &ChatStreamResponse{Choices: []StreamChoice{newStreamChoice("", "", &finishReason)}, Usage: &usage}
+	}()
+	return ch, nil
+}
+
+func (p *fakeProvider) ListModels(ctx context.Context) ([]ModelInfo, error) { return nil, nil }
+
+func (p *fakeProvider) ValidateConfig() error { return p.validateErr }
+
+func (p *fakeProvider) Close() error {
+	p.closed = true
+	return nil
+}
+
+// record 记录请求的副本，返回本次调用预设的错误
+func (p *fakeProvider) record(req *ChatRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	copied := *req
+	copied.Messages = append([]Message{}, req.Messages...)
+	p.requests = append(p.requests, &copied)
+
+	p.calls++
+	if len(p.errs) == 0 {
+		return nil
+	}
+	err := p.errs[0]
+	p.errs = p.errs[1:]
+	return err
+}
+
+// wantsTool 是否请求调用未读消息工具
+func (p *fakeProvider) wantsTool(req *ChatRequest) bool {
+	if !req.toolsEnabled() {
+		return false
+	}
+	return p.alwaysCall || req.Messages[len(req.Messages)-1].Role != model.MessageRoleTool
+}
+
+// reply 下一条预设回复
+func (p *fakeProvider) reply() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.replies) == 0 {
+		return "ok"
+	}
+	p.replied++
+	return p.replies[min(p.replied, len(p.replies))-1]
+}
+
+func newFakeRegistry(t *testing.T, created *[]*fakeProvider) *ProviderRegistry {
+	require.NoError(t, logger.Init("error", "text", "stdout"))
+
+	registry := NewProviderRegistry()
+	registry.RegisterFactory(NewProviderFactory("fake", func(cfg config.ProviderConfig) AIProvider {
+		p := &fakeProvider{name: "fake"}
+		if cfg.APIKey == "" {
+			p.validateErr = errors.New("API密钥不能为空")
+		}
+		*created = append(*created, p)
+		return p
+	}))
+	return registry
+}
+
+// newTestService 创建使用测试提供商和内存仓储的服务
+// providers 的键为提供商名称，每个提供商有一个名为 "<名称>-model" 的模型，默认提供商为 primary；
+// configure 在加载提供商之前调整配置和服务的组件.
+func newTestService(
+	t *testing.T,
+	providers map[string]*fakeProvider,
+	configure ...func(s *aiService),
+) (*aiService, *fakeAIRepository) {
+	var created []*fakeProvider
+	registry := newFakeRegistry(t, &created)
+
+	cfg := &config.AIConfig{
+		DefaultProvider: "primary",
+		Providers:       map[string]config.ProviderConfig{},
+		RetryBackoff:    time.Millisecond,
+		RetryMaxBackoff: 2 * time.Millisecond,
+	}
+	for name, provider := range providers {
+		p := provider
+		p.name = name
+		registry.RegisterFactory(NewProviderFactory(name, func(config.ProviderConfig) AIProvider { return p }))
+		cfg.Providers[name] = config.ProviderConfig{
+			Enabled: true,
+			Type:    name,
+			APIKey:  "key",
+			Models:  []config.ModelConfig{{Name: name + "-model"}},
+		}
+	}
+
+	repo := &fakeAIRepository{}
+	s := &aiService{config: cfg, registry: registry, repo: repo}
+	for _, fn := range configure {
+		fn(s)
+	}
+	require.NoError(t, registry.LoadFromConfig(cfg))
+	return s, repo
+}
+
+func requestContents(req *ChatRequest) []string {
+	contents := make([]string, len(req.Messages))
+	for i, message := range req.Messages {
+		contents[i] = message.Content
+	}
+	return contents
+}
+
+func messageRoles(messages []*model.AIMessage) []string {
+	roles := make([]string, len(messages))
+	for i, message := range messages {
+		roles[i] = message.Role
+	}
+	return roles
+}
+
+func uintPtr(value uint) *uint {
+	return &value
+}
+
+// fakeAIRepository 内存实现的 AI 仓储
+type fakeAIRepository struct {
+	mu            sync.Mutex
+	conversations []*model.AIConversation
+	messages      []*model.AIMessage
+	usageStats    []*model.AIUsageStats
+	usageErr      error
+}
+
+func (r *fakeAIRepository) CreateConversation(conversation *model.AIConversation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conversation.ID = uint(len(r.conversations) + 1)
+	r.conversations = append(r.conversations, conversation)
+	return nil
+}
+
+func (r *fakeAIRepository) GetConversationBySessionID(userID uint, sessionID string) (*model.AIConversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, conversation := range r.conversations {
+		if conversation.UserID == userID && conversation.SessionID == sessionID {
+			return conversation, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeAIRepository) ListConversations(userID uint, page, size int) ([]*model.AIConversation, int64, error) {
+	conversations, err := r.ListUserConversations(userID)
+	return conversations, int64(len(conversations)), err
+}
+
+func (r *fakeAIRepository) AddConversationStats(
+	id, currentMessageID uint,
+	messages int,
+	usage model.TokenUsage,
+	cost float64,
+) error {
+	return nil
+}
+
+func (r *fakeAIRepository) UpdateConversationFields(id uint, updates map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conversation := r.conversations[id-1]
+	for key, value := range updates {
+		switch key {
+		case "current_message_id":
+			conversation.SetCurrentMessage(value.(uint))
+		case "title":
+			conversation.Title = value.(string)
+		case "auto_title":
+			conversation.AutoTitle = value.(bool)
+		}
+	}
+	return nil
+}
+
+func (r *fakeAIRepository) SetGeneratedTitle(id uint, title string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if conversation := r.conversations[id-1]; conversation.AutoTitle {
+		conversation.Title = title
+		conversation.AutoTitle = false
+	}
+	return nil
+}
+
+func (r *fakeAIRepository) SetConversationSummary(id uint, summary string, summaryMessageID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conversation := r.conversations[id-1]
+	if conversation.SummaryMessageID == nil || *conversation.SummaryMessageID < summaryMessageID {
+		conversation.Summary = summary
+		conversation.SummaryMessageID = &summaryMessageID
+	}
+	return nil
+}
+
+func (r *fakeAIRepository) DeleteConversation(id uint) error { return nil }
+
+func (r *fakeAIRepository) CreateMessage(message *model.AIMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	message.ID = uint(len(r.messages) + 1)
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func (r *fakeAIRepository) GetMessage(conversationID, messageID uint) (*model.AIMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, message := range r.messages {
+		if message.ConversationID == conversationID && message.ID == messageID {
+			return message, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeAIRepository) GetMessagePath(conversationID, leafID uint, limit int) ([]*model.AIMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var path []*model.AIMessage
+	for id := &leafID; id != nil && (limit <= 0 || len(path) < limit); {
+		message := r.messages[*id-1]
+		if message.ConversationID != conversationID {
+			break
+		}
+		path = append([]*model.AIMessage{message}, path...)
+		id = message.ParentID
+	}
+	return path, nil
+}
+
+func (r *fakeAIRepository) GetMessageTree(conversationID uint) ([]*model.AIMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var messages []*model.AIMessage
+	for _, message := range r.messages {
+		if message.ConversationID == conversationID {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (r *fakeAIRepository) GetUsageStats(userID uint, startDate, endDate string) ([]*model.AIUsageStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stats []*model.AIUsageStats
+	for _, item := range r.usageStats {
+		if item.UserID == userID && item.Date >= startDate && item.Date <= endDate {
+			stats = append(stats, item)
+		}
+	}
+	return stats, nil
+}
+
+func (r *fakeAIRepository) UpsertUsageStats(stats []*model.AIUsageStats) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.usageErr != nil {
+		return r.usageErr
+	}
+	for _, item := range stats {
+		merged := false
+		for _, existing := range r.usageStats {
+			if existing.UserID == item.UserID && existing.Provider == item.Provider &&
+				existing.Model == item.Model && existing.Date == item.Date {
+				existing.Merge(item)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			copied := *item
+			r.usageStats = append(r.usageStats, &copied)
+		}
+	}
+	return nil
+}
+
+func (r *fakeAIRepository) ListUserConversations(userID uint) ([]*model.AIConversation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var conversations []*model.AIConversation
+	for _, conversation := range r.conversations {
+		if conversation.UserID == userID {
+			conversations = append(conversations, conversation)
+		}
+	}
+	return conversations, nil
+}
@@ -3,8 +3,11 @@ package service
 import (
 	"ai-svc/internal/model"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"regexp"
+	"time"
 )
 
 // AIProvider AI 提供商接口 - 各个提供商的具体实现
@@ -51,9 +54,34 @@ type AIService interface {
 		sessionID string,
 		content string,
 		options *ChatOptions,
-	) (<-chan *ChatStreamResponse, error)
+	) (*ChatStream, error)
+	ResumeMessageStream(ctx context.Context, userID uint, sessionID string, lastEventID int64) (*ChatStream, error)
+	CancelGeneration(ctx context.Context, userID uint, generationID string) error
 	GetMessages(ctx context.Context, userID uint, sessionID string, page, size int) ([]*model.AIMessage, error)
 
+	// 分支管理
+	RegenerateMessage(
+		ctx context.Context,
+		userID uint,
+		sessionID string,
+		messageID uint,
+		options *ChatOptions,
+	) (*model.AIMessage, error)
+	RegenerateMessageStream(
+		ctx context.Context,
+		userID uint,
+		sessionID string,
+		messageID uint,
+		options *ChatOptions,
+	) (*ChatStream, error)
+	ListBranches(ctx context.Context, userID uint, sessionID string) ([]*BranchInfo, error)
+	SwitchBranch(ctx context.Context, userID uint, sessionID string, messageID uint) ([]*model.AIMessage, error)
+
+	// OpenAI 兼容接口：按模型名称路由，不保存对话
+	CreateChatCompletion(ctx context.Context, userID uint, req *ChatRequest) (*ChatResponse, error)
+	CreateChatCompletionStream(ctx context.Context, userID uint, req *ChatRequest) (<-chan *ChatStreamResponse, error)
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+
 	// 提供商管理
 	ListProviders(ctx context.Context) ([]ProviderInfo, error)
 	GetProvider(ctx context.Context, name string) (ProviderInfo, error)
@@ -61,6 +89,9 @@ type AIService interface {
 	// 统计信息
 	GetUsageStats(ctx context.Context, userID uint, startDate, endDate string) ([]*model.AIUsageStats, error)
 	GetConversationStats(ctx context.Context, userID uint) (*ConversationStats, error)
+
+	// Close 等待后台任务结束，服务关闭时调用
+	Close()
 }
 
 // ChatRequest 聊天请求
@@ -82,15 +113,135 @@ type ChatRequest struct {
 	// 停止词
 	Stop []string `json:"stop,omitempty"`
 
+	// 工具调用
+	Tools      []ToolDefinition `json:"tools,omitempty"`
+	ToolChoice *ToolChoice      `json:"tool_choice,omitempty"`
+
+	// 结构化输出
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
 	// 用户ID（用于追踪）
 	User string `json:"user,omitempty"`
 }
 
 // Message 消息结构
 type Message struct {
-	Role    string `json:"role"` // user, assistant, system
+	Role    string `json:"role"` // user, assistant, system, tool
 	Content string `json:"content"`
 	Name    string `json:"name,omitempty"` // 可选的用户名
+
+	// ToolCalls 助手消息发起的工具调用
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	// ToolCallID tool 消息对应的工具调用ID
+	ToolCallID string `json:"tool_call_id,omitempty"`
+
+	// Parts 多模态内容（文本和图片），非空时提供商按此发送，Content 为其中的文本
+	Parts []ContentPart `json:"parts,omitempty"`
+}
+
+// ContentPart 多模态消息的内容片段
+type ContentPart struct {
+	Type     string    `json:"type"` // text 或 image_url
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL 图片地址：http(s) 链接，或 data:<mime>;base64,<data> 形式的内嵌图片
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"` // auto, low, high
+}
+
+// ToolDefinition 工具定义
+type ToolDefinition struct {
+	Type     string       `json:"type"` // 目前只支持 function
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction 函数定义
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"` // 参数的 JSON Schema
+}
+
+// ToolCall 模型发起的一次工具调用
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction 调用的函数名和参数
+type ToolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"` // JSON 字符串，流式增量中为部分片段
+}
+
+// ToolCallDelta 流式响应中的工具调用增量
+// 同一调用的多个增量 Index 相同，ID 和函数名只在第一个增量中出现，参数需要依次拼接.
+type ToolCallDelta struct {
+	Index    int              `json:"index"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ResponseFormat 输出格式（OpenAI 格式）
+// json_object 要求输出 JSON 对象，json_schema 要求输出符合给定 JSON Schema 的 JSON.
+type ResponseFormat struct {
+	Type       string            `json:"type"` // text, json_object, json_schema
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat json_schema 输出格式的定义
+type JSONSchemaFormat struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// ToolChoice 工具选择策略
+// 序列化为 OpenAI 格式：auto、none、required 为字符串，指定函数时为对象.
+type ToolChoice struct {
+	Type     string // auto, none, required, function
+	Function string // Type 为 function 时调用的函数名
+}
+
+// toolChoiceObject 指定函数时的 OpenAI 格式
+type toolChoiceObject struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"`
+}
+
+// MarshalJSON 序列化为 OpenAI 格式
+func (c ToolChoice) MarshalJSON() ([]byte, error) {
+	if c.Type != ToolChoiceFunction {
+		return json.Marshal(c.Type)
+	}
+	obj := toolChoiceObject{Type: ToolTypeFunction}
+	obj.Function.Name = c.Function
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON 解析字符串或对象
+func (c *ToolChoice) UnmarshalJSON(data []byte) error {
+	var mode string
+	if err := json.Unmarshal(data, &mode); err == nil {
+		*c = ToolChoice{Type: mode}
+		return nil
+	}
+
+	var obj toolChoiceObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*c = ToolChoice{Type: ToolChoiceFunction, Function: obj.Function.Name}
+	return nil
 }
 
 // ChatResponse 聊天响应
@@ -143,14 +294,31 @@ type ChatStreamResponse struct {
 	Provider string `json:"provider"`
 }
 
+// StreamEvent 流式回复中的一个事件，ID 在同一对话内单调递增，断线重连时用于指定断点
+type StreamEvent struct {
+	ID    int64
+	Chunk *ChatStreamResponse
+}
+
+// ChatStream 对话的流式回复，回复结束后 Events 关闭
+type ChatStream struct {
+	SessionID    string
+	GenerationID string // 用于停止生成，断线重连后保持不变
+	Events       <-chan *StreamEvent
+}
+
 // StreamChoice 流式响应选择
 type StreamChoice struct {
-	Index int `json:"index"`
-	Delta struct {
-		Role    string `json:"role,omitempty"`
-		Content string `json:"content,omitempty"`
-	} `json:"delta"`
-	FinishReason *string `json:"finish_reason"`
+	Index        int         `json:"index"`
+	Delta        StreamDelta `json:"delta"`
+	FinishReason *string     `json:"finish_reason"`
+}
+
+// StreamDelta 流式增量
+type StreamDelta struct {
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
 }
 
 // ModelInfo 模型信息
@@ -167,12 +335,13 @@ type ModelInfo struct {
 
 // ProviderInfo 提供商信息
 type ProviderInfo struct {
-	Name        string      `json:"name"`
-	DisplayName string      `json:"display_name"`
-	Enabled     bool        `json:"enabled"`
-	Models      []ModelInfo `json:"models"`
-	Status      string      `json:"status"` // available, error, disabled
-	LastError   string      `json:"last_error,omitempty"`
+	Name         string      `json:"name"`
+	DisplayName  string      `json:"display_name"`
+	Enabled      bool        `json:"enabled"`
+	Models       []ModelInfo `json:"models"`
+	Status       string      `json:"status"` // available, error, disabled
+	LastError    string      `json:"last_error,omitempty"`
+	CircuitState string      `json:"circuit_state,omitempty"` // closed, open, half_open
 }
 
 // ChatOptions 聊天选项
@@ -183,6 +352,26 @@ type ChatOptions struct {
 	MaxTokens    *int     `json:"max_tokens,omitempty"`
 	Stream       bool     `json:"stream"`
 	SystemPrompt string   `json:"system_prompt,omitempty"`
+	Cache        bool     `json:"cache,omitempty"` // 非确定性请求（temperature 不为 0）也使用回复缓存
+
+	// Images 随消息发送的图片，模型需要支持图片输入
+	Images []ImageURL `json:"images,omitempty"`
+
+	// ResponseFormat 要求模型输出 JSON，回复会按 schema 校验
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	// ForkFrom 从该消息开始新的分支：为用户消息时新消息与其并列（相当于编辑后重新发送），
+	// 为其他消息时新消息接在其后；为 0 时接在当前分支末尾
+	ForkFrom uint `json:"fork_from,omitempty"`
+}
+
+// BranchInfo 对话分支，以分支的最后一条消息标识
+type BranchInfo struct {
+	LeafID        uint      `json:"leaf_id"`         // 分支最后一条消息的 ID
+	MessageCount  int       `json:"message_count"`   // 分支上的消息数
+	Preview       string    `json:"preview"`         // 最后一条消息的摘录
+	LastMessageAt time.Time `json:"last_message_at"` // 最后一条消息的时间
+	Current       bool      `json:"current"`         // 是否为当前分支
 }
 
 // ConversationStats 对话统计
@@ -204,9 +393,10 @@ type ProviderStats struct {
 
 // APIError API错误
 type APIError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Type    string `json:"type,omitempty"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Type    string      `json:"type,omitempty"`
+	Details interface{} `json:"details,omitempty"` // 错误详情，如配额超限时的剩余额度
 }
 
 // Error 实现error接口
@@ -227,8 +417,35 @@ const (
 	FinishReasonContentFilter = "content_filter"
 	FinishReasonToolCalls     = "tool_calls"
 	FinishReasonError         = "error"
+	FinishReasonCancelled     = "cancelled" // 用户停止生成
+)
+
+// 输出格式常量
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// 工具相关常量
+const (
+	ToolTypeFunction = "function"
+
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+	ToolChoiceFunction = "function"
 )
 
+// 内容片段类型常量
+const (
+	ContentPartText  = "text"
+	ContentPartImage = "image_url"
+)
+
+// toolNamePattern 函数名的格式要求（与 OpenAI 一致）
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
 // 错误代码常量
 const (
 	ErrorCodeInvalidRequest      = "invalid_request"
@@ -239,6 +456,9 @@ const (
 	ErrorCodeProviderError       = "provider_error"
 	ErrorCodeNetworkError        = "network_error"
 	ErrorCodeAuthenticationError = "authentication_error"
+	ErrorCodeProviderUnavailable = "provider_unavailable"
+	ErrorCodeContentFiltered     = "content_filtered"
+	ErrorCodeInvalidOutput       = "invalid_output" // 模型输出不符合要求的格式
 )
 
 // 提供商状态常量
@@ -280,6 +500,10 @@ func (r *ChatRequest) SetParameters(temperature *float32, maxTokens *int) {
 	r.MaxTokens = maxTokens
 }
 
+// maxMessageContentBytes 单条消息内容的最大字节数，超过的请求在计数 token 之前拒绝
+// 足以容纳上下文最长的模型可以接受的文本.
+const maxMessageContentBytes = 512 * 1024
+
 // ValidateMessages 验证消息
 func (r *ChatRequest) ValidateMessages() error {
 	if len(r.Messages) == 0 {
@@ -296,17 +520,100 @@ func (r *ChatRequest) ValidateMessages() error {
 				Message: fmt.Sprintf("第%d条消息缺少角色", i+1),
 			}
 		}
-		if msg.Content == "" {
+		// 发起工具调用的助手消息和只有图片的消息可以没有文本内容
+		if msg.Content == "" && len(msg.ToolCalls) == 0 && len(msg.Parts) == 0 {
 			return &APIError{
 				Code:    ErrorCodeInvalidRequest,
 				Message: fmt.Sprintf("第%d条消息内容为空", i+1),
 			}
 		}
+		if len(msg.Content) > maxMessageContentBytes {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("第%d条消息内容过长，最多 %d KB", i+1, maxMessageContentBytes/1024),
+			}
+		}
+		if msg.Role == model.MessageRoleTool && msg.ToolCallID == "" {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("第%d条工具消息缺少 tool_call_id", i+1),
+			}
+		}
 	}
 
 	return nil
 }
 
+// ValidateTools 验证工具定义和工具选择策略
+func (r *ChatRequest) ValidateTools() error {
+	names := make(map[string]bool, len(r.Tools))
+	for i, tool := range r.Tools {
+		if tool.Type != ToolTypeFunction {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("第%d个工具类型不支持: %s", i+1, tool.Type),
+			}
+		}
+		if !toolNamePattern.MatchString(tool.Function.Name) {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("第%d个工具的函数名无效: %q", i+1, tool.Function.Name),
+			}
+		}
+		if names[tool.Function.Name] {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("工具函数名重复: %s", tool.Function.Name),
+			}
+		}
+		names[tool.Function.Name] = true
+
+		if len(tool.Function.Parameters) > 0 {
+			var schema map[string]interface{}
+			if err := json.Unmarshal(tool.Function.Parameters, &schema); err != nil {
+				return &APIError{
+					Code:    ErrorCodeInvalidRequest,
+					Message: fmt.Sprintf("工具 %s 的参数定义不是有效的 JSON Schema 对象", tool.Function.Name),
+				}
+			}
+		}
+	}
+
+	if r.ToolChoice == nil {
+		return nil
+	}
+	switch r.ToolChoice.Type {
+	case ToolChoiceAuto, ToolChoiceNone:
+		return nil
+	case ToolChoiceRequired:
+		if len(r.Tools) == 0 {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: "tool_choice 为 required 时必须提供工具",
+			}
+		}
+		return nil
+	case ToolChoiceFunction:
+		if !names[r.ToolChoice.Function] {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("tool_choice 指定的函数不存在: %s", r.ToolChoice.Function),
+			}
+		}
+		return nil
+	default:
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("不支持的 tool_choice: %s", r.ToolChoice.Type),
+		}
+	}
+}
+
+// toolsEnabled 判断请求是否允许模型调用工具
+func (r *ChatRequest) toolsEnabled() bool {
+	return len(r.Tools) > 0 && (r.ToolChoice == nil || r.ToolChoice.Type != ToolChoiceNone)
+}
+
 // GetLastAssistantMessage 获取最后一条助手消息
 func (r *ChatResponse) GetLastAssistantMessage() string {
 	if len(r.Choices) > 0 {
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	// imageTokenEstimate 每张图片按固定 token 数估算（OpenAI 高精度模式下 1024x1024 的图片约 765）
+	imageTokenEstimate = 765
+
+	// defaultMaxImages 未配置时每条消息最多携带的图片数
+	defaultMaxImages = 4
+
+	// defaultMaxImageSize 未配置时内嵌图片的最大字节数
+	defaultMaxImageSize = 5 * 1024 * 1024
+
+	// sniffLength 检测图片真实类型需要读取的字节数
+	sniffLength = 512
+)
+
+// defaultImageMimeTypes 未配置时允许的图片类型
+var defaultImageMimeTypes = []string{"image/png", "image/jpeg", "image/webp", "image/gif"}
+
+// inlineImage 解析后的内嵌图片
+type inlineImage struct {
+	mimeType string
+	data     string // base64 编码的图片数据
+}
+
+// parseDataURL 解析 data:<mime>;base64,<data> 形式的内嵌图片
+func parseDataURL(rawURL string) (inlineImage, bool) {
+	rest, found := strings.CutPrefix(rawURL, "data:")
+	if !found {
+		return inlineImage{}, false
+	}
+	header, data, found := strings.Cut(rest, ",")
+	if !found {
+		return inlineImage{}, false
+	}
+	mimeType, found := strings.CutSuffix(header, ";base64")
+	if !found || mimeType == "" {
+		return inlineImage{}, false
+	}
+	return inlineImage{mimeType: strings.ToLower(mimeType), data: data}, true
+}
+
+// dataURL 构建内嵌图片的 data URL
+func dataURL(mimeType, data string) string {
+	return "data:" + mimeType + ";base64," + data
+}
+
+// buildContentParts 将文本和图片组装为多模态内容，没有图片时返回 nil
+func buildContentParts(text string, images []ImageURL) []ContentPart {
+	if len(images) == 0 {
+		return nil
+	}
+
+	parts := make([]ContentPart, 0, len(images)+1)
+	if text != "" {
+		parts = append(parts, ContentPart{Type: ContentPartText, Text: text})
+	}
+	for i := range images {
+		image := images[i]
+		parts = append(parts, ContentPart{Type: ContentPartImage, ImageURL: &image})
+	}
+	return parts
+}
+
+// partsText 拼接内容片段中的文本
+func partsText(parts []ContentPart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == ContentPartText && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// hasImages 检查消息列表中是否包含图片
+func hasImages(messages []Message) bool {
+	for _, msg := range messages {
+		for _, part := range msg.Parts {
+			if part.Type == ContentPartImage {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateImages 检查消息中的内容片段：图片数量、类型、大小，以及目标模型是否支持图片输入
+func (s *aiService) validateImages(messages []Message, modelCfg config.ModelConfig) error {
+	limits := s.config.Features.Multimodal
+	maxImages := limits.MaxImages
+	if maxImages <= 0 {
+		maxImages = defaultMaxImages
+	}
+
+	for i, msg := range messages {
+		images := 0
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case ContentPartText:
+				continue
+			case ContentPartImage:
+				if part.ImageURL == nil {
+					return &APIError{
+						Code:    ErrorCodeInvalidRequest,
+						Message: fmt.Sprintf("第%d条消息的图片缺少 image_url", i+1),
+					}
+				}
+			default:
+				return &APIError{
+					Code:    ErrorCodeInvalidRequest,
+					Message: fmt.Sprintf("第%d条消息的内容类型不支持: %s", i+1, part.Type),
+				}
+			}
+
+			images++
+			if images > maxImages {
+				return &APIError{
+					Code:    ErrorCodeInvalidRequest,
+					Message: fmt.Sprintf("每条消息最多携带 %d 张图片", maxImages),
+				}
+			}
+			if err := validateImage(part.ImageURL, limits); err != nil {
+				return err
+			}
+		}
+		if images > 0 && msg.Role != model.MessageRoleUser {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("第%d条消息：只有用户消息可以携带图片", i+1),
+			}
+		}
+	}
+
+	return checkVision(messages, modelCfg)
+}
+
+// checkVision 检查模型能否处理消息中的图片
+func checkVision(messages []Message, modelCfg config.ModelConfig) error {
+	if hasImages(messages) && !modelCfg.Vision {
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("模型 %s 不支持图片输入", modelCfg.Name),
+		}
+	}
+	return nil
+}
+
+// validateImage 检查单张图片
+// 内嵌图片检查类型、大小并核对实际内容；远程图片只检查地址和扩展名，由提供商下载时再检查.
+func validateImage(image *ImageURL, limits config.MultimodalConfig) error {
+	switch image.Detail {
+	case "", "auto", "low", "high":
+	default:
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("图片精细度不支持: %s", image.Detail),
+		}
+	}
+
+	if inline, ok := parseDataURL(image.URL); ok {
+		return validateInlineImage(inline, limits)
+	}
+
+	u, err := url.Parse(image.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: "图片地址必须是 http(s) 链接或 base64 data URL",
+		}
+	}
+	if mimeType := remoteImageType(u); mimeType != "" {
+		if !imageTypeAllowed(mimeType, limits) {
+			return &APIError{
+				Code:    ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("图片类型不支持: %s", mimeType),
+			}
+		}
+	}
+	return nil
+}
+
+// validateInlineImage 检查内嵌图片的类型和大小
+func validateInlineImage(image inlineImage, limits config.MultimodalConfig) error {
+	if !imageTypeAllowed(image.mimeType, limits) {
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("图片类型不支持: %s", image.mimeType),
+		}
+	}
+
+	maxSize := limits.MaxImageSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxImageSize
+	}
+	// 先按编码长度粗略判断，避免解码过大的数据
+	if base64.StdEncoding.DecodedLen(len(image.data)) > maxSize+2 {
+		return imageTooLargeError(maxSize)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(image.data)
+	if err != nil || len(data) == 0 {
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: "图片数据不是有效的 base64 编码",
+		}
+	}
+	if len(data) > maxSize {
+		return imageTooLargeError(maxSize)
+	}
+
+	if detected := http.DetectContentType(data[:min(len(data), sniffLength)]); detected != image.mimeType {
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("图片内容与声明的类型不符: 声明 %s，实际 %s", image.mimeType, detected),
+		}
+	}
+	return nil
+}
+
+// remoteImageType 按扩展名推断远程图片的类型，无法推断时返回空
+func remoteImageType(u *url.URL) string {
+	mimeType := mime.TypeByExtension(strings.ToLower(path.Ext(u.Path)))
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return mimeType
+}
+
+// imageTypeAllowed 检查图片类型是否允许
+func imageTypeAllowed(mimeType string, limits config.MultimodalConfig) bool {
+	allowed := limits.AllowedMimeTypes
+	if len(allowed) == 0 {
+		allowed = defaultImageMimeTypes
+	}
+	for _, item := range allowed {
+		if strings.EqualFold(item, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageTooLargeError 图片超出大小限制的错误
+func imageTooLargeError(maxSize int) error {
+	return &APIError{
+		Code:    ErrorCodeInvalidRequest,
+		Message: fmt.Sprintf("图片大小超出限制: 最大 %d KB", maxSize/1024),
+	}
+}
+
+// attachmentsFromParts 将图片片段转换为消息附件
+func attachmentsFromParts(parts []ContentPart) []model.AIAttachment {
+	var attachments []model.AIAttachment
+	for _, part := range parts {
+		if part.Type != ContentPartImage || part.ImageURL == nil {
+			continue
+		}
+
+		attachment := model.AIAttachment{
+			Type:   model.ContentTypeImage,
+			Detail: part.ImageURL.Detail,
+		}
+		if inline, ok := parseDataURL(part.ImageURL.URL); ok {
+			attachment.MimeType = inline.mimeType
+			attachment.Data = inline.data
+			if data, err := base64.StdEncoding.DecodeString(inline.data); err == nil {
+				attachment.Size = len(data)
+			}
+		} else {
+			attachment.URL = part.ImageURL.URL
+			if u, err := url.Parse(part.ImageURL.URL); err == nil {
+				attachment.MimeType = remoteImageType(u)
+			}
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments
+}
+
+// partsFromAttachments 由消息文本和附件还原多模态内容，没有图片附件时返回 nil
+func partsFromAttachments(text string, attachments []model.AIAttachment) []ContentPart {
+	var images []ImageURL
+	for _, attachment := range attachments {
+		if attachment.Type != model.ContentTypeImage {
+			continue
+		}
+		image := ImageURL{URL: attachment.URL, Detail: attachment.Detail}
+		if attachment.Data != "" {
+			image.URL = dataURL(attachment.MimeType, attachment.Data)
+		}
+		images = append(images, image)
+	}
+	return buildContentParts(text, images)
+}
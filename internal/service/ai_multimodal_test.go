@@ -0,0 +1,145 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPNG 以 PNG 文件头开头的图片数据
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+func testPNGDataURL() string {
+	return dataURL("image/png", base64.StdEncoding.EncodeToString(testPNG))
+}
+
+// newImageTestRequest 创建包含一张内嵌图片和一张远程图片的请求
+func newImageTestRequest(modelName string) *ChatRequest {
+	return NewChatRequest(modelName, []Message{
+		{Role: "system", Content: "你是一个助手"},
+		{Role: "user", Content: "这是什么", Parts: buildContentParts("这是什么", []ImageURL{
+			{URL: testPNGDataURL()},
+			{URL: "https://example.com/cat.jpg", Detail: "high"},
+		})},
+	})
+}
+
+// enableMultimodal 开启图片输入，vision 为模型是否支持图片
+func enableMultimodal(vision bool) func(s *aiService) {
+	return func(s *aiService) {
+		s.config.Providers["primary"].Models[0].Vision = vision
+		s.config.Features.History.Enabled = true
+		s.config.Features.Multimodal = config.MultimodalConfig{MaxImages: 2, MaxImageSize: 1024}
+	}
+}
+
+func TestValidateImages(t *testing.T) {
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": {}}, enableMultimodal(true))
+	vision := config.ModelConfig{Name: "vision-model", Vision: true}
+
+	withImages := func(urls ...string) []Message {
+		images := make([]ImageURL, len(urls))
+		for i, url := range urls {
+			images[i] = ImageURL{URL: url}
+		}
+		return []Message{{Role: model.MessageRoleUser, Content: "这是什么", Parts: buildContentParts("这是什么", images)}}
+	}
+
+	assert.NoError(t, s.validateImages(withImages(testPNGDataURL(), "https://example.com/cat.png?size=large"), vision))
+
+	tests := []struct {
+		name     string
+		messages []Message
+		modelCfg config.ModelConfig
+		message  string
+	}{
+		{"模型不支持图片", withImages(testPNGDataURL()), config.ModelConfig{Name: "text-model"}, "不支持图片输入"},
+		{"图片数量超限", withImages(testPNGDataURL(), testPNGDataURL(), testPNGDataURL()), vision, "最多携带 2 张"},
+		{"类型不允许", withImages("data:image/bmp;base64,Qk0="), vision, "图片类型不支持"},
+		{"远程图片类型不允许", withImages("https://example.com/cat.svg"), vision, "图片类型不支持"},
+		{"地址不合法", withImages("ftp://example.com/cat.png"), vision, "http(s)"},
+		{"不是 base64", withImages("data:image/png;base64,!!!"), vision, "base64"},
+		{
+			"超出大小",
+			withImages(dataURL("image/png", base64.StdEncoding.EncodeToString(make([]byte, 2048)))),
+			vision,
+			"大小超出限制",
+		},
+		{
+			"内容与类型不符",
+			withImages(dataURL("image/jpeg", base64.StdEncoding.EncodeToString(testPNG))),
+			vision,
+			"不符",
+		},
+		{
+			"助手消息携带图片",
+			[]Message{{Role: model.MessageRoleAssistant, Parts: withImages(testPNGDataURL())[0].Parts}},
+			vision,
+			"只有用户消息",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validateImages(tt.messages, tt.modelCfg)
+			require.Error(t, err)
+			apiErr, ok := err.(*APIError)
+			require.True(t, ok)
+			assert.Equal(t, ErrorCodeInvalidRequest, apiErr.Code)
+			assert.Contains(t, apiErr.Message, tt.message)
+		})
+	}
+}
+
+func TestSendMessagePersistsImageAttachments(t *testing.T) {
+	provider := &fakeProvider{}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableMultimodal(true))
+
+	options := &ChatOptions{Images: []ImageURL{
+		{URL: testPNGDataURL(), Detail: "low"},
+		{URL: "https://example.com/cat.jpg"},
+	}}
+	_, err := s.SendMessage(context.Background(), 1, "", "这两张图有什么区别", options)
+	require.NoError(t, err)
+
+	// 发送给提供商的用户消息包含文本和两张图片
+	require.Len(t, provider.requests, 1)
+	sent := provider.requests[0].Messages
+	latest := sent[len(sent)-1]
+	assert.Equal(t, "这两张图有什么区别", latest.Content)
+	require.Len(t, latest.Parts, 3)
+	assert.Equal(t, ContentPartText, latest.Parts[0].Type)
+	assert.Equal(t, testPNGDataURL(), latest.Parts[1].ImageURL.URL)
+
+	// 图片作为附件随用户消息保存
+	userMessage := repo.messages[0]
+	assert.Equal(t, model.ContentTypeImage, userMessage.ContentType)
+	require.Len(t, userMessage.Attachments, 2)
+	assert.Equal(t, "image/png", userMessage.Attachments[0].MimeType)
+	assert.Equal(t, len(testPNG), userMessage.Attachments[0].Size)
+	assert.Equal(t, "low", userMessage.Attachments[0].Detail)
+	assert.Equal(t, "https://example.com/cat.jpg", userMessage.Attachments[1].URL)
+	assert.Equal(t, "image/jpeg", userMessage.Attachments[1].MimeType)
+
+	// 历史中的附件还原为图片内容
+	turns := groupHistoryTurns(tokenizerFor(config.ModelConfig{}), repo.messages)
+	require.Len(t, turns, 1)
+	assert.Equal(t, latest.Parts, turns[0].messages[0].Parts)
+	assert.Greater(t, turns[0].tokens, 2*imageTokenEstimate)
+}
+
+func TestSendMessageRejectsImagesForTextModel(t *testing.T) {
+	provider := &fakeProvider{}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableMultimodal(false))
+
+	options := &ChatOptions{Images: []ImageURL{{URL: testPNGDataURL()}}}
+	_, err := s.SendMessage(context.Background(), 1, "", "这是什么", options)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "不支持图片输入")
+	assert.Empty(t, provider.requests)
+	assert.Empty(t, repo.messages)
+}
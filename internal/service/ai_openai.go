@@ -7,15 +7,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
-	"time"
 )
 
 // OpenAIProvider OpenAI 提供商实现
 type OpenAIProvider struct {
+	name       string
 	config     config.ProviderConfig
 	httpClient *http.Client
 	baseURL    string
@@ -24,34 +25,29 @@ type OpenAIProvider struct {
 
 // NewOpenAIProvider 创建 OpenAI 提供商
 func NewOpenAIProvider(cfg config.ProviderConfig) *OpenAIProvider {
+	return newOpenAICompatibleProvider("openai", cfg, cfg.BaseURL)
+}
+
+// newOpenAICompatibleProvider 创建兼容 OpenAI 协议的提供商（如阿里云百炼兼容模式）
+func newOpenAICompatibleProvider(name string, cfg config.ProviderConfig, baseURL string) *OpenAIProvider {
 	return &OpenAIProvider{
-		config:  cfg,
-		baseURL: cfg.BaseURL,
-		apiKey:  cfg.APIKey,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		name:       name,
+		config:     cfg,
+		baseURL:    baseURL,
+		apiKey:     cfg.APIKey,
+		httpClient: newProviderHTTPClient(cfg),
 	}
 }
 
 // GetName 获取提供商名称
 func (p *OpenAIProvider) GetName() string {
-	return "openai"
+	return p.name
 }
 
 // Chat 发送聊天请求
 func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
 	// 构建 OpenAI API 请求
-	openaiReq := &OpenAIChatRequest{
-		Model:       req.Model,
-		Messages:    convertToOpenAIMessages(req.Messages),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stop:        req.Stop,
-		User:        req.User,
-		Stream:      false,
-	}
+	openaiReq := buildOpenAIRequest(req, false)
 
 	// 序列化请求
 	reqBody, err := json.Marshal(openaiReq)
@@ -71,7 +67,10 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRespo
 	// 发送请求
 	resp, err := p.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %w", err)
+		return nil, &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("发送请求失败: %v", err),
+		}
 	}
 	defer resp.Body.Close()
 
@@ -93,16 +92,7 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatRespo
 // ChatStream 发送流式聊天请求
 func (p *OpenAIProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatStreamResponse, error) {
 	// 构建流式请求
-	openaiReq := &OpenAIChatRequest{
-		Model:       req.Model,
-		Messages:    convertToOpenAIMessages(req.Messages),
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
-		TopP:        req.TopP,
-		Stop:        req.Stop,
-		User:        req.User,
-		Stream:      true,
-	}
+	openaiReq := buildOpenAIRequest(req, true)
 
 	// 序列化请求
 	reqBody, err := json.Marshal(openaiReq)
@@ -151,13 +141,17 @@ func (p *OpenAIProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-ch
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
-		ch := make(chan *ChatStreamResponse, 1)
-		ch <- &ChatStreamResponse{
-			Error: &APIError{
+		defer resp.Body.Close()
+		var apiErr *APIError
+		if !errors.As(p.handleErrorResponse(resp), &apiErr) {
+			apiErr = &APIError{
 				Code:    ErrorCodeProviderError,
 				Message: fmt.Sprintf("HTTP错误: %d", resp.StatusCode),
-			},
+			}
 		}
+
+		ch := make(chan *ChatStreamResponse, 1)
+		ch <- &ChatStreamResponse{Error: apiErr}
 		close(ch)
 		return ch, nil
 	}
@@ -228,11 +222,20 @@ func (p *OpenAIProvider) handleErrorResponse(resp *http.Response) error {
 
 	var errorResp OpenAIErrorResponse
 	if err := json.Unmarshal(body, &errorResp); err != nil {
-		return fmt.Errorf("HTTP错误 %d: %s", resp.StatusCode, string(body))
+		return &APIError{
+			Code:    mapHTTPStatusErrorCode(resp.StatusCode),
+			Message: fmt.Sprintf("HTTP错误 %d: %s", resp.StatusCode, string(body)),
+		}
+	}
+
+	// 兼容接口的错误类型不统一，无法识别时按状态码归类
+	code := mapOpenAIErrorCode(errorResp.Error.Type)
+	if code == ErrorCodeProviderError {
+		code = mapHTTPStatusErrorCode(resp.StatusCode)
 	}
 
 	return &APIError{
-		Code:    mapOpenAIErrorCode(errorResp.Error.Type),
+		Code:    code,
 		Message: errorResp.Error.Message,
 		Type:    errorResp.Error.Type,
 	}
@@ -315,8 +318,9 @@ func (p *OpenAIProvider) convertToStandardResponse(resp *OpenAIChatResponse) *Ch
 		choices[i] = Choice{
 			Index: choice.Index,
 			Message: Message{
-				Role:    choice.Message.Role,
-				Content: choice.Message.Content,
+				Role:      choice.Message.Role,
+				Content:   choice.Message.Content,
+				ToolCalls: choice.Message.ToolCalls,
 			},
 			FinishReason: choice.FinishReason,
 		}
@@ -342,14 +346,8 @@ func (p *OpenAIProvider) convertToStreamResponse(chunk *OpenAIStreamChunk) *Chat
 	choices := make([]StreamChoice, len(chunk.Choices))
 	for i, choice := range chunk.Choices {
 		choices[i] = StreamChoice{
-			Index: choice.Index,
-			Delta: struct {
-				Role    string `json:"role,omitempty"`
-				Content string `json:"content,omitempty"`
-			}{
-				Role:    choice.Delta.Role,
-				Content: choice.Delta.Content,
-			},
+			Index:        choice.Index,
+			Delta:        choice.Delta,
 			FinishReason: choice.FinishReason,
 		}
 	}
@@ -368,23 +366,100 @@ func (p *OpenAIProvider) convertToStreamResponse(chunk *OpenAIStreamChunk) *Chat
 
 // OpenAIChatRequest OpenAI 聊天请求
 type OpenAIChatRequest struct {
-	Model            string          `json:"model"`
-	Messages         []OpenAIMessage `json:"messages"`
-	Temperature      *float32        `json:"temperature,omitempty"`
-	MaxTokens        *int            `json:"max_tokens,omitempty"`
-	TopP             *float32        `json:"top_p,omitempty"`
-	FrequencyPenalty *float32        `json:"frequency_penalty,omitempty"`
-	PresencePenalty  *float32        `json:"presence_penalty,omitempty"`
-	Stop             []string        `json:"stop,omitempty"`
-	User             string          `json:"user,omitempty"`
-	Stream           bool            `json:"stream"`
+	Model            string           `json:"model"`
+	Messages         []OpenAIMessage  `json:"messages"`
+	Temperature      *float32         `json:"temperature,omitempty"`
+	MaxTokens        *int             `json:"max_tokens,omitempty"`
+	TopP             *float32         `json:"top_p,omitempty"`
+	FrequencyPenalty *float32         `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float32         `json:"presence_penalty,omitempty"`
+	Stop             OpenAIStop       `json:"stop,omitempty"`
+	Tools            []ToolDefinition `json:"tools,omitempty"`
+	ToolChoice       *ToolChoice      `json:"tool_choice,omitempty"`
+	ResponseFormat   *ResponseFormat  `json:"response_format,omitempty"`
+	User             string           `json:"user,omitempty"`
+	Stream           bool             `json:"stream"`
+
+	// 以下字段仅在作为 OpenAI 兼容接口的请求时使用
+	MaxCompletionTokens *int                 `json:"max_completion_tokens,omitempty"`
+	StreamOptions       *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+// OpenAIStop 停止词，兼容字符串和字符串数组两种写法
+type OpenAIStop []string
+
+// UnmarshalJSON 解析字符串或字符串数组
+func (s *OpenAIStop) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "" {
+			*s = OpenAIStop{single}
+		}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// OpenAIStreamOptions 流式选项
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // OpenAIMessage OpenAI 消息
 type OpenAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-	Name    string `json:"name,omitempty"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Name       string     `json:"name,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+
+	// Parts 多模态内容，不为空时 content 序列化为内容片段数组
+	Parts []ContentPart `json:"-"`
+}
+
+// MarshalJSON 有内容片段时 content 使用数组形式
+func (m OpenAIMessage) MarshalJSON() ([]byte, error) {
+	type alias OpenAIMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(alias(m))
+	}
+	return json.Marshal(struct {
+		alias
+		Content []ContentPart `json:"content"`
+	}{alias: alias(m), Content: m.Parts})
+}
+
+// UnmarshalJSON 解析字符串或内容片段数组形式的 content
+func (m *OpenAIMessage) UnmarshalJSON(data []byte) error {
+	type alias OpenAIMessage
+	var raw struct {
+		alias
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = OpenAIMessage(raw.alias)
+
+	content := bytes.TrimSpace(raw.Content)
+	switch {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+		return nil
+	case content[0] == '[':
+		if err := json.Unmarshal(content, &m.Parts); err != nil {
+			return err
+		}
+		m.Content = partsText(m.Parts)
+		return nil
+	default:
+		return json.Unmarshal(content, &m.Content)
+	}
 }
 
 // OpenAIChatResponse OpenAI 聊天响应
@@ -423,12 +498,9 @@ type OpenAIStreamChunk struct {
 
 // OpenAIStreamChoice OpenAI 流式选择
 type OpenAIStreamChoice struct {
-	Index int `json:"index"`
-	Delta struct {
-		Role    string `json:"role,omitempty"`
-		Content string `json:"content,omitempty"`
-	} `json:"delta"`
-	FinishReason *string `json:"finish_reason"`
+	Index        int         `json:"index"`
+	Delta        StreamDelta `json:"delta"`
+	FinishReason *string     `json:"finish_reason"`
 }
 
 // OpenAIErrorResponse OpenAI 错误响应
@@ -445,14 +517,37 @@ type OpenAIError struct {
 
 // 辅助函数
 
+// buildOpenAIRequest 构建 OpenAI 请求（流式和非流式共用）
+func buildOpenAIRequest(req *ChatRequest, stream bool) *OpenAIChatRequest {
+	openaiReq := &OpenAIChatRequest{
+		Model:          req.Model,
+		Messages:       convertToOpenAIMessages(req.Messages),
+		Temperature:    req.Temperature,
+		MaxTokens:      req.MaxTokens,
+		TopP:           req.TopP,
+		Stop:           req.Stop,
+		User:           req.User,
+		Stream:         stream,
+		ResponseFormat: req.ResponseFormat,
+	}
+	if len(req.Tools) > 0 {
+		openaiReq.Tools = req.Tools
+		openaiReq.ToolChoice = req.ToolChoice
+	}
+	return openaiReq
+}
+
 // convertToOpenAIMessages 转换为 OpenAI 消息格式
 func convertToOpenAIMessages(messages []Message) []OpenAIMessage {
 	openaiMessages := make([]OpenAIMessage, len(messages))
 	for i, msg := range messages {
 		openaiMessages[i] = OpenAIMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-			Name:    msg.Name,
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+			Parts:      msg.Parts,
 		}
 	}
 	return openaiMessages
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newToolTestRequest 创建带工具定义和一轮工具调用历史的请求
+func newToolTestRequest(modelName string) *ChatRequest {
+	req := NewChatRequest(modelName, []Message{
+		{Role: "user", Content: "北京天气怎么样"},
+		{Role: "assistant", ToolCalls: []ToolCall{{
+			ID:       "call_1",
+			Type:     ToolTypeFunction,
+			Function: ToolCallFunction{Name: "get_weather", Arguments: `{"city":"北京"}`},
+		}}},
+		{Role: "tool", ToolCallID: "call_1", Content: `{"temperature":20}`},
+	})
+	req.Tools = []ToolDefinition{{
+		Type: ToolTypeFunction,
+		Function: ToolFunction{
+			Name:        "get_weather",
+			Description: "查询城市天气",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+		},
+	}}
+	req.ToolChoice = &ToolChoice{Type: ToolChoiceAuto}
+	return req
+}
+
+func TestToolChoiceJSON(t *testing.T) {
+	data, err := json.Marshal(ToolChoice{Type: ToolChoiceRequired})
+	require.NoError(t, err)
+	assert.JSONEq(t, `"required"`, string(data))
+
+	data, err = json.Marshal(ToolChoice{Type: ToolChoiceFunction, Function: "get_weather"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"function","function":{"name":"get_weather"}}`, string(data))
+
+	var choice ToolChoice
+	require.NoError(t, json.Unmarshal(data, &choice))
+	assert.Equal(t, ToolChoice{Type: ToolChoiceFunction, Function: "get_weather"}, choice)
+
+	require.NoError(t, json.Unmarshal([]byte(`"none"`), &choice))
+	assert.Equal(t, ToolChoice{Type: ToolChoiceNone}, choice)
+}
+
+func TestOpenAIProviderToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		assert.Equal(t, "auto", req["tool_choice"])
+		tools := req["tools"].([]interface{})
+		require.Len(t, tools, 1)
+		messages := req["messages"].([]interface{})
+		require.Len(t, messages, 3)
+		assert.Contains(t, messages[1], "tool_calls")
+		assert.Equal(t, "call_1", messages[2].(map[string]interface{})["tool_call_id"])
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o",
+			"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":null,
+			"tool_calls":[{"id":"call_2","type":"function",
+			"function":{"name":"get_weather","arguments":"{\"city\":\"上海\"}"}}]}}],
+			"usage":{"prompt_tokens":30,"completion_tokens":10,"total_tokens":40}}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(config.ProviderConfig{BaseURL: server.URL, APIKey: "key"})
+	resp, err := provider.Chat(context.Background(), newToolTestRequest("gpt-4o"))
+	require.NoError(t, err)
+
+	assert.Equal(t, FinishReasonToolCalls, resp.Choices[0].FinishReason)
+	require.Len(t, resp.Choices[0].Message.ToolCalls, 1)
+	call := resp.Choices[0].Message.ToolCalls[0]
+	assert.Equal(t, "call_2", call.ID)
+	assert.Equal(t, "get_weather", call.Function.Name)
+	assert.JSONEq(t, `{"city":"上海"}`, call.Function.Arguments)
+}
+
+func TestOpenAIProviderStreamToolCallDeltas(t *testing.T) {
+	events := []string{
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,` +
+			`"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,` +
+			`"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,` +
+			`"function":{"arguments":"\"北京\"}"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, strings.Join(events, "\n\n")+"\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(config.ProviderConfig{BaseURL: server.URL, APIKey: "key"})
+	req := newToolTestRequest("gpt-4o")
+	req.Stream = true
+	stream, err := provider.ChatStream(context.Background(), req)
+	require.NoError(t, err)
+
+	var calls []ToolCall
+	var finishReason string
+	for chunk := range stream {
+		require.Nil(t, chunk.Error)
+		for _, choice := range chunk.Choices {
+			calls = appendToolCallDeltas(calls, choice.Delta.ToolCalls)
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+
+	assert.Equal(t, FinishReasonToolCalls, finishReason)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "call_1", calls[0].ID)
+	assert.Equal(t, "get_weather", calls[0].Function.Name)
+	assert.JSONEq(t, `{"city":"北京"}`, calls[0].Function.Arguments)
+}
+
+func TestOpenAIMessageContentParts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		messages := req["messages"].([]interface{})
+		require.Len(t, messages, 2)
+		assert.Equal(t, "你是一个助手", messages[0].(map[string]interface{})["content"])
+		parts := messages[1].(map[string]interface{})["content"].([]interface{})
+		require.Len(t, parts, 3)
+		assert.Equal(t, map[string]interface{}{"type": "text", "text": "这是什么"}, parts[0])
+		image := parts[2].(map[string]interface{})["image_url"].(map[string]interface{})
+		assert.Equal(t, "https://example.com/cat.jpg", image["url"])
+		assert.Equal(t, "high", image["detail"])
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-2","model":"gpt-4o","choices":[{"index":0,"finish_reason":"stop",`+
+			`"message":{"role":"assistant","content":"一只猫"}}]}`)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider(config.ProviderConfig{BaseURL: server.URL, APIKey: "key"})
+	resp, err := provider.Chat(context.Background(), newImageTestRequest("gpt-4o"))
+	require.NoError(t, err)
+	assert.Equal(t, "一只猫", resp.GetLastAssistantMessage())
+
+	// 请求中的数组形式 content 解析为内容片段，文本同时放入 Content
+	var msg OpenAIMessage
+	require.NoError(t, json.Unmarshal([]byte(`{"role":"user","content":[{"type":"text","text":"看图"},`+
+		`{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}`), &msg))
+	assert.Equal(t, "看图", msg.Content)
+	require.Len(t, msg.Parts, 2)
+	assert.Equal(t, "https://example.com/a.png", msg.Parts[1].ImageURL.URL)
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/internal/repository"
+	"ai-svc/pkg/logger"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 配额周期常量
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+)
+
+const (
+	// quotaRefreshInterval 从数据库重新加载用户等级和已用额度的间隔
+	quotaRefreshInterval = time.Minute
+
+	// quotaMonthLayout 月度周期的格式
+	quotaMonthLayout = "2006-01"
+)
+
+// QuotaExceededDetails 配额超限详情，作为 quota_exceeded 错误的 details 返回
+type QuotaExceededDetails struct {
+	VIPLevel        int       `json:"vip_level"`
+	Period          string    `json:"period"`                     // daily 或 monthly
+	TokenLimit      int       `json:"token_limit,omitempty"`      // token 上限，0 表示不限制
+	CostLimit       float64   `json:"cost_limit,omitempty"`       // 费用上限，0 表示不限制
+	RemainingTokens *int      `json:"remaining_tokens,omitempty"` // 剩余 token，不限制时为空
+	RemainingCost   *float64  `json:"remaining_cost,omitempty"`   // 剩余费用，不限制时为空
+	ResetAt         time.Time `json:"reset_at"`                   // 配额重置时间
+}
+
+// quotaUsage 用户在当前周期内的用量
+type quotaUsage struct {
+	vipLevel int
+	day      string
+	month    string
+
+	dailyTokens   int
+	dailyCost     float64
+	monthlyTokens int
+	monthlyCost   float64
+
+	// 已预占但尚未结算的额度，同时计入每日和每月用量
+	reservedTokens int
+	reservedCost   float64
+
+	refreshedAt time.Time
+}
+
+// QuotaManager 用量配额管理
+// 发送前按预估 token 检查并预占额度，回复保存后按实际用量结算.
+// 已用额度以 ai_usage_stats 为准，定期重新加载并与进程内累计的用量取较大值，
+// 因此统计尚未写入数据库时也不会少算.
+type QuotaManager struct {
+	config config.QuotaConfig
+	users  repository.UserRepository
+	repo   repository.AIRepository
+	now    func() time.Time
+
+	mu    sync.Mutex
+	usage map[uint]*quotaUsage
+	day   string // 上次清理的日期
+}
+
+// NewQuotaManager 创建配额管理，未启用配额时返回 nil
+func NewQuotaManager(
+	cfg config.QuotaConfig,
+	users repository.UserRepository,
+	repo repository.AIRepository,
+) *QuotaManager {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return &QuotaManager{
+		config: cfg,
+		users:  users,
+		repo:   repo,
+		now:    time.Now,
+		usage:  make(map[uint]*quotaUsage),
+	}
+}
+
+// quotaReservation 一次请求预占的额度，请求结束后必须调用 Release
+type quotaReservation struct {
+	manager *QuotaManager
+	userID  uint
+	day     string
+	tokens  int
+	cost    float64
+	once    sync.Once
+}
+
+// Release 释放预占的额度，可重复调用
+func (r *quotaReservation) Release() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.manager.release(r)
+	})
+}
+
+// Reserve 按预估用量检查配额并预占额度
+// 提示词本身已超出剩余额度时返回 quota_exceeded 错误；否则下调 max_tokens，使回复不会超出剩余额度.
+func (m *QuotaManager) Reserve(userID uint, modelCfg config.ModelConfig, req *ChatRequest) (*quotaReservation, error) {
+	usage := m.load(userID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limits, found := m.config.GetQuotaLevel(usage.vipLevel)
+	if !found {
+		return nil, nil
+	}
+
+	now := m.now()
+	promptTokens := estimateRequestTokens(tokenizerFor(modelCfg), req)
+	promptCost := modelCfg.CalculatePrice(promptTokens, 0)
+
+	periods := []struct {
+		name       string
+		tokenLimit int
+		costLimit  float64
+		usedTokens int
+		usedCost   float64
+		resetAt    time.Time
+	}{
+		{
+			QuotaPeriodDaily, limits.DailyTokens, limits.DailyCost,
+			usage.dailyTokens, usage.dailyCost, nextDay(now),
+		},
+		{
+			QuotaPeriodMonthly, limits.MonthlyTokens, limits.MonthlyCost,
+			usage.monthlyTokens, usage.monthlyCost, nextMonth(now),
+		},
+	}
+
+	maxOutput := -1 // 负数表示不限制
+	for _, period := range periods {
+		remainingTokens := period.tokenLimit - period.usedTokens - usage.reservedTokens
+		remainingCost := period.costLimit - period.usedCost - usage.reservedCost
+
+		exceeded := false
+		if period.tokenLimit > 0 {
+			exceeded = remainingTokens <= promptTokens
+			maxOutput = minOutputTokens(maxOutput, remainingTokens-promptTokens)
+		}
+		if period.costLimit > 0 {
+			exceeded = exceeded || remainingCost <= promptCost
+			if modelCfg.Pricing.Output > 0 {
+				affordable := int((remainingCost - promptCost) / modelCfg.Pricing.Output * 1000)
+				exceeded = exceeded || affordable <= 0
+				maxOutput = minOutputTokens(maxOutput, affordable)
+			}
+		}
+		if !exceeded {
+			continue
+		}
+
+		details := &QuotaExceededDetails{
+			VIPLevel:   usage.vipLevel,
+			Period:     period.name,
+			TokenLimit: period.tokenLimit,
+			CostLimit:  period.costLimit,
+			ResetAt:    period.resetAt,
+		}
+		if period.tokenLimit > 0 {
+			remaining := max(remainingTokens, 0)
+			details.RemainingTokens = &remaining
+		}
+		if period.costLimit > 0 {
+			remaining := max(remainingCost, 0)
+			details.RemainingCost = &remaining
+		}
+		return nil, &APIError{
+			Code: ErrorCodeQuotaExceeded,
+			Message: fmt.Sprintf("%s配额已用完，将于 %s 重置",
+				quotaPeriodName(period.name), period.resetAt.Format(time.DateTime)),
+			Details: details,
+		}
+	}
+
+	if maxOutput >= 0 && (req.MaxTokens == nil || *req.MaxTokens > maxOutput) {
+		req.MaxTokens = &maxOutput
+	}
+	outputTokens := 0
+	if req.MaxTokens != nil {
+		outputTokens = *req.MaxTokens
+	}
+
+	reservation := &quotaReservation{
+		manager: m,
+		userID:  userID,
+		day:     usage.day,
+		tokens:  promptTokens + outputTokens,
+		cost:    modelCfg.CalculatePrice(promptTokens, outputTokens),
+	}
+	usage.reservedTokens += reservation.tokens
+	usage.reservedCost += reservation.cost
+	return reservation, nil
+}
+
+// Record 按实际用量结算，message 为本次请求保存的助手回复
+func (m *QuotaManager) Record(userID uint, message *model.AIMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, exists := m.usage[userID]
+	if !exists {
+		return
+	}
+	m.rollover(usage, m.now())
+	usage.dailyTokens += message.TotalTokens
+	usage.dailyCost += message.Cost
+	usage.monthlyTokens += message.TotalTokens
+	usage.monthlyCost += message.Cost
+}
+
+// release 释放预占的额度
+func (m *QuotaManager) release(reservation *quotaReservation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, exists := m.usage[reservation.userID]
+	if !exists || usage.day != reservation.day {
+		// 跨周期后预占额度已随周期重置
+		return
+	}
+	usage.reservedTokens = max(usage.reservedTokens-reservation.tokens, 0)
+	usage.reservedCost = max(usage.reservedCost-reservation.cost, 0)
+}
+
+// load 获取用户当前周期的用量，超过刷新间隔时从数据库重新加载
+// 数据库查询在锁外进行，查询失败时继续使用进程内的用量.
+func (m *QuotaManager) load(userID uint) *quotaUsage {
+	now := m.now()
+
+	m.mu.Lock()
+	m.evict(now)
+	usage, exists := m.usage[userID]
+	if exists && usage.day == now.Format(usageDateLayout) && now.Sub(usage.refreshedAt) < quotaRefreshInterval {
+		m.mu.Unlock()
+		return usage
+	}
+	m.mu.Unlock()
+
+	vipLevel := m.vipLevel(userID)
+	day, month := now.Format(usageDateLayout), now.Format(quotaMonthLayout)
+	stats, err := m.repo.GetUsageStats(userID, month+"-01", day)
+	if err != nil {
+		logger.Warn("加载AI用量失败，按进程内用量检查配额", map[string]any{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage, exists = m.usage[userID]
+	if !exists {
+		usage = &quotaUsage{day: day, month: month}
+		m.usage[userID] = usage
+	}
+	m.rollover(usage, now)
+	usage.vipLevel = vipLevel
+	if err != nil {
+		return usage
+	}
+
+	var dailyTokens, monthlyTokens int
+	var dailyCost, monthlyCost float64
+	for _, stat := range stats {
+		monthlyTokens += stat.TotalTokens
+		monthlyCost += stat.TotalCost
+		if strings.HasPrefix(stat.Date, day) {
+			dailyTokens += stat.TotalTokens
+			dailyCost += stat.TotalCost
+		}
+	}
+	usage.dailyTokens = max(usage.dailyTokens, dailyTokens)
+	usage.dailyCost = max(usage.dailyCost, dailyCost)
+	usage.monthlyTokens = max(usage.monthlyTokens, monthlyTokens)
+	usage.monthlyCost = max(usage.monthlyCost, monthlyCost)
+	usage.refreshedAt = now
+	return usage
+}
+
+// evict 进入新的一天时移除当天还没有使用过的用户，调用方需持有锁
+// 被移除的用户再次请求时从数据库重新加载已用额度，进程内只保留当天活跃的用户.
+func (m *QuotaManager) evict(now time.Time) {
+	day := now.Format(usageDateLayout)
+	if m.day == day {
+		return
+	}
+	m.day = day
+	for userID, usage := range m.usage {
+		if usage.day != day {
+			delete(m.usage, userID)
+		}
+	}
+}
+
+// rollover 进入新的周期时清零对应的用量，调用方需持有锁
+func (m *QuotaManager) rollover(usage *quotaUsage, now time.Time) {
+	if day := now.Format(usageDateLayout); usage.day != day {
+		usage.day = day
+		usage.dailyTokens, usage.dailyCost = 0, 0
+		usage.reservedTokens, usage.reservedCost = 0, 0
+	}
+	if month := now.Format(quotaMonthLayout); usage.month != month {
+		usage.month = month
+		usage.monthlyTokens, usage.monthlyCost = 0, 0
+	}
+}
+
+// vipLevel 获取用户当前有效的 VIP 等级，VIP 过期或查询失败时按普通用户处理
+func (m *QuotaManager) vipLevel(userID uint) int {
+	user, err := m.users.GetByID(userID)
+	if err != nil {
+		logger.Warn("查询用户VIP等级失败，按普通用户检查配额", map[string]any{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		return 0
+	}
+	if !user.IsVIP() {
+		return 0
+	}
+	return user.VIPLevel
+}
+
+// reserveQuota 检查并预占用户配额，未启用配额时返回 nil
+func (s *aiService) reserveQuota(userID uint, target *chatTarget, req *ChatRequest) (*quotaReservation, error) {
+	if s.quota == nil {
+		return nil, nil
+	}
+	return s.quota.Reserve(userID, target.model, req)
+}
+
+// 辅助函数
+
+// minOutputTokens 取较小的输出上限，负数表示不限制
+func minOutputTokens(current, limit int) int {
+	limit = max(limit, 0)
+	if current < 0 {
+		return limit
+	}
+	return min(current, limit)
+}
+
+// quotaPeriodName 配额周期的显示名称
+func quotaPeriodName(period string) string {
+	if period == QuotaPeriodMonthly {
+		return "本月"
+	}
+	return "今日"
+}
+
+// nextDay 下一天零点
+func nextDay(now time.Time) time.Time {
+	year, month, day := now.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+}
+
+// nextMonth 下个月一日零点
+func nextMonth(now time.Time) time.Time {
+	year, month, _ := now.Date()
+	return time.Date(year, month+1, 1, 0, 0, 0, 0, now.Location())
+}
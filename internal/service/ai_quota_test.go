@@ -0,0 +1,193 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/internal/repository"
+	"ai-svc/pkg/logger"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeUserRepository 只实现 GetByID 的用户仓储
+type fakeUserRepository struct {
+	repository.UserRepository
+	users map[uint]*model.User
+}
+
+func (r *fakeUserRepository) GetByID(id uint) (*model.User, error) {
+	if user, exists := r.users[id]; exists {
+		return user, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+var testQuotaConfig = config.QuotaConfig{
+	Enabled: true,
+	Levels: []config.QuotaLevelConfig{
+		{Level: 0, DailyTokens: 1000, MonthlyTokens: 5000},
+		{Level: 2, DailyTokens: 10000, DailyCost: 1},
+	},
+}
+
+func newTestQuotaManager(t *testing.T, repo *fakeAIRepository, users map[uint]*model.User, now time.Time) *QuotaManager {
+	require.NoError(t, logger.Init("error", "text", "stdout"))
+	manager := NewQuotaManager(testQuotaConfig, &fakeUserRepository{users: users}, repo)
+	manager.now = func() time.Time { return now }
+	return manager
+}
+
+func quotaTestRequest(maxTokens int) *ChatRequest {
+	req := NewChatRequest("gpt-4", []Message{{Role: model.MessageRoleUser, Content: "hello world"}})
+	req.MaxTokens = &maxTokens
+	return req
+}
+
+func TestQuotaConfigGetQuotaLevel(t *testing.T) {
+	level, found := testQuotaConfig.GetQuotaLevel(1)
+	require.True(t, found)
+	assert.Equal(t, 0, level.Level)
+
+	level, found = testQuotaConfig.GetQuotaLevel(3)
+	require.True(t, found)
+	assert.Equal(t, 2, level.Level)
+
+	_, found = (&config.QuotaConfig{Levels: []config.QuotaLevelConfig{{Level: 1}}}).GetQuotaLevel(0)
+	assert.False(t, found)
+}
+
+func TestQuotaManagerRejectsExhaustedDailyTokens(t *testing.T) {
+	now := time.Date(2025, 6, 15, 10, 0, 0, 0, time.Local)
+	repo := &fakeAIRepository{usageStats: []*model.AIUsageStats{
+		{UserID: 1, Provider: "openai", Model: "gpt-4", Date: "2025-06-15", TotalTokens: 995},
+		{UserID: 1, Provider: "openai", Model: "gpt-4", Date: "2025-06-01", TotalTokens: 2000},
+	}}
+	manager := newTestQuotaManager(t, repo, nil, now)
+
+	_, err := manager.Reserve(1, config.ModelConfig{Name: "gpt-4"}, quotaTestRequest(100))
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorCodeQuotaExceeded, apiErr.Code)
+
+	details, ok := apiErr.Details.(*QuotaExceededDetails)
+	require.True(t, ok)
+	assert.Equal(t, QuotaPeriodDaily, details.Period)
+	assert.Equal(t, 1000, details.TokenLimit)
+	require.NotNil(t, details.RemainingTokens)
+	assert.Equal(t, 5, *details.RemainingTokens)
+	assert.Nil(t, details.RemainingCost)
+	assert.Equal(t, time.Date(2025, 6, 16, 0, 0, 0, 0, time.Local), details.ResetAt)
+}
+
+func TestQuotaManagerClampsMaxTokensAndReleases(t *testing.T) {
+	now := time.Date(2025, 6, 15, 10, 0, 0, 0, time.Local)
+	manager := newTestQuotaManager(t, &fakeAIRepository{}, nil, now)
+	modelCfg := config.ModelConfig{Name: "gpt-4"}
+
+	req := quotaTestRequest(4096)
+	reservation, err := manager.Reserve(1, modelCfg, req)
+	require.NoError(t, err)
+	require.NotNil(t, reservation)
+	promptTokens := estimateMessagesTokens(tokenizerFor(modelCfg), req.Messages)
+	assert.Equal(t, 1000-promptTokens, *req.MaxTokens)
+
+	// 预占的额度在释放前计入用量
+	_, err = manager.Reserve(1, modelCfg, quotaTestRequest(10))
+	require.Error(t, err)
+
+	reservation.Release()
+	reservation.Release()
+	manager.Record(1, &model.AIMessage{TotalTokens: 900})
+
+	req = quotaTestRequest(4096)
+	_, err = manager.Reserve(1, modelCfg, req)
+	require.NoError(t, err)
+	assert.Equal(t, 100-promptTokens, *req.MaxTokens)
+
+	// 次日重置每日额度，每月额度继续累计
+	manager.now = func() time.Time { return now.Add(24 * time.Hour) }
+	manager.Record(1, &model.AIMessage{TotalTokens: 0})
+	req = quotaTestRequest(4096)
+	_, err = manager.Reserve(1, modelCfg, req)
+	require.NoError(t, err)
+	assert.Equal(t, 1000-promptTokens, *req.MaxTokens)
+}
+
+func TestQuotaManagerEvictsUsersOfPreviousDays(t *testing.T) {
+	now := time.Date(2025, 6, 15, 10, 0, 0, 0, time.Local)
+	repo := &fakeAIRepository{}
+	manager := newTestQuotaManager(t, repo, nil, now)
+	modelCfg := config.ModelConfig{Name: "gpt-4"}
+
+	for userID := uint(1); userID <= 3; userID++ {
+		reservation, err := manager.Reserve(userID, modelCfg, quotaTestRequest(10))
+		require.NoError(t, err)
+		reservation.Release()
+	}
+	manager.Record(1, &model.AIMessage{TotalTokens: 300})
+	assert.Len(t, manager.usage, 3)
+
+	// 次日第一次请求时移除前一天的用户，已用额度从数据库重新加载
+	manager.now = func() time.Time { return now.Add(24 * time.Hour) }
+	repo.usageStats = []*model.AIUsageStats{{UserID: 1, Date: "2025-06-15", TotalTokens: 4800}}
+	_, err := manager.Reserve(2, modelCfg, quotaTestRequest(10))
+	require.NoError(t, err)
+	assert.Len(t, manager.usage, 1)
+	assert.Contains(t, manager.usage, uint(2))
+
+	req := quotaTestRequest(4096)
+	_, err = manager.Reserve(1, modelCfg, req)
+	require.NoError(t, err)
+	promptTokens := estimateMessagesTokens(tokenizerFor(modelCfg), req.Messages)
+	assert.Equal(t, 5000-4800-promptTokens, *req.MaxTokens)
+}
+
+func TestQuotaManagerUsesActiveVIPLevel(t *testing.T) {
+	now := time.Date(2025, 6, 15, 10, 0, 0, 0, time.Local)
+	expired := now.Add(-time.Hour)
+	users := map[uint]*model.User{
+		1: {VIPLevel: 2},
+		2: {VIPLevel: 2, VIPExpireAt: &expired},
+	}
+	manager := newTestQuotaManager(t, &fakeAIRepository{}, users, now)
+	modelCfg := config.ModelConfig{Name: "gpt-4", Pricing: config.PricingConfig{Input: 0.01, Output: 0.1}}
+
+	req := quotaTestRequest(100000)
+	_, err := manager.Reserve(1, modelCfg, req)
+	require.NoError(t, err)
+	// 费用上限 1 按输出价格 0.1/1K 最多约 10000 token
+	assert.Less(t, *req.MaxTokens, 10000)
+	assert.Greater(t, *req.MaxTokens, 9900)
+
+	req = quotaTestRequest(100000)
+	_, err = manager.Reserve(2, modelCfg, req)
+	require.NoError(t, err)
+	assert.Less(t, *req.MaxTokens, 1000)
+}
+
+func TestSendMessageEnforcesQuota(t *testing.T) {
+	provider := &fakeProvider{}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider})
+	repo.usageStats = []*model.AIUsageStats{
+		{UserID: 1, Date: time.Now().Format(usageDateLayout), TotalTokens: 999},
+	}
+	s.quota = NewQuotaManager(testQuotaConfig, &fakeUserRepository{}, repo)
+
+	_, err := s.SendMessage(context.Background(), 1, "", "你好", nil)
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorCodeQuotaExceeded, apiErr.Code)
+	assert.Zero(t, provider.calls)
+	// 超出配额的请求不保存用户消息
+	assert.Empty(t, repo.messages)
+
+	_, err = s.SendMessage(context.Background(), 2, "", "你好", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.calls)
+}
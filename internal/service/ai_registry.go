@@ -0,0 +1,447 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultProviderTimeout 未配置超时时间时的默认值
+const defaultProviderTimeout = 60 * time.Second
+
+// providerFactory 基于构造函数的提供商工厂
+type providerFactory struct {
+	providerType string
+	create       func(cfg config.ProviderConfig) AIProvider
+}
+
+// NewProviderFactory 使用构造函数创建提供商工厂
+func NewProviderFactory(providerType string, create func(cfg config.ProviderConfig) AIProvider) ProviderFactory {
+	return &providerFactory{
+		providerType: providerType,
+		create:       create,
+	}
+}
+
+// CreateProvider 创建提供商实例，config 必须是 config.ProviderConfig
+func (f *providerFactory) CreateProvider(cfg interface{}) (AIProvider, error) {
+	switch c := cfg.(type) {
+	case config.ProviderConfig:
+		return f.create(c), nil
+	case *config.ProviderConfig:
+		if c == nil {
+			return nil, fmt.Errorf("%s 提供商配置不能为空", f.providerType)
+		}
+		return f.create(*c), nil
+	default:
+		return nil, fmt.Errorf("%s 提供商配置类型错误: %T", f.providerType, cfg)
+	}
+}
+
+// GetProviderType 获取提供商类型
+func (f *providerFactory) GetProviderType() string {
+	return f.providerType
+}
+
+// builtinProviderFactories 内置提供商工厂
+func builtinProviderFactories() []ProviderFactory {
+	return []ProviderFactory{
+		NewProviderFactory("openai", func(cfg config.ProviderConfig) AIProvider { return NewOpenAIProvider(cfg) }),
+		NewProviderFactory("claude", func(cfg config.ProviderConfig) AIProvider { return NewClaudeProvider(cfg) }),
+		NewProviderFactory("baidu", func(cfg config.ProviderConfig) AIProvider { return NewBaiduProvider(cfg) }),
+		NewProviderFactory("alibaba", func(cfg config.ProviderConfig) AIProvider { return NewAlibabaProvider(cfg) }),
+		NewProviderFactory("tencent", func(cfg config.ProviderConfig) AIProvider { return NewTencentProvider(cfg) }),
+	}
+}
+
+// ProviderHealth 提供商健康状态
+type ProviderHealth struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"` // available, error, disabled
+	LastError string    `json:"last_error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+
+	// Circuit 熔断器统计，提供商未创建时为空
+	Circuit *CircuitStats `json:"circuit,omitempty"`
+}
+
+// providerEntry 注册表中的提供商条目
+type providerEntry struct {
+	config   config.ProviderConfig
+	provider AIProvider // 禁用或创建失败时为 nil
+	breaker  *circuitBreaker
+	health   ProviderHealth
+}
+
+// ProviderRegistry AI 提供商注册表
+// 每种提供商类型注册一个工厂，提供商实例按配置创建，支持运行时增删.
+type ProviderRegistry struct {
+	mu            sync.RWMutex
+	factories     map[string]ProviderFactory
+	entries       map[string]*providerEntry
+	breakerConfig config.CircuitBreakerConfig
+}
+
+// NewProviderRegistry 创建提供商注册表，并注册所有内置工厂
+func NewProviderRegistry() *ProviderRegistry {
+	r := &ProviderRegistry{
+		factories: make(map[string]ProviderFactory),
+		entries:   make(map[string]*providerEntry),
+	}
+	for _, factory := range builtinProviderFactories() {
+		r.RegisterFactory(factory)
+	}
+	return r
+}
+
+// RegisterFactory 注册提供商工厂，同类型的工厂会被覆盖
+func (r *ProviderRegistry) RegisterFactory(factory ProviderFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[factory.GetProviderType()] = factory
+}
+
+// LoadFromConfig 根据配置创建所有提供商
+// 创建失败或配置无效的提供商会记录为 error 状态，没有任何可用提供商时返回错误.
+func (r *ProviderRegistry) LoadFromConfig(cfg *config.AIConfig) error {
+	r.setBreakerConfig(cfg.CircuitBreaker)
+
+	for name, providerCfg := range cfg.Providers {
+		if err := r.AddProvider(name, applyProviderDefaults(cfg, providerCfg)); err != nil {
+			logger.Warn("AI提供商不可用，已跳过", map[string]any{
+				"provider": name,
+				"error":    err.Error(),
+			})
+		}
+	}
+
+	if len(r.AvailableNames()) == 0 {
+		return errors.New("没有可用的AI提供商，请检查 ai.providers 配置")
+	}
+
+	if _, exists := r.Provider(cfg.DefaultProvider); !exists {
+		logger.Warn("默认AI提供商不可用", map[string]any{
+			"default_provider": cfg.DefaultProvider,
+		})
+	}
+
+	return nil
+}
+
+// AddProvider 添加或替换提供商
+// 禁用的提供商只登记配置；创建或校验失败时登记为 error 状态并返回错误.
+func (r *ProviderRegistry) AddProvider(name string, cfg config.ProviderConfig) error {
+	entry := &providerEntry{
+		config: cfg,
+		health: ProviderHealth{
+			Name:      name,
+			Type:      providerType(name, cfg),
+			CheckedAt: time.Now(),
+		},
+	}
+
+	var err error
+	if !cfg.Enabled {
+		entry.health.Status = ProviderStatusDisabled
+	} else {
+		entry.provider, err = r.createProvider(entry.health.Type, cfg)
+		if err != nil {
+			entry.health.Status = ProviderStatusError
+			entry.health.LastError = err.Error()
+		} else {
+			entry.health.Status = ProviderStatusAvailable
+			r.mu.RLock()
+			entry.breaker = newCircuitBreaker(r.breakerConfig)
+			r.mu.RUnlock()
+		}
+	}
+
+	r.mu.Lock()
+	old := r.entries[name]
+	r.entries[name] = entry
+	r.mu.Unlock()
+
+	if old != nil {
+		closeProvider(name, old.provider)
+	}
+	return err
+}
+
+// RemoveProvider 移除提供商并关闭其连接
+func (r *ProviderRegistry) RemoveProvider(name string) error {
+	r.mu.Lock()
+	entry, exists := r.entries[name]
+	delete(r.entries, name)
+	r.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("提供商不存在: %s", name)
+	}
+	closeProvider(name, entry.provider)
+	return nil
+}
+
+// Reload 按新配置同步提供商：移除已删除的，重建配置有变化的，其余保持不变
+// 熔断配置只对重建的提供商生效.
+func (r *ProviderRegistry) Reload(cfg *config.AIConfig) error {
+	var errs []error
+	r.setBreakerConfig(cfg.CircuitBreaker)
+
+	for _, name := range r.Names() {
+		if _, exists := cfg.Providers[name]; !exists {
+			if err := r.RemoveProvider(name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for name, providerCfg := range cfg.Providers {
+		providerCfg = applyProviderDefaults(cfg, providerCfg)
+		if current, exists := r.Config(name); exists && reflect.DeepEqual(current, providerCfg) {
+			continue
+		}
+		if err := r.AddProvider(name, providerCfg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	logger.Info("AI提供商已重新加载，ai.features 等其他配置需重启服务后生效", map[string]any{
+		"available": r.AvailableNames(),
+	})
+	return errors.Join(errs...)
+}
+
+// Provider 获取可用的提供商实例
+func (r *ProviderRegistry) Provider(name string) (AIProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.entries[name]
+	if !exists || entry.provider == nil {
+		return nil, false
+	}
+	return entry.provider, true
+}
+
+// Config 获取提供商配置
+func (r *ProviderRegistry) Config(name string) (config.ProviderConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.entries[name]
+	if !exists {
+		return config.ProviderConfig{}, false
+	}
+	return entry.config, true
+}
+
+// Health 获取提供商健康状态，熔断中的提供商报告为 error 状态
+func (r *ProviderRegistry) Health(name string) (ProviderHealth, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.entries[name]
+	if !exists {
+		return ProviderHealth{}, false
+	}
+
+	health := entry.health
+	if entry.breaker != nil {
+		stats := entry.breaker.Stats()
+		health.Circuit = &stats
+		if stats.State != CircuitStateClosed && health.Status == ProviderStatusAvailable {
+			health.Status = ProviderStatusError
+			health.LastError = stats.LastError
+		}
+	}
+	return health, true
+}
+
+// Allow 判断熔断器是否放行对提供商的请求，放行后必须调用 RecordResult
+func (r *ProviderRegistry) Allow(name string) bool {
+	breaker := r.breaker(name)
+	return breaker == nil || breaker.Allow()
+}
+
+// RecordResult 向熔断器报告请求结果，请求被调用方取消时不计入统计
+func (r *ProviderRegistry) RecordResult(ctx context.Context, name string, err error) {
+	breaker := r.breaker(name)
+	if breaker == nil {
+		return
+	}
+	if ctx.Err() != nil {
+		breaker.Release()
+		return
+	}
+	breaker.Record(err)
+}
+
+// Names 列出所有已登记的提供商名称（已排序）
+func (r *ProviderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AvailableNames 列出所有可用的提供商名称（已排序）
+func (r *ProviderRegistry) AvailableNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.entries))
+	for name, entry := range r.entries {
+		if entry.provider != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckHealth 检查所有已创建提供商的健康状态并返回结果
+func (r *ProviderRegistry) CheckHealth(ctx context.Context) []ProviderHealth {
+	r.mu.RLock()
+	targets := make(map[string]AIProvider, len(r.entries))
+	for name, entry := range r.entries {
+		if entry.provider != nil {
+			targets[name] = entry.provider
+		}
+	}
+	r.mu.RUnlock()
+
+	for name, provider := range targets {
+		err := provider.ValidateConfig()
+		if err == nil {
+			_, err = provider.ListModels(ctx)
+		}
+
+		r.mu.Lock()
+		// 检查期间提供商可能已被替换
+		if entry, exists := r.entries[name]; exists && entry.provider == provider {
+			entry.health.CheckedAt = time.Now()
+			if err != nil {
+				entry.health.Status = ProviderStatusError
+				entry.health.LastError = err.Error()
+			} else {
+				entry.health.Status = ProviderStatusAvailable
+				entry.health.LastError = ""
+			}
+		}
+		r.mu.Unlock()
+	}
+
+	names := r.Names()
+	result := make([]ProviderHealth, 0, len(names))
+	for _, name := range names {
+		if health, exists := r.Health(name); exists {
+			result = append(result, health)
+		}
+	}
+	return result
+}
+
+// Close 关闭所有提供商
+func (r *ProviderRegistry) Close() {
+	r.mu.Lock()
+	entries := r.entries
+	r.entries = make(map[string]*providerEntry)
+	r.mu.Unlock()
+
+	for name, entry := range entries {
+		closeProvider(name, entry.provider)
+	}
+}
+
+// breaker 获取提供商的熔断器
+func (r *ProviderRegistry) breaker(name string) *circuitBreaker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if entry, exists := r.entries[name]; exists {
+		return entry.breaker
+	}
+	return nil
+}
+
+// setBreakerConfig 设置新建提供商使用的熔断配置
+func (r *ProviderRegistry) setBreakerConfig(cfg config.CircuitBreakerConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakerConfig = cfg
+}
+
+// createProvider 通过工厂创建并校验提供商
+func (r *ProviderRegistry) createProvider(typ string, cfg config.ProviderConfig) (AIProvider, error) {
+	r.mu.RLock()
+	factory, exists := r.factories[typ]
+	r.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("不支持的AI提供商类型: %s", typ)
+	}
+
+	provider, err := factory.CreateProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := provider.ValidateConfig(); err != nil {
+		_ = provider.Close()
+		return nil, err
+	}
+	return provider, nil
+}
+
+// applyProviderDefaults 使用全局配置补全提供商配置
+func applyProviderDefaults(cfg *config.AIConfig, providerCfg config.ProviderConfig) config.ProviderConfig {
+	if providerCfg.Timeout <= 0 {
+		providerCfg.Timeout = cfg.Timeout
+	}
+	return providerCfg
+}
+
+// newProviderHTTPClient 创建提供商使用的 HTTP 客户端
+// 超时时间作用于等待响应头，流式响应开始后的持续读取不受限制，由请求上下文控制.
+func newProviderHTTPClient(cfg config.ProviderConfig) *http.Client {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultProviderTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Transport: transport}
+}
+
+// providerType 获取提供商类型，未配置时使用配置键名
+func providerType(name string, cfg config.ProviderConfig) string {
+	if cfg.Type != "" {
+		return cfg.Type
+	}
+	return name
+}
+
+// closeProvider 关闭提供商并记录错误
+func closeProvider(name string, provider AIProvider) {
+	if provider == nil {
+		return
+	}
+	if err := provider.Close(); err != nil {
+		logger.Error("关闭AI提供商失败", map[string]any{
+			"provider": name,
+			"error":    err.Error(),
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderRegistryLoadFromConfig(t *testing.T) {
+	var created []*fakeProvider
+	registry := newFakeRegistry(t, &created)
+
+	err := registry.LoadFromConfig(&config.AIConfig{
+		DefaultProvider: "primary",
+		Providers: map[string]config.ProviderConfig{
+			"primary":  {Enabled: true, Type: "fake", APIKey: "key"},
+			"broken":   {Enabled: true, Type: "fake"},
+			"disabled": {Enabled: false, Type: "fake", APIKey: "key"},
+			"unknown":  {Enabled: true, APIKey: "key"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"broken", "disabled", "primary", "unknown"}, registry.Names())
+	assert.Equal(t, []string{"primary"}, registry.AvailableNames())
+
+	health, _ := registry.Health("primary")
+	assert.Equal(t, ProviderStatusAvailable, health.Status)
+
+	health, _ = registry.Health("broken")
+	assert.Equal(t, ProviderStatusError, health.Status)
+	assert.Equal(t, "API密钥不能为空", health.LastError)
+	for _, p := range created {
+		if p.validateErr != nil {
+			assert.True(t, p.closed, "校验失败的实例应被关闭")
+		}
+	}
+
+	health, _ = registry.Health("disabled")
+	assert.Equal(t, ProviderStatusDisabled, health.Status)
+
+	health, _ = registry.Health("unknown")
+	assert.Equal(t, ProviderStatusError, health.Status)
+	assert.Contains(t, health.LastError, "不支持的AI提供商类型")
+}
+
+func TestProviderRegistryNoAvailableProvider(t *testing.T) {
+	var created []*fakeProvider
+	registry := newFakeRegistry(t, &created)
+
+	err := registry.LoadFromConfig(&config.AIConfig{
+		Providers: map[string]config.ProviderConfig{
+			"broken": {Enabled: true, Type: "fake"},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestProviderRegistryRuntimeChanges(t *testing.T) {
+	var created []*fakeProvider
+	registry := newFakeRegistry(t, &created)
+
+	require.NoError(t, registry.AddProvider("a", config.ProviderConfig{Enabled: true, Type: "fake", APIKey: "key"}))
+	require.NoError(t, registry.AddProvider("b", config.ProviderConfig{Enabled: true, Type: "fake", APIKey: "key"}))
+	require.Len(t, created, 2)
+
+	// 配置未变化的提供商保持不变，删除的提供商被关闭，变化的提供商被重建
+	err := registry.Reload(&config.AIConfig{
+		Providers: map[string]config.ProviderConfig{
+			"a": {Enabled: true, Type: "fake", APIKey: "key"},
+			"c": {Enabled: true, Type: "fake", APIKey: "key"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, registry.Names())
+	assert.False(t, created[0].closed)
+	assert.True(t, created[1].closed)
+	require.Len(t, created, 3)
+
+	err = registry.Reload(&config.AIConfig{
+		Providers: map[string]config.ProviderConfig{
+			"a": {Enabled: true, Type: "fake", APIKey: "new-key"},
+			"c": {Enabled: true, Type: "fake", APIKey: "key"},
+		},
+	})
+	require.NoError(t, err)
+	assert.True(t, created[0].closed)
+	provider, exists := registry.Provider("a")
+	require.True(t, exists)
+	assert.Same(t, created[3], provider)
+
+	require.NoError(t, registry.RemoveProvider("c"))
+	assert.True(t, created[2].closed)
+	_, exists = registry.Provider("c")
+	assert.False(t, exists)
+	assert.Error(t, registry.RemoveProvider("c"))
+}
+
+func TestProviderRegistryCheckHealth(t *testing.T) {
+	var created []*fakeProvider
+	registry := newFakeRegistry(t, &created)
+	require.NoError(t, registry.AddProvider("a", config.ProviderConfig{Enabled: true, Type: "fake", APIKey: "key"}))
+
+	created[0].validateErr = errors.New("连接失败")
+	results := registry.CheckHealth(context.Background())
+	require.Len(t, results, 1)
+	assert.Equal(t, ProviderStatusError, results[0].Status)
+	assert.Equal(t, "连接失败", results[0].LastError)
+
+	created[0].validateErr = nil
+	results = registry.CheckHealth(context.Background())
+	assert.Equal(t, ProviderStatusAvailable, results[0].Status)
+	assert.Empty(t, results[0].LastError)
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// sseMaxLineSize SSE 单行最大长度
+const sseMaxLineSize = 1024 * 1024
+
+// sseEvent 一条 Server-Sent Event
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// readSSE 逐条读取 SSE 事件，handler 返回 false 时停止读取
+func readSSE(body io.Reader, handler func(event *sseEvent) bool) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), sseMaxLineSize)
+
+	event := &sseEvent{}
+	var data []string
+
+	dispatch := func() bool {
+		if len(data) == 0 && event.Event == "" {
+			return true
+		}
+		event.Data = strings.Join(data, "\n")
+		keepGoing := handler(event)
+		event = &sseEvent{}
+		data = data[:0]
+		return keepGoing
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// 空行表示一个事件结束
+		if line == "" {
+			if !dispatch() {
+				return nil
+			}
+			continue
+		}
+
+		// 注释行
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			event.ID = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// 处理末尾没有空行的事件
+	dispatch()
+	return nil
+}
+
+// sendStreamChunk 向流式通道发送数据，上下文取消时放弃发送
+func sendStreamChunk(ctx context.Context, ch chan<- *ChatStreamResponse, chunk *ChatStreamResponse) bool {
+	select {
+	case ch <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// newStreamChoice 创建只包含增量内容的流式选择
+func newStreamChoice(role, content string, finishReason *string) StreamChoice {
+	choice := StreamChoice{FinishReason: finishReason}
+	choice.Delta.Role = role
+	choice.Delta.Content = content
+	return choice
+}
+
+// newToolCallStreamChoice 创建只包含工具调用增量的流式选择
+func newToolCallStreamChoice(delta ToolCallDelta) StreamChoice {
+	choice := StreamChoice{}
+	choice.Delta.ToolCalls = []ToolCallDelta{delta}
+	return choice
+}
+
+// appendToolCallDeltas 将流式工具调用增量合并到完整的工具调用中
+// 按 Index 定位调用，ID、类型和函数名取第一次出现的值，参数片段依次拼接.
+func appendToolCallDeltas(calls []ToolCall, deltas []ToolCallDelta) []ToolCall {
+	for _, delta := range deltas {
+		if delta.Index < 0 {
+			continue
+		}
+		for len(calls) <= delta.Index {
+			calls = append(calls, ToolCall{Type: ToolTypeFunction})
+		}
+		call := &calls[delta.Index]
+		if delta.ID != "" && call.ID == "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		if delta.Function.Name != "" && call.Function.Name == "" {
+			call.Function.Name = delta.Function.Name
+		}
+		call.Function.Arguments += delta.Function.Arguments
+	}
+	return calls
+}
+
+// newStreamTextChunk 创建由本服务补发的增量内容分片，finishReason 为空表示未结束
+func newStreamTextChunk(responseID string, target *chatTarget, content, finishReason string) *ChatStreamResponse {
+	var reason *string
+	if finishReason != "" {
+		reason = &finishReason
+	}
+	return &ChatStreamResponse{
+		ID:       responseID,
+		Object:   ObjectChatCompletionChunk,
+		Created:  time.Now().Unix(),
+		Model:    target.model.Name,
+		Choices:  []StreamChoice{newStreamChoice("", content, reason)},
+		Provider: target.providerName,
+	}
+}
+
+// newStreamErrorChunk 构建错误块，非 APIError 的错误按提供商错误返回
+func newStreamErrorChunk(target *chatTarget, err error) *ChatStreamResponse {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = &APIError{
+			Code:    ErrorCodeProviderError,
+			Message: err.Error(),
+		}
+	}
+	return &ChatStreamResponse{
+		Error:    apiErr,
+		Provider: target.providerName,
+	}
+}
+
+// isEmptyStreamChunk 判断分片的增量是否为空，没有选择的分片可能携带用量信息，不视为空
+func isEmptyStreamChunk(chunk *ChatStreamResponse) bool {
+	if len(chunk.Choices) == 0 {
+		return false
+	}
+	choice := chunk.Choices[0]
+	return choice.Delta.Role == "" && choice.Delta.Content == "" && len(choice.Delta.ToolCalls) == 0 &&
+		(choice.FinishReason == nil || *choice.FinishReason == "")
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/pkg/jsonschema"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// structuredOutputMaxRepairs 回复不符合格式要求时最多要求模型修正的次数
+const structuredOutputMaxRepairs = 1
+
+// objectSchema json_object 格式只要求输出 JSON 对象
+var objectSchema = jsonschema.MustCompile([]byte(`{"type":"object"}`))
+
+// structuredOutput 一次请求的结构化输出校验：编译后的 schema 和已修正的次数
+type structuredOutput struct {
+	schema  *jsonschema.Schema
+	repairs int
+}
+
+// newStructuredOutput 校验输出格式并编译 schema，未要求结构化输出时返回 nil
+func newStructuredOutput(format *ResponseFormat) (*structuredOutput, error) {
+	if format == nil {
+		return nil, nil
+	}
+
+	switch format.Type {
+	case "", ResponseFormatText:
+		return nil, nil
+	case ResponseFormatJSONObject:
+		return &structuredOutput{schema: objectSchema}, nil
+	case ResponseFormatJSONSchema:
+	default:
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("不支持的输出格式: %s", format.Type),
+		}
+	}
+
+	definition := format.JSONSchema
+	if definition == nil || len(definition.Schema) == 0 {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: "json_schema 输出格式缺少 schema",
+		}
+	}
+	if !toolNamePattern.MatchString(definition.Name) {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("json_schema 名称不合法: %q", definition.Name),
+		}
+	}
+	schema, err := jsonschema.Compile(definition.Schema)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("json_schema 无效: %v", err),
+		}
+	}
+	return &structuredOutput{schema: schema}, nil
+}
+
+// requiresStructuredOutput 检查输出格式是否要求结构化输出
+func requiresStructuredOutput(format *ResponseFormat) bool {
+	return format != nil && format.Type != "" && format.Type != ResponseFormatText
+}
+
+// applyResponseFormat 把输出格式要求应用到请求：模型原生支持时交给提供商，否则在系统提示词中说明格式要求
+func applyResponseFormat(req *ChatRequest, format *ResponseFormat, modelCfg config.ModelConfig) {
+	if !requiresStructuredOutput(format) {
+		return
+	}
+	if modelCfg.StructuredOutput {
+		req.ResponseFormat = format
+		return
+	}
+
+	req.ResponseFormat = nil
+	instruction := responseFormatInstruction(format)
+	if len(req.Messages) > 0 && req.Messages[0].Role == model.MessageRoleSystem {
+		req.Messages[0].Content += "\n\n" + instruction
+		return
+	}
+	req.Messages = append([]Message{{Role: model.MessageRoleSystem, Content: instruction}}, req.Messages...)
+}
+
+// responseFormatInstruction 不支持原生结构化输出时加入系统提示词的格式说明
+func responseFormatInstruction(format *ResponseFormat) string {
+	const rule = "不要输出任何解释或其他内容，也不要使用 Markdown 代码块。"
+	if format.JSONSchema == nil {
+		return "请只输出一个合法的 JSON 对象，" + rule
+	}
+
+	schema := format.JSONSchema.Schema
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, schema); err == nil {
+		schema = compact.Bytes()
+	}
+	instruction := "请只输出一个符合以下 JSON Schema 的 JSON，" + rule
+	if format.JSONSchema.Description != "" {
+		instruction += "\n输出说明：" + format.JSONSchema.Description
+	}
+	return instruction + "\nJSON Schema：" + string(schema)
+}
+
+// rejectStreamingResponseFormat 结构化输出需要完整的回复才能校验，不支持流式响应
+func rejectStreamingResponseFormat(format *ResponseFormat) error {
+	if requiresStructuredOutput(format) {
+		return &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: "结构化输出暂不支持流式响应",
+		}
+	}
+	return nil
+}
+
+// check 校验回复，返回去掉代码块标记等多余内容后的 JSON 和校验错误
+func (o *structuredOutput) check(content string) (string, jsonschema.Errors) {
+	content = extractJSON(content)
+	err := o.schema.ValidateJSON([]byte(content))
+	if err == nil {
+		return content, nil
+	}
+
+	var errs jsonschema.Errors
+	if !errors.As(err, &errs) {
+		errs = jsonschema.Errors{{Path: "$", Message: err.Error()}}
+	}
+	return content, errs
+}
+
+// repair 把不符合要求的回复和校验错误追加到请求中，要求模型修正
+// 已达到修正次数上限时返回 false.
+func (o *structuredOutput) repair(req *ChatRequest, content string, errs jsonschema.Errors) bool {
+	if o.repairs >= structuredOutputMaxRepairs {
+		return false
+	}
+	o.repairs++
+
+	var feedback strings.Builder
+	feedback.WriteString("你的输出不符合要求的格式：\n")
+	for _, message := range errs.Messages() {
+		feedback.WriteString("- " + message + "\n")
+	}
+	feedback.WriteString("请修正后重新输出，只输出 JSON。")
+
+	req.Messages = append(req.Messages,
+		Message{Role: model.MessageRoleAssistant, Content: content},
+		Message{Role: model.MessageRoleUser, Content: feedback.String()},
+	)
+	return true
+}
+
+// invalidOutputError 回复修正后仍不符合格式要求时返回的错误
+func invalidOutputError(errs jsonschema.Errors) error {
+	return &APIError{
+		Code:    ErrorCodeInvalidOutput,
+		Message: "模型输出不符合要求的 JSON 格式",
+		Details: map[string]interface{}{"errors": errs.Messages()},
+	}
+}
+
+// extractJSON 去掉回复首尾的空白和 Markdown 代码块标记
+func extractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+
+	// 去掉 ```json 这一行和结尾的 ```
+	if _, rest, found := strings.Cut(content, "\n"); found {
+		content = rest
+	}
+	content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+	return strings.TrimSpace(content)
+}
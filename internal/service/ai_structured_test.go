@@ -0,0 +1,136 @@
+package service
+
+import (
+	"ai-svc/internal/model"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// weatherFormat 天气查询结果的 JSON Schema 输出格式
+var weatherFormat = &ResponseFormat{
+	Type: ResponseFormatJSONSchema,
+	JSONSchema: &JSONSchemaFormat{
+		Name: "weather",
+		Schema: json.RawMessage(`{
+			"type": "object",
+			"properties": {"city": {"type": "string"}, "temperature": {"type": "number"}},
+			"required": ["city", "temperature"],
+			"additionalProperties": false
+		}`),
+	},
+}
+
+func TestSendMessageRepairsStructuredOutput(t *testing.T) {
+	provider := &fakeProvider{replies: []string{
+		`北京今天 20 度`,
+		"```json\n{\"city\":\"北京\",\"temperature\":20}\n```",
+	}}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider})
+
+	options := &ChatOptions{ResponseFormat: weatherFormat}
+	reply, err := s.SendMessage(context.Background(), 1, "", "北京天气怎么样", options)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"city":"北京","temperature":20}`, reply.Content)
+	assert.Equal(t, model.MessageStatusReceived, reply.Status)
+
+	// 模型不支持原生结构化输出时通过系统提示词说明格式
+	require.Len(t, provider.requests, 2)
+	first := provider.requests[0]
+	assert.Nil(t, first.ResponseFormat)
+	assert.Equal(t, model.MessageRoleSystem, first.Messages[0].Role)
+	assert.Contains(t, first.Messages[0].Content, `"required":["city","temperature"]`)
+
+	// 修正请求携带不合格的回复和校验错误
+	repair := provider.requests[1].Messages
+	assert.Equal(t, "北京今天 20 度", repair[len(repair)-2].Content)
+	assert.Contains(t, repair[len(repair)-1].Content, "不是合法的 JSON")
+
+	// 不合格的回复保存为失败消息
+	require.Len(t, repo.messages, 3)
+	assert.Equal(t, model.MessageStatusError, repo.messages[1].Status)
+	assert.Contains(t, repo.messages[1].Metadata, "output_errors")
+}
+
+func TestSendMessageFailsWhenStructuredOutputStillInvalid(t *testing.T) {
+	provider := &fakeProvider{replies: []string{`{"city":"北京"}`}}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, func(s *aiService) {
+		s.config.Providers["primary"].Models[0].StructuredOutput = true
+	})
+
+	options := &ChatOptions{ResponseFormat: weatherFormat}
+	_, err := s.SendMessage(context.Background(), 1, "", "北京天气怎么样", options)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, ErrorCodeInvalidOutput, apiErr.Code)
+	details := apiErr.Details.(map[string]interface{})
+	assert.Equal(t, []string{"$: 缺少必需的属性 temperature"}, details["errors"])
+
+	// 模型原生支持时交给提供商，不修改提示词
+	require.Len(t, provider.requests, 2)
+	assert.Equal(t, weatherFormat, provider.requests[0].ResponseFormat)
+	assert.Equal(t, model.MessageRoleUser, provider.requests[0].Messages[0].Role)
+	assert.Equal(t, []string{"user", "assistant", "assistant"}, messageRoles(repo.messages))
+}
+
+func TestStructuredOutputRejectsInvalidRequests(t *testing.T) {
+	provider := &fakeProvider{replies: []string{`{}`}}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": provider})
+
+	withSchema := func(name, schema string) *ResponseFormat {
+		return &ResponseFormat{
+			Type:       ResponseFormatJSONSchema,
+			JSONSchema: &JSONSchemaFormat{Name: name, Schema: json.RawMessage(schema)},
+		}
+	}
+	for _, format := range []*ResponseFormat{
+		{Type: "xml"},
+		{Type: ResponseFormatJSONSchema},
+		withSchema("bad name", `{}`),
+		withSchema("result", `{"type":1}`),
+	} {
+		_, err := s.SendMessage(context.Background(), 1, "", "你好", &ChatOptions{ResponseFormat: format})
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, ErrorCodeInvalidRequest, apiErr.Code)
+	}
+
+	_, err := s.SendMessageStream(context.Background(), 1, "", "你好", &ChatOptions{ResponseFormat: weatherFormat})
+	assert.Error(t, err)
+	assert.Empty(t, provider.requests)
+}
+
+func TestCreateChatCompletionRepairsStructuredOutput(t *testing.T) {
+	provider := &fakeProvider{replies: []string{`[1, 2]`, ` {"ok": true} `}}
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": provider})
+
+	req := NewChatRequest("primary-model", []Message{
+		{Role: model.MessageRoleSystem, Content: "你是一个助手"},
+		{Role: model.MessageRoleUser, Content: "你好"},
+	})
+	req.ResponseFormat = &ResponseFormat{Type: ResponseFormatJSONObject}
+	resp, err := s.CreateChatCompletion(context.Background(), 1, req)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok": true}`, resp.Choices[0].Message.Content)
+
+	require.Len(t, provider.requests, 2)
+	system := provider.requests[0].Messages[0].Content
+	assert.Contains(t, system, "你是一个助手\n\n请只输出一个合法的 JSON 对象")
+	assert.Contains(t, provider.requests[1].Messages[3].Content, "类型应为 object，实际为 array")
+}
+
+func TestOpenAIRequestResponseFormat(t *testing.T) {
+	req := NewChatRequest("gpt-4o", []Message{{Role: model.MessageRoleUser, Content: "你好"}})
+	req.ResponseFormat = weatherFormat
+
+	data, err := json.Marshal(buildOpenAIRequest(req, false))
+	require.NoError(t, err)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &body))
+	format := body["response_format"].(map[string]interface{})
+	assert.Equal(t, "json_schema", format["type"])
+	assert.Equal(t, "weather", format["json_schema"].(map[string]interface{})["name"])
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"ai-svc/internal/model"
+	"ai-svc/pkg/logger"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSummarizerTimeout 未配置时生成标题和摘要的超时时间
+	defaultSummarizerTimeout = 30 * time.Second
+
+	// transcriptItemMaxRunes 发送给摘要模型的对话记录中每条消息的最大长度
+	transcriptItemMaxRunes = 2000
+
+	// titleQuotes 生成的标题两端需要去掉的引号
+	titleQuotes = " \"'“”‘’《》「」"
+
+	// titleSystemPrompt 生成标题的系统提示词
+	titleSystemPrompt = "根据下面的对话生成一个简短的标题，概括对话的主题。" +
+		"使用对话所用的语言，不超过 20 个字，不要加引号和标点，只输出标题本身。"
+
+	// summarySystemPrompt 生成摘要的系统提示词
+	summarySystemPrompt = "把下面的对话压缩为一段摘要，保留用户的目标、已确认的事实和结论、尚未解决的问题，" +
+		"省略寒暄和重复的内容。已有摘要时把新的对话合并进去，只输出合并后的摘要本身。"
+)
+
+// summarizeAfterReply 保存回复后在后台生成标题和摘要
+// 只在一次完整的回复之后触发，工具调用的中间步骤、失败和停止生成的回复不触发.
+func (s *aiService) summarizeAfterReply(conversation *model.AIConversation, reply *model.AIMessage) {
+	cfg := s.config.Features.Summarizer
+	if !cfg.Enabled || reply.Status != model.MessageStatusReceived || reply.FinishReason == FinishReasonToolCalls {
+		return
+	}
+
+	// 对话对象随后还会被请求协程修改，后台任务使用副本；同一对话已有任务在运行时跳过，由之后的回复再触发
+	snapshot := *conversation
+	s.summaries.start(conversation.ID, func() { s.summarize(&snapshot) })
+}
+
+// summaryTasks 后台生成标题和摘要的任务
+// 同一对话同时只运行一个任务，关闭后不再启动新任务.
+type summaryTasks struct {
+	mu      sync.Mutex
+	running map[uint]bool
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// start 在后台为对话运行 fn，该对话已有任务在运行或已关闭时不运行
+func (t *summaryTasks) start(conversationID uint, fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || t.running[conversationID] {
+		return
+	}
+	if t.running == nil {
+		t.running = make(map[uint]bool)
+	}
+	t.running[conversationID] = true
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer t.finish(conversationID)
+		fn()
+	}()
+}
+
+// finish 标记对话的任务已结束
+func (t *summaryTasks) finish(conversationID uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.running, conversationID)
+}
+
+// close 不再启动新任务，并等待进行中的任务结束
+func (t *summaryTasks) close() {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.wg.Wait()
+}
+
+// summarize 为对话生成标题和摘要，生成失败只记录日志
+func (s *aiService) summarize(conversation *model.AIConversation) {
+	cfg := s.config.Features.Summarizer
+	needTitle := cfg.Title && conversation.AutoTitle
+	needSummary := s.config.Features.History.Enabled && cfg.Interval > 0
+	if (!needTitle && !needSummary) || conversation.CurrentMessageID == nil {
+		return
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultSummarizerTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	target, err := s.resolveTarget(cfg.Provider, cfg.Model)
+	if err != nil {
+		logger.Warn("摘要模型不可用", map[string]any{
+			"provider": cfg.Provider,
+			"model":    cfg.Model,
+			"error":    err.Error(),
+		})
+		return
+	}
+
+	path, err := s.repo.GetMessagePath(conversation.ID, *conversation.CurrentMessageID, s.summaryLookback())
+	if err != nil {
+		logger.Error("加载摘要所需的对话失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"error":           err.Error(),
+		})
+		return
+	}
+
+	// 生成期间用户可能修改了标题，较慢的旧任务也可能晚于新任务完成，保存时由数据库按条件更新
+	if needTitle {
+		if title := s.generateTitle(ctx, conversation, target, path); title != "" {
+			if err := s.repo.SetGeneratedTitle(conversation.ID, title); err != nil {
+				logger.Error("保存对话标题失败", map[string]any{
+					"conversation_id": conversation.ID,
+					"error":           err.Error(),
+				})
+			}
+		}
+	}
+	if needSummary {
+		if summary, lastID := s.generateSummary(ctx, conversation, target, path); summary != "" {
+			if err := s.repo.SetConversationSummary(conversation.ID, summary, lastID); err != nil {
+				logger.Error("保存对话摘要失败", map[string]any{
+					"conversation_id": conversation.ID,
+					"error":           err.Error(),
+				})
+			}
+		}
+	}
+}
+
+// generateTitle 根据第一轮问答生成标题，对话还没有完整的一轮时返回空
+func (s *aiService) generateTitle(
+	ctx context.Context,
+	conversation *model.AIConversation,
+	target *chatTarget,
+	path []*model.AIMessage,
+) string {
+	transcript := formatTranscript(path)
+	// 只需要第一轮问答
+	if len(transcript) > 2 {
+		transcript = transcript[:2]
+	}
+	if len(transcript) < 2 {
+		return ""
+	}
+
+	text, err := s.generateText(ctx, conversation.UserID, target, titleSystemPrompt, strings.Join(transcript, "\n"))
+	if err != nil {
+		logger.Warn("生成对话标题失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"error":           err.Error(),
+		})
+		return ""
+	}
+	return cleanTitle(text)
+}
+
+// generateSummary 把历史窗口之前尚未摘要的消息合并到摘要中
+// 新增的消息达到配置的间隔才重新生成，返回新摘要和它涵盖的最后一条消息的 ID.
+func (s *aiService) generateSummary(
+	ctx context.Context,
+	conversation *model.AIConversation,
+	target *chatTarget,
+	path []*model.AIMessage,
+) (string, uint) {
+	// 历史窗口内的消息会原样发送，不需要摘要
+	end := len(path) - s.historyMaxMessages()
+	if end <= 0 {
+		return "", 0
+	}
+
+	// 已有摘要涵盖的消息不在当前分支上时（例如切换了分支）从头生成
+	start, previous := 0, ""
+	if conversation.SummaryMessageID != nil {
+		for i, message := range path[:end] {
+			if message.ID == *conversation.SummaryMessageID {
+				start, previous = i+1, conversation.Summary
+				break
+			}
+		}
+	}
+	if end-start < s.config.Features.Summarizer.Interval {
+		return "", 0
+	}
+
+	transcript := formatTranscript(path[start:end])
+	if len(transcript) == 0 {
+		return "", 0
+	}
+	content := strings.Join(transcript, "\n")
+	if previous != "" {
+		content = fmt.Sprintf("已有摘要：\n%s\n\n新的对话：\n%s", previous, content)
+	}
+
+	summary, err := s.generateText(ctx, conversation.UserID, target, summarySystemPrompt, content)
+	if err != nil {
+		logger.Warn("生成对话摘要失败", map[string]any{
+			"conversation_id": conversation.ID,
+			"error":           err.Error(),
+		})
+		return "", 0
+	}
+	return strings.TrimSpace(summary), path[end-1].ID
+}
+
+// generateText 使用摘要模型生成文本，用量计入用户的统计和配额
+func (s *aiService) generateText(
+	ctx context.Context,
+	userID uint,
+	target *chatTarget,
+	systemPrompt string,
+	content string,
+) (string, error) {
+	req := NewChatRequest(target.model.Name, []Message{
+		{Role: model.MessageRoleSystem, Content: systemPrompt},
+		{Role: model.MessageRoleUser, Content: content},
+	})
+	req.User = fmt.Sprintf("%d", userID)
+	temperature := float32(0.3)
+	var maxTokens *int
+	if value := s.config.Features.Summarizer.MaxTokens; value > 0 {
+		maxTokens = &value
+	}
+	req.SetParameters(&temperature, maxTokens)
+
+	start := time.Now()
+	resp, answered, err := s.chatWithFailover(ctx, target, req)
+	if err != nil {
+		return "", err
+	}
+	// 生成标题和摘要不是用户的请求，只计用量，不计请求数和消息数
+	s.recordUsage(userID, completionUsage(answered, resp.Usage, time.Since(start), nil), 0, 0)
+
+	text := strings.TrimSpace(resp.GetLastAssistantMessage())
+	if text == "" {
+		return "", errors.New("摘要模型返回了空内容")
+	}
+	return text, nil
+}
+
+// summarizedHistory 以已生成的摘要代替它涵盖的早期消息，返回其余的历史和摘要消息
+// 摘要占用的 token 从历史窗口的预算中扣除；摘要涵盖的最后一条消息不在历史中时（例如切换了分支）
+// 或预算放不下摘要时不使用摘要.
+func summarizedHistory(
+	conversation *model.AIConversation,
+	history []*model.AIMessage,
+	window *historyWindow,
+) ([]*model.AIMessage, *Message) {
+	if conversation.SummaryMessageID == nil || conversation.Summary == "" {
+		return history, nil
+	}
+	for i, message := range history {
+		if message.ID != *conversation.SummaryMessageID {
+			continue
+		}
+		summary := Message{Role: model.MessageRoleSystem, Content: earlierSummaryPrefix + conversation.Summary}
+		tokens := estimateMessageTokens(window.counter, summary)
+		if window.maxTokens > 0 {
+			if tokens >= window.maxTokens {
+				return history, nil
+			}
+			window.maxTokens -= tokens
+		}
+		return history[i+1:], &summary
+	}
+	return history, nil
+}
+
+// addSummary 把已生成的摘要放在系统提示词之后、其余历史之前
+func (r *contextResult) addSummary(summary Message, window historyWindow, hasSystemPrompt bool) {
+	at := 0
+	if hasSystemPrompt {
+		at = 1
+	}
+	r.Messages = append(r.Messages[:at], append([]Message{summary}, r.Messages[at:]...)...)
+	r.EstimatedTokens += estimateMessageTokens(window.counter, summary)
+	r.Summarized = true
+}
+
+// formatTranscript 把对话整理为发送给摘要模型的文本，每条消息一行
+// 只保留用户消息和完整的助手回复，跳过工具调用的中间步骤和失败的回复.
+func formatTranscript(messages []*model.AIMessage) []string {
+	var lines []string
+	for _, message := range messages {
+		if message.Status == model.MessageStatusError || message.FinishReason == FinishReasonToolCalls {
+			continue
+		}
+		var speaker string
+		switch message.Role {
+		case model.MessageRoleUser:
+			speaker = "用户"
+		case model.MessageRoleAssistant:
+			speaker = "助手"
+		default:
+			continue
+		}
+		content := truncateRunes(collapseSpaces(message.Content), transcriptItemMaxRunes)
+		if content == "" {
+			continue
+		}
+		lines = append(lines, speaker+"："+content)
+	}
+	return lines
+}
+
+// cleanTitle 整理模型生成的标题：只取第一行，去掉引号和结尾的标点
+func cleanTitle(text string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	title = strings.TrimPrefix(strings.TrimSpace(title), "标题：")
+	title = strings.TrimRight(title, titleQuotes+"。.!！?？")
+	title = strings.TrimLeft(title, titleQuotes)
+	return truncateTitle(title)
+}
+
+// summaryLookback 生成和使用摘要时需要加载的消息数：历史窗口加上两次摘要的间隔
+func (s *aiService) summaryLookback() int {
+	return s.historyMaxMessages() + 2*s.config.Features.Summarizer.Interval
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/pkg/tokenizer"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enableSummarizer 开启历史和摘要，历史窗口只保留两条消息
+func enableSummarizer(s *aiService) {
+	s.config.Features.History = config.HistoryConfig{Enabled: true, MaxMessages: 2}
+	s.config.Features.Summarizer = config.SummarizerConfig{Enabled: true, Title: true, Interval: 2}
+}
+
+func TestSummarizerGeneratesTitleAndRollingSummary(t *testing.T) {
+	provider := &fakeProvider{replies: []string{"回答一", "“天气查询”。", "回答二", "早期摘要", "回答三", "更新后的摘要"}}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableSummarizer)
+	ctx := context.Background()
+
+	// 首轮对话后生成标题，历史窗口之前还没有消息，不生成摘要
+	_, err := s.SendMessage(ctx, 1, "", "问题一", nil)
+	require.NoError(t, err)
+	s.summaries.wg.Wait()
+	require.Len(t, provider.requests, 2)
+	conversation := repo.conversations[0]
+	assert.Equal(t, "天气查询", conversation.Title)
+	assert.False(t, conversation.AutoTitle)
+	assert.Equal(t, []string{"用户：问题一\n助手：回答一"}, requestContents(provider.requests[1])[1:])
+
+	// 历史窗口之前的消息达到间隔后生成摘要，标题不再重新生成
+	_, err = s.SendMessage(ctx, 1, conversation.SessionID, "问题二", nil)
+	require.NoError(t, err)
+	s.summaries.wg.Wait()
+	assert.Equal(t, "早期摘要", conversation.Summary)
+	assert.Equal(t, uintPtr(2), conversation.SummaryMessageID)
+	assert.Equal(t, "用户：问题一\n助手：回答一", requestContents(provider.requests[3])[1])
+
+	// 摘要代替它涵盖的消息，与历史窗口一起发送
+	_, err = s.SendMessage(ctx, 1, conversation.SessionID, "问题三", nil)
+	require.NoError(t, err)
+	s.summaries.wg.Wait()
+	assert.Equal(t, []string{"以下是更早对话的摘要，供参考：\n早期摘要", "问题二", "回答二", "问题三"},
+		requestContents(provider.requests[4]))
+
+	// 新增的消息再次达到间隔时把它们合并到已有摘要中
+	assert.Equal(t, "已有摘要：\n早期摘要\n\n新的对话：\n用户：问题二\n助手：回答二",
+		requestContents(provider.requests[5])[1])
+	assert.Equal(t, "更新后的摘要", conversation.Summary)
+	assert.Equal(t, uintPtr(4), conversation.SummaryMessageID)
+	assert.Equal(t, "天气查询", conversation.Title)
+}
+
+func TestCreateConversationTitle(t *testing.T) {
+	s, _ := newTestService(t, map[string]*fakeProvider{"primary": {}}, enableSummarizer)
+	ctx := context.Background()
+
+	conversation, err := s.CreateConversation(ctx, 1, "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, defaultConversationTitle, conversation.Title)
+	assert.True(t, conversation.AutoTitle)
+
+	conversation, err = s.CreateConversation(ctx, 1, "旅行计划", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "旅行计划", conversation.Title)
+	assert.False(t, conversation.AutoTitle)
+}
+
+func TestSummarizeDoesNotOverwriteNewerChanges(t *testing.T) {
+	provider := &fakeProvider{replies: []string{"回答一", "回答二", "生成的标题", "旧摘要"}}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, func(s *aiService) {
+		enableSummarizer(s)
+		s.config.Features.Summarizer.Enabled = false
+	})
+	ctx := context.Background()
+
+	_, err := s.SendMessage(ctx, 1, "", "问题一", nil)
+	require.NoError(t, err)
+	conversation := repo.conversations[0]
+	_, err = s.SendMessage(ctx, 1, conversation.SessionID, "问题二", nil)
+	require.NoError(t, err)
+
+	// 生成期间用户修改了标题，另一个任务已保存了更新的摘要
+	snapshot := *conversation
+	require.NoError(t, s.UpdateConversation(ctx, 1, conversation.SessionID, map[string]interface{}{"title": "我的标题"}))
+	require.NoError(t, repo.SetConversationSummary(conversation.ID, "新摘要", 3))
+
+	s.summarize(&snapshot)
+	require.Len(t, provider.requests, 4)
+	assert.Equal(t, "我的标题", conversation.Title)
+	assert.Equal(t, "新摘要", conversation.Summary)
+	assert.Equal(t, uintPtr(3), conversation.SummaryMessageID)
+}
+
+func TestSummaryTasksRunOncePerConversation(t *testing.T) {
+	var tasks summaryTasks
+	release := make(chan struct{})
+	runs := 0
+	tasks.start(1, func() {
+		<-release
+		runs++
+	})
+	// 同一对话的任务还在运行时跳过
+	tasks.start(1, func() { runs++ })
+	close(release)
+
+	tasks.close()
+	assert.Equal(t, 1, runs)
+
+	// 关闭后不再启动新任务
+	tasks.start(2, func() { runs++ })
+	tasks.close()
+	assert.Equal(t, 1, runs)
+}
+
+func TestSummarizedHistory(t *testing.T) {
+	history := newHistory(3)
+	for i, message := range history {
+		message.ID = uint(i + 1)
+	}
+	conversation := &model.AIConversation{Summary: "用户在规划北京旅行", SummaryMessageID: uintPtr(2)}
+	window := historyWindow{counter: tokenizer.ForModel("qwen-turbo"), maxMessages: 2, maxTokens: 1000}
+
+	// 摘要代替它涵盖的消息，占用的 token 从预算中扣除
+	rest, summary := summarizedHistory(conversation, history, &window)
+	require.NotNil(t, summary)
+	assert.Equal(t, "以下是更早对话的摘要，供参考：\n用户在规划北京旅行", summary.Content)
+	assert.Equal(t, history[2:], rest)
+	assert.Equal(t, 1000-estimateMessageTokens(window.counter, *summary), window.maxTokens)
+
+	result := buildContextMessages("系统提示", rest, userMessage("最新问题"), window)
+	result.addSummary(*summary, window, true)
+	require.Len(t, result.Messages, 5)
+	assert.Equal(t, summary.Content, result.Messages[1].Content)
+	assert.Equal(t, "问题3", result.Messages[2].Content)
+	assert.True(t, result.Summarized)
+
+	// 摘要涵盖的消息不在当前分支上时不使用摘要
+	conversation.SummaryMessageID = uintPtr(99)
+	rest, summary = summarizedHistory(conversation, history, &window)
+	assert.Nil(t, summary)
+	assert.Equal(t, history, rest)
+}
+
+func TestCleanTitle(t *testing.T) {
+	assert.Equal(t, "天气查询", cleanTitle("标题：《天气查询》。\n这是根据对话生成的标题"))
+	assert.Equal(t, "Weather lookup", cleanTitle(`"Weather lookup."`))
+}
@@ -0,0 +1,621 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/pkg/tencentcloud"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// tencentDefaultBaseURL 混元 API 默认地址
+	tencentDefaultBaseURL = "https://hunyuan.tencentcloudapi.com"
+
+	// hunyuanService 混元服务名（参与签名）
+	hunyuanService = "hunyuan"
+
+	// hunyuanVersion 混元接口版本
+	hunyuanVersion = "2023-09-01"
+
+	// hunyuanActionChat 对话接口名
+	hunyuanActionChat = "ChatCompletions"
+)
+
+// TencentProvider 腾讯混元提供商实现
+type TencentProvider struct {
+	config     config.ProviderConfig
+	httpClient *http.Client
+	baseURL    string
+	region     string
+	signer     *tencentcloud.Signer
+}
+
+// NewTencentProvider 创建腾讯混元提供商
+func NewTencentProvider(cfg config.ProviderConfig) *TencentProvider {
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = tencentDefaultBaseURL
+	}
+
+	return &TencentProvider{
+		config:     cfg,
+		baseURL:    baseURL,
+		region:     cfg.Region,
+		signer:     tencentcloud.NewSigner(cfg.SecretID, cfg.SecretKey),
+		httpClient: newProviderHTTPClient(cfg),
+	}
+}
+
+// GetName 获取提供商名称
+func (p *TencentProvider) GetName() string {
+	return "tencent"
+}
+
+// Chat 发送聊天请求
+func (p *TencentProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	body, err := p.doRequest(ctx, p.buildRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var hunyuanResp HunyuanResponse
+	if err := json.NewDecoder(body).Decode(&hunyuanResp); err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeProviderError,
+			Message: fmt.Sprintf("解析响应失败: %v", err),
+		}
+	}
+	if hunyuanResp.Response.Error != nil {
+		return nil, newHunyuanAPIError(hunyuanResp.Response.Error)
+	}
+
+	return p.convertToStandardResponse(req.Model, &hunyuanResp.Response.HunyuanChatResult), nil
+}
+
+// ChatStream 发送流式聊天请求
+func (p *TencentProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatStreamResponse, error) {
+	body, err := p.doRequest(ctx, p.buildRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *ChatStreamResponse, 10)
+	go p.handleStreamResponse(ctx, req.Model, body, ch)
+
+	return ch, nil
+}
+
+// ListModels 列出可用模型
+func (p *TencentProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return modelsFromConfig(p.GetName(), p.config), nil
+}
+
+// ValidateConfig 验证配置是否有效
+func (p *TencentProvider) ValidateConfig() error {
+	if p.signer.SecretID == "" || p.signer.SecretKey == "" {
+		return fmt.Errorf("腾讯云 SecretID 和 SecretKey 不能为空")
+	}
+	if len(p.config.Models) == 0 {
+		return fmt.Errorf("腾讯混元至少需要配置一个模型")
+	}
+	return nil
+}
+
+// Close 关闭连接
+func (p *TencentProvider) Close() error {
+	p.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// 私有方法
+
+// buildRequest 构建混元请求
+// 混元要求 system 消息只能位于首位，其后 user/assistant 交替出现（工具结果跟在发起调用的 assistant 消息之后）.
+func (p *TencentProvider) buildRequest(req *ChatRequest, stream bool) *HunyuanChatRequest {
+	hunyuanReq := &HunyuanChatRequest{
+		Model:       req.Model,
+		Stream:      stream,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	}
+	if len(req.Tools) > 0 {
+		hunyuanReq.Tools = convertToHunyuanTools(req.Tools)
+		hunyuanReq.ToolChoice, hunyuanReq.CustomTool = convertToHunyuanToolChoice(req.ToolChoice, hunyuanReq.Tools)
+	}
+
+	var systemParts []string
+	var messages []HunyuanMessage
+	for _, msg := range req.Messages {
+		if msg.Role == model.MessageRoleSystem {
+			systemParts = append(systemParts, msg.Content)
+			continue
+		}
+
+		hunyuanMsg := HunyuanMessage{Role: msg.Role, Content: msg.Content, ToolCallID: msg.ToolCallID}
+		if len(msg.Parts) > 0 {
+			hunyuanMsg.Content = ""
+			hunyuanMsg.Contents = convertToHunyuanContents(msg.Parts)
+		}
+		for _, call := range msg.ToolCalls {
+			hunyuanMsg.ToolCalls = append(hunyuanMsg.ToolCalls, HunyuanToolCall{
+				ID:       call.ID,
+				Type:     call.Type,
+				Function: HunyuanFunctionCall(call.Function),
+			})
+		}
+
+		// 合并相邻的同角色文本消息，多模态消息不合并
+		if n := len(messages); n > 0 && messages[n-1].Role == msg.Role && msg.Role != model.MessageRoleTool &&
+			len(messages[n-1].ToolCalls) == 0 && len(hunyuanMsg.ToolCalls) == 0 &&
+			len(messages[n-1].Contents) == 0 && len(hunyuanMsg.Contents) == 0 {
+			messages[n-1].Content += "\n\n" + msg.Content
+			continue
+		}
+		messages = append(messages, hunyuanMsg)
+	}
+
+	if len(systemParts) > 0 {
+		messages = append([]HunyuanMessage{{
+			Role:    model.MessageRoleSystem,
+			Content: strings.Join(systemParts, "\n\n"),
+		}}, messages...)
+	}
+	hunyuanReq.Messages = messages
+
+	return hunyuanReq
+}
+
+// doRequest 签名并发送请求，返回响应体
+func (p *TencentProvider) doRequest(ctx context.Context, hunyuanReq *HunyuanChatRequest) (io.ReadCloser, error) {
+	reqBody, err := json.Marshal(hunyuanReq)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("序列化请求失败: %v", err),
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("创建HTTP请求失败: %v", err),
+		}
+	}
+	p.signer.Sign(httpReq, tencentcloud.Action{
+		Service: hunyuanService,
+		Name:    hunyuanActionChat,
+		Version: hunyuanVersion,
+		Region:  p.region,
+	}, reqBody, time.Now())
+	httpReq.Header.Set("User-Agent", "ai-svc/1.0")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, &APIError{
+			Code:    ErrorCodeNetworkError,
+			Message: fmt.Sprintf("发送请求失败: %v", err),
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{
+			Code:    mapHTTPStatusErrorCode(resp.StatusCode),
+			Message: fmt.Sprintf("HTTP错误 %d: %s", resp.StatusCode, string(body)),
+		}
+	}
+
+	// 流式请求出错时返回的是普通 JSON
+	if hunyuanReq.Stream && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		defer resp.Body.Close()
+		var errResp HunyuanResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			return nil, &APIError{
+				Code:    ErrorCodeProviderError,
+				Message: fmt.Sprintf("解析响应失败: %v", err),
+			}
+		}
+		if errResp.Response.Error != nil {
+			return nil, newHunyuanAPIError(errResp.Response.Error)
+		}
+		return nil, &APIError{
+			Code:    ErrorCodeProviderError,
+			Message: "流式请求返回了非流式响应",
+		}
+	}
+
+	return resp.Body, nil
+}
+
+// handleStreamResponse 处理流式响应
+func (p *TencentProvider) handleStreamResponse(
+	ctx context.Context,
+	modelName string,
+	body io.ReadCloser,
+	ch chan<- *ChatStreamResponse,
+) {
+	defer close(ch)
+	defer body.Close()
+
+	first := true
+	var id string
+	var created int64
+	var usage model.TokenUsage
+
+	err := readSSE(body, func(event *sseEvent) bool {
+		if event.Data == "" {
+			return true
+		}
+
+		var chunk HunyuanChatResult
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			sendStreamChunk(ctx, ch, &ChatStreamResponse{
+				Error: &APIError{
+					Code:    ErrorCodeProviderError,
+					Message: fmt.Sprintf("解析流式数据失败: %v", err),
+				},
+				Provider: p.GetName(),
+			})
+			return false
+		}
+
+		if chunk.ErrorMsg != nil {
+			sendStreamChunk(ctx, ch, &ChatStreamResponse{
+				Error: &APIError{
+					Code:    ErrorCodeProviderError,
+					Message: chunk.ErrorMsg.Msg,
+					Type:    strconv.FormatInt(chunk.ErrorMsg.Code, 10),
+				},
+				Provider: p.GetName(),
+			})
+			return false
+		}
+
+		id = chunk.ID
+		created = chunk.Created
+		usage = chunk.Usage.toTokenUsage()
+
+		var role, content, reason string
+		var toolCalls []ToolCallDelta
+		if len(chunk.Choices) > 0 {
+			content = chunk.Choices[0].Delta.Content
+			reason = chunk.Choices[0].FinishReason
+			for _, call := range chunk.Choices[0].Delta.ToolCalls {
+				toolCalls = append(toolCalls, ToolCallDelta{
+					Index:    call.Index,
+					ID:       call.ID,
+					Type:     call.Type,
+					Function: ToolCallFunction(call.Function),
+				})
+			}
+		}
+		if first {
+			role = model.MessageRoleAssistant
+			first = false
+		}
+
+		var finishReason *string
+		if reason != "" {
+			mapped := mapHunyuanFinishReason(reason)
+			finishReason = &mapped
+		}
+
+		choice := newStreamChoice(role, content, finishReason)
+		choice.Delta.ToolCalls = toolCalls
+		return sendStreamChunk(ctx, ch, &ChatStreamResponse{
+			ID:       id,
+			Object:   ObjectChatCompletionChunk,
+			Created:  created,
+			Model:    modelName,
+			Choices:  []StreamChoice{choice},
+			Provider: p.GetName(),
+		})
+	})
+
+	if err != nil {
+		sendStreamChunk(ctx, ch, &ChatStreamResponse{
+			Error: &APIError{
+				Code:    ErrorCodeNetworkError,
+				Message: fmt.Sprintf("读取流式数据失败: %v", err),
+			},
+			Provider: p.GetName(),
+		})
+		return
+	}
+
+	sendStreamChunk(ctx, ch, &ChatStreamResponse{
+		ID:       id,
+		Object:   ObjectChatCompletionChunk,
+		Created:  created,
+		Model:    modelName,
+		Usage:    &usage,
+		Done:     true,
+		Provider: p.GetName(),
+	})
+}
+
+// convertToStandardResponse 转换为标准响应
+func (p *TencentProvider) convertToStandardResponse(modelName string, resp *HunyuanChatResult) *ChatResponse {
+	choices := make([]Choice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choices[i] = Choice{
+			Index: i,
+			Message: Message{
+				Role:    model.MessageRoleAssistant,
+				Content: choice.Message.Content,
+			},
+			FinishReason: mapHunyuanFinishReason(choice.FinishReason),
+		}
+		for _, call := range choice.Message.ToolCalls {
+			choices[i].Message.ToolCalls = append(choices[i].Message.ToolCalls, ToolCall{
+				ID:       call.ID,
+				Type:     call.Type,
+				Function: ToolCallFunction(call.Function),
+			})
+		}
+	}
+
+	return &ChatResponse{
+		ID:       resp.ID,
+		Object:   ObjectChatCompletion,
+		Created:  resp.Created,
+		Model:    modelName,
+		Choices:  choices,
+		Usage:    resp.Usage.toTokenUsage(),
+		Provider: p.GetName(),
+	}
+}
+
+// 混元 API 结构体定义
+
+// HunyuanChatRequest 混元对话请求
+type HunyuanChatRequest struct {
+	Model       string           `json:"Model"`
+	Messages    []HunyuanMessage `json:"Messages"`
+	Stream      bool             `json:"Stream"`
+	Temperature *float32         `json:"Temperature,omitempty"`
+	TopP        *float32         `json:"TopP,omitempty"`
+	Tools       []HunyuanTool    `json:"Tools,omitempty"`
+	ToolChoice  string           `json:"ToolChoice,omitempty"` // none, auto, custom
+	CustomTool  *HunyuanTool     `json:"CustomTool,omitempty"` // ToolChoice 为 custom 时强制调用的工具
+}
+
+// HunyuanMessage 混元消息
+type HunyuanMessage struct {
+	Role       string            `json:"Role"`
+	Content    string            `json:"Content"`
+	ToolCalls  []HunyuanToolCall `json:"ToolCalls,omitempty"`
+	ToolCallID string            `json:"ToolCallId,omitempty"`
+
+	// Contents 多模态内容，与 Content 二选一
+	Contents []HunyuanContent `json:"Contents,omitempty"`
+}
+
+// MarshalJSON 使用 Contents 时不发送 Content
+func (m HunyuanMessage) MarshalJSON() ([]byte, error) {
+	type alias HunyuanMessage
+	if len(m.Contents) == 0 {
+		return json.Marshal(alias(m))
+	}
+	return json.Marshal(struct {
+		alias
+		Content string `json:"Content,omitempty"`
+	}{alias: alias(m)})
+}
+
+// HunyuanContent 混元多模态内容片段
+type HunyuanContent struct {
+	Type     string           `json:"Type"` // text, image_url
+	Text     string           `json:"Text,omitempty"`
+	ImageURL *HunyuanImageURL `json:"ImageUrl,omitempty"`
+}
+
+// HunyuanImageURL 混元图片地址，支持 http(s) 链接和 base64 data URL
+type HunyuanImageURL struct {
+	URL string `json:"Url"`
+}
+
+// HunyuanTool 混元工具定义
+type HunyuanTool struct {
+	Type     string              `json:"Type"`
+	Function HunyuanToolFunction `json:"Function"`
+}
+
+// HunyuanToolFunction 混元函数定义，参数定义为 JSON 字符串
+type HunyuanToolFunction struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description,omitempty"`
+	Parameters  string `json:"Parameters"`
+}
+
+// HunyuanToolCall 混元工具调用，流式增量中通过 Index 区分不同的调用
+type HunyuanToolCall struct {
+	Index    int                 `json:"Index,omitempty"`
+	ID       string              `json:"Id,omitempty"`
+	Type     string              `json:"Type,omitempty"`
+	Function HunyuanFunctionCall `json:"Function"`
+}
+
+// HunyuanFunctionCall 混元函数调用
+type HunyuanFunctionCall struct {
+	Name      string `json:"Name,omitempty"`
+	Arguments string `json:"Arguments"`
+}
+
+// HunyuanResponse 腾讯云 API 3.0 响应包装
+type HunyuanResponse struct {
+	Response struct {
+		HunyuanChatResult
+		Error     *HunyuanError `json:"Error,omitempty"`
+		RequestID string        `json:"RequestId"`
+	} `json:"Response"`
+}
+
+// HunyuanChatResult 混元对话结果（非流式响应的 Response 内容与流式数据块共用）
+type HunyuanChatResult struct {
+	ID       string              `json:"Id"`
+	Created  int64               `json:"Created"`
+	Note     string              `json:"Note,omitempty"`
+	Choices  []HunyuanChoice     `json:"Choices"`
+	Usage    HunyuanUsage        `json:"Usage"`
+	ErrorMsg *HunyuanStreamError `json:"ErrorMsg,omitempty"`
+}
+
+// HunyuanChoice 混元选择
+type HunyuanChoice struct {
+	FinishReason string         `json:"FinishReason"`
+	Message      HunyuanMessage `json:"Message"`
+	Delta        HunyuanMessage `json:"Delta"`
+}
+
+// HunyuanUsage 混元使用量
+type HunyuanUsage struct {
+	PromptTokens     int `json:"PromptTokens"`
+	CompletionTokens int `json:"CompletionTokens"`
+	TotalTokens      int `json:"TotalTokens"`
+}
+
+// toTokenUsage 转换为标准使用量
+func (u HunyuanUsage) toTokenUsage() model.TokenUsage {
+	return model.TokenUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
+
+// HunyuanError 腾讯云 API 错误
+type HunyuanError struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+}
+
+// HunyuanStreamError 流式过程中返回的错误
+type HunyuanStreamError struct {
+	Code int64  `json:"Code"`
+	Msg  string `json:"Msg"`
+}
+
+// 辅助函数
+
+// convertToHunyuanContents 转换多模态内容
+func convertToHunyuanContents(parts []ContentPart) []HunyuanContent {
+	contents := make([]HunyuanContent, 0, len(parts))
+	for _, part := range parts {
+		switch {
+		case part.Type == ContentPartText && part.Text != "":
+			contents = append(contents, HunyuanContent{Type: ContentPartText, Text: part.Text})
+		case part.Type == ContentPartImage && part.ImageURL != nil:
+			contents = append(contents, HunyuanContent{
+				Type:     ContentPartImage,
+				ImageURL: &HunyuanImageURL{URL: part.ImageURL.URL},
+			})
+		}
+	}
+	return contents
+}
+
+// convertToHunyuanTools 转换工具定义
+func convertToHunyuanTools(tools []ToolDefinition) []HunyuanTool {
+	hunyuanTools := make([]HunyuanTool, len(tools))
+	for i, tool := range tools {
+		parameters := string(tool.Function.Parameters)
+		if parameters == "" {
+			parameters = `{"type":"object","properties":{}}`
+		}
+		hunyuanTools[i] = HunyuanTool{
+			Type: ToolTypeFunction,
+			Function: HunyuanToolFunction{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  parameters,
+			},
+		}
+	}
+	return hunyuanTools
+}
+
+// convertToHunyuanToolChoice 转换工具选择策略
+// 混元只支持 none、auto 和 custom，required 在只有一个工具时等同于指定该工具，否则按 auto 处理.
+func convertToHunyuanToolChoice(choice *ToolChoice, tools []HunyuanTool) (string, *HunyuanTool) {
+	if choice == nil {
+		return "", nil
+	}
+
+	name := ""
+	switch {
+	case choice.Type == ToolChoiceNone:
+		return "none", nil
+	case choice.Type == ToolChoiceFunction:
+		name = choice.Function
+	case choice.Type == ToolChoiceRequired && len(tools) == 1:
+		name = tools[0].Function.Name
+	default:
+		return "auto", nil
+	}
+
+	for i := range tools {
+		if tools[i].Function.Name == name {
+			return "custom", &tools[i]
+		}
+	}
+	return "auto", nil
+}
+
+// newHunyuanAPIError 根据腾讯云错误码创建 API 错误
+func newHunyuanAPIError(e *HunyuanError) *APIError {
+	return &APIError{
+		Code:    mapHunyuanErrorCode(e.Code),
+		Message: e.Message,
+		Type:    e.Code,
+	}
+}
+
+// mapHunyuanErrorCode 映射腾讯云错误代码
+func mapHunyuanErrorCode(code string) string {
+	switch {
+	case strings.HasPrefix(code, "AuthFailure"), code == "UnauthorizedOperation":
+		return ErrorCodeAuthenticationError
+	case strings.HasPrefix(code, "RequestLimitExceeded"), code == "LimitExceeded":
+		return ErrorCodeRateLimitExceeded
+	case strings.HasPrefix(code, "ResourceInsufficient"),
+		code == "FailedOperation.ResourcePackExhausted",
+		code == "FailedOperation.ServiceStop",
+		code == "FailedOperation.ServiceStopArrears":
+		return ErrorCodeQuotaExceeded
+	case code == "InvalidParameterValue.Model":
+		return ErrorCodeInvalidModel
+	case strings.HasPrefix(code, "InvalidParameter"),
+		strings.HasPrefix(code, "MissingParameter"),
+		strings.HasPrefix(code, "UnknownParameter"),
+		strings.HasPrefix(code, "UnsupportedOperation"):
+		return ErrorCodeInvalidRequest
+	default:
+		return ErrorCodeProviderError
+	}
+}
+
+// mapHunyuanFinishReason 映射混元完成原因
+func mapHunyuanFinishReason(reason string) string {
+	switch reason {
+	case "length":
+		return FinishReasonLength
+	case "sensitive":
+		return FinishReasonContentFilter
+	case "tool_calls":
+		return FinishReasonToolCalls
+	default:
+		return FinishReasonStop
+	}
+}
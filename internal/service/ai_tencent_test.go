@@ -0,0 +1,177 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTencentProvider(baseURL string) *TencentProvider {
+	return NewTencentProvider(config.ProviderConfig{
+		Enabled:   true,
+		BaseURL:   baseURL,
+		SecretID:  "AKIDtest",
+		SecretKey: "secret",
+		Region:    "ap-beijing",
+		Models:    []config.ModelConfig{{Name: "hunyuan-lite", MaxTokens: 4096}},
+	})
+}
+
+func TestTencentProviderChatStream(t *testing.T) {
+	events := []string{
+		`data: {"Id":"hy-1","Created":1700000000,"Choices":[{"Delta":{"Role":"assistant","Content":"你"},` +
+			`"FinishReason":""}],"Usage":{"PromptTokens":6,"CompletionTokens":1,"TotalTokens":7}}`,
+		`data: {"Id":"hy-1","Created":1700000000,"Choices":[{"Delta":{"Role":"assistant","Content":"好"},` +
+			`"FinishReason":"stop"}],"Usage":{"PromptTokens":6,"CompletionTokens":2,"TotalTokens":8}}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "ChatCompletions", r.Header.Get("X-TC-Action"))
+		assert.Equal(t, "2023-09-01", r.Header.Get("X-TC-Version"))
+		assert.Equal(t, "ap-beijing", r.Header.Get("X-TC-Region"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"TC3-HMAC-SHA256 Credential=AKIDtest/"))
+
+		var req HunyuanChatRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		require.Len(t, req.Messages, 2)
+		assert.Equal(t, "system", req.Messages[0].Role)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, strings.Join(events, "\n\n")+"\n\n")
+	}))
+	defer server.Close()
+
+	provider := newTestTencentProvider(server.URL)
+	stream, err := provider.ChatStream(context.Background(), NewStreamChatRequest("hunyuan-lite", []Message{
+		{Role: "system", Content: "你是一个助手"},
+		{Role: "user", Content: "你好"},
+	}))
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var last *ChatStreamResponse
+	for chunk := range stream {
+		require.Nil(t, chunk.Error)
+		content.WriteString(chunk.GetContent())
+		last = chunk
+	}
+
+	assert.Equal(t, "你好", content.String())
+	require.NotNil(t, last)
+	assert.True(t, last.Done)
+	require.NotNil(t, last.Usage)
+	assert.Equal(t, 8, last.Usage.TotalTokens)
+}
+
+func TestTencentProviderErrorMapping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure",`+
+			`"Message":"The provided credentials could not be validated."},"RequestId":"req-1"}}`)
+	}))
+	defer server.Close()
+
+	provider := newTestTencentProvider(server.URL)
+	_, err := provider.Chat(context.Background(), NewChatRequest(
+		"hunyuan-lite",
+		[]Message{{Role: "user", Content: "你好"}},
+	))
+	require.Error(t, err)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorCodeAuthenticationError, apiErr.Code)
+	assert.Equal(t, "AuthFailure.SignatureFailure", apiErr.Type)
+}
+
+func TestTencentProviderStreamToolCalls(t *testing.T) {
+	events := []string{
+		`data: {"Id":"hy-2","Created":1700000000,"Choices":[{"Delta":{"Role":"assistant","Content":"",` +
+			`"ToolCalls":[{"Index":0,"Id":"call_3","Type":"function","Function":{"Name":"get_weather",` +
+			`"Arguments":"{\"city\":"}}]},"FinishReason":""}]}`,
+		`data: {"Id":"hy-2","Created":1700000000,"Choices":[{"Delta":{"Role":"assistant","Content":"",` +
+			`"ToolCalls":[{"Index":0,"Function":{"Arguments":"\"深圳\"}"}}]},"FinishReason":"tool_calls"}],` +
+			`"Usage":{"PromptTokens":20,"CompletionTokens":6,"TotalTokens":26}}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req HunyuanChatRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Tools, 1)
+		assert.JSONEq(t, `{"type":"object","properties":{"city":{"type":"string"}}}`, req.Tools[0].Function.Parameters)
+		assert.Equal(t, "auto", req.ToolChoice)
+		require.Len(t, req.Messages, 3)
+		require.Len(t, req.Messages[1].ToolCalls, 1)
+		assert.Equal(t, "call_1", req.Messages[2].ToolCallID)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, strings.Join(events, "\n\n")+"\n\n")
+	}))
+	defer server.Close()
+
+	provider := newTestTencentProvider(server.URL)
+	req := newToolTestRequest("hunyuan-lite")
+	req.Stream = true
+	stream, err := provider.ChatStream(context.Background(), req)
+	require.NoError(t, err)
+
+	var calls []ToolCall
+	var finishReason string
+	for chunk := range stream {
+		require.Nil(t, chunk.Error)
+		for _, choice := range chunk.Choices {
+			calls = appendToolCallDeltas(calls, choice.Delta.ToolCalls)
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+
+	assert.Equal(t, FinishReasonToolCalls, finishReason)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "call_3", calls[0].ID)
+	assert.JSONEq(t, `{"city":"深圳"}`, calls[0].Function.Arguments)
+}
+
+func TestTencentProviderImageContents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []map[string]json.RawMessage `json:"Messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Len(t, req.Messages, 2)
+
+		// 使用 Contents 时不能同时携带 Content
+		user := req.Messages[1]
+		assert.NotContains(t, user, "Content")
+		var contents []HunyuanContent
+		require.NoError(t, json.Unmarshal(user["Contents"], &contents))
+		assert.Equal(t, []HunyuanContent{
+			{Type: "text", Text: "这是什么"},
+			{Type: "image_url", ImageURL: &HunyuanImageURL{URL: testPNGDataURL()}},
+			{Type: "image_url", ImageURL: &HunyuanImageURL{URL: "https://example.com/cat.jpg"}},
+		}, contents)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"Response":{"Id":"hy-3","Created":1700000000,"Choices":[{"FinishReason":"stop",`+
+			`"Message":{"Role":"assistant","Content":"一只猫"}}],`+
+			`"Usage":{"PromptTokens":900,"CompletionTokens":3,"TotalTokens":903}}}`)
+	}))
+	defer server.Close()
+
+	provider := newTestTencentProvider(server.URL)
+	resp, err := provider.Chat(context.Background(), newImageTestRequest("hunyuan-vision"))
+	require.NoError(t, err)
+	assert.Equal(t, "一只猫", resp.GetLastAssistantMessage())
+}
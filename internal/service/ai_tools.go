@@ -0,0 +1,381 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/pkg/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultToolMaxIterations 未配置时一次对话最多执行的工具调用轮数
+	defaultToolMaxIterations = 5
+
+	// defaultToolTimeout 未配置时单次工具执行的超时时间
+	defaultToolTimeout = 10 * time.Second
+
+	// toolResultMaxRunes 工具结果的最大长度，超出部分截断，避免撑爆上下文
+	toolResultMaxRunes = 4000
+)
+
+// 内置工具名称
+const (
+	ToolNameUnreadMessageCount = "get_unread_message_count"
+	ToolNameUserDevices        = "list_user_devices"
+)
+
+// emptyToolParameters 无参数工具的 JSON Schema
+var emptyToolParameters = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// Tool 服务端工具
+// 模型请求调用工具时由服务端执行，工具只能访问调用者本人的数据.
+type Tool interface {
+	// Definition 提供给模型的工具定义
+	Definition() ToolDefinition
+
+	// Execute 以调用者身份执行工具，arguments 为模型生成的 JSON 参数，返回值序列化后作为结果提供给模型
+	Execute(ctx context.Context, userID uint, arguments json.RawMessage) (interface{}, error)
+}
+
+// functionTool 基于函数的工具
+type functionTool struct {
+	definition ToolDefinition
+	execute    func(ctx context.Context, userID uint, arguments json.RawMessage) (interface{}, error)
+}
+
+// NewFunctionTool 使用函数创建工具，parameters 为空时表示没有参数
+func NewFunctionTool(
+	name, description string,
+	parameters json.RawMessage,
+	execute func(ctx context.Context, userID uint, arguments json.RawMessage) (interface{}, error),
+) Tool {
+	if len(parameters) == 0 {
+		parameters = emptyToolParameters
+	}
+	return &functionTool{
+		definition: ToolDefinition{
+			Type: ToolTypeFunction,
+			Function: ToolFunction{
+				Name:        name,
+				Description: description,
+				Parameters:  parameters,
+			},
+		},
+		execute: execute,
+	}
+}
+
+// Definition 提供给模型的工具定义
+func (t *functionTool) Definition() ToolDefinition {
+	return t.definition
+}
+
+// Execute 执行工具
+func (t *functionTool) Execute(ctx context.Context, userID uint, arguments json.RawMessage) (interface{}, error) {
+	return t.execute(ctx, userID, arguments)
+}
+
+// ToolRegistry 服务端工具注册表
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+// NewToolRegistry 创建工具注册表
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools: make(map[string]Tool),
+	}
+}
+
+// NewBuiltinToolRegistry 创建包含内置工具的注册表，未启用工具调用时返回 nil
+func NewBuiltinToolRegistry(
+	cfg config.ToolsConfig,
+	messageService MessageService,
+	deviceService DeviceService,
+) *ToolRegistry {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	registry := NewToolRegistry()
+	for _, tool := range builtinTools(messageService, deviceService) {
+		if err := registry.Register(tool); err != nil {
+			logger.Error("注册内置工具失败", map[string]any{
+				"tool":  tool.Definition().Function.Name,
+				"error": err.Error(),
+			})
+		}
+	}
+	return registry
+}
+
+// Register 注册工具，名称不合法或已存在时返回错误
+func (r *ToolRegistry) Register(tool Tool) error {
+	definition := tool.Definition()
+	if err := (&ChatRequest{Tools: []ToolDefinition{definition}}).ValidateTools(); err != nil {
+		return err
+	}
+	name := definition.Function.Name
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[name]; exists {
+		return fmt.Errorf("工具已注册: %s", name)
+	}
+	r.tools[name] = tool
+	return nil
+}
+
+// Get 按名称获取工具
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tool, exists := r.tools[name]
+	return tool, exists
+}
+
+// Definitions 获取所有工具定义，按名称排序以保证请求稳定
+func (r *ToolRegistry) Definitions() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	definitions := make([]ToolDefinition, 0, len(names))
+	for _, name := range names {
+		definitions = append(definitions, r.tools[name].Definition())
+	}
+	return definitions
+}
+
+// builtinTools 内置工具：查询当前用户的未读消息数和登录设备
+func builtinTools(messageService MessageService, deviceService DeviceService) []Tool {
+	return []Tool{
+		NewFunctionTool(
+			ToolNameUnreadMessageCount,
+			"获取当前用户的未读站内消息数量",
+			nil,
+			func(ctx context.Context, userID uint, arguments json.RawMessage) (interface{}, error) {
+				return messageService.GetUnreadCount(userID)
+			},
+		),
+		NewFunctionTool(
+			ToolNameUserDevices,
+			"列出当前用户已登录的设备，包括设备类型、名称、在线状态和最近活跃时间",
+			nil,
+			func(ctx context.Context, userID uint, arguments json.RawMessage) (interface{}, error) {
+				devices, err := deviceService.GetUserDevices(userID, callerDevice(ctx))
+				if err != nil {
+					return nil, err
+				}
+				return newDeviceToolResult(devices), nil
+			},
+		),
+	}
+}
+
+// deviceToolResult list_user_devices 的结果
+// 结果会发送给第三方模型并保存为对话消息，不包含设备 ID（认证凭证）和 IP 地址.
+type deviceToolResult struct {
+	Devices []deviceToolItem `json:"devices"`
+}
+
+// deviceToolItem 提供给模型的设备信息
+type deviceToolItem struct {
+	DeviceType   string    `json:"device_type"`
+	DeviceName   string    `json:"device_name"`
+	OSVersion    string    `json:"os_version"`
+	IsOnline     bool      `json:"is_online"`
+	IsCurrent    bool      `json:"is_current"`
+	LastActiveAt time.Time `json:"last_active_at"`
+}
+
+// newDeviceToolResult 从设备列表中提取提供给模型的字段
+func newDeviceToolResult(devices *model.DeviceListResponse) *deviceToolResult {
+	result := &deviceToolResult{Devices: make([]deviceToolItem, 0, len(devices.Devices))}
+	for _, device := range devices.Devices {
+		result.Devices = append(result.Devices, deviceToolItem{
+			DeviceType:   device.DeviceType,
+			DeviceName:   device.DeviceName,
+			OSVersion:    device.OSVersion,
+			IsOnline:     device.IsOnline,
+			IsCurrent:    device.IsCurrent,
+			LastActiveAt: device.LastActiveAt,
+		})
+	}
+	return result
+}
+
+// callerDeviceKey 上下文中调用者设备 ID 的键
+type callerDeviceKey struct{}
+
+// WithCallerDevice 在上下文中记录调用者登录的设备 ID，工具据此识别当前设备
+func WithCallerDevice(ctx context.Context, deviceID string) context.Context {
+	return context.WithValue(ctx, callerDeviceKey{}, deviceID)
+}
+
+// callerDevice 获取上下文中调用者的设备 ID，未记录时返回空
+func callerDevice(ctx context.Context) string {
+	deviceID, _ := ctx.Value(callerDeviceKey{}).(string)
+	return deviceID
+}
+
+// pendingToolCalls 获取需要在服务端执行的工具调用
+// 未启用工具、请求已禁止调用工具或模型没有以 tool_calls 结束时返回空.
+func (s *aiService) pendingToolCalls(req *ChatRequest, finishReason string, calls []ToolCall) []ToolCall {
+	if s.tools == nil || !req.toolsEnabled() || finishReason != FinishReasonToolCalls {
+		return nil
+	}
+	return ensureToolCallIDs(calls)
+}
+
+// runToolCalls 执行模型请求的工具调用，保存每个结果，并把本轮调用和结果追加到请求中
+// iteration 为已执行的轮数，达到上限后要求模型不再调用工具、直接回答.
+func (s *aiService) runToolCalls(
+	ctx context.Context,
+	conversation *model.AIConversation,
+	target *chatTarget,
+	req *ChatRequest,
+	content string,
+	calls []ToolCall,
+	iteration int,
+) error {
+	req.Messages = append(req.Messages, Message{
+		Role:      model.MessageRoleAssistant,
+		Content:   content,
+		ToolCalls: calls,
+	})
+
+	for _, call := range calls {
+		start := time.Now()
+		result, err := s.executeToolCall(ctx, conversation.UserID, call)
+
+		message := conversation.AddMessage(model.MessageRoleTool, result)
+		message.Status = model.MessageStatusReceived
+		message.Provider = target.providerName
+		message.Model = target.model.Name
+		message.ResponseTime = int(time.Since(start).Milliseconds())
+		metadata := map[string]interface{}{
+			"tool_call_id": call.ID,
+			"tool_name":    call.Function.Name,
+			"iteration":    iteration,
+		}
+		if err != nil {
+			message.Status = model.MessageStatusError
+			metadata["error"] = err.Error()
+		}
+		message.Metadata = encodeMetadata(metadata)
+
+		if err := s.repo.CreateMessage(message); err != nil {
+			logger.Error("保存工具调用结果失败", map[string]any{
+				"conversation_id": conversation.ID,
+				"tool":            call.Function.Name,
+				"error":           err.Error(),
+			})
+			return errors.New("保存工具调用结果失败")
+		}
+		conversation.SetCurrentMessage(message.ID)
+		conversation.UpdateStats(model.TokenUsage{}, 0)
+
+		req.Messages = append(req.Messages, Message{
+			Role:       model.MessageRoleTool,
+			Content:    result,
+			ToolCallID: call.ID,
+		})
+	}
+
+	if iteration >= s.maxToolIterations() {
+		req.ToolChoice = &ToolChoice{Type: ToolChoiceNone}
+	}
+	return checkTokenBudget(req, target.model)
+}
+
+// executeToolCall 以调用者身份执行一次工具调用，返回提供给模型的结果
+// 工具不存在或执行失败时把错误作为结果返回，由模型决定如何回答.
+func (s *aiService) executeToolCall(ctx context.Context, userID uint, call ToolCall) (string, error) {
+	tool, exists := s.tools.Get(call.Function.Name)
+	if !exists {
+		err := fmt.Errorf("工具不存在: %s", call.Function.Name)
+		return toolErrorResult(err), err
+	}
+
+	arguments := json.RawMessage(call.Function.Arguments)
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	if !json.Valid(arguments) {
+		err := fmt.Errorf("工具参数不是合法的 JSON: %s", call.Function.Name)
+		return toolErrorResult(err), err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.toolTimeout())
+	defer cancel()
+
+	output, err := tool.Execute(ctx, userID, arguments)
+	if err != nil {
+		logger.Warn("工具执行失败", map[string]any{
+			"user_id": userID,
+			"tool":    call.Function.Name,
+			"error":   err.Error(),
+		})
+		return toolErrorResult(err), err
+	}
+
+	data, err := json.Marshal(output)
+	if err != nil {
+		return toolErrorResult(err), err
+	}
+	return truncateRunes(string(data), toolResultMaxRunes), nil
+}
+
+// maxToolIterations 一次对话最多执行的工具调用轮数
+func (s *aiService) maxToolIterations() int {
+	if limit := s.config.Features.Tools.MaxIterations; limit > 0 {
+		return limit
+	}
+	return defaultToolMaxIterations
+}
+
+// toolTimeout 单次工具执行的超时时间
+func (s *aiService) toolTimeout() time.Duration {
+	if timeout := s.config.Features.Tools.Timeout; timeout > 0 {
+		return timeout
+	}
+	return defaultToolTimeout
+}
+
+// 辅助函数
+
+// ensureToolCallIDs 为缺少 ID 的工具调用生成 ID，工具结果需要通过 ID 对应到调用
+func ensureToolCallIDs(calls []ToolCall) []ToolCall {
+	for i := range calls {
+		if calls[i].ID == "" {
+			calls[i].ID = "call_" + uuid.New().String()
+		}
+		if calls[i].Type == "" {
+			calls[i].Type = ToolTypeFunction
+		}
+	}
+	return calls
+}
+
+// toolErrorResult 工具执行失败时提供给模型的结果
+func toolErrorResult(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
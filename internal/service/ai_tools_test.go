@@ -0,0 +1,179 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMessageService 只实现未读消息数的消息服务
+type fakeMessageService struct {
+	MessageService
+	userIDs []uint
+}
+
+func (s *fakeMessageService) GetUnreadCount(userID uint) (*model.UnreadCountResponse, error) {
+	s.userIDs = append(s.userIDs, userID)
+	return &model.UnreadCountResponse{UnreadCount: 3}, nil
+}
+
+// fakeDeviceService 只实现设备列表的设备服务
+type fakeDeviceService struct {
+	DeviceService
+	userIDs []uint
+}
+
+func (s *fakeDeviceService) GetUserDevices(userID uint, currentDeviceID string) (*model.DeviceListResponse, error) {
+	s.userIDs = append(s.userIDs, userID)
+	return &model.DeviceListResponse{Devices: []model.DeviceResponse{{
+		DeviceID:   "device-secret",
+		DeviceName: "iPhone",
+		ClientIP:   "10.0.0.1",
+		IsCurrent:  currentDeviceID == "device-secret",
+	}}}, nil
+}
+
+// toolsReply 测试提供商收到工具结果后的最终回答
+const toolsReply = "你有 3 条未读消息"
+
+// enableTools 开启内置工具，最多执行两轮工具调用
+func enableTools(messages MessageService) func(s *aiService) {
+	return func(s *aiService) {
+		s.config.Features.Tools = config.ToolsConfig{Enabled: true, MaxIterations: 2}
+		s.tools = NewBuiltinToolRegistry(s.config.Features.Tools, messages, &fakeDeviceService{})
+	}
+}
+
+func TestSendMessageRunsToolLoop(t *testing.T) {
+	provider := &fakeProvider{replies: []string{toolsReply}}
+	messages := &fakeMessageService{}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableTools(messages))
+	s.usage = newUsageAggregator(repo, config.UsageTrackingConfig{Enabled: true})
+
+	reply, err := s.SendMessage(context.Background(), 7, "", "我有几条未读消息", nil)
+	require.NoError(t, err)
+	assert.Equal(t, toolsReply, reply.Content)
+
+	// 两次模型调用只计一次请求，消息数包括用户消息、工具调用、工具结果和最终回答
+	s.usage.Flush()
+	require.Len(t, repo.usageStats, 1)
+	assert.Equal(t, 1, repo.usageStats[0].RequestCount)
+	assert.Equal(t, 4, repo.usageStats[0].MessageCount)
+	assert.Equal(t, 30, repo.usageStats[0].TotalTokens)
+
+	// 工具以调用者身份执行
+	assert.Equal(t, []uint{7}, messages.userIDs)
+
+	// 每一步都保存为对话消息
+	assert.Equal(t, []string{"user", "assistant", "tool", "assistant"}, messageRoles(repo.messages))
+	step, result := repo.messages[1], repo.messages[2]
+	assert.Equal(t, FinishReasonToolCalls, step.FinishReason)
+	assert.Equal(t, 15, step.TotalTokens)
+	assert.JSONEq(t, `{"unread_count":3}`, result.Content)
+
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(result.Metadata), &metadata))
+	assert.Equal(t, ToolNameUnreadMessageCount, metadata["tool_name"])
+	callID := metadata["tool_call_id"].(string)
+	assert.NotEmpty(t, callID)
+
+	// 第二次请求携带工具调用和结果
+	require.Len(t, provider.requests, 2)
+	sent := provider.requests[1].Messages
+	require.GreaterOrEqual(t, len(sent), 3)
+	assert.Equal(t, callID, sent[len(sent)-2].ToolCalls[0].ID)
+	assert.Equal(t, model.MessageRoleTool, sent[len(sent)-1].Role)
+	assert.Equal(t, callID, sent[len(sent)-1].ToolCallID)
+}
+
+func TestSendMessageStopsToolLoopAtIterationCap(t *testing.T) {
+	provider := &fakeProvider{replies: []string{toolsReply}, alwaysCall: true}
+	messages := &fakeMessageService{}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableTools(messages))
+
+	reply, err := s.SendMessage(context.Background(), 7, "", "我有几条未读消息", nil)
+	require.NoError(t, err)
+	assert.Equal(t, toolsReply, reply.Content)
+
+	// 两轮工具调用后要求模型直接回答
+	require.Len(t, provider.requests, 3)
+	assert.Equal(t, &ToolChoice{Type: ToolChoiceNone}, provider.requests[2].ToolChoice)
+	assert.Len(t, messages.userIDs, 2)
+	roles := []string{"user", "assistant", "tool", "assistant", "tool", "assistant"}
+	assert.Equal(t, roles, messageRoles(repo.messages))
+}
+
+func TestSendMessageStreamRunsToolLoop(t *testing.T) {
+	provider := &fakeProvider{replies: []string{toolsReply}}
+	messages := &fakeMessageService{}
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": provider}, enableTools(messages))
+
+	stream, err := s.SendMessageStream(context.Background(), 7, "", "我有几条未读消息", nil)
+	require.NoError(t, err)
+
+	var content strings.Builder
+	var done *ChatStreamResponse
+	for event := range stream.Events {
+		chunk := event.Chunk
+		require.Nil(t, chunk.Error)
+		content.WriteString(chunk.GetContent())
+		if chunk.Done {
+			done = chunk
+		}
+	}
+
+	assert.Equal(t, toolsReply, content.String())
+	require.NotNil(t, done)
+	assert.Equal(t, 30, done.Usage.TotalTokens)
+	assert.Equal(t, []uint{7}, messages.userIDs)
+
+	require.Equal(t, []string{"user", "assistant", "tool", "assistant"}, messageRoles(repo.messages))
+	assert.Equal(t, FinishReasonToolCalls, repo.messages[1].FinishReason)
+	sent := provider.requests[1].Messages
+	assert.Equal(t, "call_stream", sent[len(sent)-1].ToolCallID)
+}
+
+func TestBuiltinToolRegistry(t *testing.T) {
+	assert.Nil(t, NewBuiltinToolRegistry(config.ToolsConfig{}, &fakeMessageService{}, &fakeDeviceService{}))
+
+	devices := &fakeDeviceService{}
+	registry := NewBuiltinToolRegistry(config.ToolsConfig{Enabled: true}, &fakeMessageService{}, devices)
+	require.NotNil(t, registry)
+
+	var names []string
+	for _, definition := range registry.Definitions() {
+		names = append(names, definition.Function.Name)
+	}
+	assert.Equal(t, []string{ToolNameUnreadMessageCount, ToolNameUserDevices}, names)
+
+	// 重复注册和名称不合法时拒绝
+	assert.Error(t, registry.Register(NewFunctionTool(ToolNameUserDevices, "", nil, nil)))
+	assert.Error(t, registry.Register(NewFunctionTool("list devices", "", nil, nil)))
+
+	s := &aiService{config: &config.AIConfig{}, tools: registry}
+	ctx := WithCallerDevice(context.Background(), "device-secret")
+	result, err := s.executeToolCall(ctx, 9, ToolCall{
+		ID:       "call_1",
+		Function: ToolCallFunction{Name: ToolNameUserDevices},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, result, "iPhone")
+	assert.Contains(t, result, `"is_current":true`)
+	// 设备 ID 和 IP 不提供给模型
+	assert.NotContains(t, result, "device-secret")
+	assert.NotContains(t, result, "10.0.0.1")
+	assert.Equal(t, []uint{9}, devices.userIDs)
+
+	result, err = s.executeToolCall(context.Background(), 9, ToolCall{
+		ID:       "call_2",
+		Function: ToolCallFunction{Name: "unknown_tool", Arguments: "{}"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, result, "error")
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"ai-svc/internal/repository"
+	"ai-svc/pkg/logger"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultUsageFlushInterval 未配置时每日统计的写入间隔
+	defaultUsageFlushInterval = 5 * time.Second
+
+	// defaultUsageBatchSize 未配置时触发立即写入的待写入条数
+	defaultUsageBatchSize = 100
+
+	// usageDateLayout 统计日期格式
+	usageDateLayout = "2006-01-02"
+)
+
+// usageKey 每日统计的维度
+type usageKey struct {
+	userID   uint
+	provider string
+	model    string
+	date     string
+}
+
+// UsageAggregator 每日使用统计汇总器
+// 每次对话的用量先在内存中按用户、提供商、模型和日期汇总，由后台协程批量写入数据库，
+// 记录用量只需持有一次锁，不会等待数据库.
+type UsageAggregator struct {
+	repo      repository.AIRepository
+	interval  time.Duration
+	batchSize int
+	now       func() time.Time
+
+	mu      sync.Mutex
+	pending map[usageKey]*model.AIUsageStats
+
+	flush     chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewUsageAggregator 创建每日使用统计汇总器并启动后台写入，未启用使用统计时返回 nil
+func NewUsageAggregator(repo repository.AIRepository, cfg config.UsageTrackingConfig) *UsageAggregator {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	a := newUsageAggregator(repo, cfg)
+	go a.run()
+	return a
+}
+
+// newUsageAggregator 创建汇总器，未配置的参数使用默认值
+func newUsageAggregator(repo repository.AIRepository, cfg config.UsageTrackingConfig) *UsageAggregator {
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = defaultUsageFlushInterval
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultUsageBatchSize
+	}
+
+	return &UsageAggregator{
+		repo:      repo,
+		interval:  interval,
+		batchSize: batchSize,
+		now:       time.Now,
+		pending:   make(map[usageKey]*model.AIUsageStats),
+		flush:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// Record 记录一次模型调用的用量，message 为本次调用保存的助手回复
+// requests 和 messages 为计入的请求数和消息数：一次请求多次调用模型时只有第一次计入请求，
+// 没有计入请求的调用不参与平均响应时间；回复状态为 error 时计一次错误.
+func (a *UsageAggregator) Record(userID uint, message *model.AIMessage, requests, messages int) {
+	stats := &model.AIUsageStats{
+		UserID:           userID,
+		Provider:         message.Provider,
+		Model:            message.Model,
+		Date:             a.now().Format(usageDateLayout),
+		RequestCount:     requests,
+		MessageCount:     messages,
+		PromptTokens:     message.PromptTokens,
+		CompletionTokens: message.CompletionTokens,
+		TotalTokens:      message.TotalTokens,
+		TotalCost:        message.Cost,
+	}
+	if requests > 0 {
+		stats.AvgResponseTime = message.ResponseTime
+	}
+	if message.Status == model.MessageStatusError {
+		stats.ErrorCount = 1
+	}
+
+	if a.merge(stats) >= a.batchSize {
+		select {
+		case a.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// usageCounts 一次用户请求在使用统计中计入的请求数和消息数
+// 工具调用和修正输出时一次请求会多次调用模型，请求只在第一次记录用量时计入，
+// 消息数为上次记录之后新增的消息，包括用户消息、工具结果、修正要求和本次的回复.
+type usageCounts struct {
+	recorded bool
+	counted  int // 已计入的消息数
+}
+
+// newUsageCounts 创建一次用户请求的计数，existing 为请求之前已有、不再计入的消息数
+func newUsageCounts(existing int) *usageCounts {
+	return &usageCounts{counted: existing}
+}
+
+// next 返回本次记录用量时计入的请求数和消息数，total 为加上本次回复后的消息总数
+func (c *usageCounts) next(total int) (requests, messages int) {
+	if !c.recorded {
+		requests, c.recorded = 1, true
+	}
+	messages, c.counted = total-c.counted, total
+	return requests, messages
+}
+
+// Flush 立即写入当前汇总的统计
+func (a *UsageAggregator) Flush() {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[usageKey]*model.AIUsageStats)
+	a.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	stats := make([]*model.AIUsageStats, 0, len(pending))
+	for _, item := range pending {
+		stats = append(stats, item)
+	}
+	if err := a.repo.UpsertUsageStats(stats); err != nil {
+		logger.Error("写入AI使用统计失败", map[string]any{
+			"count": len(stats),
+			"error": err.Error(),
+		})
+		// 放回待写入队列，下次写入时重试
+		for _, item := range stats {
+			a.merge(item)
+		}
+	}
+}
+
+// Close 停止后台写入并写入剩余的统计，服务关闭时调用
+func (a *UsageAggregator) Close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+		<-a.stopped
+		a.Flush()
+	})
+}
+
+// merge 合并到待写入的统计，返回待写入条数
+func (a *UsageAggregator) merge(stats *model.AIUsageStats) int {
+	key := usageKey{
+		userID:   stats.UserID,
+		provider: stats.Provider,
+		model:    stats.Model,
+		date:     stats.Date,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if existing, exists := a.pending[key]; exists {
+		existing.Merge(stats)
+	} else {
+		a.pending[key] = stats
+	}
+	return len(a.pending)
+}
+
+// run 定时或在待写入条数达到上限时写入统计
+func (a *UsageAggregator) run() {
+	defer close(a.stopped)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.Flush()
+		case <-a.flush:
+			a.Flush()
+		case <-a.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"ai-svc/internal/config"
+	"ai-svc/internal/model"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageAggregatorMergesByDay(t *testing.T) {
+	repo := &fakeAIRepository{}
+	aggregator := newUsageAggregator(repo, config.UsageTrackingConfig{Enabled: true})
+	now := time.Date(2025, 6, 1, 23, 59, 0, 0, time.Local)
+	aggregator.now = func() time.Time { return now }
+
+	aggregator.Record(1, &model.AIMessage{
+		Provider: "openai", Model: "gpt-4", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15,
+		Cost: 0.01, ResponseTime: 100, Status: model.MessageStatusReceived,
+	}, 1, 2)
+	aggregator.Record(1, &model.AIMessage{
+		Provider: "openai", Model: "gpt-4", ResponseTime: 300, Status: model.MessageStatusError,
+	}, 1, 2)
+	now = now.Add(time.Minute)
+	aggregator.Record(1, &model.AIMessage{
+		Provider: "openai", Model: "gpt-4", TotalTokens: 7, ResponseTime: 50, Status: model.MessageStatusReceived,
+	}, 1, 2)
+
+	// 写入前不访问数据库
+	assert.Empty(t, repo.usageStats)
+	aggregator.Flush()
+	require.Len(t, repo.usageStats, 2)
+
+	first := repo.usageStats[0]
+	if first.Date != "2025-06-01" {
+		first = repo.usageStats[1]
+	}
+	assert.Equal(t, "2025-06-01", first.Date)
+	assert.Equal(t, 2, first.RequestCount)
+	assert.Equal(t, 4, first.MessageCount)
+	assert.Equal(t, 15, first.TotalTokens)
+	assert.InDelta(t, 0.01, first.TotalCost, 1e-9)
+	assert.Equal(t, 200, first.AvgResponseTime)
+	assert.Equal(t, 1, first.ErrorCount)
+
+	// 再次写入时在已有记录上累加
+	now = time.Date(2025, 6, 1, 8, 0, 0, 0, time.Local)
+	aggregator.Record(1, &model.AIMessage{
+		Provider: "openai", Model: "gpt-4", TotalTokens: 5, ResponseTime: 500, Status: model.MessageStatusReceived,
+	}, 1, 2)
+	aggregator.Flush()
+	require.Len(t, repo.usageStats, 2)
+	assert.Equal(t, 3, first.RequestCount)
+	assert.Equal(t, 20, first.TotalTokens)
+	assert.Equal(t, 300, first.AvgResponseTime)
+}
+
+func TestUsageAggregatorRetriesFailedWrites(t *testing.T) {
+	repo := &fakeAIRepository{usageErr: errors.New("db down")}
+	aggregator := newUsageAggregator(repo, config.UsageTrackingConfig{Enabled: true})
+
+	aggregator.Record(1, &model.AIMessage{Provider: "openai", Model: "gpt-4", TotalTokens: 10}, 1, 2)
+	aggregator.Flush()
+	assert.Empty(t, repo.usageStats)
+
+	repo.usageErr = nil
+	aggregator.Record(1, &model.AIMessage{Provider: "openai", Model: "gpt-4", TotalTokens: 5}, 1, 2)
+	aggregator.Flush()
+	require.Len(t, repo.usageStats, 1)
+	assert.Equal(t, 2, repo.usageStats[0].RequestCount)
+	assert.Equal(t, 15, repo.usageStats[0].TotalTokens)
+}
+
+func TestUsageAggregatorFlushesOnClose(t *testing.T) {
+	repo := &fakeAIRepository{}
+	aggregator := NewUsageAggregator(repo, config.UsageTrackingConfig{Enabled: true, FlushInterval: time.Hour})
+	require.NotNil(t, aggregator)
+
+	aggregator.Record(1, &model.AIMessage{Provider: "openai", Model: "gpt-4", TotalTokens: 10}, 1, 2)
+	aggregator.Close()
+	require.Len(t, repo.usageStats, 1)
+	assert.Equal(t, 10, repo.usageStats[0].TotalTokens)
+
+	assert.Nil(t, NewUsageAggregator(repo, config.UsageTrackingConfig{}))
+}
+
+func TestSendMessageRecordsUsage(t *testing.T) {
+	s, repo := newTestService(t, map[string]*fakeProvider{"primary": {}})
+	s.usage = newUsageAggregator(repo, config.UsageTrackingConfig{Enabled: true})
+
+	_, err := s.SendMessage(context.Background(), 7, "", "你好", nil)
+	require.NoError(t, err)
+
+	s.usage.Flush()
+	require.Len(t, repo.usageStats, 1)
+	assert.Equal(t, uint(7), repo.usageStats[0].UserID)
+	assert.Equal(t, "primary", repo.usageStats[0].Provider)
+	assert.Equal(t, 1, repo.usageStats[0].RequestCount)
+	assert.Equal(t, 2, repo.usageStats[0].MessageCount)
+}
+
+func TestUsageAggregatorIgnoresFollowUpResponseTime(t *testing.T) {
+	repo := &fakeAIRepository{}
+	aggregator := newUsageAggregator(repo, config.UsageTrackingConfig{Enabled: true})
+
+	aggregator.Record(1, &model.AIMessage{Provider: "openai", Model: "gpt-4", TotalTokens: 10, ResponseTime: 100}, 1, 2)
+	aggregator.Record(1, &model.AIMessage{Provider: "openai", Model: "gpt-4", TotalTokens: 5, ResponseTime: 900}, 0, 2)
+	aggregator.Flush()
+
+	require.Len(t, repo.usageStats, 1)
+	assert.Equal(t, 1, repo.usageStats[0].RequestCount)
+	assert.Equal(t, 4, repo.usageStats[0].MessageCount)
+	assert.Equal(t, 15, repo.usageStats[0].TotalTokens)
+	assert.Equal(t, 100, repo.usageStats[0].AvgResponseTime)
+}
+
+func TestUsageCounts(t *testing.T) {
+	// 对话已有 4 条消息，本次请求保存了用户消息
+	counts := newUsageCounts(4)
+
+	requests, messages := counts.next(6)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 2, messages)
+
+	// 工具结果和之后的回复
+	requests, messages = counts.next(8)
+	assert.Equal(t, 0, requests)
+	assert.Equal(t, 2, messages)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"ai-svc/internal/model"
+	"ai-svc/internal/repository"
+	"ai-svc/pkg/logger"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// APIKeyPrefix API 密钥的固定前缀，用于区分 API 密钥和 JWT
+	APIKeyPrefix = "sk-"
+
+	// apiKeyRandomBytes API 密钥的随机字节数
+	apiKeyRandomBytes = 24
+
+	// apiKeyDisplayLength 保存用于识别密钥的前缀长度
+	apiKeyDisplayLength = 10
+
+	// maxAPIKeysPerUser 每个用户可用密钥的数量上限
+	maxAPIKeysPerUser = 20
+)
+
+// ErrInvalidAPIKey API 密钥无效、已吊销或已过期
+var ErrInvalidAPIKey = errors.New("API密钥无效或已失效")
+
+// APIKeyService API 密钥服务接口
+type APIKeyService interface {
+	// Issue 签发密钥，返回的明文密钥只在签发时可见
+	Issue(userID uint, name string, expiresAt *time.Time) (string, *model.APIKey, error)
+	List(userID uint) ([]*model.APIKey, error)
+	Revoke(userID, id uint) error
+
+	// Authenticate 校验密钥，返回密钥所属的用户ID
+	Authenticate(key string) (uint, error)
+}
+
+// apiKeyService API 密钥服务实现
+type apiKeyService struct {
+	repo repository.APIKeyRepository
+}
+
+// NewAPIKeyService 创建 API 密钥服务实例
+func NewAPIKeyService(repo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{repo: repo}
+}
+
+// Issue 签发密钥
+func (s *apiKeyService) Issue(userID uint, name string, expiresAt *time.Time) (string, *model.APIKey, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, errors.New("过期时间必须晚于当前时间")
+	}
+
+	keys, err := s.repo.ListByUser(userID)
+	if err != nil {
+		return "", nil, errors.New("查询API密钥失败")
+	}
+	active := 0
+	for _, key := range keys {
+		if key.IsActive() {
+			active++
+		}
+	}
+	if active >= maxAPIKeysPerUser {
+		return "", nil, errors.New("可用的API密钥数量已达上限")
+	}
+
+	random := make([]byte, apiKeyRandomBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, errors.New("生成API密钥失败")
+	}
+	plain := APIKeyPrefix + hex.EncodeToString(random)
+
+	key := &model.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:apiKeyDisplayLength],
+		Hash:      hashAPIKey(plain),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(key); err != nil {
+		logger.Error("保存API密钥失败", map[string]any{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+		return "", nil, errors.New("保存API密钥失败")
+	}
+	return plain, key, nil
+}
+
+// List 获取用户的密钥列表
+func (s *apiKeyService) List(userID uint) ([]*model.APIKey, error) {
+	return s.repo.ListByUser(userID)
+}
+
+// Revoke 吊销密钥
+func (s *apiKeyService) Revoke(userID, id uint) error {
+	revoked, err := s.repo.Revoke(userID, id)
+	if err != nil {
+		return errors.New("吊销API密钥失败")
+	}
+	if !revoked {
+		return errors.New("API密钥不存在或已吊销")
+	}
+	return nil
+}
+
+// Authenticate 校验密钥
+func (s *apiKeyService) Authenticate(plain string) (uint, error) {
+	if !strings.HasPrefix(plain, APIKeyPrefix) {
+		return 0, ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.GetByHash(hashAPIKey(plain))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Error("查询API密钥失败", map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return 0, ErrInvalidAPIKey
+	}
+	if !key.IsActive() {
+		return 0, ErrInvalidAPIKey
+	}
+
+	// 异步更新最后使用时间，避免影响请求
+	go func() {
+		if err := s.repo.UpdateLastUsed(key.ID, time.Now()); err != nil {
+			logger.Error("更新API密钥使用时间失败", map[string]any{
+				"key_id": key.ID,
+				"error":  err.Error(),
+			})
+		}
+	}()
+
+	return key.UserID, nil
+}
+
+// hashAPIKey 计算密钥摘要
+func hashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"ai-svc/internal/model"
+	"ai-svc/pkg/logger"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeAPIKeyRepository 内存实现的 API 密钥仓储
+type fakeAPIKeyRepository struct {
+	mu   sync.Mutex
+	keys []*model.APIKey
+}
+
+func (r *fakeAPIKeyRepository) Create(key *model.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key.ID = uint(len(r.keys) + 1)
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) GetByHash(hash string) (*model.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range r.keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeAPIKeyRepository) ListByUser(userID uint) ([]*model.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []*model.APIKey
+	for _, key := range r.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeAPIKeyRepository) Revoke(userID, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range r.keys {
+		if key.ID == id && key.UserID == userID && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeAPIKeyRepository) UpdateLastUsed(id uint, usedAt time.Time) error { return nil }
+
+func TestAPIKeyIssueAndAuthenticate(t *testing.T) {
+	require.NoError(t, logger.Init("error", "text", "stdout"))
+	repo := &fakeAPIKeyRepository{}
+	s := NewAPIKeyService(repo)
+
+	plain, key, err := s.Issue(3, "ci", nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plain, APIKeyPrefix))
+	assert.NotContains(t, key.Hash, plain)
+	assert.Equal(t, plain[:len(key.Prefix)], key.Prefix)
+
+	userID, err := s.Authenticate(plain)
+	require.NoError(t, err)
+	assert.Equal(t, uint(3), userID)
+
+	_, err = s.Authenticate(plain + "x")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// 其他用户不能吊销
+	assert.Error(t, s.Revoke(4, key.ID))
+	require.NoError(t, s.Revoke(3, key.ID))
+	_, err = s.Authenticate(plain)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestAPIKeyRejectsExpiredKey(t *testing.T) {
+	require.NoError(t, logger.Init("error", "text", "stdout"))
+	repo := &fakeAPIKeyRepository{}
+	s := NewAPIKeyService(repo)
+
+	past := time.Now().Add(-time.Hour)
+	_, _, err := s.Issue(1, "expired", &past)
+	assert.Error(t, err)
+
+	future := time.Now().Add(time.Hour)
+	plain, key, err := s.Issue(1, "short", &future)
+	require.NoError(t, err)
+	key.ExpiresAt = &past
+	_, err = s.Authenticate(plain)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
@@ -0,0 +1,127 @@
+// Package cache 提供带过期时间的键值缓存，默认使用进程内 LRU，也可以使用 Redis 兼容的存储.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Store 缓存存储接口
+type Store interface {
+	// Get 读取缓存，不存在或已过期时 found 为 false
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+
+	// Set 写入缓存，ttl<=0 表示不过期
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete 删除缓存
+	Delete(ctx context.Context, key string) error
+
+	// Close 释放连接等资源
+	Close() error
+}
+
+// lruEntry LRU 缓存项
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time // 零值表示不过期
+}
+
+// LRU 进程内 LRU 缓存，超出容量时淘汰最久未使用的项
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // 头部为最近使用
+	now      func() time.Time
+}
+
+// NewLRU 创建 LRU 缓存
+func NewLRU(capacity int) *LRU {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRU{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get 读取缓存，命中的项移到最近使用
+func (c *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.items[key]
+	if !exists {
+		return nil, false, nil
+	}
+
+	entry := element.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Set 写入缓存，超出容量时淘汰最久未使用的项
+func (c *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	if element, exists := c.items[key]; exists {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Delete 删除缓存
+func (c *LRU) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.items[key]; exists {
+		c.remove(element)
+	}
+	return nil
+}
+
+// Len 当前缓存项数量（含未清理的过期项）
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Close LRU 没有需要释放的资源
+func (c *LRU) Close() error {
+	return nil
+}
+
+// remove 移除缓存项，调用方需持有锁
+func (c *LRU) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*lruEntry).key)
+}
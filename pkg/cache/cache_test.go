@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), 0))
+	require.NoError(t, c.Set(ctx, "b", []byte("2"), 0))
+	_, found, _ := c.Get(ctx, "a")
+	assert.True(t, found)
+
+	// b 最久未使用，被淘汰
+	require.NoError(t, c.Set(ctx, "c", []byte("3"), 0))
+	_, found, _ = c.Get(ctx, "b")
+	assert.False(t, found)
+
+	value, found, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, 2, c.Len())
+
+	require.NoError(t, c.Delete(ctx, "a"))
+	_, found, _ = c.Get(ctx, "a")
+	assert.False(t, found)
+}
+
+func TestLRUExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.Set(ctx, "key", []byte("value"), time.Minute))
+	_, found, _ := c.Get(ctx, "key")
+	assert.True(t, found)
+
+	now = now.Add(time.Minute)
+	_, found, _ = c.Get(ctx, "key")
+	assert.False(t, found)
+	assert.Equal(t, 0, c.Len())
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore 基于 Redis 协议的缓存，兼容 Redis、KeyDB、Dragonfly 等服务
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore 创建 Redis 缓存，所有键自动加上 prefix 前缀
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Get 读取缓存
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set 写入缓存
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+// Delete 删除缓存
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+// Close 关闭连接
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
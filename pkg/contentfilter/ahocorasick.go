@@ -0,0 +1,125 @@
+package contentfilter
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// acNode Aho-Corasick 自动机节点
+type acNode struct {
+	next    map[rune]int
+	fail    int
+	outputs []int // 在此节点结束的关键词（含失败链上的）
+}
+
+// automaton 多关键词匹配自动机，按字符匹配且不区分大小写
+type automaton struct {
+	nodes    []acNode
+	keywords []string
+	lengths  []int // 关键词的字符数
+	maxRunes int   // 最长关键词的字符数
+}
+
+// newAutomaton 构建自动机，空关键词和重复关键词被忽略
+func newAutomaton(keywords []string) *automaton {
+	a := &automaton{nodes: []acNode{{next: map[rune]int{}}}}
+
+	seen := make(map[string]bool)
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword == "" || seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+		a.insert(keyword)
+	}
+	a.buildFailLinks()
+	return a
+}
+
+// insert 将关键词加入字典树
+func (a *automaton) insert(keyword string) {
+	node := 0
+	for _, r := range keyword {
+		child, exists := a.nodes[node].next[r]
+		if !exists {
+			child = len(a.nodes)
+			a.nodes = append(a.nodes, acNode{next: map[rune]int{}})
+			a.nodes[node].next[r] = child
+		}
+		node = child
+	}
+
+	index := len(a.keywords)
+	a.keywords = append(a.keywords, keyword)
+	a.lengths = append(a.lengths, utf8.RuneCountInString(keyword))
+	a.nodes[node].outputs = append(a.nodes[node].outputs, index)
+	a.maxRunes = max(a.maxRunes, a.lengths[index])
+}
+
+// buildFailLinks 按广度优先构建失败指针，并把失败链上的输出合并到节点
+func (a *automaton) buildFailLinks() {
+	queue := make([]int, 0, len(a.nodes))
+	for _, child := range a.nodes[0].next {
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for r, child := range a.nodes[node].next {
+			fail := a.nodes[node].fail
+			for fail > 0 && !a.hasNext(fail, r) {
+				fail = a.nodes[fail].fail
+			}
+			if next, exists := a.nodes[fail].next[r]; exists {
+				a.nodes[child].fail = next
+			}
+			a.nodes[child].outputs = append(a.nodes[child].outputs, a.nodes[a.nodes[child].fail].outputs...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+func (a *automaton) hasNext(node int, r rune) bool {
+	_, exists := a.nodes[node].next[r]
+	return exists
+}
+
+// find 查找文本中所有关键词出现的位置（允许重叠），按结束位置排序
+func (a *automaton) find(text string) []Match {
+	if len(a.keywords) == 0 {
+		return nil
+	}
+
+	var matches []Match
+	var offsets []int // 每个字符的起始字节偏移
+	node := 0
+	for offset := 0; offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		offsets = append(offsets, offset)
+		end := offset + size
+		r = unicode.ToLower(r)
+
+		for node > 0 && !a.hasNext(node, r) {
+			node = a.nodes[node].fail
+		}
+		if next, exists := a.nodes[node].next[r]; exists {
+			node = next
+		}
+
+		for _, index := range a.nodes[node].outputs {
+			start := offsets[len(offsets)-a.lengths[index]]
+			matches = append(matches, Match{
+				Start: start,
+				End:   end,
+				Text:  text[start:end],
+				Rule:  a.keywords[index],
+			})
+		}
+		offset = end
+	}
+	return matches
+}
@@ -0,0 +1,83 @@
+package contentfilter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// patternPrefix 规则文件中正则表达式行的前缀
+const patternPrefix = "re:"
+
+// LoadRulesFile 读取规则文件
+// 每行一条规则，空行和 # 开头的行被忽略，re: 开头的行为正则表达式，其余为关键词.
+func LoadRulesFile(path string) (Rules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Rules{}, fmt.Errorf("打开规则文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var rules Rules
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if pattern, ok := strings.CutPrefix(line, patternPrefix); ok {
+			rules.Patterns = append(rules.Patterns, strings.TrimSpace(pattern))
+			continue
+		}
+		rules.Keywords = append(rules.Keywords, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return Rules{}, fmt.Errorf("读取规则文件失败: %w", err)
+	}
+	return rules, nil
+}
+
+// WatchFile 定期检查规则文件，修改时间变化后重新加载，与 base 合并后替换规则
+// 阻塞直到 ctx 结束；每次加载（包括失败）都会回调 onReload.
+func (f *Filter) WatchFile(
+	ctx context.Context,
+	path string,
+	base Rules,
+	interval time.Duration,
+	onReload func(rules Rules, err error),
+) {
+	// 启动前的文件已由调用方加载
+	var lastModified time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastModified = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(lastModified) {
+			continue
+		}
+		lastModified = info.ModTime()
+
+		rules, err := LoadRulesFile(path)
+		if err == nil {
+			rules = base.Merge(rules)
+			err = f.Update(rules)
+		}
+		if onReload != nil {
+			onReload(rules, err)
+		}
+	}
+}
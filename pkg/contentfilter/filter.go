@@ -0,0 +1,268 @@
+// Package contentfilter 提供基于 Aho-Corasick 关键词匹配和正则表达式的内容过滤，
+// 支持拦截、打码、标记三种处理方式，以及流式文本的跨分片过滤.
+package contentfilter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Action 命中规则后的处理方式
+type Action string
+
+// 处理方式常量
+const (
+	ActionBlock Action = "block" // 拦截：不再输出命中位置及之后的内容
+	ActionMask  Action = "mask"  // 打码：将命中的内容替换为 *
+	ActionFlag  Action = "flag"  // 标记：内容原样输出，仅记录命中
+)
+
+const (
+	// patternWindow 流式过滤时为正则规则保留的字符数，跨分片且不超过该长度的匹配都能被发现
+	patternWindow = 32
+
+	// maskRune 打码使用的字符
+	maskRune = '*'
+)
+
+// Rules 过滤规则
+type Rules struct {
+	Keywords []string // 关键词，不区分大小写
+	Patterns []string // 正则表达式
+}
+
+// Merge 合并两组规则
+func (r Rules) Merge(other Rules) Rules {
+	return Rules{
+		Keywords: append(append([]string{}, r.Keywords...), other.Keywords...),
+		Patterns: append(append([]string{}, r.Patterns...), other.Patterns...),
+	}
+}
+
+// Match 一次命中
+type Match struct {
+	Start int    `json:"-"`    // 起始字节偏移
+	End   int    `json:"-"`    // 结束字节偏移（不含）
+	Text  string `json:"text"` // 命中的原文
+	Rule  string `json:"rule"` // 命中的关键词或正则表达式
+}
+
+// Result 过滤结果
+type Result struct {
+	Text    string  // 处理后的文本：拦截时为命中位置之前的内容，打码时为打码后的内容
+	Matches []Match // 命中列表
+	Action  Action  // 执行的处理方式，未命中时为空
+}
+
+// Blocked 是否被拦截
+func (r Result) Blocked() bool {
+	return r.Action == ActionBlock
+}
+
+// ruleSet 编译后的规则，更新时整体替换
+type ruleSet struct {
+	keywords *automaton
+	patterns []*regexp.Regexp
+	window   int // 流式过滤需要保留的最大字符数
+}
+
+// Filter 内容过滤器，规则可在运行时并发安全地替换
+type Filter struct {
+	action Action
+	rules  atomic.Pointer[ruleSet]
+}
+
+// New 创建过滤器，action 为空时默认拦截
+func New(action Action, rules Rules) (*Filter, error) {
+	switch action {
+	case "":
+		action = ActionBlock
+	case ActionBlock, ActionMask, ActionFlag:
+	default:
+		return nil, fmt.Errorf("不支持的过滤动作: %s", action)
+	}
+
+	filter := &Filter{action: action}
+	if err := filter.Update(rules); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Update 编译并替换规则，编译失败时保留原规则
+func (f *Filter) Update(rules Rules) error {
+	compiled := &ruleSet{keywords: newAutomaton(rules.Keywords)}
+	for _, pattern := range rules.Patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("正则表达式无效 %q: %w", pattern, err)
+		}
+		compiled.patterns = append(compiled.patterns, re)
+	}
+
+	compiled.window = compiled.keywords.maxRunes
+	if len(compiled.patterns) > 0 {
+		compiled.window = max(compiled.window, patternWindow)
+	}
+
+	f.rules.Store(compiled)
+	return nil
+}
+
+// Action 命中后的处理方式
+func (f *Filter) Action() Action {
+	return f.action
+}
+
+// Check 过滤一段完整文本
+func (f *Filter) Check(text string) Result {
+	stream := f.NewStream()
+	stream.pending = text
+	return stream.Flush()
+}
+
+// find 查找所有命中，按起始位置排序
+func (r *ruleSet) find(text string) []Match {
+	matches := r.keywords.find(text)
+	for _, re := range r.patterns {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			matches = append(matches, Match{
+				Start: loc[0],
+				End:   loc[1],
+				Text:  text[loc[0]:loc[1]],
+				Rule:  re.String(),
+			})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+	return matches
+}
+
+// Stream 流式文本过滤器
+// 每次写入后只输出确定不会与后续分片组成命中的部分，末尾最多保留 window-1 个字符等待后续分片.
+type Stream struct {
+	filter  *Filter
+	pending string
+	blocked bool
+	matches []Match
+}
+
+// NewStream 创建流式过滤器，每个流单独使用
+func (f *Filter) NewStream() *Stream {
+	return &Stream{filter: f}
+}
+
+// Write 写入一个分片，返回可以输出的内容；被拦截后不再输出任何内容
+func (s *Stream) Write(delta string) Result {
+	if s.blocked {
+		return Result{Action: ActionBlock}
+	}
+	s.pending += delta
+	return s.emit(false)
+}
+
+// Flush 输出剩余的全部内容，流结束时调用
+func (s *Stream) Flush() Result {
+	if s.blocked {
+		return Result{Action: ActionBlock}
+	}
+	return s.emit(true)
+}
+
+// Matches 目前为止的全部命中
+func (s *Stream) Matches() []Match {
+	return s.matches
+}
+
+// Blocked 是否已被拦截
+func (s *Stream) Blocked() bool {
+	return s.blocked
+}
+
+// emit 计算可以输出的位置，并对输出部分执行处理
+func (s *Stream) emit(final bool) Result {
+	rules := s.filter.rules.Load()
+	matches := rules.find(s.pending)
+
+	cut := len(s.pending)
+	if !final {
+		cut = holdBack(s.pending, rules.window-1)
+		// 跨越输出位置的命中整体留到下次输出
+		for moved := true; moved; {
+			moved = false
+			for _, match := range matches {
+				if match.Start < cut && match.End > cut {
+					cut = match.Start
+					moved = true
+				}
+			}
+		}
+	}
+
+	var emitted []Match
+	for _, match := range matches {
+		if match.End <= cut {
+			emitted = append(emitted, match)
+		}
+	}
+
+	text := s.pending[:cut]
+	s.pending = s.pending[cut:]
+	if len(emitted) == 0 {
+		return Result{Text: text}
+	}
+
+	s.matches = append(s.matches, emitted...)
+	result := Result{Text: text, Matches: emitted, Action: s.filter.action}
+	switch s.filter.action {
+	case ActionBlock:
+		s.blocked = true
+		s.pending = ""
+		result.Text = text[:emitted[0].Start]
+	case ActionMask:
+		result.Text = mask(text, emitted)
+	}
+	return result
+}
+
+// holdBack 返回保留末尾 runes 个字符时的输出位置
+func holdBack(text string, runes int) int {
+	cut := len(text)
+	for i := 0; i < runes && cut > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:cut])
+		cut -= size
+	}
+	return cut
+}
+
+// mask 将命中的字符替换为打码字符
+func mask(text string, matches []Match) string {
+	var builder strings.Builder
+	builder.Grow(len(text))
+
+	covered := 0
+	for _, match := range matches {
+		if match.End <= covered {
+			continue
+		}
+		start := max(match.Start, covered)
+		builder.WriteString(text[covered:start])
+		builder.WriteString(strings.Repeat(string(maskRune), utf8.RuneCountInString(text[start:match.End])))
+		covered = match.End
+	}
+	builder.WriteString(text[covered:])
+	return builder.String()
+}
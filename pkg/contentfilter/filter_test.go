@@ -0,0 +1,137 @@
+package contentfilter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutomatonFindsOverlappingKeywords(t *testing.T) {
+	a := newAutomaton([]string{"he", "she", "his", "hers", "敏感词"})
+
+	var rules []string
+	for _, match := range a.find("uSHErs 含有敏感词") {
+		rules = append(rules, match.Rule)
+		assert.Equal(t, strings.ToLower(match.Text), match.Rule)
+	}
+	assert.Equal(t, []string{"she", "he", "hers", "敏感词"}, rules)
+}
+
+func TestCheckActions(t *testing.T) {
+	rules := Rules{Keywords: []string{"敏感词"}, Patterns: []string{`1[3-9]\d{9}`}}
+
+	blocker, err := New(ActionBlock, rules)
+	require.NoError(t, err)
+	result := blocker.Check("前文敏感词后文")
+	assert.True(t, result.Blocked())
+	assert.Equal(t, "前文", result.Text)
+
+	masker, err := New(ActionMask, rules)
+	require.NoError(t, err)
+	result = masker.Check("电话13800138000，敏感词")
+	assert.Equal(t, ActionMask, result.Action)
+	assert.Equal(t, "电话***********，***", result.Text)
+	require.Len(t, result.Matches, 2)
+
+	flagger, err := New(ActionFlag, rules)
+	require.NoError(t, err)
+	result = flagger.Check("敏感词")
+	assert.Equal(t, ActionFlag, result.Action)
+	assert.Equal(t, "敏感词", result.Text)
+
+	result = flagger.Check("正常内容")
+	assert.Empty(t, result.Action)
+	assert.Empty(t, result.Matches)
+
+	_, err = New("drop", rules)
+	assert.Error(t, err)
+	_, err = New(ActionBlock, Rules{Patterns: []string{"("}})
+	assert.Error(t, err)
+}
+
+func TestStreamAcrossChunks(t *testing.T) {
+	masker, err := New(ActionMask, Rules{Keywords: []string{"敏感词"}})
+	require.NoError(t, err)
+
+	stream := masker.NewStream()
+	var output strings.Builder
+	for _, delta := range []string{"这是", "敏", "感", "词吗", "？"} {
+		output.WriteString(stream.Write(delta).Text)
+	}
+	output.WriteString(stream.Flush().Text)
+
+	assert.Equal(t, "这是***吗？", output.String())
+	assert.Len(t, stream.Matches(), 1)
+}
+
+func TestStreamBlockStopsOutput(t *testing.T) {
+	blocker, err := New(ActionBlock, Rules{Keywords: []string{"secret"}})
+	require.NoError(t, err)
+
+	stream := blocker.NewStream()
+	var output strings.Builder
+	blocked := false
+	for _, delta := range []string{"the ", "sec", "ret is", " out"} {
+		result := stream.Write(delta)
+		output.WriteString(result.Text)
+		if result.Blocked() {
+			blocked = true
+			break
+		}
+	}
+
+	assert.True(t, blocked)
+	assert.True(t, stream.Blocked())
+	assert.Equal(t, "the ", output.String())
+	assert.Empty(t, stream.Flush().Text)
+}
+
+func TestWatchFileReloadsRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# 注释\n旧词\n"), 0o600))
+
+	loaded, err := LoadRulesFile(path)
+	require.NoError(t, err)
+	base := Rules{Keywords: []string{"配置词"}}
+	filter, err := New(ActionFlag, base.Merge(loaded))
+	require.NoError(t, err)
+	assert.NotEmpty(t, filter.Check("旧词").Matches)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan error, 1)
+	go filter.WatchFile(ctx, path, base, 10*time.Millisecond, func(_ Rules, err error) {
+		select {
+		case reloaded <- err:
+		default:
+		}
+	})
+
+	require.NoError(t, os.WriteFile(path, []byte("新词\nre:\\d{6}\n"), 0o600))
+
+	// 监听协程可能在写入之后才记录初始修改时间，持续更新修改时间直到触发重新加载
+	deadline := time.After(time.Second)
+	for done := false; !done; {
+		modified := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(path, modified, modified))
+		select {
+		case err := <-reloaded:
+			require.NoError(t, err)
+			done = true
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("规则文件未重新加载")
+		}
+	}
+
+	assert.Empty(t, filter.Check("旧词").Matches)
+	assert.NotEmpty(t, filter.Check("新词").Matches)
+	assert.NotEmpty(t, filter.Check("123456").Matches)
+	assert.NotEmpty(t, filter.Check("配置词").Matches)
+}
@@ -0,0 +1,360 @@
+// Package jsonschema 实现 JSON Schema 常用子集的编译和校验，用于检查模型的结构化输出.
+// 支持 type、properties、required、additionalProperties、items、enum、const、字符串长度和 pattern、
+// 数值范围、数组长度、anyOf/oneOf/allOf/not，以及指向 $defs、definitions 的本地 $ref.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Schema 编译后的 JSON Schema
+type Schema struct {
+	root *node
+	defs map[string]*node // 以 $ref 为键的定义
+}
+
+// node 编译后的单个 schema 节点
+type node struct {
+	never bool // false schema，不允许任何值
+
+	ref        string
+	types      []string
+	properties map[string]*node
+	required   []string
+
+	// additionalProperties 为 false 时 noAdditional 为 true；为 schema 时使用 additional
+	noAdditional bool
+	additional   *node
+
+	items *node
+
+	enum     []interface{}
+	hasConst bool
+	constVal interface{}
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+
+	minItems *int
+	maxItems *int
+
+	anyOf []*node
+	oneOf []*node
+	allOf []*node
+	not   *node
+}
+
+// rawSchema schema 的原始结构
+type rawSchema struct {
+	Ref                  string                     `json:"$ref"`
+	Defs                 map[string]json.RawMessage `json:"$defs"`
+	Definitions          map[string]json.RawMessage `json:"definitions"`
+	Type                 json.RawMessage            `json:"type"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Enum                 []json.RawMessage          `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              string                     `json:"pattern"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     json.RawMessage            `json:"exclusiveMinimum"`
+	ExclusiveMaximum     json.RawMessage            `json:"exclusiveMaximum"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	AnyOf                []json.RawMessage          `json:"anyOf"`
+	OneOf                []json.RawMessage          `json:"oneOf"`
+	AllOf                []json.RawMessage          `json:"allOf"`
+	Not                  json.RawMessage            `json:"not"`
+}
+
+// validTypes JSON Schema 支持的类型
+var validTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+// Compile 编译 JSON Schema
+func Compile(data []byte) (*Schema, error) {
+	var raw rawSchema
+	if err := unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("schema 格式错误: %w", err)
+	}
+
+	s := &Schema{defs: make(map[string]*node)}
+	for prefix, defs := range map[string]map[string]json.RawMessage{
+		"#/$defs/":       raw.Defs,
+		"#/definitions/": raw.Definitions,
+	} {
+		for name, def := range defs {
+			compiled, err := compile(def)
+			if err != nil {
+				return nil, fmt.Errorf("定义 %s: %w", name, err)
+			}
+			s.defs[prefix+name] = compiled
+		}
+	}
+
+	root, err := compile(data)
+	if err != nil {
+		return nil, err
+	}
+	s.root = root
+	s.defs["#"] = root
+
+	if err := s.checkRefs(root, make(map[*node]bool)); err != nil {
+		return nil, err
+	}
+	for _, def := range s.defs {
+		if err := s.checkRefs(def, make(map[*node]bool)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// MustCompile 编译 JSON Schema，失败时 panic
+func MustCompile(data []byte) *Schema {
+	s, err := Compile(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// compile 编译单个 schema 节点
+func compile(data []byte) (*node, error) {
+	data = bytes.TrimSpace(data)
+	switch string(data) {
+	case "true":
+		return &node{}, nil
+	case "false":
+		return &node{never: true}, nil
+	}
+
+	var raw rawSchema
+	if err := unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("schema 格式错误: %w", err)
+	}
+
+	n := &node{
+		ref:       raw.Ref,
+		required:  raw.Required,
+		minLength: raw.MinLength,
+		maxLength: raw.MaxLength,
+		minimum:   raw.Minimum,
+		maximum:   raw.Maximum,
+		minItems:  raw.MinItems,
+		maxItems:  raw.MaxItems,
+	}
+
+	var err error
+	if n.types, err = compileTypes(raw.Type); err != nil {
+		return nil, err
+	}
+
+	if len(raw.Properties) > 0 {
+		n.properties = make(map[string]*node, len(raw.Properties))
+		for name, property := range raw.Properties {
+			if n.properties[name], err = compile(property); err != nil {
+				return nil, fmt.Errorf("属性 %s: %w", name, err)
+			}
+		}
+	}
+
+	if len(raw.AdditionalProperties) > 0 {
+		additional, err := compile(raw.AdditionalProperties)
+		if err != nil {
+			return nil, fmt.Errorf("additionalProperties: %w", err)
+		}
+		if additional.never {
+			n.noAdditional = true
+		} else {
+			n.additional = additional
+		}
+	}
+
+	if len(raw.Items) > 0 {
+		if n.items, err = compile(raw.Items); err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+	}
+
+	for _, item := range raw.Enum {
+		value, err := decode(item)
+		if err != nil {
+			return nil, fmt.Errorf("enum: %w", err)
+		}
+		n.enum = append(n.enum, value)
+	}
+	if len(raw.Const) > 0 {
+		if n.constVal, err = decode(raw.Const); err != nil {
+			return nil, fmt.Errorf("const: %w", err)
+		}
+		n.hasConst = true
+	}
+
+	if raw.Pattern != "" {
+		if n.pattern, err = regexp.Compile(raw.Pattern); err != nil {
+			return nil, fmt.Errorf("pattern 无效 %q: %w", raw.Pattern, err)
+		}
+	}
+
+	// draft-04 中 exclusiveMinimum/exclusiveMaximum 是布尔值，表示 minimum/maximum 不含边界
+	if n.exclusiveMinimum, err = compileExclusive(raw.ExclusiveMinimum, &n.minimum); err != nil {
+		return nil, fmt.Errorf("exclusiveMinimum: %w", err)
+	}
+	if n.exclusiveMaximum, err = compileExclusive(raw.ExclusiveMaximum, &n.maximum); err != nil {
+		return nil, fmt.Errorf("exclusiveMaximum: %w", err)
+	}
+
+	if n.anyOf, err = compileList("anyOf", raw.AnyOf); err != nil {
+		return nil, err
+	}
+	if n.oneOf, err = compileList("oneOf", raw.OneOf); err != nil {
+		return nil, err
+	}
+	if n.allOf, err = compileList("allOf", raw.AllOf); err != nil {
+		return nil, err
+	}
+	if len(raw.Not) > 0 {
+		if n.not, err = compile(raw.Not); err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// compileList 编译 anyOf、oneOf、allOf 中的 schema 列表
+func compileList(keyword string, items []json.RawMessage) ([]*node, error) {
+	var nodes []*node
+	for _, item := range items {
+		compiled, err := compile(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyword, err)
+		}
+		nodes = append(nodes, compiled)
+	}
+	return nodes, nil
+}
+
+// compileTypes 解析字符串或字符串数组形式的 type
+func compileTypes(data json.RawMessage) ([]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var types []string
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		types = []string{single}
+	} else if err := json.Unmarshal(data, &types); err != nil {
+		return nil, fmt.Errorf("type 格式错误: %s", data)
+	}
+
+	for _, t := range types {
+		if !validTypes[t] {
+			return nil, fmt.Errorf("不支持的类型: %s", t)
+		}
+	}
+	return types, nil
+}
+
+// compileExclusive 解析数值或布尔形式的排他边界，布尔形式时把对应的闭区间边界转为开区间
+func compileExclusive(data json.RawMessage, bound **float64) (*float64, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var exclusive bool
+	if err := json.Unmarshal(data, &exclusive); err == nil {
+		if !exclusive || *bound == nil {
+			return nil, nil
+		}
+		value := **bound
+		*bound = nil
+		return &value, nil
+	}
+
+	var value float64
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// checkRefs 检查所有 $ref 都能解析
+func (s *Schema) checkRefs(n *node, visited map[*node]bool) error {
+	if n == nil || visited[n] {
+		return nil
+	}
+	visited[n] = true
+
+	if n.ref != "" {
+		if _, exists := s.defs[n.ref]; !exists {
+			return fmt.Errorf("无法解析的 $ref: %s", n.ref)
+		}
+	}
+
+	children := []*node{n.additional, n.items, n.not}
+	for _, property := range n.properties {
+		children = append(children, property)
+	}
+	children = append(children, n.anyOf...)
+	children = append(children, n.oneOf...)
+	children = append(children, n.allOf...)
+	for _, child := range children {
+		if err := s.checkRefs(child, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 辅助函数
+
+// unmarshal 解析 JSON，数字保留为 json.Number，值之后不能有多余的内容
+func unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("JSON 之后存在多余的内容")
+	}
+	return nil
+}
+
+// decode 解析任意 JSON 值
+func decode(data []byte) (interface{}, error) {
+	var value interface{}
+	if err := unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// quote 格式化错误信息中的值
+func quote(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,112 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 10},
+		"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+		"email": {"type": ["string", "null"], "pattern": "^[^@]+@[^@]+$"},
+		"role": {"enum": ["admin", "user"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+		"address": {"$ref": "#/$defs/address"}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"$defs": {
+		"address": {
+			"type": "object",
+			"properties": {"city": {"type": "string"}},
+			"required": ["city"]
+		}
+	}
+}`
+
+func TestValidateJSON(t *testing.T) {
+	schema, err := Compile([]byte(personSchema))
+	require.NoError(t, err)
+
+	assert.NoError(t, schema.ValidateJSON([]byte(`{"name":"张三","age":30,"email":null,"role":"admin",`+
+		`"tags":["a"],"address":{"city":"北京"}}`)))
+	// 1.0 视为整数
+	assert.NoError(t, schema.ValidateJSON([]byte(`{"name":"李四","age":1.0}`)))
+
+	tests := []struct {
+		name    string
+		data    string
+		message string
+	}{
+		{"不是 JSON", `{"name":`, "$: 不是合法的 JSON"},
+		{"多余的内容", `{"name":"张三","age":1} 好的`, "$: 不是合法的 JSON"},
+		{"缺少必需属性", `{"name":"张三"}`, "$: 缺少必需的属性 age"},
+		{"类型错误", `{"name":"张三","age":"30"}`, "$.age: 类型应为 integer，实际为 string"},
+		{"不是整数", `{"name":"张三","age":1.5}`, "$.age: 类型应为 integer，实际为 number"},
+		{"超出范围", `{"name":"张三","age":150}`, "$.age: 必须小于 150"},
+		{"字符串过长", `{"name":"一二三四五六七八九十一","age":1}`, "$.name: 长度不能大于 10"},
+		{"不匹配模式", `{"name":"张三","age":1,"email":"invalid"}`, "$.email: 不匹配模式"},
+		{"不在枚举中", `{"name":"张三","age":1,"role":"root"}`, `$.role: 取值应为 ["admin","user"] 之一`},
+		{"数组元素类型", `{"name":"张三","age":1,"tags":[1]}`, "$.tags[0]: 类型应为 string"},
+		{"数组过长", `{"name":"张三","age":1,"tags":["a","b","c"]}`, "$.tags: 元素个数不能多于 2"},
+		{"不允许的属性", `{"name":"张三","age":1,"extra":true}`, "$.extra: 不允许的属性"},
+		{"引用的定义", `{"name":"张三","age":1,"address":{}}`, "$.address: 缺少必需的属性 city"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.ValidateJSON([]byte(tt.data))
+			require.Error(t, err)
+			errs, ok := err.(Errors)
+			require.True(t, ok)
+			assert.Contains(t, errs.Error(), tt.message)
+		})
+	}
+}
+
+func TestValidateCombinators(t *testing.T) {
+	schema := MustCompile([]byte(`{
+		"anyOf": [{"type": "string"}, {"type": "number", "minimum": 10}],
+		"not": {"const": "forbidden"}
+	}`))
+	assert.NoError(t, schema.ValidateJSON([]byte(`"ok"`)))
+	assert.NoError(t, schema.ValidateJSON([]byte(`12`)))
+	assert.Error(t, schema.ValidateJSON([]byte(`5`)))
+	assert.Error(t, schema.ValidateJSON([]byte(`"forbidden"`)))
+
+	oneOf := MustCompile([]byte(`{"oneOf": [{"type": "integer"}, {"type": "number"}]}`))
+	assert.NoError(t, oneOf.ValidateJSON([]byte(`1.5`)))
+	err := oneOf.ValidateJSON([]byte(`1`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "实际符合 2 个")
+
+	// 递归引用
+	tree := MustCompile([]byte(`{
+		"type": "object",
+		"properties": {"children": {"type": "array", "items": {"$ref": "#"}}},
+		"additionalProperties": false
+	}`))
+	assert.NoError(t, tree.ValidateJSON([]byte(`{"children":[{"children":[]}]}`)))
+	assert.Error(t, tree.ValidateJSON([]byte(`{"children":[{"name":"x"}]}`)))
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`{"type": "date"}`,
+		`{"pattern": "("}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"properties": {"a": {"type": 1}}}`,
+	} {
+		_, err := Compile([]byte(data))
+		assert.Error(t, err, data)
+	}
+
+	// draft-04 的布尔形式 exclusiveMinimum
+	schema := MustCompile([]byte(`{"minimum": 0, "exclusiveMinimum": true}`))
+	assert.Error(t, schema.ValidateJSON([]byte(`0`)))
+	assert.NoError(t, schema.ValidateJSON([]byte(`0.1`)))
+}
@@ -0,0 +1,324 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxErrors 最多报告的校验错误数
+	maxErrors = 20
+
+	// maxDepth schema 嵌套的最大深度，防止循环引用导致栈溢出
+	maxDepth = 64
+)
+
+// ValidationError 单个校验错误
+type ValidationError struct {
+	Path    string // 出错位置，如 $.items[0].name
+	Message string
+}
+
+// Error 实现error接口
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Errors 校验错误列表
+type Errors []ValidationError
+
+// Error 实现error接口
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Messages 获取所有错误信息
+func (e Errors) Messages() []string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return messages
+}
+
+// ValidateJSON 解析并校验 JSON 文本，不是合法 JSON 或不符合 schema 时返回 Errors
+func (s *Schema) ValidateJSON(data []byte) error {
+	value, err := decode(data)
+	if err != nil {
+		return Errors{{Path: "$", Message: fmt.Sprintf("不是合法的 JSON: %v", err)}}
+	}
+	return s.Validate(value)
+}
+
+// Validate 校验已解析的值（数字需为 json.Number 或 float64），不符合 schema 时返回 Errors
+func (s *Schema) Validate(value interface{}) error {
+	v := &validator{schema: s}
+	v.validate(s.root, value, "$", 0)
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// validator 一次校验的状态
+type validator struct {
+	schema *Schema
+	errors Errors
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	if len(v.errors) < maxErrors {
+		v.errors = append(v.errors, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// valid 判断值是否符合子 schema，不记录错误（用于 anyOf、oneOf、not）
+func (v *validator) valid(n *node, value interface{}, depth int) bool {
+	sub := &validator{schema: v.schema}
+	sub.validate(n, value, "$", depth)
+	return len(sub.errors) == 0
+}
+
+func (v *validator) validate(n *node, value interface{}, path string, depth int) {
+	if depth > maxDepth {
+		v.fail(path, "schema 嵌套过深")
+		return
+	}
+	if n.never {
+		v.fail(path, "不允许出现该值")
+		return
+	}
+	if n.ref != "" {
+		v.validate(v.schema.defs[n.ref], value, path, depth+1)
+	}
+
+	if len(n.types) > 0 && !matchesType(n.types, value) {
+		v.fail(path, "类型应为 %s，实际为 %s", strings.Join(n.types, " 或 "), typeOf(value))
+		return
+	}
+	if len(n.enum) > 0 && !containsValue(n.enum, value) {
+		v.fail(path, "取值应为 %s 之一", quote(n.enum))
+	}
+	if n.hasConst && !equal(n.constVal, value) {
+		v.fail(path, "取值应为 %s", quote(n.constVal))
+	}
+
+	switch typed := value.(type) {
+	case string:
+		v.validateString(n, typed, path)
+	case json.Number, float64:
+		v.validateNumber(n, toFloat(typed), path)
+	case []interface{}:
+		v.validateArray(n, typed, path, depth)
+	case map[string]interface{}:
+		v.validateObject(n, typed, path, depth)
+	}
+
+	for _, sub := range n.allOf {
+		v.validate(sub, value, path, depth+1)
+	}
+	if len(n.anyOf) > 0 {
+		matched := false
+		for _, sub := range n.anyOf {
+			if v.valid(sub, value, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "不符合 anyOf 中的任何一个 schema")
+		}
+	}
+	if len(n.oneOf) > 0 {
+		matched := 0
+		for _, sub := range n.oneOf {
+			if v.valid(sub, value, depth+1) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(path, "应恰好符合 oneOf 中的一个 schema，实际符合 %d 个", matched)
+		}
+	}
+	if n.not != nil && v.valid(n.not, value, depth+1) {
+		v.fail(path, "不应符合 not 中的 schema")
+	}
+}
+
+func (v *validator) validateString(n *node, value, path string) {
+	length := utf8.RuneCountInString(value)
+	if n.minLength != nil && length < *n.minLength {
+		v.fail(path, "长度不能小于 %d", *n.minLength)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		v.fail(path, "长度不能大于 %d", *n.maxLength)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(value) {
+		v.fail(path, "不匹配模式 %s", n.pattern.String())
+	}
+}
+
+func (v *validator) validateNumber(n *node, value float64, path string) {
+	if n.minimum != nil && value < *n.minimum {
+		v.fail(path, "不能小于 %v", *n.minimum)
+	}
+	if n.maximum != nil && value > *n.maximum {
+		v.fail(path, "不能大于 %v", *n.maximum)
+	}
+	if n.exclusiveMinimum != nil && value <= *n.exclusiveMinimum {
+		v.fail(path, "必须大于 %v", *n.exclusiveMinimum)
+	}
+	if n.exclusiveMaximum != nil && value >= *n.exclusiveMaximum {
+		v.fail(path, "必须小于 %v", *n.exclusiveMaximum)
+	}
+}
+
+func (v *validator) validateArray(n *node, value []interface{}, path string, depth int) {
+	if n.minItems != nil && len(value) < *n.minItems {
+		v.fail(path, "元素个数不能少于 %d", *n.minItems)
+	}
+	if n.maxItems != nil && len(value) > *n.maxItems {
+		v.fail(path, "元素个数不能多于 %d", *n.maxItems)
+	}
+	if n.items != nil {
+		for i, item := range value {
+			v.validate(n.items, item, fmt.Sprintf("%s[%d]", path, i), depth+1)
+		}
+	}
+}
+
+func (v *validator) validateObject(n *node, value map[string]interface{}, path string, depth int) {
+	for _, name := range n.required {
+		if _, exists := value[name]; !exists {
+			v.fail(path, "缺少必需的属性 %s", name)
+		}
+	}
+
+	// 按名称排序，保证错误顺序稳定
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := path + "." + name
+		if property, exists := n.properties[name]; exists {
+			v.validate(property, value[name], propertyPath, depth+1)
+			continue
+		}
+		if n.noAdditional {
+			v.fail(propertyPath, "不允许的属性")
+		} else if n.additional != nil {
+			v.validate(n.additional, value[name], propertyPath, depth+1)
+		}
+	}
+}
+
+// 辅助函数
+
+// typeOf 获取值的 JSON 类型
+func typeOf(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number, float64:
+		if isInteger(toFloat(typed)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// matchesType 检查值是否属于任一类型，integer 也属于 number
+func matchesType(types []string, value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat 将数字转换为 float64
+func toFloat(value interface{}) float64 {
+	switch typed := value.(type) {
+	case json.Number:
+		f, _ := typed.Float64()
+		return f
+	case float64:
+		return typed
+	}
+	return 0
+}
+
+// isInteger 判断数值是否为整数（1.0 也视为整数）
+func isInteger(value float64) bool {
+	return !math.IsInf(value, 0) && value == math.Trunc(value)
+}
+
+// containsValue 检查值是否在列表中
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, item := range values {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal 按 JSON 语义比较两个值，数字按数值比较
+func equal(a, b interface{}) bool {
+	switch typedA := a.(type) {
+	case json.Number, float64:
+		switch b.(type) {
+		case json.Number, float64:
+			return toFloat(typedA) == toFloat(b)
+		}
+		return false
+	case []interface{}:
+		typedB, ok := b.([]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for i := range typedA {
+			if !equal(typedA[i], typedB[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		typedB, ok := b.(map[string]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for key, item := range typedA {
+			other, exists := typedB[key]
+			if !exists || !equal(item, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,47 @@
+package tencentcloud
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignerAuthorization(t *testing.T) {
+	signer := NewSigner("AKIDtest", "secret")
+	payload := []byte(`{"Model":"hunyuan-lite"}`)
+
+	auth := signer.Authorization("hunyuan.tencentcloudapi.com", "hunyuan", payload, 1700000000)
+
+	assert.Equal(t, "TC3-HMAC-SHA256 Credential=AKIDtest/2023-11-14/hunyuan/tc3_request, "+
+		"SignedHeaders=content-type;host, "+
+		"Signature=261beea8fea23cfac6e12c47fb1dba85a2c4b70c62315cf6574650991c6994bc", auth)
+}
+
+func TestSignerSign(t *testing.T) {
+	signer := &Signer{SecretID: "AKIDtest", SecretKey: "secret", Token: "tmp-token"}
+	payload := []byte(`{"Model":"hunyuan-lite"}`)
+
+	req, err := http.NewRequest(http.MethodPost, "https://hunyuan.tencentcloudapi.com", bytes.NewReader(payload))
+	require.NoError(t, err)
+
+	signer.Sign(req, Action{
+		Service: "hunyuan",
+		Name:    "ChatCompletions",
+		Version: "2023-09-01",
+		Region:  "ap-beijing",
+	}, payload, time.Unix(1700000000, 0))
+
+	assert.Equal(t, ContentTypeJSON, req.Header.Get("Content-Type"))
+	assert.Equal(t, "ChatCompletions", req.Header.Get("X-TC-Action"))
+	assert.Equal(t, "2023-09-01", req.Header.Get("X-TC-Version"))
+	assert.Equal(t, "1700000000", req.Header.Get("X-TC-Timestamp"))
+	assert.Equal(t, "ap-beijing", req.Header.Get("X-TC-Region"))
+	assert.Equal(t, "tmp-token", req.Header.Get("X-TC-Token"))
+	assert.Equal(t,
+		signer.Authorization("hunyuan.tencentcloudapi.com", "hunyuan", payload, 1700000000),
+		req.Header.Get("Authorization"))
+}
@@ -0,0 +1,36 @@
+package tokenizer
+
+import "unicode"
+
+var (
+	// approxTokenizer 通用近似计数：每个中日韩字符约 1 个 token
+	approxTokenizer = &approximate{name: EncodingApprox, cjkRatio: 1}
+
+	// approxCJKTokenizer 国产模型近似计数：词表对中文更友好，每个汉字约 0.6 个 token
+	approxCJKTokenizer = &approximate{name: EncodingApproxCJK, cjkRatio: 0.6}
+)
+
+// approximate 按字符类型估算 token 数
+// 中日韩字符按 cjkRatio 计算，其他字符统一按约 4 个字符 1 个 token 估算.
+type approximate struct {
+	name     string
+	cjkRatio float64
+}
+
+// Name 编码名称
+func (a *approximate) Name() string {
+	return a.name
+}
+
+// Count 估算文本的 token 数
+func (a *approximate) Count(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return int(float64(cjk)*a.cjkRatio+0.5) + (other+3)/4
+}
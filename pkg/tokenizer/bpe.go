@@ -0,0 +1,237 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/heap"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed assets/*.tiktoken.gz
+var assets embed.FS
+
+// maxMergePieceBytes 计数时精确合并的最大片段长度，更长的片段按近似计数
+const maxMergePieceBytes = 4096
+
+// encodingSpec BPE 编码的词表文件和预分词规则
+type encodingSpec struct {
+	file  string
+	split func(text string) []string
+}
+
+var encodingSpecs = map[string]encodingSpec{
+	EncodingCL100K: {file: "assets/cl100k_base.tiktoken.gz", split: splitCL100K},
+	EncodingO200K:  {file: "assets/o200k_base.tiktoken.gz", split: splitO200K},
+}
+
+// lazyEncoding 首次使用时加载的编码
+type lazyEncoding struct {
+	once     sync.Once
+	encoding *BPE
+	err      error
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = map[string]*lazyEncoding{}
+)
+
+// BPE 字节级 BPE 编码器，与 tiktoken 的编码结果一致
+type BPE struct {
+	name  string
+	ranks map[string]int
+	split func(text string) []string
+}
+
+// GetEncoding 获取 BPE 编码器，词表在首次调用时解压加载，之后复用
+func GetEncoding(name string) (*BPE, error) {
+	spec, exists := encodingSpecs[name]
+	if !exists {
+		return nil, fmt.Errorf("不支持的编码: %s", name)
+	}
+
+	encodingsMu.Lock()
+	lazy, exists := encodings[name]
+	if !exists {
+		lazy = &lazyEncoding{}
+		encodings[name] = lazy
+	}
+	encodingsMu.Unlock()
+
+	lazy.once.Do(func() {
+		lazy.encoding, lazy.err = loadEncoding(name, spec)
+	})
+	return lazy.encoding, lazy.err
+}
+
+// loadEncoding 读取内置词表，每行为 base64 编码的 token 和它的合并优先级
+func loadEncoding(name string, spec encodingSpec) (*BPE, error) {
+	file, err := assets.Open(spec.file)
+	if err != nil {
+		return nil, fmt.Errorf("打开词表失败: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("解压词表失败: %w", err)
+	}
+	defer reader.Close()
+
+	encoding := &BPE{
+		name:  name,
+		ranks: make(map[string]int),
+		split: spec.split,
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := strings.Fields(string(line))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("词表格式错误: %q", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("词表格式错误: %w", err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("词表格式错误: %w", err)
+		}
+
+		encoding.ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取词表失败: %w", err)
+	}
+
+	return encoding, nil
+}
+
+// Name 编码名称
+func (e *BPE) Name() string {
+	return e.name
+}
+
+// Encode 将文本编码为 token 序列
+func (e *BPE) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range e.split(text) {
+		if rank, exists := e.ranks[piece]; exists {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, e.bytePairMerge(piece)...)
+	}
+	return tokens
+}
+
+// Count 统计文本的 token 数
+// 超过 maxMergePieceBytes 的片段（如不含空白的长串、base64 数据）按近似计数，避免长文本占用过多 CPU.
+func (e *BPE) Count(text string) int {
+	count := 0
+	for _, piece := range e.split(text) {
+		if _, exists := e.ranks[piece]; exists {
+			count++
+			continue
+		}
+		if len(piece) > maxMergePieceBytes {
+			count += approxTokenizer.Count(piece)
+			continue
+		}
+		count += len(e.bytePairMerge(piece))
+	}
+	return count
+}
+
+// bytePairMerge 从单字节开始，反复合并优先级最高（rank 最小）的相邻片段
+// 片段以链表连接，候选的合并放在按 rank 排序的堆中，合并后失效的候选在取出时跳过，
+// 复杂度为 O(n log n)，与逐轮扫描全部片段的结果一致.
+func (e *BPE) bytePairMerge(piece string) []int {
+	n := len(piece)
+	// next[i] 为从 i 开始的片段之后的片段起点，n 表示末尾
+	next := make([]int, n+1)
+	prev := make([]int, n+1)
+	alive := make([]bool, n+1)
+	for i := range next {
+		next[i], prev[i], alive[i] = i+1, i-1, true
+	}
+
+	candidates := &mergeHeap{}
+	// push 加入 start 与其后一个片段合并的候选
+	push := func(start int) {
+		if start < 0 || next[start] >= n {
+			return
+		}
+		end := next[next[start]]
+		if rank, exists := e.ranks[piece[start:end]]; exists {
+			heap.Push(candidates, mergeCandidate{rank: rank, start: start, end: end})
+		}
+	}
+	for i := 0; i < n-1; i++ {
+		push(i)
+	}
+
+	for candidates.Len() > 0 {
+		candidate := heap.Pop(candidates).(mergeCandidate)
+		start := candidate.start
+		// 参与合并的片段已经变化，候选失效
+		if !alive[start] || next[start] >= n || next[next[start]] != candidate.end {
+			continue
+		}
+
+		right := next[start]
+		alive[right] = false
+		next[start] = next[right]
+		prev[next[right]] = start
+		push(start)
+		push(prev[start])
+	}
+
+	var tokens []int
+	for i := 0; i < n; i = next[i] {
+		tokens = append(tokens, e.ranks[piece[i:next[i]]])
+	}
+	return tokens
+}
+
+// mergeCandidate 一次候选的合并：把 [start, end) 合并为一个片段
+type mergeCandidate struct {
+	rank  int
+	start int
+	end   int
+}
+
+// mergeHeap 按 rank 排序的候选合并，rank 相同时靠前的优先
+type mergeHeap []mergeCandidate
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].start < h[j].start
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x any) { *h = append(*h, x.(mergeCandidate)) }
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,223 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// 预分词：BPE 只在预分词得到的片段内部合并.
+// tiktoken 的分词正则使用了 Go regexp 不支持的否定预查 \s+(?!\S)，这里按正则的匹配顺序和回溯语义手工实现.
+
+// runeText 按字符访问的文本，offsets 记录每个字符的字节偏移
+type runeText struct {
+	text    string
+	runes   []rune
+	offsets []int
+}
+
+func newRuneText(text string) *runeText {
+	t := &runeText{text: text}
+	for offset, r := range text {
+		t.runes = append(t.runes, r)
+		t.offsets = append(t.offsets, offset)
+	}
+	t.offsets = append(t.offsets, len(text))
+	return t
+}
+
+// split 从头开始依次用 match 匹配片段
+func (t *runeText) split(match func(t *runeText, i int) int) []string {
+	pieces := make([]string, 0, len(t.runes)/3+1)
+	for i := 0; i < len(t.runes); {
+		end := match(t, i)
+		pieces = append(pieces, t.text[t.offsets[i]:t.offsets[end]])
+		i = end
+	}
+	return pieces
+}
+
+// splitCL100K cl100k_base 的预分词：
+// (?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitCL100K(text string) []string {
+	if !utf8.ValidString(text) {
+		text = string([]rune(text))
+	}
+	return newRuneText(text).split(matchCL100K)
+}
+
+func matchCL100K(t *runeText, i int) int {
+	r := t.runes
+	if n := t.contraction(i); n > 0 {
+		return i + n
+	}
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	j := i
+	if isPrefixRune(r[i]) && i+1 < len(r) && unicode.IsLetter(r[i+1]) {
+		j++
+	}
+	if unicode.IsLetter(r[j]) {
+		return t.skip(j, unicode.IsLetter)
+	}
+
+	if end := t.matchNumber(i); end > i {
+		return end
+	}
+	if end := t.matchPunct(i, false); end > i {
+		return end
+	}
+	return t.matchSpace(i)
+}
+
+// splitO200K o200k_base 的预分词：
+// [^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?
+// |[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?
+// |\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitO200K(text string) []string {
+	if !utf8.ValidString(text) {
+		text = string([]rune(text))
+	}
+	return newRuneText(text).split(matchO200K)
+}
+
+func matchO200K(t *runeText, i int) int {
+	starts := []int{i}
+	if isPrefixRune(t.runes[i]) && i+1 < len(t.runes) {
+		starts = []int{i + 1, i}
+	}
+
+	for _, word := range []func(p int) int{t.matchLowerWord, t.matchUpperWord} {
+		for _, start := range starts {
+			if end := word(start); end > start {
+				return end + t.contraction(end)
+			}
+		}
+	}
+
+	if end := t.matchNumber(i); end > i {
+		return end
+	}
+	if end := t.matchPunct(i, true); end > i {
+		return end
+	}
+	return t.matchSpace(i)
+}
+
+// matchLowerWord [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+
+// 前半部分贪婪匹配后回溯到最后一个可作为后半部分开头的位置.
+func (t *runeText) matchLowerWord(p int) int {
+	upperEnd := t.skip(p, isUpperRune)
+	for k := upperEnd; k >= p; k-- {
+		if k < len(t.runes) && isLowerRune(t.runes[k]) {
+			return t.skip(k, isLowerRune)
+		}
+	}
+	return p
+}
+
+// matchUpperWord [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*
+func (t *runeText) matchUpperWord(p int) int {
+	upperEnd := t.skip(p, isUpperRune)
+	if upperEnd == p {
+		return p
+	}
+	return t.skip(upperEnd, isLowerRune)
+}
+
+// contraction (?i:'s|'t|'re|'ve|'m|'ll|'d)，返回匹配的字符数
+func (t *runeText) contraction(i int) int {
+	r := t.runes
+	if i >= len(r) || r[i] != '\'' || i+1 >= len(r) {
+		return 0
+	}
+
+	switch unicode.ToLower(r[i+1]) {
+	case 's', 't', 'm', 'd':
+		return 2
+	case 'r', 'v':
+		if i+2 < len(r) && unicode.ToLower(r[i+2]) == 'e' {
+			return 3
+		}
+	case 'l':
+		if i+2 < len(r) && unicode.ToLower(r[i+2]) == 'l' {
+			return 3
+		}
+	}
+	return 0
+}
+
+// matchNumber \p{N}{1,3}
+func (t *runeText) matchNumber(i int) int {
+	j := i
+	for j < len(t.runes) && j-i < 3 && unicode.IsNumber(t.runes[j]) {
+		j++
+	}
+	return j
+}
+
+// matchPunct ` ?[^\s\p{L}\p{N}]+[\r\n]*`，o200k 的结尾还允许 /
+func (t *runeText) matchPunct(i int, slash bool) int {
+	r := t.runes
+	j := i
+	if r[j] == ' ' && j+1 < len(r) && isPunctRune(r[j+1]) {
+		j++
+	}
+	if !isPunctRune(r[j]) {
+		return i
+	}
+
+	j = t.skip(j, isPunctRune)
+	return t.skip(j, func(r rune) bool {
+		return r == '\r' || r == '\n' || (slash && r == '/')
+	})
+}
+
+// matchSpace \s*[\r\n]+|\s+(?!\S)|\s+
+func (t *runeText) matchSpace(i int) int {
+	end := t.skip(i, unicode.IsSpace)
+	if end == i {
+		// 非法字符等无法归类的情况，单独成段
+		return i + 1
+	}
+
+	// \s*[\r\n]+ 回溯到空白中的最后一个换行
+	for k := end - 1; k >= i; k-- {
+		if t.runes[k] == '\r' || t.runes[k] == '\n' {
+			return k + 1
+		}
+	}
+
+	// \s+(?!\S) 后面紧跟非空白时留下最后一个空白，与后面的词合并
+	if end < len(t.runes) && end-1 > i {
+		return end - 1
+	}
+	return end
+}
+
+// skip 从 i 开始跳过满足条件的字符，返回第一个不满足条件的位置
+func (t *runeText) skip(i int, match func(r rune) bool) int {
+	for i < len(t.runes) && match(t.runes[i]) {
+		i++
+	}
+	return i
+}
+
+// isPrefixRune [^\r\n\p{L}\p{N}]
+func isPrefixRune(r rune) bool {
+	return r != '\r' && r != '\n' && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isPunctRune [^\s\p{L}\p{N}]
+func isPunctRune(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isUpperRune [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]
+func isUpperRune(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isLowerRune [\p{Ll}\p{Lm}\p{Lo}\p{M}]
+func isLowerRune(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
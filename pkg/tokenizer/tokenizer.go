@@ -0,0 +1,83 @@
+// Package tokenizer 提供离线 token 计数，用于发送请求前的成本估算、历史裁剪和配额检查.
+// OpenAI 系列模型使用内置词表的 BPE 编码（cl100k_base、o200k_base，词表来自 tiktoken，MIT 许可），
+// 其他厂商的模型词表未公开，使用按字符类型估算的近似计数.
+package tokenizer
+
+import "strings"
+
+// 编码名称常量
+const (
+	EncodingCL100K    = "cl100k_base"
+	EncodingO200K     = "o200k_base"
+	EncodingApprox    = "approx"     // 通用近似计数
+	EncodingApproxCJK = "approx_cjk" // 中文词表更友好的国产模型近似计数
+)
+
+// Tokenizer token 计数器
+type Tokenizer interface {
+	// Name 编码名称
+	Name() string
+
+	// Count 统计文本的 token 数
+	Count(text string) int
+}
+
+// modelPrefix 模型名前缀与编码的对应关系
+type modelPrefix struct {
+	prefix   string
+	encoding string
+}
+
+// modelPrefixes 按模型名前缀匹配编码，较长的前缀排在前面
+var modelPrefixes = []modelPrefix{
+	{"gpt-4o", EncodingO200K},
+	{"gpt-4.1", EncodingO200K},
+	{"gpt-4.5", EncodingO200K},
+	{"gpt-5", EncodingO200K},
+	{"chatgpt-4o", EncodingO200K},
+	{"o1", EncodingO200K},
+	{"o3", EncodingO200K},
+	{"o4", EncodingO200K},
+	{"gpt-4", EncodingCL100K},
+	{"gpt-3.5", EncodingCL100K},
+	{"gpt-35", EncodingCL100K},
+	{"text-embedding-3", EncodingCL100K},
+	{"text-embedding-ada-002", EncodingCL100K},
+	{"ernie", EncodingApproxCJK},
+	{"qwen", EncodingApproxCJK},
+	{"hunyuan", EncodingApproxCJK},
+}
+
+// EncodingForModel 返回模型使用的编码名称，未知模型返回通用近似计数
+// 无法从名称推断编码的模型（如自定义部署名）可以在模型配置中通过 tokenizer 指定.
+func EncodingForModel(modelName string) string {
+	name := strings.ToLower(modelName)
+	for _, item := range modelPrefixes {
+		if strings.HasPrefix(name, item.prefix) {
+			return item.encoding
+		}
+	}
+	return EncodingApprox
+}
+
+// ForModel 返回模型对应的计数器
+// 词表加载失败时退回近似计数，保证调用方始终可以计数.
+func ForModel(modelName string) Tokenizer {
+	tokenizer, err := Get(EncodingForModel(modelName))
+	if err != nil {
+		return approxTokenizer
+	}
+	return tokenizer
+}
+
+// Get 按编码名称获取计数器，BPE 词表在首次使用时加载
+func Get(encoding string) (Tokenizer, error) {
+	switch encoding {
+	case EncodingApprox:
+		return approxTokenizer, nil
+	case EncodingApproxCJK:
+		return approxCJKTokenizer, nil
+	default:
+		return GetEncoding(encoding)
+	}
+}
@@ -0,0 +1,71 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeMatchesTiktoken(t *testing.T) {
+	cl100k, err := GetEncoding(EncodingCL100K)
+	require.NoError(t, err)
+	assert.Equal(t, []int{15339, 1917}, cl100k.Encode("hello world"))
+	assert.Equal(t, []int{83, 1609, 5963, 374, 2294, 0}, cl100k.Encode("tiktoken is great!"))
+	assert.Equal(t, []int{57668, 53901, 3574, 244, 98220}, cl100k.Encode("你好世界"))
+
+	o200k, err := GetEncoding(EncodingO200K)
+	require.NoError(t, err)
+	assert.Equal(t, []int{24912, 2375}, o200k.Encode("hello world"))
+	assert.Equal(t, []int{177519, 28428}, o200k.Encode("你好世界"))
+}
+
+func TestCountMatchesEncode(t *testing.T) {
+	text := "I'LL check it:\r\n\r\n  func main() {}  \n12345 naïve 日本語 😀"
+	for _, name := range []string{EncodingCL100K, EncodingO200K} {
+		encoding, err := GetEncoding(name)
+		require.NoError(t, err)
+		assert.Equal(t, len(encoding.Encode(text)), encoding.Count(text), name)
+	}
+}
+
+func TestCountLongPiece(t *testing.T) {
+	encoding, err := GetEncoding(EncodingCL100K)
+	require.NoError(t, err)
+
+	// 不含空白的长串整体是一个片段，超过上限后按近似计数
+	long := strings.Repeat("abcdef", 30000)
+	start := time.Now()
+	assert.Equal(t, approxTokenizer.Count(long), encoding.Count(long))
+	assert.Less(t, time.Since(start), time.Second)
+
+	// 精确编码使用堆合并，结果与逐个片段合并一致
+	assert.Equal(t, []int{42302}, encoding.Encode("abcdef"))
+	assert.Len(t, encoding.Encode(long), 30000)
+}
+
+func TestSplitPieces(t *testing.T) {
+	// 空白后紧跟单词时，最后一个空格与单词合并
+	assert.Equal(t, []string{"a", "  ", " b", "\n\n", "  "}, splitCL100K("a   b\n\n  "))
+	assert.Equal(t, []string{"HTTPServer", " i", "Phone"}, splitO200K("HTTPServer iPhone"))
+	assert.Equal(t, []string{"123", "45", " don", "'t"}, splitCL100K("12345 don't"))
+}
+
+func TestForModel(t *testing.T) {
+	assert.Equal(t, EncodingO200K, ForModel("gpt-4o-mini").Name())
+	assert.Equal(t, EncodingCL100K, ForModel("gpt-4-turbo").Name())
+	assert.Equal(t, EncodingCL100K, ForModel("gpt-3.5-turbo").Name())
+	assert.Equal(t, EncodingApproxCJK, ForModel("qwen-turbo").Name())
+	assert.Equal(t, EncodingApprox, ForModel("claude-3-haiku-20240307").Name())
+
+	_, err := Get("unknown")
+	assert.Error(t, err)
+}
+
+func TestApproximateCount(t *testing.T) {
+	assert.Equal(t, 3, approxTokenizer.Count("hello world"))
+	assert.Equal(t, 4, approxTokenizer.Count("你好世界"))
+	assert.Equal(t, 2, approxCJKTokenizer.Count("你好世界"))
+}
@@ -0,0 +1,36 @@
+-- AI 对话分支迁移脚本
+-- 为已有对话补全消息的 parent_id 和对话的 current_message_id，使旧对话按原有顺序成为一个分支
+-- parent_id 和 current_message_id 字段由服务启动时的 AutoMigrate 添加，请在新版本启动后、用户继续旧对话前执行
+-- 需要 MySQL 8.0 及以上版本（使用窗口函数），执行前请备份数据库！
+
+USE ai_svc;
+
+-- 1. 旧对话中的每条消息接在同一对话的上一条消息之后
+UPDATE ai_messages m
+INNER JOIN (
+    SELECT id, LAG(id) OVER (PARTITION BY conversation_id ORDER BY id) AS prev_id
+    FROM ai_messages
+) p ON p.id = m.id
+INNER JOIN ai_conversations c ON c.id = m.conversation_id
+SET m.parent_id = p.prev_id
+WHERE c.current_message_id IS NULL
+  AND m.parent_id IS NULL
+  AND p.prev_id IS NOT NULL;
+
+-- 2. 旧对话的当前分支指向最后一条消息
+UPDATE ai_conversations c
+INNER JOIN (
+    SELECT conversation_id, MAX(id) AS last_id
+    FROM ai_messages
+    GROUP BY conversation_id
+) l ON l.conversation_id = c.id
+SET c.current_message_id = l.last_id
+WHERE c.current_message_id IS NULL;
+
+-- 3. 检查结果：列出有多条首条消息的对话，只有编辑过第一条消息的新对话才会出现
+SELECT '=== 有多条首条消息的对话 ===' as step;
+SELECT conversation_id, COUNT(*) AS root_count
+FROM ai_messages
+WHERE parent_id IS NULL
+GROUP BY conversation_id
+HAVING root_count > 1;